@@ -36,6 +36,14 @@ type StartOptions struct {
 	SessionID string
 	Resume    bool
 	Mode      session.Mode
+	Backend   string // Registry backend name; empty = default. Ignored by concrete agents.
+	Config    session.AgentConfig
+	// ForkFrom branches a new session (Resume false) from another session's
+	// conversation. Backends that cannot fork start a fresh conversation.
+	ForkFrom string
+	// PriorCostUSD is the cost already recorded for the resumed or forked
+	// conversation. Backends that report running cost totals count from it.
+	PriorCostUSD float64
 }
 
 // Agent defines the interface for an AI agent.
@@ -53,9 +61,9 @@ type Session interface {
 	// EventTypeDone signals the current message response is complete.
 	Events() <-chan AgentEvent
 
-	// SendMessage sends a new message to the agent.
+	// SendMessage sends a new message to the agent, optionally with resolved attachments.
 	// It should only be called after the previous message is complete (received EventTypeDone).
-	SendMessage(prompt string) error
+	SendMessage(prompt string, attachments ...Attachment) error
 
 	// SendPermissionResponse sends a permission response to the agent.
 	SendPermissionResponse(data PermissionRequestData, choice PermissionChoice) error
@@ -0,0 +1,43 @@
+package agent
+
+// AttachmentType distinguishes inline uploads from worktree file references.
+type AttachmentType string
+
+const (
+	AttachmentImage AttachmentType = "image" // Inline base64 image (e.g., a screenshot)
+	AttachmentFile  AttachmentType = "file"  // File in the worktree, referenced by Path
+)
+
+// Attachment is content sent alongside a user message.
+// Clients send either an image (MediaType + Data) or a file reference (Path).
+// The server resolves file references before handing attachments to an agent,
+// so agents can rely on MediaType and Data always being set.
+type Attachment struct {
+	Type      AttachmentType `json:"type"`
+	Name      string         `json:"name,omitempty"`
+	Path      string         `json:"path,omitempty"`       // worktree-relative path (file only)
+	MediaType string         `json:"media_type,omitempty"` // e.g. "image/png", "application/pdf", "text/plain"
+	Data      string         `json:"data,omitempty"`       // base64-encoded content
+}
+
+// IsImageMediaType reports whether mediaType is an image format agents accept.
+func IsImageMediaType(mediaType string) bool {
+	switch mediaType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	default:
+		return false
+	}
+}
+
+// WithoutData returns copies of attachments with their content dropped, for
+// history records and broadcasts. Names, paths and media types stay, so
+// clients can still list what was attached without large lines in history.
+func WithoutData(attachments []Attachment) []Attachment {
+	var out []Attachment
+	for _, a := range attachments {
+		a.Data = ""
+		out = append(out, a)
+	}
+	return out
+}
@@ -5,6 +5,7 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -12,6 +13,7 @@ import (
 	"io"
 	"log/slog"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -39,30 +41,7 @@ func New() *Agent {
 func (a *Agent) Start(ctx context.Context, opts agent.StartOptions) (agent.Session, error) {
 	procCtx, cancel := context.WithCancel(ctx)
 
-	claudeArgs := []string{
-		"--output-format", "stream-json",
-		"--input-format", "stream-json",
-		"--verbose",
-	}
-
-	// Add mode-specific options
-	switch opts.Mode {
-	case session.ModeYolo:
-		claudeArgs = append(claudeArgs, "--dangerously-skip-permissions")
-	default:
-		// Default mode: use permission prompt tool
-		claudeArgs = append(claudeArgs, "--permission-prompt-tool", "stdio")
-	}
-
-	if opts.SessionID != "" {
-		if opts.Resume {
-			claudeArgs = append(claudeArgs, "--resume", opts.SessionID)
-		} else {
-			claudeArgs = append(claudeArgs, "--session-id", opts.SessionID)
-		}
-	}
-
-	cmd := exec.CommandContext(procCtx, Binary, claudeArgs...)
+	cmd := exec.CommandContext(procCtx, Binary, buildArgs(opts)...)
 	cmd.Dir = opts.WorkDir
 
 	// stdin ownership is transferred to session; closed by session.Close()
@@ -124,7 +103,8 @@ func (a *Agent) Start(ctx context.Context, opts agent.StartOptions) (agent.Sessi
 		defer stderr.Close()
 
 		stderrCh := readStderr(stderr)
-		streamOutput(procCtx, log, stdout, events, pendingRequests)
+		costs := &costTracker{reported: opts.PriorCostUSD}
+		streamOutput(procCtx, log, stdout, events, pendingRequests, costs)
 		waitForProcess(procCtx, log, cmd, stderrCh, events)
 
 		// Notify client that process has ended (abnormal: process should stay alive)
@@ -137,6 +117,57 @@ func (a *Agent) Start(ctx context.Context, opts agent.StartOptions) (agent.Sessi
 	return sess, nil
 }
 
+// buildArgs translates StartOptions into Claude CLI arguments.
+func buildArgs(opts agent.StartOptions) []string {
+	args := []string{
+		"--output-format", "stream-json",
+		"--input-format", "stream-json",
+		"--verbose",
+	}
+
+	// Add mode-specific options
+	switch opts.Mode {
+	case session.ModeYolo:
+		args = append(args, "--dangerously-skip-permissions")
+	case session.ModePlan:
+		// Plan mode still prompts, so ExitPlanMode reaches the user for approval
+		args = append(args, "--permission-mode", "plan", "--permission-prompt-tool", "stdio")
+	default:
+		// Default mode: use permission prompt tool
+		args = append(args, "--permission-prompt-tool", "stdio")
+	}
+
+	// Per-session overrides
+	cfg := opts.Config
+	if cfg.Model != "" {
+		args = append(args, "--model", cfg.Model)
+	}
+	if cfg.SystemPrompt != "" {
+		args = append(args, "--append-system-prompt", cfg.SystemPrompt)
+	}
+	if len(cfg.AllowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(cfg.AllowedTools, ","))
+	}
+	if len(cfg.DisallowedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(cfg.DisallowedTools, ","))
+	}
+	if cfg.MaxTurns > 0 {
+		args = append(args, "--max-turns", strconv.Itoa(cfg.MaxTurns))
+	}
+
+	if opts.SessionID != "" {
+		if opts.Resume {
+			args = append(args, "--resume", opts.SessionID)
+		} else if opts.ForkFrom != "" {
+			args = append(args, "--resume", opts.ForkFrom, "--fork-session", "--session-id", opts.SessionID)
+		} else {
+			args = append(args, "--session-id", opts.SessionID)
+		}
+	}
+
+	return args
+}
+
 // session implements agent.Session for Claude CLI.
 type cliSession struct {
 	log             *slog.Logger
@@ -154,22 +185,65 @@ func (s *cliSession) Events() <-chan agent.AgentEvent {
 }
 
 // SendMessage sends a message to Claude.
-func (s *cliSession) SendMessage(prompt string) error {
+func (s *cliSession) SendMessage(prompt string, attachments ...agent.Attachment) error {
+	content, err := buildContent(prompt, attachments)
+	if err != nil {
+		return err
+	}
 	msg := userMessage{
 		Type: "user",
 		Message: userContent{
 			Role:    "user",
-			Content: []textContent{{Type: "text", Text: prompt}},
+			Content: content,
 		},
 	}
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
-	s.log.Debug("sending prompt", "length", len(prompt))
+	s.log.Debug("sending prompt", "length", len(prompt), "attachments", len(attachments))
 	return s.writeStdin(data)
 }
 
+// buildContent converts a prompt and its attachments into content blocks.
+// Attachments come first, as recommended for image and document prompts.
+func buildContent(prompt string, attachments []agent.Attachment) ([]contentBlock, error) {
+	blocks := make([]contentBlock, 0, len(attachments)+1)
+
+	for _, a := range attachments {
+		switch {
+		case agent.IsImageMediaType(a.MediaType):
+			blocks = append(blocks, contentBlock{
+				Type:   "image",
+				Source: &mediaSource{Type: "base64", MediaType: a.MediaType, Data: a.Data},
+			})
+		case a.MediaType == "application/pdf":
+			blocks = append(blocks, contentBlock{
+				Type:   "document",
+				Title:  a.Name,
+				Source: &mediaSource{Type: "base64", MediaType: a.MediaType, Data: a.Data},
+			})
+		case strings.HasPrefix(a.MediaType, "text/"):
+			text, err := base64.StdEncoding.DecodeString(a.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode attachment %q: %w", a.Name, err)
+			}
+			blocks = append(blocks, contentBlock{
+				Type:   "document",
+				Title:  a.Name,
+				Source: &mediaSource{Type: "text", MediaType: "text/plain", Data: string(text)},
+			})
+		default:
+			return nil, fmt.Errorf("unsupported attachment media type %q", a.MediaType)
+		}
+	}
+
+	if prompt != "" || len(blocks) == 0 {
+		blocks = append(blocks, contentBlock{Type: "text", Text: prompt})
+	}
+	return blocks, nil
+}
+
 // SendPermissionResponse sends a permission response to Claude.
 func (s *cliSession) SendPermissionResponse(data agent.PermissionRequestData, choice agent.PermissionChoice) error {
 	var content controlResponseContent
@@ -326,7 +400,7 @@ func readStderr(stderr io.Reader) <-chan string {
 	return ch
 }
 
-func streamOutput(ctx context.Context, log *slog.Logger, stdout io.Reader, events chan<- agent.AgentEvent, pendingRequests *sync.Map) {
+func streamOutput(ctx context.Context, log *slog.Logger, stdout io.Reader, events chan<- agent.AgentEvent, pendingRequests *sync.Map, costs *costTracker) {
 	scanner := bufio.NewScanner(stdout)
 	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
 
@@ -337,6 +411,10 @@ func streamOutput(ctx context.Context, log *slog.Logger, stdout io.Reader, event
 		}
 
 		for _, event := range parseLine(log, line, pendingRequests) {
+			if usage, ok := event.(agent.UsageEvent); ok {
+				usage.Usage.CostUSD = costs.delta(usage.Usage.CostUSD)
+				event = usage
+			}
 			select {
 			case events <- event:
 			case <-ctx.Done():
@@ -394,13 +472,22 @@ type userMessage struct {
 }
 
 type userContent struct {
-	Role    string        `json:"role"`
-	Content []textContent `json:"content"`
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
 }
 
-type textContent struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+// contentBlock is a text, image or document block in a user message.
+type contentBlock struct {
+	Type   string       `json:"type"`
+	Text   string       `json:"text,omitempty"`
+	Title  string       `json:"title,omitempty"`
+	Source *mediaSource `json:"source,omitempty"`
+}
+
+type mediaSource struct {
+	Type      string `json:"type"` // "base64" or "text"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
 }
 
 type controlRequest struct {
@@ -497,7 +584,7 @@ func parseLine(log *slog.Logger, line []byte, pendingRequests *sync.Map) []agent
 	case "user":
 		return parseUserEvent(log, event)
 	case "result":
-		return []agent.AgentEvent{parseResultEvent(line)}
+		return parseResultEvent(line)
 	case "system":
 		// Skip init event (noise at session start)
 		if event.Subtype == "init" {
@@ -788,25 +875,81 @@ func hasImageContent(content json.RawMessage) bool {
 }
 
 type resultEvent struct {
-	Subtype   string   `json:"subtype"`
-	SessionID string   `json:"session_id"`
-	Errors    []string `json:"errors"`
-}
-
-func parseResultEvent(line []byte) agent.AgentEvent {
+	Subtype      string       `json:"subtype"`
+	SessionID    string       `json:"session_id"`
+	Errors       []string     `json:"errors"`
+	TotalCostUSD float64      `json:"total_cost_usd"`
+	DurationMS   int64        `json:"duration_ms"`
+	Usage        *resultUsage `json:"usage"`
+}
+
+// costTracker converts the running cost total of a CLI process into per-turn
+// costs. The CLI does not document total_cost_usd; observed behaviour is that
+// it accumulates over every turn of the process and that a resumed or forked
+// conversation's total carries on from the cost saved in its transcript, so
+// the tracker starts from the cost already recorded for it.
+// TestStreamOutput_CostFromTranscript pins these assumptions against sample
+// output in testdata; refresh it when the CLI changes how it reports cost.
+type costTracker struct {
+	reported float64 // last running total seen
+}
+
+// delta returns the cost added since the last result. A zero total, as on
+// crash results, adds nothing; a total below the last one means /clear reset
+// the running total, which then counts in full.
+func (c *costTracker) delta(total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	delta := total - c.reported
+	if delta < 0 {
+		delta = total
+	}
+	c.reported = total
+	return delta
+}
+
+type resultUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+// parseResultEvent ends the turn, preceded by a usage event when the
+// result line carries usage data. Token counts and duration cover the turn,
+// but the CLI reports cost as a running total; streamOutput turns it into
+// the turn's share with a costTracker.
+func parseResultEvent(line []byte) []agent.AgentEvent {
 	var result resultEvent
 	if err := json.Unmarshal(line, &result); err != nil {
-		return agent.DoneEvent{}
+		return []agent.AgentEvent{agent.DoneEvent{}}
+	}
+
+	var events []agent.AgentEvent
+	if result.Usage != nil || result.TotalCostUSD > 0 {
+		usage := session.Usage{
+			CostUSD:    result.TotalCostUSD,
+			Turns:      1,
+			DurationMS: result.DurationMS,
+		}
+		if result.Usage != nil {
+			usage.InputTokens = result.Usage.InputTokens
+			usage.OutputTokens = result.Usage.OutputTokens
+			usage.CacheCreationTokens = result.Usage.CacheCreationInputTokens
+			usage.CacheReadTokens = result.Usage.CacheReadInputTokens
+		}
+		events = append(events, agent.UsageEvent{Usage: usage})
 	}
 
 	// Check if this was an interrupt (aborted request)
 	if result.Subtype == "error_during_execution" {
 		for _, e := range result.Errors {
 			if strings.Contains(e, "Request was aborted") {
-				return agent.InterruptedEvent{}
+				return append(events, agent.InterruptedEvent{})
 			}
 		}
 	}
 
-	return agent.DoneEvent{}
+	return append(events, agent.DoneEvent{})
 }
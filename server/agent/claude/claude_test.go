@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"io"
 	"log/slog"
+	"math"
+	"os"
+	"strings"
 	"sync"
 	"testing"
 
 	"github.com/pockode/server/agent"
+	"github.com/pockode/server/session"
 )
 
 func TestParseLine(t *testing.T) {
@@ -37,6 +41,22 @@ func TestParseLine(t *testing.T) {
 			input:    `{"type":"result","subtype":"success","result":"Hello"}`,
 			expected: []agent.AgentEvent{agent.DoneEvent{}},
 		},
+		{
+			name:  "result event with usage",
+			input: `{"type":"result","subtype":"success","total_cost_usd":0.0125,"duration_ms":4200,"num_turns":3,"usage":{"input_tokens":10,"output_tokens":20,"cache_creation_input_tokens":30,"cache_read_input_tokens":40}}`,
+			expected: []agent.AgentEvent{
+				agent.UsageEvent{Usage: session.Usage{
+					InputTokens:         10,
+					OutputTokens:        20,
+					CacheCreationTokens: 30,
+					CacheReadTokens:     40,
+					CostUSD:             0.0125,
+					Turns:               1,
+					DurationMS:          4200,
+				}},
+				agent.DoneEvent{},
+			},
+		},
 		{
 			name:     "result event interrupted",
 			input:    `{"type":"result","subtype":"error_during_execution","errors":["Error: Request was aborted."]}`,
@@ -266,6 +286,9 @@ func agentEventEqual(a, b agent.AgentEvent) bool {
 	case agent.DoneEvent:
 		_, ok := b.(agent.DoneEvent)
 		return ok
+	case agent.UsageEvent:
+		bv, ok := b.(agent.UsageEvent)
+		return ok && av.Usage == bv.Usage
 	case agent.InterruptedEvent:
 		_, ok := b.(agent.InterruptedEvent)
 		return ok
@@ -442,6 +465,57 @@ func TestSession_SendPermissionResponse_AlwaysAllow(t *testing.T) {
 	}
 }
 
+func TestSession_SendMessage_WithAttachments(t *testing.T) {
+	var buf bytes.Buffer
+	sess := &cliSession{
+		log:   testLogger(),
+		stdin: nopWriteCloser{&buf},
+	}
+
+	err := sess.SendMessage("What is wrong here?",
+		agent.Attachment{Type: agent.AttachmentImage, MediaType: "image/png", Data: "iVBORw0KGgo="},
+		agent.Attachment{Type: agent.AttachmentFile, Name: "main.go", Path: "main.go", MediaType: "text/plain", Data: "cGFja2FnZSBtYWlu"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var msg userMessage
+	if err := json.Unmarshal(buf.Bytes(), &msg); err != nil {
+		t.Fatalf("failed to unmarshal message: %v", err)
+	}
+
+	blocks := msg.Message.Content
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 content blocks, got %d", len(blocks))
+	}
+	if blocks[0].Type != "image" || blocks[0].Source == nil || blocks[0].Source.Type != "base64" || blocks[0].Source.MediaType != "image/png" {
+		t.Errorf("unexpected image block: %+v", blocks[0])
+	}
+	if blocks[1].Type != "document" || blocks[1].Title != "main.go" || blocks[1].Source == nil || blocks[1].Source.Data != "package main" {
+		t.Errorf("unexpected document block: %+v", blocks[1])
+	}
+	if blocks[2].Type != "text" || blocks[2].Text != "What is wrong here?" {
+		t.Errorf("unexpected text block: %+v", blocks[2])
+	}
+}
+
+func TestSession_SendMessage_UnsupportedAttachment(t *testing.T) {
+	var buf bytes.Buffer
+	sess := &cliSession{
+		log:   testLogger(),
+		stdin: nopWriteCloser{&buf},
+	}
+
+	err := sess.SendMessage("hi", agent.Attachment{Type: agent.AttachmentFile, MediaType: "application/zip", Data: "AAAA"})
+	if err == nil {
+		t.Error("expected error for unsupported media type")
+	}
+	if buf.Len() != 0 {
+		t.Error("expected nothing to be written")
+	}
+}
+
 func TestSession_SendMessage(t *testing.T) {
 	var buf bytes.Buffer
 	sess := &cliSession{
@@ -663,3 +737,156 @@ func TestExtractEventsFromText(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    agent.StartOptions
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "default mode uses permission prompt tool",
+			opts:    agent.StartOptions{SessionID: "s1", Mode: session.ModeDefault},
+			want:    []string{"--permission-prompt-tool stdio", "--session-id s1"},
+			notWant: []string{"--permission-mode", "--dangerously-skip-permissions"},
+		},
+		{
+			name:    "yolo mode skips permissions",
+			opts:    agent.StartOptions{SessionID: "s1", Mode: session.ModeYolo},
+			want:    []string{"--dangerously-skip-permissions"},
+			notWant: []string{"--permission-prompt-tool", "--permission-mode"},
+		},
+		{
+			name: "plan mode sets permission mode and keeps prompt tool",
+			opts: agent.StartOptions{SessionID: "s1", Mode: session.ModePlan},
+			want: []string{"--permission-mode plan", "--permission-prompt-tool stdio"},
+		},
+		{
+			name: "session config becomes flags",
+			opts: agent.StartOptions{SessionID: "s1", Config: session.AgentConfig{
+				Model:           "opus",
+				SystemPrompt:    "be brief",
+				AllowedTools:    []string{"Read", "Bash(git:*)"},
+				DisallowedTools: []string{"WebFetch"},
+				MaxTurns:        5,
+			}},
+			want: []string{
+				"--model opus",
+				"--append-system-prompt be brief",
+				"--allowedTools Read,Bash(git:*)",
+				"--disallowedTools WebFetch",
+				"--max-turns 5",
+			},
+		},
+		{
+			name:    "empty config adds no flags",
+			opts:    agent.StartOptions{SessionID: "s1"},
+			notWant: []string{"--model", "--append-system-prompt", "--allowedTools", "--disallowedTools", "--max-turns"},
+		},
+		{
+			name:    "resume uses --resume",
+			opts:    agent.StartOptions{SessionID: "s1", Resume: true},
+			want:    []string{"--resume s1"},
+			notWant: []string{"--session-id"},
+		},
+		{
+			name:    "fork branches parent conversation",
+			opts:    agent.StartOptions{SessionID: "s2", ForkFrom: "s1"},
+			want:    []string{"--resume s1 --fork-session --session-id s2"},
+			notWant: []string{"--resume s2"},
+		},
+		{
+			name:    "resume ignores fork origin",
+			opts:    agent.StartOptions{SessionID: "s2", Resume: true, ForkFrom: "s1"},
+			want:    []string{"--resume s2"},
+			notWant: []string{"--fork-session"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			joined := strings.Join(buildArgs(tt.opts), " ")
+			for _, w := range tt.want {
+				if !strings.Contains(joined, w) {
+					t.Errorf("expected args to contain %q, got %q", w, joined)
+				}
+			}
+			for _, nw := range tt.notWant {
+				if strings.Contains(joined, nw) {
+					t.Errorf("expected args not to contain %q, got %q", nw, joined)
+				}
+			}
+		})
+	}
+}
+
+func TestCostTracker_Delta(t *testing.T) {
+	costs := &costTracker{reported: 0.5}
+
+	steps := []struct {
+		total float64
+		want  float64
+	}{
+		{total: 0.75, want: 0.25}, // first turn after resume counts from the prior cost
+		{total: 1.0, want: 0.25},
+		{total: 0, want: 0},     // zeroed crash result
+		{total: 0.1, want: 0.1}, // /clear reset the running total
+		{total: 0.3, want: 0.2},
+	}
+	for i, s := range steps {
+		if got := costs.delta(s.total); math.Abs(got-s.want) > 1e-9 {
+			t.Errorf("step %d: delta(%v) = %v, want %v", i, s.total, got, s.want)
+		}
+	}
+}
+
+// streamCosts runs a stdout transcript through streamOutput and returns the
+// cost of each usage event
+func streamCosts(t *testing.T, file string, costs *costTracker) []float64 {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan agent.AgentEvent, 64)
+	streamOutput(t.Context(), slog.Default(), bytes.NewReader(data), events, &sync.Map{}, costs)
+	close(events)
+
+	var got []float64
+	for event := range events {
+		if usage, ok := event.(agent.UsageEvent); ok {
+			got = append(got, usage.Usage.CostUSD)
+		}
+	}
+	return got
+}
+
+func TestStreamOutput_CostFromTranscript(t *testing.T) {
+	// Two turns in one process: total_cost_usd is the running total
+	costs := &costTracker{}
+	got := streamCosts(t, "testdata/cost_session.jsonl", costs)
+	want := []float64{0.019356, 0.002591}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d usage events, got %v", len(want), got)
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("turn %d: cost %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// A resumed process continues from the saved total, including an
+	// interrupted turn
+	recorded := got[0] + got[1]
+	got = streamCosts(t, "testdata/cost_resumed.jsonl", &costTracker{reported: recorded})
+	want = []float64{0.001715, 0.000456}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d usage events, got %v", len(want), got)
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("resumed turn %d: cost %v, want %v", i, got[i], want[i])
+		}
+	}
+}
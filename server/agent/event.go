@@ -1,6 +1,10 @@
 package agent
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/pockode/server/session"
+)
 
 // EventType defines the type of agent event.
 type EventType string
@@ -23,6 +27,7 @@ const (
 	EventTypeQuestionResponse   EventType = "question_response"   // User question response
 	EventTypeRaw                EventType = "raw"                 // Unprocessed CLI output
 	EventTypeCommandOutput      EventType = "command_output"      // Local command output (e.g., /context)
+	EventTypeUsage              EventType = "usage"               // Token and cost accounting for a turn
 )
 
 // AwaitsUserInput returns true for events where the AI pauses and waits for user input.
@@ -291,24 +296,36 @@ func (e ProcessEndedEvent) ToRecord() EventRecord {
 	return EventRecord{Type: e.EventType()}
 }
 
-// MessageEvent is for history replay only, not sent as RPC notification.
+// MessageEvent is a user message delivered to the agent.
 type MessageEvent struct {
-	Content string
+	Content     string
+	Attachments []Attachment
+	User        string // who sent it
+	Checkpoint  string // worktree snapshot taken before the turn, if any
 }
 
 func (MessageEvent) EventType() EventType { return EventTypeMessage }
 func (MessageEvent) isAgentEvent()        {}
 
+// ToRecord records attachments without their content, so history lines stay
+// small enough to read back.
 func (e MessageEvent) ToRecord() EventRecord {
-	return EventRecord{Type: e.EventType(), Content: e.Content}
+	return EventRecord{Type: e.EventType(), Content: e.Content, Attachments: WithoutData(e.Attachments), User: e.User, Checkpoint: e.Checkpoint}
 }
 
 // PermissionResponseEvent is for history replay only, not sent as RPC notification.
 type PermissionResponseEvent struct {
 	RequestID string
 	Choice    string // "deny", "allow", "always_allow"
+	User      string // who decided
+	RuleID    string // policy rule that decided instead of a user
+	Reason    string // why nobody chose, e.g. PermissionReasonTimeout
 }
 
+// PermissionReasonTimeout marks a response applied because the request
+// waited longer than its configured timeout.
+const PermissionReasonTimeout = "timeout"
+
 func (PermissionResponseEvent) EventType() EventType { return EventTypePermissionResponse }
 func (PermissionResponseEvent) isAgentEvent()        {}
 
@@ -317,6 +334,9 @@ func (e PermissionResponseEvent) ToRecord() EventRecord {
 		Type:      e.EventType(),
 		RequestID: e.RequestID,
 		Choice:    e.Choice,
+		User:      e.User,
+		RuleID:    e.RuleID,
+		Reason:    e.Reason,
 	}
 }
 
@@ -324,6 +344,7 @@ func (e PermissionResponseEvent) ToRecord() EventRecord {
 type QuestionResponseEvent struct {
 	RequestID string
 	Answers   map[string]string // nil = cancelled
+	User      string            // who answered
 }
 
 func (QuestionResponseEvent) EventType() EventType { return EventTypeQuestionResponse }
@@ -334,6 +355,7 @@ func (e QuestionResponseEvent) ToRecord() EventRecord {
 		Type:      e.EventType(),
 		RequestID: e.RequestID,
 		Answers:   e.Answers,
+		User:      e.User,
 	}
 }
 
@@ -358,3 +380,17 @@ func (CommandOutputEvent) isAgentEvent()        {}
 func (e CommandOutputEvent) ToRecord() EventRecord {
 	return EventRecord{Type: e.EventType(), Content: e.Content}
 }
+
+// UsageEvent reports the token usage and cost of a completed turn.
+// It is emitted just before the turn's done event.
+type UsageEvent struct {
+	Usage session.Usage
+}
+
+func (UsageEvent) EventType() EventType { return EventTypeUsage }
+func (UsageEvent) isAgentEvent()        {}
+
+func (e UsageEvent) ToRecord() EventRecord {
+	usage := e.Usage
+	return EventRecord{Type: e.EventType(), Usage: &usage}
+}
@@ -0,0 +1,335 @@
+// Package fake implements a deterministic agent.Agent that replays scripted
+// transcripts. It lets CI and frontend development exercise the whole server
+// (relay, watchers, history) without a Claude install or network access.
+//
+// A script is a JSON file of turns. Each user message plays the next turn;
+// once the turns run out, messages are echoed back.
+//
+//	{
+//	  "delay_ms": 50,
+//	  "turns": [
+//	    {"steps": [
+//	      {"type": "text", "content": "Reading {{prompt}}"},
+//	      {"type": "tool_call", "tool_name": "Read", "tool_use_id": "t1", "tool_input": {"file_path": "a.go"}},
+//	      {"type": "permission_request", "request_id": "r1", "tool_name": "Bash", "tool_use_id": "t2", "tool_input": {"command": "ls"}},
+//	      {"type": "tool_result", "tool_use_id": "t1", "tool_result": "package main", "delay_ms": 500},
+//	      {"type": "done"}
+//	    ]},
+//	    {"steps": [{"type": "crash", "content": "segmentation fault"}]}
+//	  ]
+//	}
+//
+// Steps are agent.EventRecord objects plus an optional delay_ms (falling back
+// to the script-wide delay_ms). "{{prompt}}" in content is replaced with the
+// user message. permission_request and ask_user_question steps pause the turn
+// until the matching response arrives. The pseudo-type "crash" emits an error
+// and ends the process, like a CLI dying mid-turn.
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/logger"
+)
+
+// StepCrash is a pseudo event type that terminates the fake process.
+const StepCrash agent.EventType = "crash"
+
+const promptPlaceholder = "{{prompt}}"
+
+// Script is a scripted transcript replayed by the fake agent.
+type Script struct {
+	DelayMS int    `json:"delay_ms,omitempty"` // default delay before each step
+	Turns   []Turn `json:"turns"`
+}
+
+// Turn is the response to a single user message.
+type Turn struct {
+	Steps []Step `json:"steps"`
+}
+
+// Step is one event emitted during a turn.
+type Step struct {
+	agent.EventRecord
+	DelayMS *int `json:"delay_ms,omitempty"` // overrides Script.DelayMS
+}
+
+// echoTurn is played once the script's turns are exhausted.
+var echoTurn = Turn{Steps: []Step{
+	{EventRecord: agent.EventRecord{Type: agent.EventTypeText, Content: "Echo: " + promptPlaceholder}},
+	{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}},
+}}
+
+// LoadScript reads and validates a script file.
+func LoadScript(path string) (Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Script{}, err
+	}
+
+	var script Script
+	if err := json.Unmarshal(data, &script); err != nil {
+		return Script{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := script.Validate(); err != nil {
+		return Script{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return script, nil
+}
+
+// Validate checks that every step has a known event type.
+func (s Script) Validate() error {
+	for i, turn := range s.Turns {
+		for j, step := range turn.Steps {
+			if step.Type == StepCrash {
+				continue
+			}
+			if _, err := step.ToEvent(); err != nil {
+				return fmt.Errorf("turns[%d].steps[%d]: %w", i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Agent implements agent.Agent by replaying a Script.
+// Every started session replays the script from its first turn.
+type Agent struct {
+	script Script
+}
+
+// New creates a fake Agent. An empty script echoes every message.
+func New(script Script) *Agent {
+	return &Agent{script: script}
+}
+
+func (a *Agent) Start(ctx context.Context, opts agent.StartOptions) (agent.Session, error) {
+	procCtx, cancel := context.WithCancel(ctx)
+
+	log := slog.With("sessionId", opts.SessionID, "agent", "fake")
+	log.Info("fake agent started", "mode", opts.Mode, "turns", len(a.script.Turns))
+
+	sess := &fakeSession{
+		log:        log,
+		script:     a.script,
+		ctx:        procCtx,
+		cancel:     cancel,
+		events:     make(chan agent.AgentEvent),
+		messages:   make(chan string, 16),
+		responses:  make(chan struct{}, 1),
+		interrupts: make(chan struct{}, 1),
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.LogPanic(r, "fake agent crashed", "sessionId", opts.SessionID)
+			}
+		}()
+		defer close(sess.events)
+		defer cancel()
+
+		sess.run()
+	}()
+
+	return sess, nil
+}
+
+type fakeSession struct {
+	log        *slog.Logger
+	script     Script
+	ctx        context.Context
+	cancel     func()
+	events     chan agent.AgentEvent
+	messages   chan string
+	responses  chan struct{}
+	interrupts chan struct{}
+	closeOnce  sync.Once
+}
+
+func (s *fakeSession) Events() <-chan agent.AgentEvent {
+	return s.events
+}
+
+// SendMessage queues the next turn. Attachments are accepted but not replayed.
+func (s *fakeSession) SendMessage(prompt string, attachments ...agent.Attachment) error {
+	select {
+	case s.messages <- prompt:
+		return nil
+	case <-s.ctx.Done():
+		return errors.New("fake agent is closed")
+	}
+}
+
+func (s *fakeSession) SendPermissionResponse(data agent.PermissionRequestData, choice agent.PermissionChoice) error {
+	s.log.Info("permission response", "requestId", data.RequestID, "choice", choice)
+	notify(s.responses)
+	return nil
+}
+
+func (s *fakeSession) SendQuestionResponse(data agent.QuestionRequestData, answers map[string]string) error {
+	s.log.Info("question response", "requestId", data.RequestID)
+	notify(s.responses)
+	return nil
+}
+
+func (s *fakeSession) SendInterrupt() error {
+	s.log.Info("sending interrupt signal")
+	notify(s.interrupts)
+	return nil
+}
+
+// Close ends the session. Safe to call multiple times.
+func (s *fakeSession) Close() {
+	s.closeOnce.Do(func() {
+		s.log.Info("terminating fake agent")
+		s.cancel()
+	})
+}
+
+// notify does a non-blocking send so callers never stall on an idle session.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func drain(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+	}
+}
+
+func (s *fakeSession) run() {
+	next := 0
+	for {
+		select {
+		case prompt := <-s.messages:
+			turn := echoTurn
+			if next < len(s.script.Turns) {
+				turn = s.script.Turns[next]
+			}
+			next++
+
+			if !s.play(turn, prompt) {
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// play emits a turn's steps. It returns false when the process has ended.
+func (s *fakeSession) play(turn Turn, prompt string) bool {
+	// Signals sent while idle belong to no turn
+	drain(s.interrupts)
+	drain(s.responses)
+
+	for _, step := range turn.Steps {
+		if !s.wait(s.delay(step)) {
+			return s.interrupted()
+		}
+
+		if step.Type == StepCrash {
+			msg := step.Content
+			if msg == "" {
+				msg = "fake agent crashed"
+			}
+			s.emit(agent.ErrorEvent{Error: msg})
+			s.emit(agent.ProcessEndedEvent{})
+			return false
+		}
+
+		record := step.EventRecord
+		record.Content = strings.ReplaceAll(record.Content, promptPlaceholder, prompt)
+		event, err := record.ToEvent()
+		if err != nil {
+			s.log.Warn("skipping invalid step", "error", err)
+			continue
+		}
+		if !s.emit(event) {
+			return false
+		}
+
+		switch event.EventType() {
+		case agent.EventTypePermissionRequest, agent.EventTypeAskUserQuestion:
+			if !s.awaitResponse() {
+				return s.interrupted()
+			}
+		}
+	}
+	return s.ctx.Err() == nil
+}
+
+func (s *fakeSession) delay(step Step) time.Duration {
+	ms := s.script.DelayMS
+	if step.DelayMS != nil {
+		ms = *step.DelayMS
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// wait sleeps for d. It returns false if interrupted or closed.
+func (s *fakeSession) wait(d time.Duration) bool {
+	if d <= 0 {
+		select {
+		case <-s.interrupts:
+			return false
+		default:
+			return s.ctx.Err() == nil
+		}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.interrupts:
+		return false
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// awaitResponse blocks until a permission/question response arrives.
+// It returns false if interrupted or closed.
+func (s *fakeSession) awaitResponse() bool {
+	select {
+	case <-s.responses:
+		return true
+	case <-s.interrupts:
+		return false
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// interrupted ends the current turn. It returns false when the process has ended.
+func (s *fakeSession) interrupted() bool {
+	if s.ctx.Err() != nil {
+		return false
+	}
+	return s.emit(agent.InterruptedEvent{})
+}
+
+func (s *fakeSession) emit(event agent.AgentEvent) bool {
+	select {
+	case s.events <- event:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
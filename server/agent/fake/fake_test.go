@@ -0,0 +1,166 @@
+package fake
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pockode/server/agent"
+)
+
+func startSession(t *testing.T, script Script) agent.Session {
+	t.Helper()
+	sess, err := New(script).Start(context.Background(), agent.StartOptions{SessionID: "s1"})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(sess.Close)
+	return sess
+}
+
+func expectEvents(t *testing.T, sess agent.Session, want ...agent.AgentEvent) {
+	t.Helper()
+	for i, w := range want {
+		select {
+		case got, ok := <-sess.Events():
+			if !ok {
+				t.Fatalf("event[%d]: channel closed, expected %+v", i, w)
+			}
+			if got.EventType() != w.EventType() || got.ToRecord().Content != w.ToRecord().Content {
+				t.Errorf("event[%d]: expected %+v, got %+v", i, w, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event[%d]: timeout waiting for %+v", i, w)
+		}
+	}
+}
+
+func expectNoEvent(t *testing.T, sess agent.Session) {
+	t.Helper()
+	select {
+	case got := <-sess.Events():
+		t.Fatalf("unexpected event %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSession_EchoWithoutScript(t *testing.T) {
+	sess := startSession(t, Script{})
+
+	sess.SendMessage("hello")
+	expectEvents(t, sess, agent.TextEvent{Content: "Echo: hello"}, agent.DoneEvent{})
+}
+
+func TestSession_PlaysTurnsInOrder(t *testing.T) {
+	sess := startSession(t, Script{Turns: []Turn{
+		{Steps: []Step{
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeText, Content: "first {{prompt}}"}},
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}},
+		}},
+	}})
+
+	sess.SendMessage("a")
+	expectEvents(t, sess, agent.TextEvent{Content: "first a"}, agent.DoneEvent{})
+
+	// Script exhausted: falls back to echo
+	sess.SendMessage("b")
+	expectEvents(t, sess, agent.TextEvent{Content: "Echo: b"}, agent.DoneEvent{})
+}
+
+func TestSession_PermissionRequestWaitsForResponse(t *testing.T) {
+	sess := startSession(t, Script{Turns: []Turn{
+		{Steps: []Step{
+			{EventRecord: agent.EventRecord{Type: agent.EventTypePermissionRequest, RequestID: "r1", ToolName: "Bash"}},
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}},
+		}},
+	}})
+
+	sess.SendMessage("go")
+	expectEvents(t, sess, agent.PermissionRequestEvent{})
+	expectNoEvent(t, sess)
+
+	sess.SendPermissionResponse(agent.PermissionRequestData{RequestID: "r1"}, agent.PermissionAllow)
+	expectEvents(t, sess, agent.DoneEvent{})
+}
+
+func TestSession_Interrupt(t *testing.T) {
+	delay := 10_000
+	sess := startSession(t, Script{Turns: []Turn{
+		{Steps: []Step{
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeText, Content: "slow"}, DelayMS: &delay},
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}},
+		}},
+	}})
+
+	sess.SendMessage("go")
+	time.Sleep(20 * time.Millisecond)
+	sess.SendInterrupt()
+	expectEvents(t, sess, agent.InterruptedEvent{})
+
+	// Next message continues with the echo fallback
+	sess.SendMessage("again")
+	expectEvents(t, sess, agent.TextEvent{Content: "Echo: again"}, agent.DoneEvent{})
+}
+
+func TestSession_Crash(t *testing.T) {
+	sess := startSession(t, Script{Turns: []Turn{
+		{Steps: []Step{{EventRecord: agent.EventRecord{Type: StepCrash, Content: "boom"}}}},
+	}})
+
+	sess.SendMessage("go")
+	expectEvents(t, sess, agent.ErrorEvent{Error: "boom"}, agent.ProcessEndedEvent{})
+
+	select {
+	case _, ok := <-sess.Events():
+		if ok {
+			t.Error("expected events channel to be closed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for channel close")
+	}
+}
+
+func TestSession_Delay(t *testing.T) {
+	sess := startSession(t, Script{DelayMS: 30, Turns: []Turn{
+		{Steps: []Step{{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}}}},
+	}})
+
+	start := time.Now()
+	sess.SendMessage("go")
+	expectEvents(t, sess, agent.DoneEvent{})
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("expected at least 30ms delay, got %v", elapsed)
+	}
+}
+
+func TestLoadScript(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("valid", func(t *testing.T) {
+		path := filepath.Join(dir, "valid.json")
+		os.WriteFile(path, []byte(`{"delay_ms":5,"turns":[{"steps":[{"type":"text","content":"hi","delay_ms":0},{"type":"crash"}]}]}`), 0644)
+
+		script, err := LoadScript(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if script.DelayMS != 5 || len(script.Turns) != 1 || len(script.Turns[0].Steps) != 2 {
+			t.Fatalf("unexpected script: %+v", script)
+		}
+		step := script.Turns[0].Steps[0]
+		if step.Content != "hi" || step.DelayMS == nil || *step.DelayMS != 0 {
+			t.Errorf("unexpected step: %+v", step)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		path := filepath.Join(dir, "bad.json")
+		os.WriteFile(path, []byte(`{"turns":[{"steps":[{"type":"bogus"}]}]}`), 0644)
+
+		if _, err := LoadScript(path); err == nil {
+			t.Error("expected error for unknown step type")
+		}
+	})
+}
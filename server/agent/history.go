@@ -1,6 +1,11 @@
 package agent
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pockode/server/session"
+)
 
 // EventRecord is the serialized form of an AgentEvent.
 // Used for persistence (history storage) and notifications (WebSocket).
@@ -19,9 +24,71 @@ type EventRecord struct {
 	Questions             []AskUserQuestion  `json:"questions,omitempty"`
 	Choice                string             `json:"choice,omitempty"`
 	Answers               map[string]string  `json:"answers,omitempty"`
+	Attachments           []Attachment       `json:"attachments,omitempty"`
+	Usage                 *session.Usage     `json:"usage,omitempty"`
+	User                  string             `json:"user,omitempty"` // who caused a user-side record
+	RuleID                string             `json:"rule_id,omitempty"`
+	Reason                string             `json:"reason,omitempty"`
+	Checkpoint            string             `json:"checkpoint,omitempty"` // worktree snapshot before a message's turn
 }
 
 // NewEventRecord creates an EventRecord from an AgentEvent.
 func NewEventRecord(event AgentEvent) EventRecord {
 	return event.ToRecord()
 }
+
+// ToEvent converts a serialized record back into an AgentEvent.
+// It is the inverse of AgentEvent.ToRecord and is used by backends whose
+// wire format is EventRecord itself (e.g., line-protocol adapters).
+// Unlike ToRecord, this switch must be updated when adding a new event type.
+func (r EventRecord) ToEvent() (AgentEvent, error) {
+	switch r.Type {
+	case EventTypeText:
+		return TextEvent{Content: r.Content}, nil
+	case EventTypeToolCall:
+		return ToolCallEvent{ToolName: r.ToolName, ToolInput: r.ToolInput, ToolUseID: r.ToolUseID}, nil
+	case EventTypeToolResult:
+		return ToolResultEvent{ToolUseID: r.ToolUseID, ToolResult: r.ToolResult}, nil
+	case EventTypeWarning:
+		return WarningEvent{Message: r.Message, Code: r.Code}, nil
+	case EventTypeError:
+		return ErrorEvent{Error: r.Error}, nil
+	case EventTypeDone:
+		return DoneEvent{}, nil
+	case EventTypeInterrupted:
+		return InterruptedEvent{}, nil
+	case EventTypePermissionRequest:
+		return PermissionRequestEvent{
+			RequestID:             r.RequestID,
+			ToolName:              r.ToolName,
+			ToolInput:             r.ToolInput,
+			ToolUseID:             r.ToolUseID,
+			PermissionSuggestions: r.PermissionSuggestions,
+		}, nil
+	case EventTypeRequestCancelled:
+		return RequestCancelledEvent{RequestID: r.RequestID}, nil
+	case EventTypeAskUserQuestion:
+		return AskUserQuestionEvent{RequestID: r.RequestID, ToolUseID: r.ToolUseID, Questions: r.Questions}, nil
+	case EventTypeSystem:
+		return SystemEvent{Content: r.Content}, nil
+	case EventTypeProcessEnded:
+		return ProcessEndedEvent{}, nil
+	case EventTypeMessage:
+		return MessageEvent{Content: r.Content, Attachments: r.Attachments, User: r.User, Checkpoint: r.Checkpoint}, nil
+	case EventTypePermissionResponse:
+		return PermissionResponseEvent{RequestID: r.RequestID, Choice: r.Choice, User: r.User, RuleID: r.RuleID, Reason: r.Reason}, nil
+	case EventTypeQuestionResponse:
+		return QuestionResponseEvent{RequestID: r.RequestID, Answers: r.Answers, User: r.User}, nil
+	case EventTypeRaw:
+		return RawEvent{Content: r.Content}, nil
+	case EventTypeCommandOutput:
+		return CommandOutputEvent{Content: r.Content}, nil
+	case EventTypeUsage:
+		if r.Usage == nil {
+			return nil, fmt.Errorf("usage record without usage")
+		}
+		return UsageEvent{Usage: *r.Usage}, nil
+	default:
+		return nil, fmt.Errorf("unknown event type: %q", r.Type)
+	}
+}
@@ -0,0 +1,340 @@
+// Package lineproto implements agent.Agent for CLI tools that speak a
+// newline-delimited JSON protocol.
+//
+// Pockode writes one command per line to the tool's stdin:
+//
+//	{"type":"message","content":"...","attachments":[{"type":"image","media_type":"image/png","data":"<base64>"}]}
+//	{"type":"permission_response","request_id":"...","tool_use_id":"...","choice":"allow"}
+//	{"type":"question_response","request_id":"...","tool_use_id":"...","answers":{...}}
+//	{"type":"interrupt"}
+//
+// The tool writes agent.EventRecord objects to stdout, one per line
+// (e.g. {"type":"text","content":"..."} followed by {"type":"done"}).
+// Lines that are not valid records are surfaced as raw events.
+//
+// This lets wrappers around other agents (Codex, Aider, ...) plug into
+// Pockode without a dedicated Go backend.
+package lineproto
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/logger"
+)
+
+const stderrReadTimeout = 5 * time.Second
+
+// Config describes a line-protocol backend.
+type Config struct {
+	Name    string            `json:"name"`
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+type configFile struct {
+	Default string   `json:"default,omitempty"`
+	Agents  []Config `json:"agents"`
+}
+
+// LoadConfig reads backend definitions from a JSON file of the form
+// {"default": "name", "agents": [{"name": ..., "command": ..., "args": [...]}]}.
+// A missing file yields no backends and no error.
+func LoadConfig(path string) (defaultName string, configs []Config, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var f configFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return "", nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for i, c := range f.Agents {
+		if c.Name == "" || c.Command == "" {
+			return "", nil, fmt.Errorf("parse %s: agents[%d]: name and command are required", path, i)
+		}
+	}
+
+	return f.Default, f.Agents, nil
+}
+
+// Agent implements agent.Agent for a line-protocol CLI tool.
+type Agent struct {
+	cfg Config
+}
+
+// New creates a line-protocol Agent.
+func New(cfg Config) *Agent {
+	return &Agent{cfg: cfg}
+}
+
+// Start launches the configured command.
+// Session details are passed as POCKODE_SESSION_ID, POCKODE_RESUME, POCKODE_MODE,
+// POCKODE_CONFIG (the session's AgentConfig as JSON) and POCKODE_FORK_FROM
+// (the parent session ID when a forked session first starts, otherwise empty).
+func (a *Agent) Start(ctx context.Context, opts agent.StartOptions) (agent.Session, error) {
+	config, err := json.Marshal(opts.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	procCtx, cancel := context.WithCancel(ctx)
+
+	cmd := exec.CommandContext(procCtx, a.cfg.Command, a.cfg.Args...)
+	cmd.Dir = opts.WorkDir
+	cmd.Env = append(os.Environ(),
+		"POCKODE_SESSION_ID="+opts.SessionID,
+		"POCKODE_RESUME="+strconv.FormatBool(opts.Resume),
+		"POCKODE_MODE="+string(opts.Mode),
+		"POCKODE_CONFIG="+string(config),
+		"POCKODE_FORK_FROM="+opts.ForkFrom,
+	)
+	for k, v := range a.cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		cancel()
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		cancel()
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		stdin.Close()
+		stdout.Close()
+		stderr.Close()
+		cancel()
+		return nil, fmt.Errorf("failed to start %s: %w", a.cfg.Name, err)
+	}
+
+	log := slog.With("sessionId", opts.SessionID, "agent", a.cfg.Name)
+	log.Info("agent process started", "pid", cmd.Process.Pid, "mode", opts.Mode)
+
+	events := make(chan agent.AgentEvent)
+	sess := &lineSession{
+		log:    log,
+		events: events,
+		stdin:  stdin,
+		cancel: cancel,
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.LogPanic(r, "agent process crashed", "sessionId", opts.SessionID, "agent", a.cfg.Name)
+			}
+		}()
+		defer close(events)
+		defer cancel()
+		defer stdout.Close()
+		defer stderr.Close()
+
+		stderrCh := readStderr(stderr)
+		streamOutput(procCtx, log, stdout, events)
+		waitForProcess(procCtx, log, cmd, stderrCh, events)
+
+		select {
+		case events <- agent.ProcessEndedEvent{}:
+		case <-procCtx.Done():
+		}
+	}()
+
+	return sess, nil
+}
+
+// command is a single line written to the tool's stdin.
+type command struct {
+	Type        string             `json:"type"`
+	Content     string             `json:"content,omitempty"`
+	Attachments []agent.Attachment `json:"attachments,omitempty"`
+	RequestID   string             `json:"request_id,omitempty"`
+	ToolUseID   string             `json:"tool_use_id,omitempty"`
+	ToolInput   json.RawMessage    `json:"tool_input,omitempty"`
+	Choice      string             `json:"choice,omitempty"`
+	Answers     map[string]string  `json:"answers,omitempty"`
+}
+
+type lineSession struct {
+	log       *slog.Logger
+	events    chan agent.AgentEvent
+	stdin     io.WriteCloser
+	stdinMu   sync.Mutex
+	cancel    func()
+	closeOnce sync.Once
+}
+
+func (s *lineSession) Events() <-chan agent.AgentEvent {
+	return s.events
+}
+
+func (s *lineSession) SendMessage(prompt string, attachments ...agent.Attachment) error {
+	return s.write(command{Type: "message", Content: prompt, Attachments: attachments})
+}
+
+func (s *lineSession) SendPermissionResponse(data agent.PermissionRequestData, choice agent.PermissionChoice) error {
+	return s.write(command{
+		Type:      "permission_response",
+		RequestID: data.RequestID,
+		ToolUseID: data.ToolUseID,
+		ToolInput: data.ToolInput,
+		Choice:    choiceString(choice),
+	})
+}
+
+func (s *lineSession) SendQuestionResponse(data agent.QuestionRequestData, answers map[string]string) error {
+	return s.write(command{
+		Type:      "question_response",
+		RequestID: data.RequestID,
+		ToolUseID: data.ToolUseID,
+		Answers:   answers,
+	})
+}
+
+func (s *lineSession) SendInterrupt() error {
+	s.log.Info("sending interrupt signal")
+	return s.write(command{Type: "interrupt"})
+}
+
+// Close terminates the process. Safe to call multiple times.
+func (s *lineSession) Close() {
+	s.closeOnce.Do(func() {
+		s.log.Info("terminating agent process")
+		s.cancel()
+		s.stdinMu.Lock()
+		s.stdin.Close()
+		s.stdinMu.Unlock()
+	})
+}
+
+func (s *lineSession) write(cmd command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", cmd.Type, err)
+	}
+	s.stdinMu.Lock()
+	defer s.stdinMu.Unlock()
+	_, err = s.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func choiceString(choice agent.PermissionChoice) string {
+	switch choice {
+	case agent.PermissionAllow:
+		return "allow"
+	case agent.PermissionAlwaysAllow:
+		return "always_allow"
+	default:
+		return "deny"
+	}
+}
+
+// parseLine converts one stdout line into an event.
+func parseLine(line []byte) agent.AgentEvent {
+	var record agent.EventRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return agent.RawEvent{Content: string(line)}
+	}
+	event, err := record.ToEvent()
+	if err != nil {
+		return agent.RawEvent{Content: string(line)}
+	}
+	return event
+}
+
+func readStderr(stderr io.Reader) <-chan string {
+	ch := make(chan string, 1)
+	go func() {
+		var content strings.Builder
+		defer func() {
+			if r := recover(); r != nil {
+				logger.LogPanic(r, "failed to read agent stderr")
+			}
+			ch <- content.String()
+		}()
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			content.WriteString(scanner.Text())
+			content.WriteString("\n")
+		}
+	}()
+	return ch
+}
+
+func streamOutput(ctx context.Context, log *slog.Logger, stdout io.Reader, events chan<- agent.AgentEvent) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		select {
+		case events <- parseLine(line):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Error("stdout scanner error", "error", err)
+		select {
+		case events <- agent.WarningEvent{Message: "Some output could not be read", Code: "scanner_error"}:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func waitForProcess(ctx context.Context, log *slog.Logger, cmd *exec.Cmd, stderrCh <-chan string, events chan<- agent.AgentEvent) {
+	var stderrContent string
+	select {
+	case stderrContent = <-stderrCh:
+	case <-time.After(stderrReadTimeout):
+	}
+
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		errMsg := stderrContent
+		if errMsg == "" {
+			errMsg = err.Error()
+		}
+		select {
+		case events <- agent.ErrorEvent{Error: errMsg}:
+		case <-ctx.Done():
+		}
+	}
+
+	log.Info("agent process exited")
+}
@@ -0,0 +1,146 @@
+package lineproto
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pockode/server/agent"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected agent.AgentEvent
+	}{
+		{
+			name:     "text record",
+			input:    `{"type":"text","content":"hello"}`,
+			expected: agent.TextEvent{Content: "hello"},
+		},
+		{
+			name:     "done record",
+			input:    `{"type":"done"}`,
+			expected: agent.DoneEvent{},
+		},
+		{
+			name:     "invalid json becomes raw",
+			input:    "not json",
+			expected: agent.RawEvent{Content: "not json"},
+		},
+		{
+			name:     "unknown type becomes raw",
+			input:    `{"type":"bogus"}`,
+			expected: agent.RawEvent{Content: `{"type":"bogus"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseLine([]byte(tt.input))
+			if got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("missing file", func(t *testing.T) {
+		def, configs, err := LoadConfig(filepath.Join(dir, "missing.json"))
+		if err != nil || def != "" || configs != nil {
+			t.Errorf("expected empty result, got %q %v %v", def, configs, err)
+		}
+	})
+
+	t.Run("valid file", func(t *testing.T) {
+		path := filepath.Join(dir, "agents.json")
+		os.WriteFile(path, []byte(`{"default":"echo","agents":[{"name":"echo","command":"cat"}]}`), 0644)
+
+		def, configs, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if def != "echo" {
+			t.Errorf("expected default 'echo', got %q", def)
+		}
+		if len(configs) != 1 || configs[0].Command != "cat" {
+			t.Errorf("unexpected configs: %+v", configs)
+		}
+	})
+
+	t.Run("missing command", func(t *testing.T) {
+		path := filepath.Join(dir, "bad.json")
+		os.WriteFile(path, []byte(`{"agents":[{"name":"x"}]}`), 0644)
+
+		if _, _, err := LoadConfig(path); err == nil {
+			t.Error("expected error for missing command")
+		}
+	})
+}
+
+func TestAgent_RoundTrip(t *testing.T) {
+	// Echo every message back as text, then finish the turn.
+	script := `while read -r line; do
+  echo '{"type":"text","content":"ack"}'
+  echo '{"type":"done"}'
+done`
+	a := New(Config{Name: "sh", Command: "sh", Args: []string{"-c", script}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sess, err := a.Start(ctx, agent.StartOptions{WorkDir: t.TempDir(), SessionID: "s1"})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer sess.Close()
+
+	if err := sess.SendMessage("hello"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	want := []agent.AgentEvent{agent.TextEvent{Content: "ack"}, agent.DoneEvent{}}
+	for i, w := range want {
+		select {
+		case got := <-sess.Events():
+			if got != w {
+				t.Errorf("event[%d]: expected %+v, got %+v", i, w, got)
+			}
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for events")
+		}
+	}
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestLineSession_WritesCommands(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	sess := &lineSession{log: testLogger(), stdin: w, cancel: func() {}}
+	sess.SendPermissionResponse(agent.PermissionRequestData{RequestID: "r1", ToolUseID: "t1"}, agent.PermissionAlwaysAllow)
+	w.Close()
+
+	var cmd command
+	if err := json.NewDecoder(r).Decode(&cmd); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if cmd.Type != "permission_response" || cmd.RequestID != "r1" || cmd.Choice != "always_allow" {
+		t.Errorf("unexpected command: %+v", cmd)
+	}
+}
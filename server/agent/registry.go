@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrUnknownAgent = errors.New("unknown agent")
+
+// Registry holds the agent backends available on this server, keyed by name.
+// It implements Agent itself by dispatching Start to the backend named in
+// StartOptions.Backend, so process managers can stay backend-agnostic.
+type Registry struct {
+	mu          sync.RWMutex
+	agents      map[string]Agent
+	names       []string // registration order
+	defaultName string
+}
+
+var _ Agent = (*Registry)(nil)
+
+func NewRegistry() *Registry {
+	return &Registry{agents: make(map[string]Agent)}
+}
+
+// Register adds a backend. The first registered backend becomes the default.
+// Registering an existing name replaces its backend.
+func (r *Registry) Register(name string, a Agent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.agents[name]; !exists {
+		r.names = append(r.names, name)
+	}
+	r.agents[name] = a
+	if r.defaultName == "" {
+		r.defaultName = name
+	}
+}
+
+// SetDefault selects the backend used when a session does not name one.
+func (r *Registry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.agents[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAgent, name)
+	}
+	r.defaultName = name
+	return nil
+}
+
+// Default returns the name of the default backend.
+func (r *Registry) Default() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultName
+}
+
+// Names returns backend names in registration order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.names))
+	copy(names, r.names)
+	return names
+}
+
+// Has reports whether a backend is registered under name.
+// The empty name refers to the default backend.
+func (r *Registry) Has(name string) bool {
+	_, err := r.resolve(name)
+	return err == nil
+}
+
+// Start launches a session on the backend named by opts.Backend
+// (empty = default backend).
+func (r *Registry) Start(ctx context.Context, opts StartOptions) (Session, error) {
+	a, err := r.resolve(opts.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return a.Start(ctx, opts)
+}
+
+func (r *Registry) resolve(name string) (Agent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if name == "" {
+		name = r.defaultName
+	}
+	a, ok := r.agents[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAgent, name)
+	}
+	return a, nil
+}
@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type stubAgent struct {
+	started []StartOptions
+}
+
+func (a *stubAgent) Start(ctx context.Context, opts StartOptions) (Session, error) {
+	a.started = append(a.started, opts)
+	return nil, nil
+}
+
+func TestRegistry_FirstRegisteredIsDefault(t *testing.T) {
+	r := NewRegistry()
+	r.Register("claude", &stubAgent{})
+	r.Register("codex", &stubAgent{})
+
+	if r.Default() != "claude" {
+		t.Errorf("expected default 'claude', got %q", r.Default())
+	}
+	names := r.Names()
+	if len(names) != 2 || names[0] != "claude" || names[1] != "codex" {
+		t.Errorf("unexpected names: %v", names)
+	}
+}
+
+func TestRegistry_StartDispatchesByBackend(t *testing.T) {
+	claude := &stubAgent{}
+	codex := &stubAgent{}
+	r := NewRegistry()
+	r.Register("claude", claude)
+	r.Register("codex", codex)
+
+	r.Start(context.Background(), StartOptions{SessionID: "a"})
+	r.Start(context.Background(), StartOptions{SessionID: "b", Backend: "codex"})
+
+	if len(claude.started) != 1 || claude.started[0].SessionID != "a" {
+		t.Errorf("expected default backend to start session a, got %+v", claude.started)
+	}
+	if len(codex.started) != 1 || codex.started[0].SessionID != "b" {
+		t.Errorf("expected codex to start session b, got %+v", codex.started)
+	}
+}
+
+func TestRegistry_UnknownBackend(t *testing.T) {
+	r := NewRegistry()
+	r.Register("claude", &stubAgent{})
+
+	_, err := r.Start(context.Background(), StartOptions{Backend: "missing"})
+	if !errors.Is(err, ErrUnknownAgent) {
+		t.Errorf("expected ErrUnknownAgent, got %v", err)
+	}
+	if r.Has("missing") {
+		t.Error("expected Has to be false for unknown backend")
+	}
+	if err := r.SetDefault("missing"); !errors.Is(err, ErrUnknownAgent) {
+		t.Errorf("expected ErrUnknownAgent from SetDefault, got %v", err)
+	}
+}
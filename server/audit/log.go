@@ -0,0 +1,463 @@
+// Package audit keeps an append-only, hash-chained record of mutating actions.
+//
+// Each entry stores the hash of the previous one, so editing or deleting an
+// entry breaks the chain from that point on. Hashes are HMACs keyed by a
+// secret kept outside the log directory, so rewriting entries also requires
+// the key. Dropping entries from the end keeps a valid chain; Verify reports
+// the head so it can be recorded elsewhere and compared later. The active
+// file is rotated by size; rotated segments keep the chain and the oldest are
+// pruned.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pockode/server/fsutil"
+)
+
+const (
+	DefaultMaxBytes = 8 << 20
+	DefaultMaxFiles = 20
+
+	DefaultLimit = 100
+	MaxLimit     = 1000
+
+	activeFile = "audit.jsonl"
+	keyFile    = "audit.key"
+)
+
+// Entry is one audited action.
+type Entry struct {
+	Seq      int64           `json:"seq"`
+	Time     time.Time       `json:"time"`
+	Actor    string          `json:"actor"`
+	Role     string          `json:"role,omitempty"`
+	ConnID   string          `json:"conn_id,omitempty"`
+	Worktree string          `json:"worktree"`
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Denied   bool            `json:"denied,omitempty"` // rejected by role check
+	Prev     string          `json:"prev"`
+	Hash     string          `json:"hash"`
+}
+
+func (e Entry) computeHash(key []byte) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Log appends entries to <dataDir>/audit.
+type Log struct {
+	dir      string
+	key      []byte
+	maxBytes int64
+	maxFiles int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	lastSeq  int64
+	lastHash string
+}
+
+// Open opens the audit log in dataDir, resuming the chain where it ended.
+// maxBytes and maxFiles bound the active file and the number of rotated
+// segments; zero selects the defaults.
+func Open(dataDir string, maxBytes int64, maxFiles int) (*Log, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	l := &Log{
+		dir:      filepath.Join(dataDir, "audit"),
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+	}
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadKey(filepath.Join(dataDir, keyFile))
+	if err != nil {
+		return nil, err
+	}
+	l.key = key
+
+	files, err := l.files()
+	if err != nil {
+		return nil, err
+	}
+	// The newest segment holding any entry carries the chain head
+	for i := len(files) - 1; i >= 0; i-- {
+		last, ok, err := lastEntry(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			l.lastSeq, l.lastHash = last.Seq, last.Hash
+			break
+		}
+	}
+
+	if err := l.openActive(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// loadKey reads the HMAC key, creating a random one on first use.
+func loadKey(path string) ([]byte, error) {
+	encoded, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(encoded)))
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("%s: malformed key", path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := fsutil.WriteFileAtomic(path, []byte(hex.EncodeToString(key)+"\n")); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (l *Log) openActive() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, activeFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Append records an entry. Seq, Time, Prev and Hash are filled in.
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return Entry{}, errors.New("audit log is closed")
+	}
+
+	e.Seq = l.lastSeq + 1
+	e.Time = time.Now().UTC()
+	e.Prev = l.lastHash
+	hash, err := e.computeHash(l.key)
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Hash = hash
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	line = append(line, '\n')
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotateLocked(); err != nil {
+			return Entry{}, err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	l.lastSeq, l.lastHash = e.Seq, e.Hash
+	return e, nil
+}
+
+// Record appends an entry for an action the server took without a request,
+// such as a permission answered by policy or a scheduled run. Failures are
+// logged rather than returned, so they never hold up the action.
+func (l *Log) Record(actor, worktree, method string, params any) {
+	entry := Entry{Actor: actor, Worktree: worktree, Method: method}
+	if params != nil {
+		if raw, err := json.Marshal(params); err == nil {
+			entry.Params = Params(raw)
+		}
+	}
+	if _, err := l.Append(entry); err != nil {
+		slog.Error("failed to write audit entry", "method", method, "error", err)
+	}
+}
+
+// ForWorktree binds the log to one worktree for process managers.
+func (l *Log) ForWorktree(name string) *WorktreeRecorder {
+	return &WorktreeRecorder{log: l, worktree: name}
+}
+
+// WorktreeRecorder records actions on behalf of a single worktree.
+type WorktreeRecorder struct {
+	log      *Log
+	worktree string
+}
+
+func (w *WorktreeRecorder) Record(actor, method string, params any) {
+	w.log.Record(actor, w.worktree, method, params)
+}
+
+// rotateLocked renames the active file after its last sequence number,
+// so segment names sort chronologically, and prunes the oldest segments.
+func (l *Log) rotateLocked() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	rotated := filepath.Join(l.dir, fmt.Sprintf("audit-%012d.jsonl", l.lastSeq))
+	if err := os.Rename(filepath.Join(l.dir, activeFile), rotated); err != nil {
+		return err
+	}
+	if err := l.openActive(); err != nil {
+		return err
+	}
+
+	files, err := l.files()
+	if err != nil {
+		return err
+	}
+	segments := files[:len(files)-1]
+	for len(segments) > l.maxFiles {
+		if err := os.Remove(segments[0]); err != nil {
+			return err
+		}
+		segments = segments[1:]
+	}
+	return nil
+}
+
+// files lists rotated segments oldest first, followed by the active file.
+func (l *Log) files() ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, "audit-") && strings.HasSuffix(name, ".jsonl") {
+			files = append(files, filepath.Join(l.dir, name))
+		}
+	}
+	sort.Strings(files)
+	return append(files, filepath.Join(l.dir, activeFile)), nil
+}
+
+func readEntries(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var e Entry
+			if jsonErr := json.Unmarshal(line, &e); jsonErr != nil {
+				return nil, fmt.Errorf("%s: malformed entry after seq %d", filepath.Base(path), lastSeq(entries))
+			}
+			entries = append(entries, e)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func lastSeq(entries []Entry) int64 {
+	if len(entries) == 0 {
+		return 0
+	}
+	return entries[len(entries)-1].Seq
+}
+
+func lastEntry(path string) (Entry, bool, error) {
+	entries, err := readEntries(path)
+	if err != nil || len(entries) == 0 {
+		return Entry{}, false, err
+	}
+	return entries[len(entries)-1], true, nil
+}
+
+// Query filters List. Zero fields match everything.
+type Query struct {
+	Actor     string
+	Worktree  *string // nil matches every worktree; "" is the main worktree
+	Method    string  // exact method, or a namespace prefix ending in "."
+	Since     time.Time
+	Until     time.Time // exclusive
+	BeforeSeq int64     // page backwards from this sequence number
+	Limit     int
+}
+
+func (q Query) matches(e Entry) bool {
+	switch {
+	case q.BeforeSeq > 0 && e.Seq >= q.BeforeSeq:
+		return false
+	case q.Actor != "" && e.Actor != q.Actor:
+		return false
+	case q.Worktree != nil && e.Worktree != *q.Worktree:
+		return false
+	case q.Method != "" && e.Method != q.Method && !(strings.HasSuffix(q.Method, ".") && strings.HasPrefix(e.Method, q.Method)):
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// List returns matching entries, newest first.
+func (l *Log) List(q Query) ([]Entry, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	q.Limit = min(q.Limit, MaxLimit)
+
+	l.mu.Lock()
+	files, err := l.files()
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Entry{}
+	for _, path := range slices.Backward(files) {
+		entries, err := readEntries(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range slices.Backward(entries) {
+			if !q.matches(e) {
+				continue
+			}
+			result = append(result, e)
+			if len(result) == q.Limit {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+// VerifyResult reports the outcome of checking the hash chain.
+type VerifyResult struct {
+	Entries   int    `json:"entries"`
+	FirstSeq  int64  `json:"first_seq"`
+	LastSeq   int64  `json:"last_seq"`
+	LastHash  string `json:"last_hash,omitempty"`  // chain head; record it to detect later truncation
+	BrokenSeq int64  `json:"broken_seq,omitempty"` // first entry that fails verification
+	Reason    string `json:"reason,omitempty"`
+}
+
+func (r VerifyResult) OK() bool {
+	return r.BrokenSeq == 0 && r.Reason == ""
+}
+
+// Verify recomputes every retained entry's hash and checks the links between
+// them. The first retained entry may point at a pruned segment.
+func (l *Log) Verify() (VerifyResult, error) {
+	l.mu.Lock()
+	files, err := l.files()
+	l.mu.Unlock()
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	var result VerifyResult
+	var prev *Entry
+	for _, path := range files {
+		entries, err := readEntries(path)
+		if err != nil {
+			result.Reason = err.Error()
+			return result, nil
+		}
+		for i := range entries {
+			e := entries[i]
+			if prev == nil {
+				result.FirstSeq = e.Seq
+			}
+			hash, err := e.computeHash(l.key)
+			if err != nil {
+				return VerifyResult{}, err
+			}
+			switch {
+			case hash != e.Hash:
+				result.BrokenSeq, result.Reason = e.Seq, "hash mismatch"
+			case prev != nil && e.Prev != prev.Hash:
+				result.BrokenSeq, result.Reason = e.Seq, "chain link mismatch"
+			case prev != nil && e.Seq != prev.Seq+1:
+				result.BrokenSeq, result.Reason = e.Seq, "sequence gap"
+			}
+			if result.BrokenSeq != 0 {
+				return result, nil
+			}
+			result.Entries++
+			result.LastSeq, result.LastHash = e.Seq, e.Hash
+			prev = &entries[i]
+		}
+	}
+	return result, nil
+}
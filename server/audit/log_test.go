@@ -0,0 +1,171 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendN(t *testing.T, l *Log, n int, method string) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		_, err := l.Append(Entry{Actor: "alice", Method: method, Params: json.RawMessage(`{"i":1}`)})
+		if err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+}
+
+func TestLog_AppendChainsAndResumes(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	first, _ := l.Append(Entry{Actor: "alice", Method: "file.write"})
+	second, _ := l.Append(Entry{Actor: "bob", Method: "git.add"})
+	if first.Seq != 1 || first.Prev != "" || second.Seq != 2 || second.Prev != first.Hash {
+		t.Errorf("unexpected chain: %+v %+v", first, second)
+	}
+	l.Close()
+
+	l, _ = Open(dir, 0, 0)
+	defer l.Close()
+	third, _ := l.Append(Entry{Actor: "alice", Method: "session.set_mode"})
+	if third.Seq != 3 || third.Prev != second.Hash {
+		t.Errorf("expected chain to resume after reopen, got %+v", third)
+	}
+
+	result, err := l.Verify()
+	if err != nil || !result.OK() || result.Entries != 3 || result.LastHash != third.Hash {
+		t.Errorf("expected valid chain of 3 ending at the last hash, got %+v %v", result, err)
+	}
+}
+
+func TestLog_VerifyDetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	l, _ := Open(dir, 0, 0)
+	defer l.Close()
+	appendN(t, l, 3, "git.reset")
+
+	path := filepath.Join(dir, "audit", activeFile)
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	// Rewriting an entry changes its hash
+	tampered := strings.Replace(lines[1], `"actor":"alice"`, `"actor":"mallory"`, 1)
+	os.WriteFile(path, []byte(lines[0]+"\n"+tampered+"\n"+lines[2]+"\n"), 0600)
+	result, _ := l.Verify()
+	if result.OK() || result.BrokenSeq != 2 || result.Reason != "hash mismatch" {
+		t.Errorf("expected hash mismatch at 2, got %+v", result)
+	}
+
+	// Recomputing the hash without the key does not help
+	var e Entry
+	json.Unmarshal([]byte(tampered), &e)
+	e.Hash = ""
+	data, _ = json.Marshal(e)
+	sum := sha256.Sum256(data)
+	e.Hash = hex.EncodeToString(sum[:])
+	rehashed, _ := json.Marshal(e)
+	os.WriteFile(path, []byte(lines[0]+"\n"+string(rehashed)+"\n"+lines[2]+"\n"), 0600)
+	result, _ = l.Verify()
+	if result.OK() || result.BrokenSeq != 2 || result.Reason != "hash mismatch" {
+		t.Errorf("expected hash mismatch at 2 for an unkeyed hash, got %+v", result)
+	}
+
+	// Deleting an entry breaks the link of the next one
+	os.WriteFile(path, []byte(lines[0]+"\n"+lines[2]+"\n"), 0600)
+	result, _ = l.Verify()
+	if result.OK() || result.BrokenSeq != 3 || result.Reason != "chain link mismatch" {
+		t.Errorf("expected chain link mismatch at 3, got %+v", result)
+	}
+}
+
+func TestLog_RotationKeepsChain(t *testing.T) {
+	dir := t.TempDir()
+	l, _ := Open(dir, 300, 2)
+	defer l.Close()
+	appendN(t, l, 20, "file.write")
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "audit", "audit-*.jsonl"))
+	if len(segments) != 2 {
+		t.Errorf("expected 2 retained segments, got %v", segments)
+	}
+
+	result, err := l.Verify()
+	if err != nil || !result.OK() || result.LastSeq != 20 || result.FirstSeq <= 1 {
+		t.Errorf("expected valid pruned chain ending at 20, got %+v %v", result, err)
+	}
+
+	entries, _ := l.List(Query{Limit: 1000})
+	if len(entries) != result.Entries || entries[0].Seq != 20 {
+		t.Errorf("expected newest first across segments, got %d entries", len(entries))
+	}
+}
+
+func TestLog_List(t *testing.T) {
+	l, _ := Open(t.TempDir(), 0, 0)
+	defer l.Close()
+
+	mainWt, feature := "", "feature"
+	l.Append(Entry{Actor: "alice", Worktree: mainWt, Method: "git.add"})
+	l.Append(Entry{Actor: "bob", Worktree: feature, Method: "git.reset"})
+	l.Append(Entry{Actor: "alice", Worktree: feature, Method: "file.write"})
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []int64
+	}{
+		{"all", Query{}, []int64{3, 2, 1}},
+		{"actor", Query{Actor: "alice"}, []int64{3, 1}},
+		{"main worktree", Query{Worktree: &mainWt}, []int64{1}},
+		{"namespace", Query{Method: "git."}, []int64{2, 1}},
+		{"exact method", Query{Method: "git.add"}, []int64{1}},
+		{"page", Query{BeforeSeq: 3, Limit: 1}, []int64{2}},
+		{"future", Query{Since: time.Now().Add(time.Hour)}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := l.List(tt.query)
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			var got []int64
+			for _, e := range entries {
+				got = append(got, e.Seq)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLog_Record(t *testing.T) {
+	l, _ := Open(t.TempDir(), 0, 0)
+	defer l.Close()
+
+	l.ForWorktree("feature").Record("policy", "permission.policy", map[string]string{"input": strings.Repeat("x", 2000)})
+
+	entries, _ := l.List(Query{})
+	if len(entries) != 1 || entries[0].Actor != "policy" || entries[0].Worktree != "feature" || entries[0].Method != "permission.policy" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if !strings.Contains(string(entries[0].Params), "[2000 bytes sha256:") {
+		t.Errorf("expected long params to be summarized, got %s", entries[0].Params)
+	}
+}
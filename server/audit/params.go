@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// maxString bounds string values copied into entries.
+const maxString = 1024
+
+// Params copies request params for an entry, replacing long string values
+// (file contents, attachments) by their size and hash.
+func Params(raw json.RawMessage) json.RawMessage {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return json.RawMessage(fmt.Sprintf("%q", summarize(string(raw))))
+	}
+	data, err := json.Marshal(truncateStrings(v))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func truncateStrings(v any) any {
+	switch v := v.(type) {
+	case string:
+		if len(v) > maxString {
+			return summarize(v)
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = truncateStrings(v[i])
+		}
+		return v
+	case map[string]any:
+		for k := range v {
+			v[k] = truncateStrings(v[k])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func summarize(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return fmt.Sprintf("[%d bytes sha256:%s]", len(s), hex.EncodeToString(sum[:]))
+}
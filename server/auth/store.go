@@ -0,0 +1,253 @@
+// Package auth manages named API tokens and the roles they grant.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pockode/server/fsutil"
+)
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrInvalidRole   = errors.New("invalid role")
+	ErrInvalidUser   = errors.New("user name is required")
+)
+
+// Role is an access level. Each role includes the permissions of the ones below it.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // read sessions, files and git state
+	RoleOperator Role = "operator" // chat with agents and change the worktree
+	RoleAdmin    Role = "admin"    // manage tokens, settings and worktrees
+)
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+func (r Role) IsValid() bool {
+	return r.rank() > 0
+}
+
+// Allows reports whether r grants at least the required role.
+func (r Role) Allows(required Role) bool {
+	return r.rank() >= required.rank() && r.IsValid()
+}
+
+// SharedTokenUser is the identity of the server-wide AUTH_TOKEN.
+const SharedTokenUser = "admin"
+
+// Identity is the authenticated user behind a request.
+type Identity struct {
+	User    string `json:"user"`
+	Role    Role   `json:"role"`
+	TokenID string `json:"token_id,omitempty"` // empty for the shared token
+}
+
+// TokenInfo describes an issued token. The secret itself is never stored.
+type TokenInfo struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type storedToken struct {
+	TokenInfo
+	Hash string `json:"hash"` // hex SHA-256 of the secret
+}
+
+type fileData struct {
+	Tokens []storedToken `json:"tokens"`
+}
+
+// Store holds the tokens of a server in <dataDir>/users.json. The shared
+// token passed to NewStore always authenticates as an admin, so existing
+// single-token setups keep working and can bootstrap named tokens.
+type Store struct {
+	path        string
+	sharedToken string
+
+	mu     sync.RWMutex
+	tokens []storedToken
+}
+
+func NewStore(dataDir, sharedToken string) (*Store, error) {
+	s := &Store{
+		path:        filepath.Join(dataDir, "users.json"),
+		sharedToken: sharedToken,
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f fileData
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	s.tokens = f.Tokens
+	return s, nil
+}
+
+// Authenticate resolves a token secret to its identity.
+func (s *Store) Authenticate(token string) (Identity, bool) {
+	if token == "" {
+		return Identity{}, false
+	}
+	if s.sharedToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.sharedToken)) == 1 {
+		return Identity{User: SharedTokenUser, Role: RoleAdmin}, true
+	}
+
+	hash := hashToken(token)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(t.Hash)) == 1 {
+			return Identity{User: t.User, Role: t.Role, TokenID: t.ID}, true
+		}
+	}
+	return Identity{}, false
+}
+
+// RoleOf returns the highest role held by user's tokens. ok is false when
+// the user has no token left, e.g. after every token was revoked.
+func (s *Store) RoleOf(user string) (Role, bool) {
+	var role Role
+	if s.sharedToken != "" && user == SharedTokenUser {
+		role = RoleAdmin
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if t.User == user && t.Role.rank() > role.rank() {
+			role = t.Role
+		}
+	}
+	return role, role.IsValid()
+}
+
+// Create issues a token for user and returns its secret, which is shown only once.
+func (s *Store) Create(user string, role Role) (string, TokenInfo, error) {
+	user = strings.TrimSpace(user)
+	if user == "" {
+		return "", TokenInfo{}, ErrInvalidUser
+	}
+	if !role.IsValid() {
+		return "", TokenInfo{}, ErrInvalidRole
+	}
+
+	secret := rand.Text()
+	t := storedToken{
+		TokenInfo: TokenInfo{
+			ID:        uuid.Must(uuid.NewV7()).String(),
+			User:      user,
+			Role:      role,
+			CreatedAt: time.Now(),
+		},
+		Hash: hashToken(secret),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := append(slices.Clone(s.tokens), t)
+	if err := s.save(tokens); err != nil {
+		return "", TokenInfo{}, err
+	}
+	s.tokens = tokens
+	return secret, t.TokenInfo, nil
+}
+
+// Revoke deletes a token. Callers close connections already authenticated
+// with it.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.tokens, func(t storedToken) bool { return t.ID == id })
+	if i < 0 {
+		return ErrTokenNotFound
+	}
+	tokens := slices.Delete(slices.Clone(s.tokens), i, i+1)
+	if err := s.save(tokens); err != nil {
+		return err
+	}
+	s.tokens = tokens
+	return nil
+}
+
+// List returns issued tokens in creation order.
+func (s *Store) List() []TokenInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]TokenInfo, len(s.tokens))
+	for i, t := range s.tokens {
+		infos[i] = t.TokenInfo
+	}
+	return infos
+}
+
+func (s *Store) save(tokens []storedToken) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(fileData{Tokens: tokens}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(s.path, data)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying the authenticated identity.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFrom returns the identity stored by WithIdentity.
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
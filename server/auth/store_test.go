@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleAdmin, RoleViewer, true},
+		{RoleAdmin, RoleAdmin, true},
+		{RoleOperator, RoleViewer, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleViewer, RoleOperator, false},
+		{"", RoleViewer, false},
+		{"root", RoleViewer, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestStore_SharedToken(t *testing.T) {
+	s, err := NewStore(t.TempDir(), "shared")
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+
+	id, ok := s.Authenticate("shared")
+	if !ok || id.User != SharedTokenUser || id.Role != RoleAdmin {
+		t.Errorf("expected shared token to be admin, got %+v %v", id, ok)
+	}
+	if _, ok := s.Authenticate("wrong"); ok {
+		t.Error("expected wrong token to fail")
+	}
+	if _, ok := s.Authenticate(""); ok {
+		t.Error("expected empty token to fail")
+	}
+}
+
+func TestStore_CreateRevokePersist(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewStore(dir, "shared")
+
+	secret, info, err := s.Create(" alice ", RoleOperator)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if info.User != "alice" || info.Role != RoleOperator || info.ID == "" {
+		t.Errorf("unexpected token info: %+v", info)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "users.json"))
+	if strings.Contains(string(data), secret) {
+		t.Error("secret must not be stored in plain text")
+	}
+
+	// Reload from disk
+	s2, _ := NewStore(dir, "shared")
+	id, ok := s2.Authenticate(secret)
+	if !ok || id.User != "alice" || id.Role != RoleOperator || id.TokenID != info.ID {
+		t.Errorf("expected alice operator after reload, got %+v %v", id, ok)
+	}
+	if list := s2.List(); len(list) != 1 || list[0].ID != info.ID {
+		t.Errorf("unexpected list: %+v", list)
+	}
+
+	if err := s2.Revoke(info.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, ok := s2.Authenticate(secret); ok {
+		t.Error("expected revoked token to fail")
+	}
+	if err := s2.Revoke(info.ID); err != ErrTokenNotFound {
+		t.Errorf("expected ErrTokenNotFound, got %v", err)
+	}
+
+	if _, _, err := s2.Create("", RoleViewer); err != ErrInvalidUser {
+		t.Errorf("expected ErrInvalidUser, got %v", err)
+	}
+	if _, _, err := s2.Create("bob", "root"); err != ErrInvalidRole {
+		t.Errorf("expected ErrInvalidRole, got %v", err)
+	}
+}
+
+func TestStore_RoleOf(t *testing.T) {
+	s, _ := NewStore(t.TempDir(), "shared")
+	s.Create("alice", RoleViewer)
+	_, op, _ := s.Create("alice", RoleOperator)
+	_, bob, _ := s.Create("bob", RoleViewer)
+
+	if role, ok := s.RoleOf(SharedTokenUser); !ok || role != RoleAdmin {
+		t.Errorf("expected shared token user to be admin, got %q %v", role, ok)
+	}
+	if role, ok := s.RoleOf("alice"); !ok || role != RoleOperator {
+		t.Errorf("expected alice's highest role, got %q %v", role, ok)
+	}
+
+	s.Revoke(op.ID)
+	if role, _ := s.RoleOf("alice"); role != RoleViewer {
+		t.Errorf("expected alice to drop to viewer, got %q", role)
+	}
+	s.Revoke(bob.ID)
+	if _, ok := s.RoleOf("bob"); ok {
+		t.Error("expected bob to have no role after revocation")
+	}
+}
@@ -0,0 +1,233 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/client"
+	"github.com/pockode/server/policy"
+)
+
+func runApprove(e *env, args []string) error {
+	fs := e.flagSet("approve", "-session ID [flags]")
+	sessionID := fs.String("session", "", "session with the pending request (required)")
+	requestID := fs.String("request", "", "request to answer (default: the only pending one)")
+	deny := fs.Bool("deny", false, "deny instead of allowing")
+	always := fs.Bool("always", false, "allow this and similar requests for the rest of the session")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if *sessionID == "" || (*deny && *always) {
+		fs.Usage()
+		return errUsage
+	}
+
+	choice := "allow"
+	switch {
+	case *deny:
+		choice = "deny"
+	case *always:
+		choice = "always_allow"
+	}
+
+	c, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	rec, err := findPending(e, c, *sessionID, *requestID, agent.EventTypePermissionRequest)
+	if err != nil {
+		return err
+	}
+	if err := c.RespondPermission(e.ctx, *sessionID, rec, choice); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "%s [%s] %s\n", choice, rec.ToolName, policy.Subject(rec.ToolName, rec.ToolInput))
+	return nil
+}
+
+func runAnswer(e *env, args []string) error {
+	fs := e.flagSet("answer", "-session ID [flags] [answer...]")
+	sessionID := fs.String("session", "", "session with the pending question (required)")
+	requestID := fs.String("request", "", "request to answer (default: the only pending one)")
+	cancel := fs.Bool("cancel", false, "dismiss the question without answering")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if *sessionID == "" || (*cancel && fs.NArg() > 0) {
+		fs.Usage()
+		return errUsage
+	}
+
+	c, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	rec, err := findPending(e, c, *sessionID, *requestID, agent.EventTypeAskUserQuestion)
+	if err != nil {
+		return err
+	}
+
+	var answers map[string]string
+	switch {
+	case *cancel:
+	case fs.NArg() > 0:
+		// Answers are given in question order
+		if fs.NArg() != len(rec.Questions) {
+			return fmt.Errorf("expected %d answers, got %d", len(rec.Questions), fs.NArg())
+		}
+		answers = make(map[string]string, len(rec.Questions))
+		for i, q := range rec.Questions {
+			answers[q.Question] = fs.Arg(i)
+		}
+	case e.interactive:
+		if answers, err = e.askQuestions(rec.Questions); err != nil {
+			return err
+		}
+	default:
+		return errors.New("answers are required when stdin is not a terminal")
+	}
+
+	return c.RespondQuestion(e.ctx, *sessionID, rec, answers)
+}
+
+// findPending returns the unanswered request of eventType with requestID, or
+// the only one if requestID is empty.
+func findPending(e *env, c *client.Client, sessionID, requestID string, eventType agent.EventType) (agent.EventRecord, error) {
+	chat, sub, err := c.SubscribeChat(e.ctx, sessionID)
+	if err != nil {
+		return agent.EventRecord{}, err
+	}
+	sub.Close()
+
+	var pending []agent.EventRecord
+	for _, rec := range pendingRequests(chat.History) {
+		if rec.Type == eventType && (requestID == "" || rec.RequestID == requestID) {
+			pending = append(pending, rec)
+		}
+	}
+
+	switch len(pending) {
+	case 0:
+		if requestID != "" {
+			return agent.EventRecord{}, fmt.Errorf("request %s is not pending", requestID)
+		}
+		return agent.EventRecord{}, errors.New("nothing is pending")
+	case 1:
+		return pending[0], nil
+	default:
+		for _, rec := range pending {
+			fmt.Fprintf(e.stderr, "%s\t%s\n", rec.RequestID, describeRequest(rec))
+		}
+		return agent.EventRecord{}, errors.New("several requests are pending; choose one with -request")
+	}
+}
+
+// pendingRequests returns permission requests and questions in history that
+// have not been answered or cancelled. Requests die with their turn.
+func pendingRequests(history []json.RawMessage) []agent.EventRecord {
+	var pending []agent.EventRecord
+	for _, raw := range history {
+		var rec agent.EventRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			continue
+		}
+		switch rec.Type {
+		case agent.EventTypePermissionRequest, agent.EventTypeAskUserQuestion:
+			pending = append(pending, rec)
+		case agent.EventTypePermissionResponse, agent.EventTypeQuestionResponse, agent.EventTypeRequestCancelled:
+			for i, p := range pending {
+				if p.RequestID == rec.RequestID {
+					pending = append(pending[:i], pending[i+1:]...)
+					break
+				}
+			}
+		case agent.EventTypeDone, agent.EventTypeInterrupted, agent.EventTypeError, agent.EventTypeProcessEnded:
+			pending = nil
+		}
+	}
+	return pending
+}
+
+func describeRequest(rec agent.EventRecord) string {
+	if rec.Type == agent.EventTypeAskUserQuestion {
+		questions := make([]string, len(rec.Questions))
+		for i, q := range rec.Questions {
+			questions[i] = q.Question
+		}
+		return strings.Join(questions, " / ")
+	}
+	return fmt.Sprintf("[%s] %s", rec.ToolName, policy.Subject(rec.ToolName, rec.ToolInput))
+}
+
+// askPermission prompts for a permission choice.
+func (e *env) askPermission() (string, error) {
+	for {
+		answer, err := e.prompt("Allow? [y]es, [a]lways, [n]o: ")
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return "allow", nil
+		case "a", "always":
+			return "always_allow", nil
+		case "n", "no":
+			return "deny", nil
+		}
+	}
+}
+
+// askQuestions prompts for each question. Options are picked by number, several
+// separated by commas for multi-select questions; anything else is sent as an
+// "Other" answer like the web app does. An empty first answer dismisses the
+// questions.
+func (e *env) askQuestions(questions []agent.AskUserQuestion) (map[string]string, error) {
+	answers := make(map[string]string, len(questions))
+	for i, q := range questions {
+		fmt.Fprintf(e.stderr, "\n%s\n", q.Question)
+		for j, opt := range q.Options {
+			fmt.Fprintf(e.stderr, "  %d. %s", j+1, opt.Label)
+			if opt.Description != "" {
+				fmt.Fprintf(e.stderr, " - %s", opt.Description)
+			}
+			fmt.Fprintln(e.stderr)
+		}
+
+		answer, err := e.prompt("> ")
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" && i == 0 {
+			return nil, nil
+		}
+		answers[q.Question] = pickOptions(q, answer)
+	}
+	return answers, nil
+}
+
+// pickOptions maps option numbers in answer to their labels.
+func pickOptions(q agent.AskUserQuestion, answer string) string {
+	other := "Other: " + answer
+	parts := strings.Split(answer, ",")
+	if !q.MultiSelect && len(parts) > 1 {
+		return other
+	}
+
+	labels := make([]string, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 || n > len(q.Options) {
+			return other
+		}
+		labels = append(labels, q.Options[n-1].Label)
+	}
+	return strings.Join(labels, ", ")
+}
@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/client"
+	"github.com/pockode/server/policy"
+)
+
+// exitInterrupted matches the shell convention for SIGINT.
+const exitInterrupted = 130
+
+func runChat(e *env, args []string) error {
+	fs := e.flagSet("chat", "[flags] [message]")
+	sessionID := fs.String("session", "", "session to continue (default: create a new one)")
+	agentName := fs.String("agent", "", "agent backend for a new session (default: server default)")
+	permission := fs.String("permission", "", `answer permission requests with "allow", "always_allow" or "deny" (default: ask when interactive, otherwise wait)`)
+	asJSON := fs.Bool("json", false, "print events as JSON lines")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	switch *permission {
+	case "", "allow", "always_allow", "deny":
+	default:
+		fmt.Fprintf(e.stderr, "invalid -permission %q\n", *permission)
+		return errUsage
+	}
+
+	message := strings.Join(fs.Args(), " ")
+	if message == "" && !e.interactive {
+		data, err := io.ReadAll(e.stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+		message = strings.TrimSpace(string(data))
+	}
+	if message == "" {
+		fmt.Fprintln(e.stderr, "a message is required, as arguments or on stdin")
+		return errUsage
+	}
+
+	c, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if *sessionID == "" {
+		created, err := c.CreateSession(e.ctx, *agentName)
+		if err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+		*sessionID = created.ID
+		fmt.Fprintf(e.stderr, "session %s\n", created.ID)
+	}
+
+	_, sub, err := c.SubscribeChat(e.ctx, *sessionID)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	queueID, err := c.SendMessage(e.ctx, *sessionID, message)
+	if err != nil {
+		return err
+	}
+	if queueID != "" {
+		fmt.Fprintln(e.stderr, "queued behind the running turn")
+	}
+
+	s := &chatStream{
+		env:        e,
+		client:     c,
+		sub:        sub,
+		sessionID:  *sessionID,
+		permission: *permission,
+		json:       *asJSON,
+	}
+	return s.run()
+}
+
+// chatStream prints a session's events until the current turn ends.
+type chatStream struct {
+	env        *env
+	client     *client.Client
+	sub        *client.Subscription[client.ChatEvent]
+	sessionID  string
+	permission string // automatic permission choice, "" to ask or wait
+	json       bool
+}
+
+func (s *chatStream) run() error {
+	e := s.env
+	for {
+		var rec agent.EventRecord
+		select {
+		case <-e.ctx.Done():
+			s.interrupt()
+			return exitError(exitInterrupted)
+		case ev, ok := <-s.sub.Events():
+			if !ok {
+				if err := s.client.Err(); err != nil {
+					return err
+				}
+				return errors.New("subscription ended")
+			}
+			if ev.Record == nil {
+				continue
+			}
+			rec = *ev.Record
+		}
+
+		if s.json {
+			data, _ := json.Marshal(rec)
+			fmt.Fprintln(e.stdout, string(data))
+		} else {
+			s.print(rec)
+		}
+
+		switch rec.Type {
+		case agent.EventTypePermissionRequest:
+			if err := s.onPermission(rec); err != nil {
+				return err
+			}
+		case agent.EventTypeAskUserQuestion:
+			if err := s.onQuestion(rec); err != nil {
+				return err
+			}
+		case agent.EventTypeDone:
+			return nil
+		case agent.EventTypeInterrupted:
+			return exitError(exitInterrupted)
+		case agent.EventTypeError:
+			if s.json {
+				return exitError(1)
+			}
+			return errors.New(rec.Error)
+		case agent.EventTypeProcessEnded:
+			return errors.New("agent process ended")
+		}
+	}
+}
+
+func (s *chatStream) print(rec agent.EventRecord) {
+	out, errOut := s.env.stdout, s.env.stderr
+	switch rec.Type {
+	case agent.EventTypeText, agent.EventTypeCommandOutput:
+		fmt.Fprint(out, rec.Content)
+		if !strings.HasSuffix(rec.Content, "\n") {
+			fmt.Fprintln(out)
+		}
+	case agent.EventTypeToolCall:
+		fmt.Fprintf(out, "[%s] %s\n", rec.ToolName, policy.Subject(rec.ToolName, rec.ToolInput))
+	case agent.EventTypeWarning:
+		fmt.Fprintf(errOut, "warning: %s\n", rec.Message)
+	case agent.EventTypePermissionRequest:
+		fmt.Fprintf(errOut, "permission requested: [%s] %s\n", rec.ToolName, policy.Subject(rec.ToolName, rec.ToolInput))
+	case agent.EventTypePermissionResponse:
+		fmt.Fprintf(errOut, "permission %s%s\n", rec.Choice, answeredBy(rec))
+	case agent.EventTypeQuestionResponse:
+		fmt.Fprintf(errOut, "question answered%s\n", answeredBy(rec))
+	case agent.EventTypeRequestCancelled:
+		fmt.Fprintln(errOut, "request cancelled")
+	}
+}
+
+func answeredBy(rec agent.EventRecord) string {
+	switch {
+	case rec.RuleID != "":
+		return " by rule " + rec.RuleID
+	case rec.Reason != "":
+		return " by " + rec.Reason
+	case rec.User != "":
+		return " by " + rec.User
+	default:
+		return ""
+	}
+}
+
+func (s *chatStream) onPermission(rec agent.EventRecord) error {
+	choice := s.permission
+	if choice == "" && s.env.interactive {
+		var err error
+		if choice, err = s.env.askPermission(); err != nil {
+			return err
+		}
+	}
+	if choice == "" {
+		fmt.Fprintf(s.env.stderr, "waiting for an answer (pockode approve -session %s -request %s)\n", s.sessionID, rec.RequestID)
+		return nil
+	}
+	return s.client.RespondPermission(s.env.ctx, s.sessionID, rec, choice)
+}
+
+func (s *chatStream) onQuestion(rec agent.EventRecord) error {
+	if !s.env.interactive {
+		fmt.Fprintf(s.env.stderr, "waiting for an answer (pockode answer -session %s -request %s)\n", s.sessionID, rec.RequestID)
+		return nil
+	}
+	answers, err := s.env.askQuestions(rec.Questions)
+	if err != nil {
+		return err
+	}
+	return s.client.RespondQuestion(s.env.ctx, s.sessionID, rec, answers)
+}
+
+// interrupt stops the running turn after Ctrl-C.
+func (s *chatStream) interrupt() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.client.Interrupt(ctx, s.sessionID); err != nil {
+		fmt.Fprintf(s.env.stderr, "failed to interrupt: %v\n", err)
+	}
+}
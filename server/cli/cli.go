@@ -0,0 +1,175 @@
+// Package cli implements the headless pockode subcommands. They talk to a
+// running server over the same WebSocket JSON-RPC API as the web app, so
+// they work locally, through the relay and from scripts alike.
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pockode/server/client"
+	"golang.org/x/term"
+)
+
+const (
+	defaultServer = "localhost:9870"
+	dialTimeout   = 10 * time.Second
+)
+
+// exitUsage is returned for invalid invocations, like flag.ExitOnError.
+const exitUsage = 2
+
+// errUsage reports a usage error that was already explained to the user.
+var errUsage = errors.New("usage")
+
+type subcommand struct {
+	name    string
+	summary string
+	run     func(e *env, args []string) error
+}
+
+var commands = []subcommand{
+	{"sessions", "list sessions", runSessions},
+	{"chat", "send a message and stream the reply", runChat},
+	{"approve", "answer a pending permission request", runApprove},
+	{"answer", "answer a pending question", runAnswer},
+}
+
+// IsCommand reports whether name is a CLI subcommand rather than a server flag.
+func IsCommand(name string) bool {
+	return name == "help" || slices.ContainsFunc(commands, func(c subcommand) bool { return c.name == name })
+}
+
+// env carries the process streams and the connection settings shared by all
+// commands.
+type env struct {
+	ctx    context.Context
+	stdin  *bufio.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// interactive is true when stdin is a terminal, so prompts can be answered
+	interactive bool
+
+	server   string
+	token    string
+	worktree string
+}
+
+// flagSet returns a flag set with the connection flags every command accepts.
+func (e *env) flagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet("pockode "+name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.StringVar(&e.server, "server", envOr("POCKODE_SERVER", defaultServer), "server address or URL (env POCKODE_SERVER)")
+	fs.StringVar(&e.token, "token", envOr("POCKODE_TOKEN", os.Getenv("AUTH_TOKEN")), "auth token (env POCKODE_TOKEN or AUTH_TOKEN)")
+	fs.StringVar(&e.worktree, "worktree", os.Getenv("POCKODE_WORKTREE"), "worktree name, empty for the main worktree (env POCKODE_WORKTREE)")
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: pockode %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args, mapping -h and flag errors to errUsage.
+func (e *env) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// dial connects with the parsed connection flags. Commands are short-lived,
+// so a lost connection fails them rather than reconnecting.
+func (e *env) dial() (*client.Client, error) {
+	if e.token == "" {
+		return nil, errors.New("auth token is required (use -token or POCKODE_TOKEN)")
+	}
+	ctx, cancel := context.WithTimeout(e.ctx, dialTimeout)
+	defer cancel()
+	return client.Dial(ctx, e.server, e.token, client.Options{Worktree: e.worktree, DisableReconnect: true})
+}
+
+// Run executes the subcommand named by args[0] and returns the exit code.
+// Interrupting with Ctrl-C cancels the command.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	e := &env{
+		ctx:    ctx,
+		stdin:  bufio.NewReader(stdin),
+		stdout: stdout,
+		stderr: stderr,
+	}
+	if f, ok := stdin.(*os.File); ok {
+		e.interactive = term.IsTerminal(int(f.Fd()))
+	}
+
+	if len(args) == 0 || args[0] == "help" {
+		usage(stderr)
+		return exitUsage
+	}
+
+	i := slices.IndexFunc(commands, func(c subcommand) bool { return c.name == args[0] })
+	if i < 0 {
+		fmt.Fprintf(stderr, "pockode: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	err := commands[i].run(e, args[1:])
+	var exit exitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.As(err, &exit):
+		return int(exit)
+	default:
+		fmt.Fprintf(stderr, "pockode %s: %v\n", args[0], err)
+		return 1
+	}
+}
+
+// exitError ends a command with a specific code and no message.
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit %d", int(e))
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: pockode <command> [flags] [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun without a command to start the server. Use \"pockode <command> -h\" for command flags.")
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// prompt prints question and reads one line from stdin.
+func (e *env) prompt(question string) (string, error) {
+	fmt.Fprint(e.stderr, question)
+	line, err := e.stdin.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/agent/fake"
+	"github.com/pockode/server/auth"
+	"github.com/pockode/server/command"
+	"github.com/pockode/server/search"
+	"github.com/pockode/server/settings"
+	"github.com/pockode/server/worktree"
+	"github.com/pockode/server/ws"
+)
+
+const testToken = "test-token"
+
+// newTestServer starts a server backed by a fake agent playing script.
+func newTestServer(t *testing.T, script fake.Script) string {
+	t.Helper()
+	dataDir := t.TempDir()
+
+	users, err := auth.NewStore(dataDir, testToken)
+	if err != nil {
+		t.Fatalf("failed to create user store: %v", err)
+	}
+	cmdStore, _ := command.NewStore(dataDir)
+	settingsStore, _ := settings.NewStore(dataDir)
+	searchIndex, err := search.Open(dataDir)
+	if err != nil {
+		t.Fatalf("failed to open search index: %v", err)
+	}
+	t.Cleanup(func() { searchIndex.Close() })
+
+	agents := agent.NewRegistry()
+	agents.Register("fake", fake.New(script))
+
+	worktreeManager := worktree.NewManager(worktree.NewRegistry(t.TempDir(), dataDir), agents, dataDir, 10*time.Minute)
+	h := ws.NewRPCHandler(users, "test", true, cmdStore, worktreeManager, settingsStore, agents, searchIndex)
+
+	server := httptest.NewServer(h)
+	t.Cleanup(func() {
+		server.Close()
+		h.Stop()
+		worktreeManager.Shutdown()
+	})
+	return server.URL
+}
+
+// syncBuffer is a bytes.Buffer safe for a command writing while a test reads.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func run(t *testing.T, server, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr syncBuffer
+	code := runWith(server, stdin, &stdout, &stderr, args...)
+	return code, stdout.String(), stderr.String()
+}
+
+func runWith(server, stdin string, stdout, stderr *syncBuffer, args ...string) int {
+	full := append([]string{args[0], "-server", server, "-token", testToken}, args[1:]...)
+	return Run(full, strings.NewReader(stdin), stdout, stderr)
+}
+
+var sessionLine = regexp.MustCompile(`session (\S+)`)
+
+func TestRun_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"bogus"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected usage exit code, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "chat") {
+		t.Errorf("expected usage to list commands, got %q", stderr.String())
+	}
+	if !IsCommand("chat") || IsCommand("-port") {
+		t.Error("IsCommand misclassified arguments")
+	}
+	if code := Run([]string{"chat", "-token", ""}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected usage exit code without a message, got %d", code)
+	}
+}
+
+func TestChat_StreamsReplyAndListsSession(t *testing.T) {
+	server := newTestServer(t, fake.Script{})
+
+	code, stdout, stderr := run(t, server, "", "chat", "hello", "there")
+	if code != 0 {
+		t.Fatalf("chat exited %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "Echo: hello there") {
+		t.Errorf("expected echoed reply, got %q", stdout)
+	}
+	m := sessionLine.FindStringSubmatch(stderr)
+	if m == nil {
+		t.Fatalf("expected new session to be reported, got %q", stderr)
+	}
+
+	// Continue the session with the message read from stdin
+	code, stdout, _ = run(t, server, "again\n", "chat", "-session", m[1], "-json")
+	if code != 0 {
+		t.Fatalf("chat exited %d", code)
+	}
+	var last agent.EventRecord
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	json.Unmarshal([]byte(lines[len(lines)-1]), &last)
+	if last.Type != agent.EventTypeDone {
+		t.Errorf("expected JSON lines ending with done, got %q", stdout)
+	}
+
+	code, stdout, _ = run(t, server, "", "sessions")
+	if code != 0 || !strings.Contains(stdout, m[1]) {
+		t.Errorf("expected session in list, got %d %q", code, stdout)
+	}
+}
+
+func permissionScript() fake.Script {
+	return fake.Script{Turns: []fake.Turn{{Steps: []fake.Step{
+		{EventRecord: agent.EventRecord{Type: agent.EventTypePermissionRequest, RequestID: "req-1", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"make test"}`), ToolUseID: "tool-1"}},
+		{EventRecord: agent.EventRecord{Type: agent.EventTypeText, Content: "tests passed"}},
+		{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}},
+	}}}}
+}
+
+func TestChat_AnswersPermissionAutomatically(t *testing.T) {
+	server := newTestServer(t, permissionScript())
+
+	code, stdout, stderr := run(t, server, "", "chat", "-permission", "allow", "run the tests")
+	if code != 0 {
+		t.Fatalf("chat exited %d: %s", code, stderr)
+	}
+	if !strings.Contains(stderr, "permission requested: [Bash] make test") {
+		t.Errorf("expected permission request to be shown, got %q", stderr)
+	}
+	if !strings.Contains(stdout, "tests passed") {
+		t.Errorf("expected turn to continue after approval, got %q", stdout)
+	}
+}
+
+func TestApprove_AnswersWaitingChat(t *testing.T) {
+	server := newTestServer(t, permissionScript())
+
+	var chatOut, chatErr syncBuffer
+	done := make(chan int, 1)
+	go func() {
+		done <- runWith(server, "", &chatOut, &chatErr, "chat", "run the tests")
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(chatErr.String(), "waiting for an answer") {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for permission request: %q", chatErr.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sessionID := sessionLine.FindStringSubmatch(chatErr.String())[1]
+
+	if code, _, stderr := run(t, server, "", "approve"); code != exitUsage {
+		t.Errorf("expected usage error without -session, got %d %q", code, stderr)
+	}
+	code, stdout, stderr := run(t, server, "", "approve", "-session", sessionID)
+	if code != 0 || !strings.Contains(stdout, "allow [Bash] make test") {
+		t.Fatalf("approve failed: %d %q %q", code, stdout, stderr)
+	}
+
+	select {
+	case code := <-done:
+		if code != 0 || !strings.Contains(chatOut.String(), "tests passed") {
+			t.Errorf("expected chat to finish after approval, got %d %q", code, chatOut.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for chat to finish")
+	}
+
+	if code, _, stderr := run(t, server, "", "approve", "-session", sessionID); code != 1 || !strings.Contains(stderr, "nothing is pending") {
+		t.Errorf("expected nothing pending after approval, got %d %q", code, stderr)
+	}
+}
+
+func TestPendingRequests(t *testing.T) {
+	records := []agent.EventRecord{
+		{Type: agent.EventTypePermissionRequest, RequestID: "old"},
+		{Type: agent.EventTypeDone},
+		{Type: agent.EventTypePermissionRequest, RequestID: "answered"},
+		{Type: agent.EventTypePermissionResponse, RequestID: "answered", Choice: "allow"},
+		{Type: agent.EventTypeAskUserQuestion, RequestID: "question"},
+		{Type: agent.EventTypePermissionRequest, RequestID: "cancelled"},
+		{Type: agent.EventTypeRequestCancelled, RequestID: "cancelled"},
+		{Type: agent.EventTypePermissionRequest, RequestID: "open"},
+	}
+	var history []json.RawMessage
+	for _, r := range records {
+		data, _ := json.Marshal(r)
+		history = append(history, data)
+	}
+
+	var ids []string
+	for _, r := range pendingRequests(history) {
+		ids = append(ids, r.RequestID)
+	}
+	if strings.Join(ids, ",") != "question,open" {
+		t.Errorf("unexpected pending requests: %v", ids)
+	}
+}
+
+func TestPickOptions(t *testing.T) {
+	single := agent.AskUserQuestion{Options: []agent.QuestionOption{{Label: "Red"}, {Label: "Blue"}}}
+	multi := single
+	multi.MultiSelect = true
+
+	tests := []struct {
+		q      agent.AskUserQuestion
+		answer string
+		want   string
+	}{
+		{single, "2", "Blue"},
+		{single, "1,2", "Other: 1,2"},
+		{multi, "1, 2", "Red, Blue"},
+		{single, "3", "Other: 3"},
+		{single, "green", "Other: green"},
+	}
+	for _, tt := range tests {
+		if got := pickOptions(tt.q, tt.answer); got != tt.want {
+			t.Errorf("pickOptions(%q) = %q, want %q", tt.answer, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+)
+
+func runSessions(e *env, args []string) error {
+	fs := e.flagSet("sessions", "[flags]")
+	asJSON := fs.Bool("json", false, "print sessions as JSON")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	c, err := e.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// The list is only available as a subscription snapshot
+	sessions, sub, err := c.SubscribeSessionList(e.ctx)
+	if err != nil {
+		return err
+	}
+	sub.Close()
+
+	if *asJSON {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sessions)
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATE\tUPDATED\tTITLE")
+	for _, s := range sessions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.ID, s.State, s.UpdatedAt.Local().Format(time.DateTime), s.Title)
+	}
+	return tw.Flush()
+}
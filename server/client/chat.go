@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/process"
+	"github.com/pockode/server/rpc"
+)
+
+// ChatEvent is an event of a chat subscription. Record is set for agent
+// events and Resync after a reconnect; when both are nil the event is a
+// change of the session's outbound Queue.
+type ChatEvent struct {
+	Record *agent.EventRecord
+	Seq    int64 // Record's history sequence number, 0 if unknown
+	Queue  []process.QueuedMessage
+
+	// Resync carries the session's state again after a reconnect or missed
+	// events, which are only visible in it. Its History continues the
+	// records seen so far when AfterSeq is nonzero and replaces them
+	// otherwise.
+	Resync *rpc.ChatMessagesSubscribeResult
+}
+
+// SubscribeChat returns a session's history and state and follows its events.
+func (c *Client) SubscribeChat(ctx context.Context, sessionID string) (rpc.ChatMessagesSubscribeResult, *Subscription[ChatEvent], error) {
+	var result rpc.ChatMessagesSubscribeResult
+	var cursor chatCursor
+	sub, err := subscribe(ctx, c, subscribeSpec[ChatEvent]{
+		method:        "chat.messages.subscribe",
+		unsubscribe:   "chat.messages.unsubscribe",
+		params:        rpc.ChatMessagesSubscribeParams{SessionID: sessionID},
+		worktreeBound: true,
+		decode:        cursor.decode,
+		resync: func(result json.RawMessage) (ChatEvent, bool) {
+			r, ok := decodeParams[rpc.ChatMessagesSubscribeResult](result)
+			return ChatEvent{Resync: &r}, ok
+		},
+		resume: func() any {
+			return rpc.ChatMessagesSubscribeParams{SessionID: sessionID, AfterSeq: cursor.last()}
+		},
+		opened: cursor.open,
+		stale:  cursor.stale,
+	}, &result)
+	return result, sub, err
+}
+
+// chatCursor tracks the last history record a chat subscription has seen, to
+// resume after it and to drop events delivered twice.
+type chatCursor struct {
+	mu  sync.Mutex
+	seq int64
+}
+
+func (cur *chatCursor) last() int64 {
+	cur.mu.Lock()
+	defer cur.mu.Unlock()
+	return cur.seq
+}
+
+func (cur *chatCursor) open(result json.RawMessage) {
+	r, _ := decodeParams[rpc.ChatMessagesSubscribeResult](result)
+	cur.mu.Lock()
+	cur.seq = r.Seq
+	cur.mu.Unlock()
+}
+
+// stale reports an event following one the subscription has not seen.
+func (cur *chatCursor) stale(params json.RawMessage) bool {
+	p, _ := decodeParams[rpc.ChatEventParams](params)
+	return p.PrevSeq > cur.last()
+}
+
+func (cur *chatCursor) decode(method string, params json.RawMessage) (ChatEvent, bool) {
+	ev, ok := decodeChatEvent(method, params)
+	if !ok || ev.Seq == 0 {
+		return ev, ok
+	}
+	cur.mu.Lock()
+	defer cur.mu.Unlock()
+	if ev.Seq <= cur.seq {
+		return ev, false
+	}
+	cur.seq = ev.Seq
+	return ev, true
+}
+
+func decodeChatEvent(method string, params json.RawMessage) (ChatEvent, bool) {
+	if method == "chat.queue" {
+		p, ok := decodeParams[rpc.ChatQueueParams](params)
+		return ChatEvent{Queue: p.Queue}, ok
+	}
+	p, ok := decodeParams[rpc.ChatEventParams](params)
+	if !ok {
+		return ChatEvent{}, false
+	}
+	// The event type is carried by the method name
+	p.EventRecord.Type = agent.EventType(strings.TrimPrefix(method, "chat."))
+	return ChatEvent{Record: &p.EventRecord, Seq: p.Seq}, true
+}
+
+// SendMessage sends a user message. The returned queue ID is set when the
+// message was queued behind a running turn.
+func (c *Client) SendMessage(ctx context.Context, sessionID, content string, attachments ...agent.Attachment) (string, error) {
+	var result rpc.MessageResult
+	err := c.Call(ctx, "chat.message", rpc.MessageParams{SessionID: sessionID, Content: content, Attachments: attachments}, &result)
+	return result.QueueID, err
+}
+
+func (c *Client) Interrupt(ctx context.Context, sessionID string) error {
+	return c.Call(ctx, "chat.interrupt", rpc.InterruptParams{SessionID: sessionID}, nil)
+}
+
+func (c *Client) ListQueue(ctx context.Context, sessionID string) ([]process.QueuedMessage, error) {
+	var result rpc.ChatQueueListResult
+	err := c.Call(ctx, "chat.queue.list", rpc.ChatQueueListParams{SessionID: sessionID}, &result)
+	return result.Queue, err
+}
+
+func (c *Client) UpdateQueued(ctx context.Context, sessionID, id, content string) error {
+	return c.Call(ctx, "chat.queue.update", rpc.ChatQueueUpdateParams{SessionID: sessionID, ID: id, Content: content}, nil)
+}
+
+func (c *Client) CancelQueued(ctx context.Context, sessionID, id string) error {
+	return c.Call(ctx, "chat.queue.cancel", rpc.ChatQueueCancelParams{SessionID: sessionID, ID: id}, nil)
+}
+
+// ResumeQueue delivers the next queued message after an interrupt paused the queue.
+func (c *Client) ResumeQueue(ctx context.Context, sessionID string) error {
+	return c.Call(ctx, "chat.queue.resume", rpc.ChatQueueResumeParams{SessionID: sessionID}, nil)
+}
+
+// RespondPermission answers a permission request with "allow",
+// "always_allow" or "deny".
+func (c *Client) RespondPermission(ctx context.Context, sessionID string, req agent.EventRecord, choice string) error {
+	return c.Call(ctx, "chat.permission_response", rpc.PermissionResponseParams{
+		SessionID:             sessionID,
+		RequestID:             req.RequestID,
+		Choice:                choice,
+		ToolInput:             req.ToolInput,
+		ToolUseID:             req.ToolUseID,
+		PermissionSuggestions: req.PermissionSuggestions,
+	}, nil)
+}
+
+// RespondQuestion answers a question request with answers keyed by question
+// text. Nil answers dismiss the question.
+func (c *Client) RespondQuestion(ctx context.Context, sessionID string, req agent.EventRecord, answers map[string]string) error {
+	return c.Call(ctx, "chat.question_response", rpc.QuestionResponseParams{
+		SessionID: sessionID,
+		RequestID: req.RequestID,
+		ToolUseID: req.ToolUseID,
+		Answers:   answers,
+	}, nil)
+}
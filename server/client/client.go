@@ -0,0 +1,550 @@
+// Package client is a Go client for the pockode WebSocket JSON-RPC API.
+//
+// A Client authenticates once, exposes typed methods for each namespace and
+// delivers subscription notifications on typed channels. When the connection
+// drops it reconnects with backoff, authenticates again and renews every open
+// subscription, so long-running tools survive server restarts and relay
+// hiccups.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/pockode/server/rpc"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const (
+	minBackoff   = 250 * time.Millisecond
+	maxBackoff   = 10 * time.Second
+	pingInterval = 30 * time.Second
+	pingTimeout  = 10 * time.Second
+)
+
+// ErrClosed is returned by calls on a closed Client.
+var ErrClosed = errors.New("client closed")
+
+// ErrProtocol is returned by Dial when the server's protocol is too old
+// for this client.
+var ErrProtocol = errors.New("incompatible protocol version")
+
+// Error is an error response from the server.
+type Error struct {
+	Code    int64
+	Message string
+	Data    json.RawMessage // details for some codes, e.g. rpc.GitErrorData
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Options configures a Client. The zero value connects to the main worktree
+// and reconnects automatically.
+type Options struct {
+	// Worktree is the worktree to bind to; empty is the main worktree.
+	Worktree string
+
+	// DisableReconnect closes the Client when the connection drops instead
+	// of reconnecting.
+	DisableReconnect bool
+}
+
+// Notification is a server notification that belongs to no subscription of
+// the Client, such as "worktree.deleted".
+type Notification struct {
+	Method string
+	Params json.RawMessage
+}
+
+// Client is a connection to a pockode server. It is safe for concurrent use.
+type Client struct {
+	endpoint string
+	token    string
+	opts     Options
+
+	notifications *queue[Notification]
+	done          chan struct{}
+
+	mu       sync.Mutex
+	conn     *jsonrpc2.Conn // nil while reconnecting
+	ready    chan struct{}  // closed once conn is set
+	auth     rpc.AuthResult
+	worktree string
+	err      error // why the Client closed
+	closed   bool
+
+	// subs holds open subscriptions, byID the live ones by server ID
+	subs map[*subscription]struct{}
+	byID map[string]*subscription
+
+	// Notifications can overtake the reply of the subscribe call that
+	// created their subscription, so unknown ones are held while a
+	// subscribe is in flight
+	subscribing int
+	held        []Notification
+}
+
+// Dial connects to server ("localhost:9870", "https://host", ...) and
+// authenticates with token.
+func Dial(ctx context.Context, server, token string, opts Options) (*Client, error) {
+	endpoint, err := WebSocketURL(server)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		endpoint:      endpoint,
+		token:         token,
+		opts:          opts,
+		notifications: newQueue[Notification](),
+		done:          make(chan struct{}),
+		ready:         make(chan struct{}),
+		worktree:      opts.Worktree,
+		subs:          make(map[*subscription]struct{}),
+		byID:          make(map[string]*subscription),
+	}
+
+	conn, auth, err := c.connect(ctx, opts.Worktree)
+	if err != nil {
+		c.notifications.close(false)
+		return nil, err
+	}
+	c.setConn(conn, auth)
+	return c, nil
+}
+
+// WebSocketURL turns a server address into its WebSocket endpoint.
+// Addresses without a scheme use plain HTTP.
+func WebSocketURL(server string) (string, error) {
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported server URL scheme %q", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ws"
+	return u.String(), nil
+}
+
+// connect dials and authenticates a new connection bound to worktree.
+func (c *Client) connect(ctx context.Context, worktree string) (*jsonrpc2.Conn, rpc.AuthResult, error) {
+	ws, _, err := websocket.Dial(ctx, c.endpoint, nil)
+	if err != nil {
+		return nil, rpc.AuthResult{}, fmt.Errorf("failed to connect to %s: %w", c.endpoint, err)
+	}
+	ws.SetReadLimit(-1)
+
+	conn := jsonrpc2.NewConn(context.Background(), &webSocketStream{conn: ws}, jsonrpc2.HandlerWithError(c.handle))
+
+	var auth rpc.AuthResult
+	params := rpc.AuthParams{Token: c.token, Worktree: worktree, ProtocolVersion: rpc.ProtocolVersion}
+	if err := call(ctx, conn, "auth", params, &auth); err != nil {
+		conn.Close()
+		return nil, rpc.AuthResult{}, fmt.Errorf("authentication failed: %w", err)
+	}
+	// Servers predating negotiation report no protocol version
+	if auth.ProtocolVersion != 0 && auth.ProtocolVersion < rpc.MinProtocolVersion {
+		conn.Close()
+		return nil, rpc.AuthResult{}, fmt.Errorf("%w: server speaks %d, client needs %d or later", ErrProtocol, auth.ProtocolVersion, rpc.MinProtocolVersion)
+	}
+
+	go c.keepAlive(conn, ws)
+	return conn, auth, nil
+}
+
+// keepAlive pings the server so dead connections are noticed and replaced.
+func (c *Client) keepAlive(conn *jsonrpc2.Conn, ws *websocket.Conn) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-conn.DisconnectNotify():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+			err := ws.Ping(ctx)
+			cancel()
+			if err != nil {
+				slog.Debug("ping failed", "error", err)
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) setConn(conn *jsonrpc2.Conn, auth rpc.AuthResult) {
+	c.mu.Lock()
+	c.conn = conn
+	c.auth = auth
+	close(c.ready)
+	c.mu.Unlock()
+
+	go c.watch(conn)
+}
+
+// watch waits for conn to drop, then reconnects or closes the Client.
+func (c *Client) watch(conn *jsonrpc2.Conn) {
+	select {
+	case <-conn.DisconnectNotify():
+	case <-c.done:
+		return
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.conn = nil
+	c.ready = make(chan struct{})
+	clear(c.byID)
+	c.mu.Unlock()
+
+	if c.opts.DisableReconnect {
+		c.shutdown(errors.New("connection lost"))
+		return
+	}
+	slog.Info("connection lost, reconnecting", "server", c.endpoint)
+	c.reconnect()
+}
+
+// reconnect dials until it succeeds, the token is rejected or the Client
+// is closed, then renews open subscriptions.
+func (c *Client) reconnect() {
+	backoff := minBackoff
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+
+		c.mu.Lock()
+		worktree := c.worktree
+		c.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), maxBackoff)
+		conn, auth, err := c.connect(ctx, worktree)
+		cancel()
+		if err != nil {
+			var rpcErr *Error
+			if errors.As(err, &rpcErr) || errors.Is(err, ErrProtocol) {
+				c.shutdown(err)
+				return
+			}
+			slog.Debug("reconnect failed", "error", err)
+			continue
+		}
+
+		c.resubscribe(conn)
+		c.setConn(conn, auth)
+		slog.Info("reconnected", "server", c.endpoint)
+		return
+	}
+}
+
+// resubscribe renews open subscriptions on conn before it is handed to
+// callers. Subscriptions the server refuses now, for example of a deleted
+// session, end.
+func (c *Client) resubscribe(conn *jsonrpc2.Conn) {
+	c.mu.Lock()
+	subs := make([]*subscription, 0, len(c.subs))
+	for sub := range c.subs {
+		subs = append(subs, sub)
+	}
+	c.subscribing++
+	c.mu.Unlock()
+	defer c.endSubscribing()
+
+	for _, sub := range subs {
+		c.renew(conn, sub)
+	}
+}
+
+// renew subscribes sub again on conn and delivers the result as a resync.
+// It reports false if sub ended instead.
+func (c *Client) renew(conn *jsonrpc2.Conn, sub *subscription) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), maxBackoff)
+	var result json.RawMessage
+	err := call(ctx, conn, sub.method, sub.params(), &result)
+	cancel()
+
+	var id struct {
+		ID string `json:"id"`
+	}
+	if err == nil {
+		err = json.Unmarshal(result, &id)
+	}
+	if err != nil {
+		slog.Warn("failed to renew subscription", "method", sub.method, "error", err)
+		c.remove(sub)
+		sub.end()
+		return false
+	}
+
+	c.mu.Lock()
+	_, open := c.subs[sub]
+	if open {
+		sub.id = id.ID
+		c.byID[id.ID] = sub
+	}
+	c.mu.Unlock()
+	if !open {
+		// Closed while being renewed
+		c.unsubscribe(conn, sub, id.ID)
+		return false
+	}
+	if sub.opened != nil {
+		sub.opened(result)
+	}
+	sub.resync(result)
+	return true
+}
+
+// refresh renews sub on the current connection after it missed
+// notifications. The caller has incremented c.subscribing.
+func (c *Client) refresh(sub *subscription) {
+	c.mu.Lock()
+	conn, oldID := c.conn, sub.id
+	c.mu.Unlock()
+	if conn == nil {
+		// The reconnect renews it
+		c.endSubscribing()
+		return
+	}
+
+	renewed := c.renew(conn, sub)
+	if renewed {
+		c.unsubscribe(conn, sub, oldID)
+	}
+	// Held notifications of the old subscription still reach sub, whose
+	// decoder drops what the renewal already delivered
+	c.endSubscribing()
+	if renewed {
+		c.mu.Lock()
+		delete(c.byID, oldID)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) unsubscribe(conn *jsonrpc2.Conn, sub *subscription, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	call(ctx, conn, sub.unsubscribe, map[string]string{"id": id}, nil)
+}
+
+// handle routes notifications to their subscription by the "id" param.
+func (c *Client) handle(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+	if !req.Notif {
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeMethodNotFound, Message: "client accepts no requests"}
+	}
+
+	n := Notification{Method: req.Method}
+	if req.Params != nil {
+		n.Params = *req.Params
+	}
+	var id struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(n.Params, &id)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id.ID != "" && c.subscribing > 0 {
+		// Hold everything to keep each subscription's notifications in order
+		c.held = append(c.held, n)
+	} else {
+		c.route(n, id.ID)
+	}
+	return nil, nil
+}
+
+// route delivers n to the subscription with id or to Notifications.
+// c.mu must be held.
+func (c *Client) route(n Notification, id string) {
+	if sub := c.byID[id]; sub != nil {
+		if sub.stale != nil && sub.stale(n.Params) {
+			// Hold later notifications until the renewal has caught up
+			c.subscribing++
+			go c.refresh(sub)
+			return
+		}
+		sub.push(n.Method, n.Params)
+	} else {
+		c.notifications.push(n)
+	}
+}
+
+// endSubscribing delivers held notifications once no subscribe is in flight.
+func (c *Client) endSubscribing() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribing--
+	if c.subscribing > 0 {
+		return
+	}
+	for _, n := range c.held {
+		var id struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(n.Params, &id)
+		c.route(n, id.ID)
+	}
+	c.held = nil
+}
+
+// Call invokes method and decodes its result into result, which may be nil.
+// It waits for a reconnect in progress. Use it for methods without a typed
+// wrapper.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	conn, err := c.liveConn(ctx)
+	if err != nil {
+		return err
+	}
+	return call(ctx, conn, method, params, result)
+}
+
+func call(ctx context.Context, conn *jsonrpc2.Conn, method string, params, result any) error {
+	var raw json.RawMessage
+	if err := conn.Call(ctx, method, params, &raw); err != nil {
+		var rpcErr *jsonrpc2.Error
+		if errors.As(err, &rpcErr) {
+			e := &Error{Code: rpcErr.Code, Message: rpcErr.Message}
+			if rpcErr.Data != nil {
+				e.Data = *rpcErr.Data
+			}
+			return e
+		}
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, result)
+}
+
+// liveConn returns the current connection, waiting while reconnecting.
+func (c *Client) liveConn(ctx context.Context) (*jsonrpc2.Conn, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			err := c.err
+			c.mu.Unlock()
+			return nil, err
+		}
+		if c.conn != nil {
+			conn := c.conn
+			c.mu.Unlock()
+			return conn, nil
+		}
+		ready := c.ready
+		c.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Auth returns the result of the latest authentication.
+func (c *Client) Auth() rpc.AuthResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.auth
+}
+
+// HasCapability reports whether the server was started with the optional
+// feature name, such as rpc.CapabilitySchedule.
+func (c *Client) HasCapability(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Contains(c.auth.Capabilities, name)
+}
+
+// Describe returns the server's description of the methods it offers.
+func (c *Client) Describe(ctx context.Context) (rpc.Document, error) {
+	var result rpc.Document
+	err := c.Call(ctx, "rpc.describe", struct{}{}, &result)
+	return result, err
+}
+
+// Notifications delivers notifications that belong to no subscription.
+// The channel is closed when the Client closes.
+func (c *Client) Notifications() <-chan Notification {
+	return c.notifications.out
+}
+
+// Done is closed when the Client closes, by Close or because the connection
+// was lost and could not be restored.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the Client closed, or nil while it is open.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		return nil
+	}
+	return c.err
+}
+
+// Close closes the connection and ends all subscriptions.
+func (c *Client) Close() error {
+	c.shutdown(ErrClosed)
+	return nil
+}
+
+func (c *Client) shutdown(cause error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.err = cause
+	conn := c.conn
+	c.conn = nil
+	subs := c.subs
+	c.subs = make(map[*subscription]struct{})
+	clear(c.byID)
+	close(c.done)
+	c.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+	// Closing by choice drops undelivered notifications; losing the
+	// connection lets readers drain them
+	drain := cause != ErrClosed
+	for sub := range subs {
+		sub.close(drain)
+	}
+	c.notifications.close(drain)
+}
@@ -0,0 +1,374 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/agent/fake"
+	"github.com/pockode/server/auth"
+	"github.com/pockode/server/command"
+	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/search"
+	"github.com/pockode/server/settings"
+	"github.com/pockode/server/worktree"
+	"github.com/pockode/server/ws"
+)
+
+const testToken = "test-token"
+
+func newTestServer(t *testing.T) string {
+	t.Helper()
+	dataDir := t.TempDir()
+
+	users, err := auth.NewStore(dataDir, testToken)
+	if err != nil {
+		t.Fatalf("failed to create user store: %v", err)
+	}
+	cmdStore, _ := command.NewStore(dataDir)
+	settingsStore, _ := settings.NewStore(dataDir)
+	searchIndex, err := search.Open(dataDir)
+	if err != nil {
+		t.Fatalf("failed to open search index: %v", err)
+	}
+	t.Cleanup(func() { searchIndex.Close() })
+
+	agents := agent.NewRegistry()
+	agents.Register("fake", fake.New(fake.Script{}))
+
+	worktreeManager := worktree.NewManager(worktree.NewRegistry(t.TempDir(), dataDir), agents, dataDir, 10*time.Minute)
+	h := ws.NewRPCHandler(users, "test", true, cmdStore, worktreeManager, settingsStore, agents, searchIndex)
+
+	server := httptest.NewServer(h)
+	t.Cleanup(func() {
+		server.Close()
+		h.Stop()
+		worktreeManager.Shutdown()
+	})
+	return server.URL
+}
+
+func dialTest(t *testing.T, server string, opts Options) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, server, testToken, opts)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// next returns the next event of sub or fails after a timeout.
+func next[T any](t *testing.T, sub *Subscription[T]) T {
+	t.Helper()
+	select {
+	case v, ok := <-sub.Events():
+		if !ok {
+			t.Fatal("subscription ended")
+		}
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	panic("unreachable")
+}
+
+// dropConnection closes the current connection as a network failure would
+// and waits until the Client has noticed.
+func dropConnection(t *testing.T, c *Client) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		replaced := c.conn != conn
+		c.mu.Unlock()
+		if replaced {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the connection to drop")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebSocketURL(t *testing.T) {
+	tests := map[string]string{
+		"localhost:9870":          "ws://localhost:9870/ws",
+		"http://127.0.0.1:9870/":  "ws://127.0.0.1:9870/ws",
+		"https://abc.pockode.com": "wss://abc.pockode.com/ws",
+		"ws://host/prefix":        "ws://host/prefix/ws",
+	}
+	for in, want := range tests {
+		if got, err := WebSocketURL(in); err != nil || got != want {
+			t.Errorf("WebSocketURL(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := WebSocketURL("ftp://host"); err == nil {
+		t.Error("expected error for unsupported scheme")
+	}
+}
+
+func TestDial_InvalidToken(t *testing.T) {
+	server := newTestServer(t)
+
+	_, err := Dial(testContext(t), server, "wrong", Options{})
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("expected server error, got %v", err)
+	}
+}
+
+func TestClient_Chat(t *testing.T) {
+	server := newTestServer(t)
+	c := dialTest(t, server, Options{})
+	ctx := testContext(t)
+
+	if c.Auth().User == "" {
+		t.Error("expected auth result to be kept")
+	}
+	if c.HasCapability(rpc.CapabilitySchedule) {
+		t.Error("expected no schedule capability without a scheduler")
+	}
+	doc, err := c.Describe(ctx)
+	if err != nil || doc.Info.ProtocolVersion != rpc.ProtocolVersion {
+		t.Errorf("Describe: %+v, %v", doc.Info, err)
+	}
+
+	sess, err := c.CreateSession(ctx, "")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	history, sub, err := c.SubscribeChat(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("SubscribeChat: %v", err)
+	}
+	defer sub.Close()
+	if len(history.History) != 0 {
+		t.Errorf("expected empty history, got %d records", len(history.History))
+	}
+
+	if _, err := c.SendMessage(ctx, sess.ID, "hi"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	var text string
+	for {
+		ev := next(t, sub)
+		if ev.Record == nil {
+			continue
+		}
+		if ev.Record.Type == agent.EventTypeText {
+			text += ev.Record.Content
+		}
+		if ev.Record.Type == agent.EventTypeDone {
+			break
+		}
+	}
+	if text != "Echo: hi" {
+		t.Errorf("expected echoed reply, got %q", text)
+	}
+
+	_, err = c.SessionConfig(ctx, "missing")
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "session not found" {
+		t.Errorf("expected server error for unknown session, got %v", err)
+	}
+}
+
+func TestClient_ReconnectRenewsSubscriptions(t *testing.T) {
+	server := newTestServer(t)
+	c := dialTest(t, server, Options{})
+	ctx := testContext(t)
+
+	sessions, sub, err := c.SubscribeSessionList(ctx)
+	if err != nil {
+		t.Fatalf("SubscribeSessionList: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("expected no sessions, got %d", len(sessions))
+	}
+
+	dropConnection(t, c)
+
+	// Calls wait for the reconnect
+	created, err := c.CreateSession(ctx, "")
+	if err != nil {
+		t.Fatalf("CreateSession after reconnect: %v", err)
+	}
+
+	if ev := next(t, sub); ev.Operation != "resync" {
+		t.Fatalf("expected resync after reconnect, got %+v", ev)
+	}
+	ev := next(t, sub)
+	if ev.Operation != "create" || ev.Session == nil || ev.Session.ID != created.ID {
+		t.Errorf("expected create event on the renewed subscription, got %+v", ev)
+	}
+
+	if err := sub.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("expected events to be closed")
+	}
+}
+
+func TestClient_ChatResumesAfterReconnect(t *testing.T) {
+	server := newTestServer(t)
+	c := dialTest(t, server, Options{})
+	ctx := testContext(t)
+
+	sess, err := c.CreateSession(ctx, "")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	_, sub, err := c.SubscribeChat(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("SubscribeChat: %v", err)
+	}
+	defer sub.Close()
+
+	if _, err := c.SendMessage(ctx, sess.ID, "hi"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	var last int64
+	for {
+		ev := next(t, sub)
+		if ev.Record == nil {
+			continue
+		}
+		last = ev.Seq
+		if ev.Record.Type == agent.EventTypeDone {
+			break
+		}
+	}
+
+	dropConnection(t, c)
+
+	ev := next(t, sub)
+	if ev.Resync == nil {
+		t.Fatalf("expected resync after reconnect, got %+v", ev)
+	}
+	if last == 0 || ev.Resync.AfterSeq != last || len(ev.Resync.History) != 0 {
+		t.Errorf("expected an empty delta after seq %d, got after_seq=%d with %d records", last, ev.Resync.AfterSeq, len(ev.Resync.History))
+	}
+}
+
+func TestChatCursor(t *testing.T) {
+	cur := chatCursor{seq: 3}
+	event := func(seq, prevSeq int64) json.RawMessage {
+		data, _ := json.Marshal(rpc.ChatEventParams{ID: "s", Seq: seq, PrevSeq: prevSeq})
+		return data
+	}
+
+	if _, ok := cur.decode("chat.text", event(3, 2)); ok {
+		t.Error("expected an already seen event to be dropped")
+	}
+	if ev, ok := cur.decode("chat.text", event(5, 3)); !ok || ev.Seq != 5 {
+		t.Errorf("expected a new event, got %+v, %v", ev, ok)
+	}
+	if cur.stale(event(8, 5)) {
+		t.Error("expected an event following a seen one to be current")
+	}
+	if !cur.stale(event(9, 8)) {
+		t.Error("expected an event following an unseen one to be stale")
+	}
+}
+
+func TestGitErrorData(t *testing.T) {
+	err := error(&Error{Code: rpc.CodeGitError, Message: "merge conflict in a.txt", Data: json.RawMessage(`{"kind":"conflict","files":["a.txt"]}`)})
+	data, ok := GitErrorData(err)
+	if !ok || data.Kind != "conflict" || len(data.Files) != 1 {
+		t.Errorf("expected conflict details, got %+v, %v", data, ok)
+	}
+	if _, ok := GitErrorData(&Error{Code: -32603, Message: "boom"}); ok {
+		t.Error("expected other errors to carry no git details")
+	}
+}
+
+func TestClient_DisableReconnect(t *testing.T) {
+	server := newTestServer(t)
+	c := dialTest(t, server, Options{DisableReconnect: true})
+	ctx := testContext(t)
+
+	_, sub, err := c.SubscribeSessionList(ctx)
+	if err != nil {
+		t.Fatalf("SubscribeSessionList: %v", err)
+	}
+
+	dropConnection(t, c)
+
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for client to close")
+	}
+	if c.Err() == nil {
+		t.Error("expected close reason")
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("expected subscription to end with the connection")
+	}
+	if _, err := c.ListAgents(ctx); err == nil {
+		t.Error("expected calls to fail after close")
+	}
+}
+
+func TestClient_Notifications(t *testing.T) {
+	server := newTestServer(t)
+	c := dialTest(t, server, Options{})
+	ctx := testContext(t)
+
+	// A subscription made through Call has no typed channel
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := c.Call(ctx, "session.list.subscribe", struct{}{}, &result); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if _, err := c.CreateSession(ctx, ""); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	select {
+	case n := <-c.Notifications():
+		if n.Method != "session.list.changed" {
+			t.Errorf("unexpected notification %q", n.Method)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for notification")
+	}
+}
+
+func TestQueue_DrainsOnClose(t *testing.T) {
+	q := newQueue[int]()
+	for i := range 3 {
+		q.push(i)
+	}
+	q.close(true)
+	q.push(3)
+
+	var got []int
+	for v := range q.out {
+		got = append(got, v)
+	}
+	if len(got) != 3 || got[2] != 2 {
+		t.Errorf("expected pushed items before close, got %v", got)
+	}
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/pockode/server/git"
+	"github.com/pockode/server/rpc"
+)
+
+// GetFile returns a file or the entries of a directory in the current
+// worktree. Path is relative to the worktree root.
+func (c *Client) GetFile(ctx context.Context, path string) (rpc.FileGetResult, error) {
+	var result rpc.FileGetResult
+	err := c.Call(ctx, "file.get", rpc.FileGetParams{Path: path}, &result)
+	return result, err
+}
+
+func (c *Client) WriteFile(ctx context.Context, path, content string) error {
+	return c.Call(ctx, "file.write", rpc.FileWriteParams{Path: path, Content: content}, nil)
+}
+
+// SubscribeFS signals changes below path. Events carry no details; fetch
+// the path again to see what changed.
+func (c *Client) SubscribeFS(ctx context.Context, path string) (*Subscription[struct{}], error) {
+	return subscribe(ctx, c, changeSpec("fs.subscribe", "fs.unsubscribe", rpc.FSSubscribeParams{Path: path}, true), nil)
+}
+
+func (c *Client) GitStatus(ctx context.Context) (git.GitStatus, error) {
+	var result git.GitStatus
+	err := c.Call(ctx, "git.status", struct{}{}, &result)
+	return result, err
+}
+
+// GitAdd stages paths.
+func (c *Client) GitAdd(ctx context.Context, paths ...string) error {
+	return c.Call(ctx, "git.add", rpc.GitPathsParams{Paths: paths}, nil)
+}
+
+// GitReset unstages paths.
+func (c *Client) GitReset(ctx context.Context, paths ...string) error {
+	return c.Call(ctx, "git.reset", rpc.GitPathsParams{Paths: paths}, nil)
+}
+
+// GitStageHunks stages the selected hunks of path's unstaged diff. hash is
+// GitDiff.Hash of the diff the selection was made against.
+func (c *Client) GitStageHunks(ctx context.Context, path, hash string, hunks []git.HunkSelection) error {
+	return c.Call(ctx, "git.hunk.stage", rpc.GitHunksParams{Path: path, Hash: hash, Hunks: hunks}, nil)
+}
+
+// GitUnstageHunks unstages the selected hunks of path's staged diff.
+func (c *Client) GitUnstageHunks(ctx context.Context, path, hash string, hunks []git.HunkSelection) error {
+	return c.Call(ctx, "git.hunk.unstage", rpc.GitHunksParams{Path: path, Hash: hash, Hunks: hunks}, nil)
+}
+
+// GitDiscardHunks reverts the selected hunks of path's unstaged diff in the
+// worktree, keeping a copy of the file that GitRestoreDiscard can bring back.
+func (c *Client) GitDiscardHunks(ctx context.Context, path, hash string, hunks []git.HunkSelection) (git.TrashEntry, error) {
+	var result git.TrashEntry
+	err := c.Call(ctx, "git.hunk.discard", rpc.GitHunksParams{Path: path, Hash: hash, Hunks: hunks}, &result)
+	return result, err
+}
+
+// GitDiscard throws away the changes to paths, keeping a copy that
+// GitRestoreDiscard can bring back. staged resets the index to HEAD too.
+func (c *Client) GitDiscard(ctx context.Context, paths []string, staged bool) (git.TrashEntry, error) {
+	var result git.TrashEntry
+	err := c.Call(ctx, "git.discard", rpc.GitDiscardParams{Paths: paths, Staged: staged}, &result)
+	return result, err
+}
+
+func (c *Client) GitRestoreDiscard(ctx context.Context, id string) (git.TrashEntry, error) {
+	var result git.TrashEntry
+	err := c.Call(ctx, "git.discard.restore", rpc.GitDiscardRestoreParams{ID: id}, &result)
+	return result, err
+}
+
+// GitDiscards lists the discards that can be restored, newest first.
+func (c *Client) GitDiscards(ctx context.Context) ([]git.TrashEntry, error) {
+	var result rpc.GitDiscardListResult
+	err := c.Call(ctx, "git.discard.list", struct{}{}, &result)
+	return result.Entries, err
+}
+
+// GitCommit commits the staged changes and returns the commit hash.
+func (c *Client) GitCommit(ctx context.Context, opts git.CommitOptions) (string, error) {
+	var result rpc.GitCommitResult
+	err := c.Call(ctx, "git.commit", rpc.GitCommitParams{Message: opts.Message, Amend: opts.Amend, SignOff: opts.SignOff}, &result)
+	return result.Hash, err
+}
+
+// GitLog returns a page of commits from HEAD, newest first, optionally
+// limited to those touching params.Path.
+func (c *Client) GitLog(ctx context.Context, params rpc.GitLogParams) (rpc.GitLogResult, error) {
+	var result rpc.GitLogResult
+	err := c.Call(ctx, "git.log", params, &result)
+	return result, err
+}
+
+// GitShow returns the commit rev with its per-file diffs; a non-empty path
+// limits the diffs to that file.
+func (c *Client) GitShow(ctx context.Context, rev, path string) (git.CommitDetail, error) {
+	var result git.CommitDetail
+	err := c.Call(ctx, "git.show", rpc.GitShowParams{Rev: rev, Path: path}, &result)
+	return result, err
+}
+
+// GitBlame blames path at rev, or the worktree file when rev is empty.
+func (c *Client) GitBlame(ctx context.Context, path, rev string) (git.Blame, error) {
+	var result git.Blame
+	err := c.Call(ctx, "git.blame", rpc.GitBlameParams{Path: path, Rev: rev}, &result)
+	return result, err
+}
+
+func (c *Client) GitBranches(ctx context.Context) ([]git.Branch, error) {
+	var result rpc.GitBranchListResult
+	err := c.Call(ctx, "git.branch.list", struct{}{}, &result)
+	return result.Branches, err
+}
+
+// GitCreateBranch creates a branch at startPoint, or HEAD when empty.
+func (c *Client) GitCreateBranch(ctx context.Context, name, startPoint string, checkout bool) error {
+	return c.Call(ctx, "git.branch.create", rpc.GitBranchCreateParams{Name: name, StartPoint: startPoint, Checkout: checkout}, nil)
+}
+
+func (c *Client) GitCheckout(ctx context.Context, name string) error {
+	return c.Call(ctx, "git.branch.checkout", rpc.GitBranchCheckoutParams{Name: name}, nil)
+}
+
+func (c *Client) GitDeleteBranch(ctx context.Context, name string, force bool) error {
+	return c.Call(ctx, "git.branch.delete", rpc.GitBranchDeleteParams{Name: name, Force: force}, nil)
+}
+
+func (c *Client) GitFetch(ctx context.Context) error {
+	return c.Call(ctx, "git.fetch", struct{}{}, nil)
+}
+
+// GitPull rebases the current branch onto its upstream.
+func (c *Client) GitPull(ctx context.Context) error {
+	return c.Call(ctx, "git.pull", struct{}{}, nil)
+}
+
+func (c *Client) GitPush(ctx context.Context, forceWithLease bool) error {
+	return c.Call(ctx, "git.push", rpc.GitPushParams{ForceWithLease: forceWithLease}, nil)
+}
+
+// GitErrorData returns the details of a git failure the user can act on,
+// such as a conflict or a rejected push.
+func GitErrorData(err error) (rpc.GitErrorData, bool) {
+	var rpcErr *Error
+	var data rpc.GitErrorData
+	if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeGitError {
+		return data, false
+	}
+	return data, json.Unmarshal(rpcErr.Data, &data) == nil
+}
+
+// SubscribeGit signals changes of the git status.
+func (c *Client) SubscribeGit(ctx context.Context) (*Subscription[struct{}], error) {
+	return subscribe(ctx, c, changeSpec("git.subscribe", "git.unsubscribe", struct{}{}, true), nil)
+}
+
+// GitDiff is the diff of one file with both sides of it.
+type GitDiff struct {
+	Diff       string `json:"diff"`
+	OldContent string `json:"old_content"`
+	NewContent string `json:"new_content"`
+	Hash       string `json:"hash"` // identifies Diff for the hunk methods
+}
+
+// SubscribeGitDiff returns the diff of path, staged or unstaged, and follows
+// changes to it.
+func (c *Client) SubscribeGitDiff(ctx context.Context, path string, staged bool) (GitDiff, *Subscription[GitDiff], error) {
+	var result GitDiff
+	decode := func(_ string, params json.RawMessage) (GitDiff, bool) {
+		return decodeParams[GitDiff](params)
+	}
+	sub, err := subscribe(ctx, c, subscribeSpec[GitDiff]{
+		method:        "git.diff.subscribe",
+		unsubscribe:   "git.diff.unsubscribe",
+		params:        rpc.GitDiffSubscribeParams{Path: path, Staged: staged},
+		worktreeBound: true,
+		decode:        decode,
+		resync:        func(result json.RawMessage) (GitDiff, bool) { return decode("", result) },
+	}, &result)
+	return result, sub, err
+}
+
+// changeSpec describes a subscription whose notifications only signal a
+// change. A renewal after reconnect is reported as a change too.
+func changeSpec(method, unsubscribe string, params any, worktreeBound bool) subscribeSpec[struct{}] {
+	return subscribeSpec[struct{}]{
+		method:        method,
+		unsubscribe:   unsubscribe,
+		params:        params,
+		worktreeBound: worktreeBound,
+		decode:        func(string, json.RawMessage) (struct{}, bool) { return struct{}{}, true },
+		resync:        func(json.RawMessage) (struct{}, bool) { return struct{}{}, true },
+	}
+}
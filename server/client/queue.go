@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/coder/websocket"
+)
+
+// queue is an unbounded channel. Pushing never blocks, so a slow reader
+// cannot stall the connection's read loop, which also delivers call results.
+type queue[T any] struct {
+	out chan T
+
+	mu     sync.Mutex
+	items  []T
+	closed bool
+	wake   chan struct{}
+	drop   chan struct{} // closed to stop delivering
+}
+
+func newQueue[T any]() *queue[T] {
+	q := &queue[T]{
+		out:  make(chan T),
+		wake: make(chan struct{}, 1),
+		drop: make(chan struct{}),
+	}
+	go q.deliver()
+	return q
+}
+
+func (q *queue[T]) push(v T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.items = append(q.items, v)
+	q.signal()
+}
+
+// close closes out once the items pushed so far are delivered, or right
+// away if drain is false.
+func (q *queue[T]) close(drain bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	if !drain {
+		close(q.drop)
+	}
+	q.signal()
+}
+
+func (q *queue[T]) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue[T]) deliver() {
+	defer close(q.out)
+	for {
+		q.mu.Lock()
+		batch, closed := q.items, q.closed
+		q.items = nil
+		q.mu.Unlock()
+
+		for _, v := range batch {
+			select {
+			case q.out <- v:
+			case <-q.drop:
+				return
+			}
+		}
+		if len(batch) > 0 {
+			continue
+		}
+		if closed {
+			return
+		}
+
+		select {
+		case <-q.wake:
+		case <-q.drop:
+			return
+		}
+	}
+}
+
+// webSocketStream adapts coder/websocket to jsonrpc2.ObjectStream.
+type webSocketStream struct {
+	conn *websocket.Conn
+	mu   sync.Mutex // protects writes
+}
+
+func (s *webSocketStream) ReadObject(v any) error {
+	_, data, err := s.conn.Read(context.Background())
+	if err != nil {
+		switch websocket.CloseStatus(err) {
+		case websocket.StatusNormalClosure, websocket.StatusGoingAway:
+			return io.EOF
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *webSocketStream) WriteObject(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Write(context.Background(), websocket.MessageText, data)
+}
+
+func (s *webSocketStream) Close() error {
+	return s.conn.Close(websocket.StatusNormalClosure, "")
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/search"
+	"github.com/pockode/server/session"
+)
+
+// CreateSession creates a session in the current worktree. An empty agent
+// uses the server default.
+func (c *Client) CreateSession(ctx context.Context, agent string) (rpc.SessionListItem, error) {
+	var result rpc.SessionListItem
+	err := c.Call(ctx, "session.create", rpc.SessionCreateParams{Agent: agent}, &result)
+	return result, err
+}
+
+func (c *Client) DeleteSession(ctx context.Context, sessionID string) error {
+	return c.Call(ctx, "session.delete", rpc.SessionDeleteParams{SessionID: sessionID}, nil)
+}
+
+func (c *Client) UpdateSessionTitle(ctx context.Context, sessionID, title string) error {
+	return c.Call(ctx, "session.update_title", rpc.SessionUpdateTitleParams{SessionID: sessionID, Title: title}, nil)
+}
+
+func (c *Client) SetSessionMode(ctx context.Context, sessionID string, mode session.Mode) error {
+	return c.Call(ctx, "session.set_mode", rpc.SessionSetModeParams{SessionID: sessionID, Mode: mode}, nil)
+}
+
+func (c *Client) SetSessionAgent(ctx context.Context, sessionID, agent string) error {
+	return c.Call(ctx, "session.set_agent", rpc.SessionSetAgentParams{SessionID: sessionID, Agent: agent}, nil)
+}
+
+func (c *Client) SetSessionMuted(ctx context.Context, sessionID string, muted bool) error {
+	return c.Call(ctx, "session.set_muted", rpc.SessionSetMutedParams{SessionID: sessionID, Muted: muted}, nil)
+}
+
+func (c *Client) SessionConfig(ctx context.Context, sessionID string) (session.AgentConfig, error) {
+	var result session.AgentConfig
+	err := c.Call(ctx, "session.get_config", rpc.SessionGetConfigParams{SessionID: sessionID}, &result)
+	return result, err
+}
+
+func (c *Client) SetSessionConfig(ctx context.Context, sessionID string, config session.AgentConfig) error {
+	return c.Call(ctx, "session.set_config", rpc.SessionSetConfigParams{SessionID: sessionID, Config: config}, nil)
+}
+
+// ForkSession copies a session's history up to and including record index
+// into a new session. A nil index copies the whole history.
+func (c *Client) ForkSession(ctx context.Context, sessionID string, index *int) (rpc.SessionListItem, error) {
+	var result rpc.SessionListItem
+	err := c.Call(ctx, "session.fork", rpc.SessionForkParams{SessionID: sessionID, Index: index}, &result)
+	return result, err
+}
+
+// ExportSession renders a session as "markdown", "html" or "json".
+func (c *Client) ExportSession(ctx context.Context, sessionID, format string) (rpc.SessionExportResult, error) {
+	var result rpc.SessionExportResult
+	err := c.Call(ctx, "session.export", rpc.SessionExportParams{SessionID: sessionID, Format: format}, &result)
+	return result, err
+}
+
+// ImportSession creates a session from a "json" export bundle.
+func (c *Client) ImportSession(ctx context.Context, bundle json.RawMessage) (rpc.SessionListItem, error) {
+	var result rpc.SessionListItem
+	err := c.Call(ctx, "session.import", rpc.SessionImportParams{Bundle: bundle}, &result)
+	return result, err
+}
+
+func (c *Client) ApprovePlan(ctx context.Context, params rpc.SessionApprovePlanParams) error {
+	return c.Call(ctx, "session.approve_plan", params, nil)
+}
+
+func (c *Client) SearchSessions(ctx context.Context, params rpc.SessionSearchParams) ([]search.Result, error) {
+	var result rpc.SessionSearchResult
+	err := c.Call(ctx, "session.search", params, &result)
+	return result.Results, err
+}
+
+// SessionListEvent is a change to the session list. After a reconnect a
+// "resync" event carries the whole list again.
+type SessionListEvent struct {
+	Operation string               // "create", "update", "delete" or "resync"
+	Session   *rpc.SessionListItem // set for "create" and "update"
+	SessionID string               // set for "delete"
+	Sessions  []rpc.SessionListItem
+}
+
+// SubscribeSessionList returns the current worktree's sessions and follows
+// changes to them.
+func (c *Client) SubscribeSessionList(ctx context.Context) ([]rpc.SessionListItem, *Subscription[SessionListEvent], error) {
+	var result rpc.SessionListSubscribeResult
+	sub, err := subscribe(ctx, c, subscribeSpec[SessionListEvent]{
+		method:        "session.list.subscribe",
+		unsubscribe:   "session.list.unsubscribe",
+		params:        struct{}{},
+		worktreeBound: true,
+		decode: func(_ string, params json.RawMessage) (SessionListEvent, bool) {
+			p, ok := decodeParams[rpc.SessionListChangedParams](params)
+			return SessionListEvent{Operation: p.Operation, Session: p.Session, SessionID: p.SessionID}, ok
+		},
+		resync: func(result json.RawMessage) (SessionListEvent, bool) {
+			r, ok := decodeParams[rpc.SessionListSubscribeResult](result)
+			return SessionListEvent{Operation: "resync", Sessions: r.Sessions}, ok
+		},
+	}, &result)
+	return result.Sessions, sub, err
+}
+
+// SessionCheckpoints lists the worktree snapshots taken before each turn of
+// a session, oldest first.
+func (c *Client) SessionCheckpoints(ctx context.Context, sessionID string) ([]rpc.SessionCheckpoint, error) {
+	var result rpc.SessionCheckpointsResult
+	err := c.Call(ctx, "session.checkpoints", rpc.SessionCheckpointsParams{SessionID: sessionID}, &result)
+	return result.Checkpoints, err
+}
+
+// RollbackSession restores the worktree to a checkpoint and returns the
+// checkpoint of the state it replaced.
+func (c *Client) RollbackSession(ctx context.Context, sessionID, checkpointID string) (string, error) {
+	var result rpc.SessionRollbackResult
+	err := c.Call(ctx, "session.rollback", rpc.SessionRollbackParams{SessionID: sessionID, CheckpointID: checkpointID}, &result)
+	return result.Backup, err
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pockode/server/command"
+	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/settings"
+)
+
+// SubscribeSettings returns the server settings and follows changes to them.
+func (c *Client) SubscribeSettings(ctx context.Context) (settings.Settings, *Subscription[settings.Settings], error) {
+	var result rpc.SettingsSubscribeResult
+	sub, err := subscribe(ctx, c, subscribeSpec[settings.Settings]{
+		method:      "settings.subscribe",
+		unsubscribe: "settings.unsubscribe",
+		params:      struct{}{},
+		decode: func(_ string, params json.RawMessage) (settings.Settings, bool) {
+			p, ok := decodeParams[rpc.SettingsChangedParams](params)
+			return p.Settings, ok
+		},
+		resync: func(result json.RawMessage) (settings.Settings, bool) {
+			r, ok := decodeParams[rpc.SettingsSubscribeResult](result)
+			return r.Settings, ok
+		},
+	}, &result)
+	return result.Settings, sub, err
+}
+
+func (c *Client) UpdateSettings(ctx context.Context, s settings.Settings) error {
+	return c.Call(ctx, "settings.update", rpc.SettingsUpdateParams{Settings: s}, nil)
+}
+
+func (c *Client) ListCommands(ctx context.Context) ([]command.Command, error) {
+	var result rpc.CommandListResult
+	err := c.Call(ctx, "command.list", struct{}{}, &result)
+	return result.Commands, err
+}
+
+func (c *Client) ListAgents(ctx context.Context) ([]rpc.AgentInfo, error) {
+	var result rpc.AgentListResult
+	err := c.Call(ctx, "agent.list", struct{}{}, &result)
+	return result.Agents, err
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// subscription is the untyped state of an open subscription, kept to renew
+// it after a reconnect.
+type subscription struct {
+	method      string // subscribe method, e.g. "git.subscribe"
+	unsubscribe string
+	params      func() any
+
+	// worktreeBound subscriptions end when the Client switches worktrees
+	worktreeBound bool
+
+	id string // server-side ID on the current connection, guarded by Client.mu
+
+	push   func(method string, params json.RawMessage)
+	resync func(result json.RawMessage)
+	close  func(drain bool)
+
+	opened func(result json.RawMessage)
+	stale  func(params json.RawMessage) bool
+}
+
+// end closes the subscription's channel after pending events are read.
+func (s *subscription) end() {
+	s.close(true)
+}
+
+// Subscription delivers the notifications of one server-side subscription
+// as typed events.
+type Subscription[T any] struct {
+	c      *Client
+	sub    *subscription
+	events *queue[T]
+}
+
+// Events delivers the subscription's events. It is closed when the
+// subscription ends: by Close, when the Client closes, when a worktree switch
+// drops it or when it cannot be renewed after a reconnect.
+func (s *Subscription[T]) Events() <-chan T {
+	return s.events.out
+}
+
+// Close unsubscribes and closes Events.
+func (s *Subscription[T]) Close() error {
+	id, ok := s.c.remove(s.sub)
+	s.events.close(false)
+	if !ok || id == "" {
+		return nil
+	}
+
+	s.c.mu.Lock()
+	conn := s.c.conn
+	s.c.mu.Unlock()
+	if conn == nil {
+		// The server dropped the subscription with the connection
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return call(ctx, conn, s.sub.unsubscribe, map[string]string{"id": id}, nil)
+}
+
+// remove forgets sub and returns its current server ID. It reports false if
+// sub had already ended.
+func (c *Client) remove(sub *subscription) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.subs[sub]; !ok {
+		return "", false
+	}
+	delete(c.subs, sub)
+	id := sub.id
+	if c.byID[id] == sub {
+		delete(c.byID, id)
+	}
+	return id, true
+}
+
+// subscribeSpec describes how to open a subscription and decode its
+// notifications. decode and resync report false to skip a notification.
+type subscribeSpec[T any] struct {
+	method        string
+	unsubscribe   string
+	params        any
+	worktreeBound bool
+
+	decode func(method string, params json.RawMessage) (T, bool)
+	resync func(result json.RawMessage) (T, bool)
+
+	// resume optionally replaces params when the subscription is renewed
+	resume func() any
+	// opened, if set, sees every subscribe result before its notifications
+	opened func(result json.RawMessage)
+	// stale, if set, reports a notification showing that earlier ones were
+	// missed; the subscription is then renewed instead
+	stale func(params json.RawMessage) bool
+}
+
+// subscribe opens a subscription and decodes the subscribe result into
+// result, which may be nil.
+func subscribe[T any](ctx context.Context, c *Client, spec subscribeSpec[T], result any) (*Subscription[T], error) {
+	conn, err := c.liveConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.subscribing++
+	c.mu.Unlock()
+	defer c.endSubscribing()
+
+	var raw json.RawMessage
+	if err := call(ctx, conn, spec.method, spec.params, &raw); err != nil {
+		return nil, err
+	}
+	var id struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return nil, err
+	}
+	if result != nil {
+		if err := json.Unmarshal(raw, result); err != nil {
+			return nil, err
+		}
+	}
+	if spec.opened != nil {
+		spec.opened(raw)
+	}
+
+	params := spec.resume
+	if params == nil {
+		params = func() any { return spec.params }
+	}
+	events := newQueue[T]()
+	sub := &subscription{
+		method:        spec.method,
+		unsubscribe:   spec.unsubscribe,
+		params:        params,
+		worktreeBound: spec.worktreeBound,
+		id:            id.ID,
+		push: func(method string, params json.RawMessage) {
+			if v, ok := spec.decode(method, params); ok {
+				events.push(v)
+			}
+		},
+		resync: func(result json.RawMessage) {
+			if v, ok := spec.resync(result); ok {
+				events.push(v)
+			}
+		},
+		close:  events.close,
+		opened: spec.opened,
+		stale:  spec.stale,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != conn {
+		// The connection was replaced before the subscription could be
+		// recorded for renewal
+		events.close(false)
+		if c.closed {
+			return nil, c.err
+		}
+		return nil, errors.New("connection lost while subscribing")
+	}
+	c.subs[sub] = struct{}{}
+	c.byID[id.ID] = sub
+	return &Subscription[T]{c: c, sub: sub, events: events}, nil
+}
+
+// endWorktreeSubscriptions ends subscriptions the server dropped when the
+// connection switched worktrees.
+func (c *Client) endWorktreeSubscriptions() {
+	c.mu.Lock()
+	var ended []*subscription
+	for sub := range c.subs {
+		if sub.worktreeBound {
+			ended = append(ended, sub)
+			delete(c.subs, sub)
+			delete(c.byID, sub.id)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, sub := range ended {
+		sub.end()
+	}
+}
+
+// decodeParams decodes notification params into a T.
+func decodeParams[T any](params json.RawMessage) (T, bool) {
+	var v T
+	if err := json.Unmarshal(params, &v); err != nil {
+		return v, false
+	}
+	return v, true
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+
+	"github.com/pockode/server/rpc"
+)
+
+func (c *Client) ListWorktrees(ctx context.Context) ([]rpc.WorktreeInfo, error) {
+	var result rpc.WorktreeListResult
+	err := c.Call(ctx, "worktree.list", struct{}{}, &result)
+	return result.Worktrees, err
+}
+
+func (c *Client) CreateWorktree(ctx context.Context, params rpc.WorktreeCreateParams) (rpc.WorktreeInfo, error) {
+	var result rpc.WorktreeCreateResult
+	err := c.Call(ctx, "worktree.create", params, &result)
+	return result.Worktree, err
+}
+
+func (c *Client) DeleteWorktree(ctx context.Context, name string) error {
+	return c.Call(ctx, "worktree.delete", rpc.WorktreeDeleteParams{Name: name}, nil)
+}
+
+// SwitchWorktree binds the connection to another worktree ("" = main), also
+// for later reconnects. Subscriptions of the previous worktree end.
+func (c *Client) SwitchWorktree(ctx context.Context, name string) (rpc.WorktreeSwitchResult, error) {
+	var result rpc.WorktreeSwitchResult
+	if err := c.Call(ctx, "worktree.switch", rpc.WorktreeSwitchParams{Name: name}, &result); err != nil {
+		return result, err
+	}
+
+	c.mu.Lock()
+	changed := c.worktree != result.WorktreeName
+	c.worktree = result.WorktreeName
+	c.auth.WorkDir = result.WorkDir
+	c.auth.WorktreeName = result.WorktreeName
+	c.mu.Unlock()
+
+	if changed {
+		c.endWorktreeSubscriptions()
+	}
+	return result, nil
+}
+
+// SubscribeWorktrees signals changes of the worktree list.
+func (c *Client) SubscribeWorktrees(ctx context.Context) (*Subscription[struct{}], error) {
+	return subscribe(ctx, c, changeSpec("worktree.subscribe", "worktree.unsubscribe", struct{}{}, false), nil)
+}
@@ -0,0 +1,86 @@
+// Package export renders session histories as Markdown, standalone HTML, or
+// a versioned JSON bundle that another server can import.
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/session"
+)
+
+// BundleVersion is the bundle format written by this server. Bundles with a
+// higher version are rejected on import.
+const BundleVersion = 1
+
+// Bundle is a portable copy of a session: its settings and raw history.
+type Bundle struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Session    BundleSession     `json:"session"`
+	History    []json.RawMessage `json:"history"`
+}
+
+// BundleSession is the subset of session metadata that travels with a bundle.
+// Usage is informational; imports do not add it to the target's totals.
+type BundleSession struct {
+	ID        string              `json:"id"`
+	Title     string              `json:"title"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Mode      session.Mode        `json:"mode"`
+	Agent     string              `json:"agent,omitempty"`
+	Config    session.AgentConfig `json:"config,omitzero"`
+	Usage     session.Usage       `json:"usage,omitzero"`
+}
+
+func NewBundle(meta session.SessionMeta, history []json.RawMessage, exportedAt time.Time) Bundle {
+	if history == nil {
+		history = []json.RawMessage{}
+	}
+	return Bundle{
+		Version:    BundleVersion,
+		ExportedAt: exportedAt,
+		Session: BundleSession{
+			ID:        meta.ID,
+			Title:     meta.Title,
+			CreatedAt: meta.CreatedAt,
+			UpdatedAt: meta.UpdatedAt,
+			Mode:      meta.Mode,
+			Agent:     meta.Agent,
+			Config:    meta.Config,
+			Usage:     meta.Usage,
+		},
+		History: history,
+	}
+}
+
+// ParseBundle decodes and validates a bundle. Errors are user-facing.
+func ParseBundle(data []byte) (Bundle, error) {
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return Bundle{}, errors.New("bundle is not valid JSON")
+	}
+	if b.Version < 1 {
+		return Bundle{}, errors.New("bundle has no version")
+	}
+	if b.Version > BundleVersion {
+		return Bundle{}, fmt.Errorf("bundle version %d is newer than supported version %d", b.Version, BundleVersion)
+	}
+	if b.Session.Mode != "" && !b.Session.Mode.IsValid() {
+		return Bundle{}, fmt.Errorf("bundle has unknown mode %q", b.Session.Mode)
+	}
+	if err := b.Session.Config.Validate(); err != nil {
+		return Bundle{}, fmt.Errorf("bundle config: %w", err)
+	}
+	for i, raw := range b.History {
+		var record agent.EventRecord
+		if err := json.Unmarshal(raw, &record); err != nil || record.Type == "" {
+			return Bundle{}, fmt.Errorf("history record %d is not an event record", i)
+		}
+	}
+	return b, nil
+}
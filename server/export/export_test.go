@@ -0,0 +1,196 @@
+package export
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/session"
+)
+
+var now = time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+
+func testHistory(t *testing.T) []json.RawMessage {
+	t.Helper()
+	events := []agent.AgentEvent{
+		agent.MessageEvent{Content: "rename foo to bar"},
+		agent.TextEvent{Content: "Renaming now."},
+		agent.ToolCallEvent{ToolName: "Edit", ToolUseID: "t1", ToolInput: json.RawMessage(`{"file_path":"main.go","old_string":"foo()","new_string":"bar()"}`)},
+		agent.ToolResultEvent{ToolUseID: "t1", ToolResult: "ok"},
+		agent.ToolCallEvent{ToolName: "Bash", ToolUseID: "t2", ToolInput: json.RawMessage(`{"command":"go test"}`)},
+		agent.ToolResultEvent{ToolUseID: "t2", ToolResult: "PASS <all>"},
+		agent.DoneEvent{},
+	}
+	history := make([]json.RawMessage, len(events))
+	for i, e := range events {
+		data, err := json.Marshal(agent.NewEventRecord(e))
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		history[i] = data
+	}
+	return history
+}
+
+func testMeta() session.SessionMeta {
+	return session.SessionMeta{
+		ID:        "sess-1",
+		Title:     "Rename foo/bar",
+		CreatedAt: now.Add(-time.Hour),
+		UpdatedAt: now,
+		Mode:      session.ModeDefault,
+		Agent:     "claude",
+		Config:    session.AgentConfig{Model: "opus"},
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	md := Markdown(testMeta(), testHistory(t), now)
+
+	for _, want := range []string{
+		"# Rename foo/bar\n",
+		"## User\n\nrename foo to bar\n",
+		"## Assistant\n\nRenaming now.\n",
+		"<summary>Tool: Edit</summary>",
+		"```diff\n--- main.go\n+++ main.go\n-foo()\n+bar()\n```",
+		"```json\n{\n  \"command\": \"go test\"\n}\n```",
+		"Result:\n\n```\nPASS <all>\n```",
+		"Model opus",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestWriteFence(t *testing.T) {
+	var b strings.Builder
+	writeFence(&b, "", "has ``` inside")
+	if !strings.HasPrefix(b.String(), "````\n") {
+		t.Errorf("fence should outgrow backtick runs, got %q", b.String())
+	}
+}
+
+func TestHTML(t *testing.T) {
+	out, err := HTML(testMeta(), testHistory(t), now)
+	if err != nil {
+		t.Fatalf("HTML failed: %v", err)
+	}
+	page := string(out)
+
+	for _, want := range []string{
+		"<title>Rename foo/bar</title>",
+		"<details>\n<summary>Tool: Edit</summary>",
+		`<span class="del">-foo()</span><span class="add">&#43;bar()</span>`,
+		"PASS &lt;all&gt;",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("html missing %q", want)
+		}
+	}
+	if strings.Contains(page, "<script") || strings.Contains(page, "<link") {
+		t.Error("html should be standalone")
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	history := testHistory(t)
+	data, err := Render(FormatJSON, testMeta(), history, now)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	b, err := ParseBundle(data)
+	if err != nil {
+		t.Fatalf("ParseBundle failed: %v", err)
+	}
+	if b.Version != BundleVersion || b.Session.Title != "Rename foo/bar" || b.Session.Config.Model != "opus" {
+		t.Errorf("unexpected bundle: %+v", b.Session)
+	}
+	if len(b.History) != len(history) {
+		t.Errorf("expected %d records, got %d", len(history), len(b.History))
+	}
+}
+
+func TestParseBundle_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"not json", `nope`, "not valid JSON"},
+		{"no version", `{"session":{}}`, "no version"},
+		{"newer version", `{"version":2}`, "newer than supported"},
+		{"bad mode", `{"version":1,"session":{"mode":"turbo"}}`, "unknown mode"},
+		{"bad config", `{"version":1,"session":{"config":{"max_turns":-1}}}`, "bundle config"},
+		{"bad record", `{"version":1,"history":[{"foo":1}]}`, "record 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseBundle([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestFileName(t *testing.T) {
+	if got := FileName(testMeta(), FormatHTML); got != "Rename-foo-bar.html" {
+		t.Errorf("got %q", got)
+	}
+	if got := FileName(session.SessionMeta{ID: "abc", Title: "日本語"}, FormatMarkdown); got != "session-abc.md" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := session.NewFileStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	meta, _ := store.Import(t.Context(), testMeta(), testHistory(t))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/sessions/{id}/export", NewHandler(func() (map[string]string, error) {
+		return map[string]string{"": dataDir}, nil
+	}))
+
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+
+	rec := get("/api/sessions/" + meta.ID + "/export?format=html&download=true")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename=Rename-foo-bar.html` {
+		t.Errorf("unexpected content disposition %q", cd)
+	}
+
+	rec = get("/api/sessions/" + meta.ID + "/export")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "inline") {
+		t.Errorf("default export should be inline markdown, got %d %v", rec.Code, rec.Header())
+	}
+
+	if rec := get("/api/sessions/" + meta.ID + "/export?format=pdf"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad format, got %d", rec.Code)
+	}
+	if rec := get("/api/sessions/missing/export"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for missing session, got %d", rec.Code)
+	}
+	if rec := get("/api/sessions/" + meta.ID + "/export?worktree=nope"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for missing worktree, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,85 @@
+package export
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/pockode/server/session"
+)
+
+// NewHandler serves GET /api/sessions/{id}/export. Query parameters:
+// format (markdown, html or json; default markdown), worktree (default main)
+// and download=true to send the file as an attachment instead of inline.
+// dataDirs maps worktree names to store data directories.
+func NewHandler(dataDirs func() (map[string]string, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		query := r.URL.Query()
+
+		format := FormatMarkdown
+		if f := query.Get("format"); f != "" {
+			format = Format(f)
+		}
+		if !format.IsValid() {
+			http.Error(w, "Invalid format", http.StatusBadRequest)
+			return
+		}
+
+		dirs, err := dataDirs()
+		if err != nil {
+			slog.Error("failed to list data directories", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		dataDir, ok := dirs[query.Get("worktree")]
+		if !ok {
+			http.Error(w, "Worktree not found", http.StatusNotFound)
+			return
+		}
+
+		sessions, err := session.ReadSessions(dataDir)
+		if err != nil {
+			slog.Error("failed to read sessions", "dataDir", dataDir, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		var meta session.SessionMeta
+		found := false
+		for _, s := range sessions {
+			if s.ID == sessionID {
+				meta, found = s, true
+				break
+			}
+		}
+		if !found {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		history, err := session.ReadHistory(dataDir, sessionID)
+		if err != nil {
+			slog.Error("failed to read history", "sessionId", sessionID, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := Render(format, meta, history, time.Now())
+		if err != nil {
+			slog.Error("failed to render export", "sessionId", sessionID, "format", format, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		disposition := "inline"
+		if query.Get("download") == "true" {
+			disposition = "attachment"
+		}
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": FileName(meta, format)}))
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.Write(body)
+	})
+}
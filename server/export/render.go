@@ -0,0 +1,262 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pockode/server/session"
+)
+
+// Format selects an export representation.
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+	FormatJSON     Format = "json"
+)
+
+func (f Format) IsValid() bool {
+	switch f {
+	case FormatMarkdown, FormatHTML, FormatJSON:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatJSON:
+		return "application/json"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+func (f Format) extension() string {
+	switch f {
+	case FormatHTML:
+		return ".html"
+	case FormatJSON:
+		return ".json"
+	default:
+		return ".md"
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// FileName suggests a download name derived from the session title.
+func FileName(meta session.SessionMeta, f Format) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(meta.Title, "-"), "-.")
+	if name == "" {
+		name = "session-" + meta.ID
+	}
+	return name + f.extension()
+}
+
+// Render exports a session in the given format.
+func Render(f Format, meta session.SessionMeta, history []json.RawMessage, now time.Time) ([]byte, error) {
+	switch f {
+	case FormatMarkdown:
+		return []byte(Markdown(meta, history, now)), nil
+	case FormatHTML:
+		return HTML(meta, history, now)
+	case FormatJSON:
+		return json.MarshalIndent(NewBundle(meta, history, now), "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown export format %q", f)
+	}
+}
+
+// Markdown renders a session as a readable document. Tool calls are wrapped
+// in <details> so renderers that support it (GitHub, GitLab) show them collapsed.
+func Markdown(meta session.SessionMeta, history []json.RawMessage, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", meta.Title)
+	fmt.Fprintf(&b, "_%s_\n", strings.Join(headerFacts(meta, now), " · "))
+
+	for _, t := range buildTranscript(history) {
+		if t.role == roleUser {
+			b.WriteString("\n## User\n")
+		} else {
+			b.WriteString("\n## Assistant\n")
+		}
+		for _, it := range t.items {
+			b.WriteString("\n")
+			switch it.kind {
+			case itemText:
+				b.WriteString(it.text + "\n")
+			case itemNotice:
+				b.WriteString("> " + strings.ReplaceAll(it.text, "\n", "\n> ") + "\n")
+			case itemOutput:
+				writeFence(&b, "", it.text)
+			case itemTool:
+				fmt.Fprintf(&b, "<details>\n<summary>Tool: %s</summary>\n\n", template.HTMLEscapeString(it.tool.name))
+				writeFence(&b, lang(it.tool.inputDiff, "json"), it.tool.input)
+				if it.tool.result != "" {
+					b.WriteString("\nResult:\n\n")
+					writeFence(&b, lang(it.tool.resultDiff, ""), it.tool.result)
+				}
+				b.WriteString("\n</details>\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+func lang(diff bool, otherwise string) string {
+	if diff {
+		return "diff"
+	}
+	return otherwise
+}
+
+// writeFence writes a code block whose fence is longer than any backtick run in text.
+func writeFence(b *strings.Builder, language, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n", fence, language, strings.TrimRight(text, "\n"), fence)
+}
+
+func headerFacts(meta session.SessionMeta, now time.Time) []string {
+	facts := []string{
+		"Session " + meta.ID,
+		"Started " + meta.CreatedAt.UTC().Format(time.DateTime) + " UTC",
+		"Exported " + now.UTC().Format(time.DateTime) + " UTC",
+	}
+	if meta.Agent != "" {
+		facts = append(facts, "Agent "+meta.Agent)
+	}
+	if meta.Config.Model != "" {
+		facts = append(facts, "Model "+meta.Config.Model)
+	}
+	if meta.Usage.CostUSD > 0 {
+		facts = append(facts, fmt.Sprintf("Cost $%.2f", meta.Usage.CostUSD))
+	}
+	return facts
+}
+
+type htmlPage struct {
+	Title string
+	Facts []string
+	Turns []htmlTurn
+}
+
+type htmlTurn struct {
+	User  bool
+	Items []htmlItem
+}
+
+type htmlItem struct {
+	Kind      string // "text" | "notice" | "output" | "tool"
+	Text      string
+	ToolName  string
+	Input     []diffLine
+	Result    []diffLine
+	HasResult bool
+}
+
+type diffLine struct {
+	Class string
+	Text  string
+}
+
+func toDiffLines(text string, diff bool) []diffLine {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	out := make([]diffLine, len(lines))
+	for i, line := range lines {
+		out[i] = diffLine{Text: line}
+		if diff {
+			out[i].Class = diffLineClass(line)
+		}
+	}
+	return out
+}
+
+// HTML renders a session as a standalone page with no external assets.
+func HTML(meta session.SessionMeta, history []json.RawMessage, now time.Time) ([]byte, error) {
+	page := htmlPage{Title: meta.Title, Facts: headerFacts(meta, now)}
+	for _, t := range buildTranscript(history) {
+		ht := htmlTurn{User: t.role == roleUser}
+		for _, it := range t.items {
+			switch it.kind {
+			case itemText:
+				ht.Items = append(ht.Items, htmlItem{Kind: "text", Text: it.text})
+			case itemNotice:
+				ht.Items = append(ht.Items, htmlItem{Kind: "notice", Text: it.text})
+			case itemOutput:
+				ht.Items = append(ht.Items, htmlItem{Kind: "output", Text: it.text})
+			case itemTool:
+				ht.Items = append(ht.Items, htmlItem{
+					Kind:      "tool",
+					ToolName:  it.tool.name,
+					Input:     toDiffLines(it.tool.input, it.tool.inputDiff),
+					Result:    toDiffLines(it.tool.result, it.tool.resultDiff),
+					HasResult: it.tool.result != "",
+				})
+			}
+		}
+		page.Turns = append(page.Turns, ht)
+	}
+
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, page); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font: 15px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; max-width: 860px; margin: 2rem auto; padding: 0 1rem; color: #1f2328; }
+h1 { margin-bottom: .25rem; }
+.facts { color: #656d76; font-size: 13px; margin-bottom: 2rem; }
+.turn { border-left: 3px solid #d0d7de; padding: .25rem 0 .25rem 1rem; margin: 1.5rem 0; }
+.turn.user { border-color: #0969da; }
+.role { font-weight: 600; font-size: 13px; text-transform: uppercase; color: #656d76; }
+.text { white-space: pre-wrap; margin: .5rem 0; }
+.notice { color: #656d76; font-style: italic; margin: .5rem 0; }
+details { margin: .5rem 0; border: 1px solid #d0d7de; border-radius: 6px; padding: .25rem .75rem; }
+summary { cursor: pointer; font-family: ui-monospace, monospace; font-size: 13px; }
+pre { background: #f6f8fa; border-radius: 6px; padding: .75rem; overflow-x: auto; font: 12px/1.45 ui-monospace, monospace; }
+pre span { display: block; min-height: 1.45em; }
+.add { background: #dafbe1; }
+.del { background: #ffebe9; }
+.hunk { color: #8250df; }
+.meta { color: #656d76; font-weight: 600; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="facts">{{range $i, $f := .Facts}}{{if $i}} · {{end}}{{$f}}{{end}}</div>
+{{range .Turns}}<section class="turn{{if .User}} user{{end}}">
+<div class="role">{{if .User}}User{{else}}Assistant{{end}}</div>
+{{range .Items}}{{if eq .Kind "text"}}<div class="text">{{.Text}}</div>
+{{else if eq .Kind "notice"}}<div class="notice">{{.Text}}</div>
+{{else if eq .Kind "output"}}<pre>{{.Text}}</pre>
+{{else}}<details>
+<summary>Tool: {{.ToolName}}</summary>
+<pre>{{range .Input}}<span{{if .Class}} class="{{.Class}}"{{end}}>{{.Text}}</span>{{end}}</pre>
+{{if .HasResult}}<div class="role">Result</div>
+<pre>{{range .Result}}<span{{if .Class}} class="{{.Class}}"{{end}}>{{.Text}}</span>{{end}}</pre>
+{{end}}</details>
+{{end}}{{end}}</section>
+{{end}}</body>
+</html>
+`))
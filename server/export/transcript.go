@@ -0,0 +1,234 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pockode/server/agent"
+)
+
+type role string
+
+const (
+	roleUser      role = "user"
+	roleAssistant role = "assistant"
+)
+
+type itemKind int
+
+const (
+	itemText   itemKind = iota // prose (assistant text may contain Markdown)
+	itemTool                   // tool call, rendered collapsed
+	itemNotice                 // permission, question, error and lifecycle notes
+	itemOutput                 // command output, rendered as code
+)
+
+// turn is a run of consecutive records from one side of the conversation.
+type turn struct {
+	role  role
+	items []item
+}
+
+type item struct {
+	kind itemKind
+	text string
+	tool toolCall
+}
+
+type toolCall struct {
+	name       string
+	input      string
+	inputDiff  bool // input is a diff (Edit/Write) rather than JSON
+	result     string
+	resultDiff bool
+}
+
+// buildTranscript groups history records into turns. Tool results are folded
+// into their calls; records with nothing to read (done, usage, raw CLI output)
+// are skipped.
+func buildTranscript(history []json.RawMessage) []turn {
+	records := make([]agent.EventRecord, 0, len(history))
+	results := make(map[string]string)
+	for _, raw := range history {
+		var r agent.EventRecord
+		if err := json.Unmarshal(raw, &r); err != nil {
+			continue
+		}
+		if r.Type == agent.EventTypeToolResult {
+			results[r.ToolUseID] = r.ToolResult
+		}
+		records = append(records, r)
+	}
+
+	var turns []turn
+	add := func(who role, it item) {
+		if len(turns) == 0 || turns[len(turns)-1].role != who {
+			turns = append(turns, turn{role: who})
+		}
+		t := &turns[len(turns)-1]
+		t.items = append(t.items, it)
+	}
+
+	for _, r := range records {
+		switch r.Type {
+		case agent.EventTypeMessage:
+			// Each user message starts its own turn, even when queued back to back
+			turns = append(turns, turn{role: roleUser})
+			add(roleUser, item{kind: itemText, text: r.Content})
+			if names := attachmentNames(r.Attachments); names != "" {
+				add(roleUser, item{kind: itemNotice, text: "Attachments: " + names})
+			}
+		case agent.EventTypeText:
+			add(roleAssistant, item{kind: itemText, text: r.Content})
+		case agent.EventTypeToolCall:
+			call := toolCall{name: r.ToolName, result: results[r.ToolUseID]}
+			call.input, call.inputDiff = formatToolInput(r.ToolName, r.ToolInput)
+			call.resultDiff = looksLikeDiff(call.result)
+			add(roleAssistant, item{kind: itemTool, tool: call})
+		case agent.EventTypeCommandOutput:
+			add(roleAssistant, item{kind: itemOutput, text: r.Content})
+		case agent.EventTypePermissionRequest:
+			add(roleAssistant, item{kind: itemNotice, text: fmt.Sprintf("Permission requested for %s", r.ToolName)})
+		case agent.EventTypePermissionResponse:
+			add(roleUser, item{kind: itemNotice, text: "Permission " + choiceText(r.Choice)})
+		case agent.EventTypeAskUserQuestion:
+			for _, q := range r.Questions {
+				add(roleAssistant, item{kind: itemNotice, text: "Question: " + q.Question})
+			}
+		case agent.EventTypeQuestionResponse:
+			if r.Answers == nil {
+				add(roleUser, item{kind: itemNotice, text: "Question dismissed"})
+			}
+			for _, q := range slices.Sorted(maps.Keys(r.Answers)) {
+				add(roleUser, item{kind: itemNotice, text: fmt.Sprintf("Answer to %q: %s", q, r.Answers[q])})
+			}
+		case agent.EventTypeError:
+			add(roleAssistant, item{kind: itemNotice, text: "Error: " + r.Error})
+		case agent.EventTypeWarning:
+			add(roleAssistant, item{kind: itemNotice, text: "Warning: " + r.Message})
+		case agent.EventTypeInterrupted:
+			add(roleAssistant, item{kind: itemNotice, text: "Interrupted"})
+		case agent.EventTypeProcessEnded:
+			add(roleAssistant, item{kind: itemNotice, text: "Process ended"})
+		}
+	}
+	return turns
+}
+
+func attachmentNames(attachments []agent.Attachment) string {
+	names := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		name := a.Name
+		if name == "" {
+			name = a.Path
+		}
+		if name == "" {
+			name = string(a.Type)
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func choiceText(choice string) string {
+	switch choice {
+	case "allow":
+		return "allowed"
+	case "always_allow":
+		return "always allowed"
+	case "deny":
+		return "denied"
+	default:
+		return choice
+	}
+}
+
+// formatToolInput renders file edits as diffs and everything else as indented JSON.
+func formatToolInput(name string, input json.RawMessage) (string, bool) {
+	switch name {
+	case "Edit":
+		var in struct {
+			FilePath  string `json:"file_path"`
+			OldString string `json:"old_string"`
+			NewString string `json:"new_string"`
+		}
+		if json.Unmarshal(input, &in) == nil {
+			return editDiff(in.FilePath, in.OldString, in.NewString), true
+		}
+	case "MultiEdit":
+		var in struct {
+			FilePath string `json:"file_path"`
+			Edits    []struct {
+				OldString string `json:"old_string"`
+				NewString string `json:"new_string"`
+			} `json:"edits"`
+		}
+		if json.Unmarshal(input, &in) == nil {
+			var b strings.Builder
+			for i, e := range in.Edits {
+				if i > 0 {
+					b.WriteString("\n")
+				}
+				b.WriteString(editDiff(in.FilePath, e.OldString, e.NewString))
+			}
+			return b.String(), true
+		}
+	case "Write":
+		var in struct {
+			FilePath string `json:"file_path"`
+			Content  string `json:"content"`
+		}
+		if json.Unmarshal(input, &in) == nil {
+			return editDiff(in.FilePath, "", in.Content), true
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, input, "", "  "); err != nil {
+		return string(input), false
+	}
+	return buf.String(), false
+}
+
+// editDiff shows a string replacement as removed and added lines.
+func editDiff(path, oldText, newText string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", path, path)
+	if oldText != "" {
+		for _, line := range strings.Split(oldText, "\n") {
+			b.WriteString("-" + line + "\n")
+		}
+	}
+	if newText != "" {
+		for _, line := range strings.Split(newText, "\n") {
+			b.WriteString("+" + line + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// looksLikeDiff reports whether tool output is a unified diff (e.g. git diff).
+func looksLikeDiff(s string) bool {
+	return strings.HasPrefix(s, "diff --git") || strings.Contains(s, "\n@@ ") || strings.HasPrefix(s, "@@ ") ||
+		(strings.Contains(s, "--- ") && strings.Contains(s, "\n+++ "))
+}
+
+// diffLineClass classifies a diff line for highlighting.
+func diffLineClass(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "diff "):
+		return "meta"
+	case strings.HasPrefix(line, "@@"):
+		return "hunk"
+	case strings.HasPrefix(line, "+"):
+		return "add"
+	case strings.HasPrefix(line, "-"):
+		return "del"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,36 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+
+	if err := WriteFileAtomic(path, []byte("one")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := WriteFileAtomic(path, []byte("two")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "two" {
+		t.Errorf("expected replaced content, got %q", data)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected no temp files left, got %d entries", len(entries))
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "data.json"), []byte("x")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
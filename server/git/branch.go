@@ -0,0 +1,147 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Branch is a local or remote-tracking branch.
+type Branch struct {
+	Name     string `json:"name"` // e.g. "main" or "origin/main"
+	Remote   bool   `json:"remote"`
+	Current  bool   `json:"current"`
+	Hash     string `json:"hash"`
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`  // commits not on Upstream
+	Behind   int    `json:"behind"` // Upstream commits not on the branch
+}
+
+const branchFormat = "--format=%(refname)%00%(HEAD)%00%(objectname)%00%(upstream:short)%00%(upstream:track,nobracket)"
+
+// Branches lists local branches followed by remote-tracking branches.
+func Branches(ctx context.Context, dir string) ([]Branch, error) {
+	output, err := run(ctx, dir, "for-each-ref", branchFormat, "refs/heads", "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+
+	branches := []Branch{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 5 {
+			continue
+		}
+		ref := fields[0]
+		b := Branch{
+			Current:  fields[1] == "*",
+			Hash:     fields[2],
+			Upstream: fields[3],
+		}
+		switch {
+		case strings.HasPrefix(ref, "refs/heads/"):
+			b.Name = strings.TrimPrefix(ref, "refs/heads/")
+		case strings.HasSuffix(ref, "/HEAD"):
+			// refs/remotes/origin/HEAD only points at the default branch
+			continue
+		default:
+			b.Name = strings.TrimPrefix(ref, "refs/remotes/")
+			b.Remote = true
+		}
+		b.Ahead, b.Behind = parseTrack(fields[4])
+		branches = append(branches, b)
+	}
+	return branches, nil
+}
+
+// parseTrack parses "ahead 1, behind 2" as printed by %(upstream:track).
+func parseTrack(track string) (ahead, behind int) {
+	for _, part := range strings.Split(track, ", ") {
+		name, count, ok := strings.Cut(part, " ")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.Atoi(count)
+		switch name {
+		case "ahead":
+			ahead = n
+		case "behind":
+			behind = n
+		}
+	}
+	return ahead, behind
+}
+
+// CreateBranch creates branch name at start, or at HEAD when start is
+// empty, and switches to it if checkout is set. A start that does not name a
+// commit returns ErrUnknownRevision.
+func CreateBranch(ctx context.Context, dir, name, start string, checkout bool) error {
+	if err := validateBranchName(ctx, dir, name); err != nil {
+		return err
+	}
+	// Passed on as given rather than resolved, so a remote branch start
+	// still sets up tracking
+	if start != "" {
+		if _, err := resolveCommit(ctx, dir, start); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"branch", "--", name}
+	if checkout {
+		args = []string{"switch", "--create", name}
+	}
+	if start != "" {
+		args = append(args, start)
+	}
+	_, err := run(ctx, dir, args...)
+	return classifyCheckout(err)
+}
+
+// Checkout switches the worktree to branch name. A name only present on a
+// remote, such as "feature" for "origin/feature", creates a tracking branch.
+func Checkout(ctx context.Context, dir, name string) error {
+	if err := validateBranchName(ctx, dir, name); err != nil {
+		return err
+	}
+	_, err := run(ctx, dir, "switch", name)
+	return classifyCheckout(err)
+}
+
+// DeleteBranch deletes a local branch. Without force, a branch with commits
+// not merged into its upstream or HEAD is kept and KindNotMerged returned.
+func DeleteBranch(ctx context.Context, dir, name string, force bool) error {
+	if err := validateBranchName(ctx, dir, name); err != nil {
+		return err
+	}
+
+	flag := "--delete"
+	if force {
+		flag = "-D"
+	}
+	output, err := run(ctx, dir, "branch", flag, "--", name)
+	if err != nil && strings.Contains(output, "not fully merged") {
+		return &Error{Kind: KindNotMerged, Output: output}
+	}
+	return err
+}
+
+func validateBranchName(ctx context.Context, dir, name string) error {
+	if name == "" || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid branch name: %q", name)
+	}
+	if _, err := run(ctx, dir, "check-ref-format", "--branch", name); err != nil {
+		return fmt.Errorf("invalid branch name: %q", name)
+	}
+	return nil
+}
+
+// classifyCheckout turns a failed switch caused by local changes into
+// KindDirty.
+func classifyCheckout(err error) error {
+	if err != nil && strings.Contains(err.Error(), "would be overwritten") {
+		return &Error{Kind: KindDirty, Output: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBranches(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	commitFile(t, dir, "a.txt", "a\n")
+
+	if err := CreateBranch(ctx, dir, "feature", "", true); err != nil {
+		t.Fatalf("CreateBranch() error: %v", err)
+	}
+	commitFile(t, dir, "b.txt", "b\n")
+
+	branches, err := Branches(ctx, dir)
+	if err != nil {
+		t.Fatalf("Branches() error: %v", err)
+	}
+	var current []string
+	for _, b := range branches {
+		if b.Current {
+			current = append(current, b.Name)
+		}
+	}
+	if len(branches) != 2 || len(current) != 1 || current[0] != "feature" {
+		t.Fatalf("expected two branches with feature current, got %+v", branches)
+	}
+
+	if err := CreateBranch(ctx, dir, "-bad", "", false); err == nil {
+		t.Error("expected invalid branch name to fail")
+	}
+	for _, start := range []string{"--orphan", "missing"} {
+		if err := CreateBranch(ctx, dir, "other", start, false); !errors.Is(err, ErrUnknownRevision) {
+			t.Errorf("CreateBranch(start=%q) expected ErrUnknownRevision, got %v", start, err)
+		}
+	}
+	if err := CreateBranch(ctx, dir, "other", "feature~1", false); err != nil {
+		t.Errorf("CreateBranch(start=feature~1) error: %v", err)
+	}
+}
+
+func TestCheckoutAndDelete(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	commitFile(t, dir, "a.txt", "a\n")
+	main, _ := run(ctx, dir, "branch", "--show-current")
+	main = main[:len(main)-1]
+
+	CreateBranch(ctx, dir, "feature", "", true)
+	commitFile(t, dir, "a.txt", "feature\n")
+
+	// A local edit that the switch would overwrite
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("local\n"), 0644)
+	var gitErr *Error
+	if err := Checkout(ctx, dir, main); !errors.As(err, &gitErr) || gitErr.Kind != KindDirty {
+		t.Fatalf("expected dirty worktree error, got %v", err)
+	}
+	runGit(t, dir, "checkout", "--", "a.txt")
+
+	if err := Checkout(ctx, dir, main); err != nil {
+		t.Fatalf("Checkout() error: %v", err)
+	}
+	if err := DeleteBranch(ctx, dir, "feature", false); !errors.As(err, &gitErr) || gitErr.Kind != KindNotMerged {
+		t.Fatalf("expected not merged error, got %v", err)
+	}
+	if err := DeleteBranch(ctx, dir, "feature", true); err != nil {
+		t.Fatalf("DeleteBranch(force) error: %v", err)
+	}
+}
+
+func TestParseTrack(t *testing.T) {
+	tests := map[string][2]int{
+		"":                  {0, 0},
+		"ahead 2":           {2, 0},
+		"behind 3":          {0, 3},
+		"ahead 1, behind 4": {1, 4},
+		"gone":              {0, 0},
+	}
+	for track, want := range tests {
+		if ahead, behind := parseTrack(track); ahead != want[0] || behind != want[1] {
+			t.Errorf("parseTrack(%q) = %d, %d; want %d, %d", track, ahead, behind, want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package git
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkpointRefPrefix keeps checkpoints out of branch and tag listings while
+// their refs stop the commits from being garbage collected.
+const checkpointRefPrefix = "refs/pockode/checkpoints/"
+
+// MaxCheckpoints is the number of checkpoints kept per session; older ones
+// are dropped.
+const MaxCheckpoints = 100
+
+var (
+	// ErrNotRepository is returned for checkpoints outside a git repository.
+	ErrNotRepository = errors.New("not a git repository")
+	// ErrCheckpointNotFound is returned for an unknown or dropped checkpoint.
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+)
+
+// checkpointIdentity is the author of checkpoint commits, so creating one
+// does not depend on the user's git config.
+var checkpointIdentity = []string{
+	"GIT_AUTHOR_NAME=Pockode", "GIT_AUTHOR_EMAIL=pockode@localhost",
+	"GIT_COMMITTER_NAME=Pockode", "GIT_COMMITTER_EMAIL=pockode@localhost",
+}
+
+var (
+	sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	hashPattern      = regexp.MustCompile(`^[0-9a-f]{40,64}$`)
+)
+
+// checkpointSubject starts the message of checkpoint commits, followed by the
+// checkpoint's sequence number within its session.
+const checkpointSubject = "pockode checkpoint"
+
+// Checkpoint is a snapshot of the worktree taken for a session.
+type Checkpoint struct {
+	ID        string    `json:"id"` // commit hash
+	CreatedAt time.Time `json:"created_at"`
+
+	seq int64 // creation order; commit dates only have second resolution
+}
+
+// CreateCheckpoint snapshots the tracked and untracked files of the
+// repository containing dir, leaving ignored files out, and returns the
+// checkpoint's ID. HEAD, the index and the worktree are not changed. If
+// nothing changed since the session's latest checkpoint, that one is
+// returned.
+func CreateCheckpoint(ctx context.Context, dir, sessionID string) (string, error) {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return "", fmt.Errorf("invalid session ID: %q", sessionID)
+	}
+	top, err := topLevel(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := createCheckpoint(ctx, top, sessionID)
+	if err != nil {
+		return "", err
+	}
+	return id, pruneCheckpoints(ctx, top, sessionID, MaxCheckpoints, "")
+}
+
+// RollbackCheckpoint checkpoints the current state of the repository
+// containing dir, then restores checkpoint id of a session. It returns the
+// new checkpoint, which undoes the rollback. Pruning happens only once the
+// restore succeeded and never drops id.
+func RollbackCheckpoint(ctx context.Context, dir, sessionID, id string) (string, error) {
+	if !sessionIDPattern.MatchString(sessionID) || !hashPattern.MatchString(id) {
+		return "", ErrCheckpointNotFound
+	}
+	top, err := topLevel(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+	if !checkpointExists(ctx, top, sessionID, id) {
+		return "", ErrCheckpointNotFound
+	}
+
+	backup, err := createCheckpoint(ctx, top, sessionID)
+	if err != nil {
+		return "", err
+	}
+	if err := RestoreCheckpoint(ctx, top, sessionID, id); err != nil {
+		return "", err
+	}
+	return backup, pruneCheckpoints(ctx, top, sessionID, MaxCheckpoints, id)
+}
+
+// createCheckpoint snapshots the worktree top without pruning.
+func createCheckpoint(ctx context.Context, top, sessionID string) (string, error) {
+	tree, err := worktreeTree(ctx, top)
+	if err != nil {
+		return "", err
+	}
+
+	checkpoints, err := Checkpoints(ctx, top, sessionID)
+	if err != nil {
+		return "", err
+	}
+	var seq int64
+	if n := len(checkpoints); n > 0 {
+		latest := checkpoints[n-1]
+		if latestTree, err := run(ctx, top, "rev-parse", latest.ID+"^{tree}"); err == nil && strings.TrimSpace(latestTree) == tree {
+			return latest.ID, nil
+		}
+		seq = latest.seq
+	}
+
+	args := []string{"commit-tree", tree, "-m", fmt.Sprintf("%s %d", checkpointSubject, seq+1)}
+	if head, err := run(ctx, top, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		args = append(args, "-p", strings.TrimSpace(head))
+	}
+	output, err := runEnv(ctx, top, checkpointIdentity, args...)
+	if err != nil {
+		return "", err
+	}
+	id := strings.TrimSpace(output)
+
+	if _, err := run(ctx, top, "update-ref", checkpointRefPrefix+sessionID+"/"+id, id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// pruneCheckpoints drops the oldest checkpoints beyond limit, skipping keep.
+func pruneCheckpoints(ctx context.Context, top, sessionID string, limit int, keep string) error {
+	checkpoints, err := Checkpoints(ctx, top, sessionID)
+	if err != nil {
+		return err
+	}
+	excess := len(checkpoints) - limit
+	for _, old := range checkpoints {
+		if excess <= 0 {
+			break
+		}
+		if old.ID == keep {
+			continue
+		}
+		if _, err := run(ctx, top, "update-ref", "-d", checkpointRefPrefix+sessionID+"/"+old.ID); err != nil {
+			return err
+		}
+		excess--
+	}
+	return nil
+}
+
+func checkpointExists(ctx context.Context, top, sessionID, id string) bool {
+	_, err := run(ctx, top, "rev-parse", "--verify", "--quiet", checkpointRefPrefix+sessionID+"/"+id)
+	return err == nil
+}
+
+// Checkpoints returns the checkpoints of a session, oldest first.
+func Checkpoints(ctx context.Context, dir, sessionID string) ([]Checkpoint, error) {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return nil, fmt.Errorf("invalid session ID: %q", sessionID)
+	}
+	top, err := topLevel(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := run(ctx, top, "for-each-ref", "--sort=committerdate", "--format=%(objectname) %(committerdate:iso-strict) %(contents:subject)", checkpointRefPrefix+sessionID+"/")
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := []Checkpoint{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		createdAt, _ := time.Parse(time.RFC3339, fields[1])
+		c := Checkpoint{ID: fields[0], CreatedAt: createdAt}
+		if len(fields) == 3 {
+			// Checkpoints made before sequence numbers sort first, by date
+			if n, ok := strings.CutPrefix(fields[2], checkpointSubject+" "); ok {
+				c.seq, _ = strconv.ParseInt(n, 10, 64)
+			}
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	slices.SortStableFunc(checkpoints, func(a, b Checkpoint) int { return cmp.Compare(a.seq, b.seq) })
+	return checkpoints, nil
+}
+
+// RestoreCheckpoint makes the files of the repository containing dir match
+// checkpoint id of a session: changed and deleted files are written back and
+// files created since are removed. Ignored files, HEAD and the index are
+// left alone.
+func RestoreCheckpoint(ctx context.Context, dir, sessionID, id string) error {
+	if !sessionIDPattern.MatchString(sessionID) || !hashPattern.MatchString(id) {
+		return ErrCheckpointNotFound
+	}
+	top, err := topLevel(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if !checkpointExists(ctx, top, sessionID, id) {
+		return ErrCheckpointNotFound
+	}
+
+	current, err := worktreeTree(ctx, top)
+	if err != nil {
+		return err
+	}
+
+	// Files created since the checkpoint
+	output, err := run(ctx, top, "diff-tree", "-r", "--name-only", "-z", "--diff-filter=A", id, current)
+	if err != nil {
+		return err
+	}
+	for _, path := range splitNul(output) {
+		if err := os.Remove(filepath.Join(top, path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removeEmptyParents(top, path)
+	}
+
+	// Files changed or deleted since the checkpoint
+	output, err = run(ctx, top, "diff-tree", "-r", "--name-only", "-z", "--diff-filter=DMT", id, current)
+	if err != nil {
+		return err
+	}
+	changed := splitNul(output)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	index, cleanup, err := tempIndex("")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	env := []string{"GIT_INDEX_FILE=" + index}
+	if _, err := runEnv(ctx, top, env, "read-tree", id); err != nil {
+		return err
+	}
+	for _, path := range changed {
+		// A directory where the checkpoint has a file blocks checkout-index
+		if info, err := os.Lstat(filepath.Join(top, path)); err == nil && info.IsDir() {
+			if err := os.RemoveAll(filepath.Join(top, path)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = runEnv(ctx, top, env, append([]string{"checkout-index", "--force", "--"}, changed...)...)
+	return err
+}
+
+// DeleteCheckpoints drops every checkpoint of a session.
+func DeleteCheckpoints(ctx context.Context, dir, sessionID string) error {
+	checkpoints, err := Checkpoints(ctx, dir, sessionID)
+	if err != nil {
+		return err
+	}
+	for _, c := range checkpoints {
+		if _, err := run(ctx, dir, "update-ref", "-d", checkpointRefPrefix+sessionID+"/"+c.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// worktreeTree writes a tree of the tracked and untracked files in the
+// worktree top and returns its hash. It works on a copy of the index, so the
+// real one is not touched; the copy keeps the cached file stats, which spares
+// hashing unchanged files again.
+func worktreeTree(ctx context.Context, top string) (string, error) {
+	realIndex, err := run(ctx, top, "rev-parse", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	realIndex = strings.TrimSpace(realIndex)
+	if !filepath.IsAbs(realIndex) {
+		realIndex = filepath.Join(top, realIndex)
+	}
+
+	index, cleanup, err := tempIndex(realIndex)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	env := []string{"GIT_INDEX_FILE=" + index}
+
+	if _, err := runEnv(ctx, top, env, "add", "--all", "--", "."); err != nil {
+		return "", err
+	}
+	tree, err := runEnv(ctx, top, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(tree), nil
+}
+
+// tempIndex creates an index file for GIT_INDEX_FILE, copied from src unless
+// src is empty or missing, and returns a function that removes it.
+func tempIndex(src string) (string, func(), error) {
+	f, err := os.CreateTemp("", "pockode-index-*")
+	if err != nil {
+		return "", nil, err
+	}
+	path := f.Name()
+	cleanup := func() { os.Remove(path) }
+
+	copied := false
+	if src != "" {
+		if in, err := os.Open(src); err == nil {
+			_, err = io.Copy(f, in)
+			in.Close()
+			if err != nil {
+				f.Close()
+				cleanup()
+				return "", nil, err
+			}
+			copied = true
+		}
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if !copied {
+		// git rejects an empty index file but creates a missing one
+		os.Remove(path)
+	}
+	return path, cleanup, nil
+}
+
+// topLevel returns the root of the worktree containing dir.
+func topLevel(ctx context.Context, dir string) (string, error) {
+	output, err := run(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", ErrNotRepository
+	}
+	return strings.TrimSpace(output), nil
+}
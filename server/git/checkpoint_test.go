@@ -0,0 +1,182 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSession = "0190f3f0-0000-7000-8000-000000000001"
+
+func TestCheckpoint_CreateAndRestore(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	commitFile(t, dir, "a.txt", "committed\n")
+	commitFile(t, dir, ".gitignore", "*.log\n")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("before turn\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("untracked\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("staged\n"), 0644)
+	runGit(t, dir, "add", "b.txt")
+
+	id, err := CreateCheckpoint(ctx, dir, testSession)
+	if err != nil {
+		t.Fatalf("CreateCheckpoint() error: %v", err)
+	}
+	if again, _ := CreateCheckpoint(ctx, dir, testSession); again != id {
+		t.Errorf("expected an unchanged worktree to reuse the checkpoint, got %s and %s", id, again)
+	}
+	if staged := stagedContent(t, dir, "untracked.txt"); staged != "" {
+		t.Errorf("expected the index to be left alone, got %q staged", staged)
+	}
+
+	// The agent's turn
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("agent edit\n"), 0644)
+	os.Remove(filepath.Join(dir, "untracked.txt"))
+	os.MkdirAll(filepath.Join(dir, "gen"), 0755)
+	os.WriteFile(filepath.Join(dir, "gen", "new.txt"), []byte("new\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "debug.log"), []byte("ignored\n"), 0644)
+
+	if err := RestoreCheckpoint(ctx, dir, testSession, id); err != nil {
+		t.Fatalf("RestoreCheckpoint() error: %v", err)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "before turn\n" {
+		t.Errorf("expected a.txt restored, got %q", got)
+	}
+	if got := readFile(t, dir, "untracked.txt"); got != "untracked\n" {
+		t.Errorf("expected untracked.txt restored, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gen")); !os.IsNotExist(err) {
+		t.Error("expected the new file and its directory to be removed")
+	}
+	if got := readFile(t, dir, "debug.log"); got != "ignored\n" {
+		t.Errorf("expected ignored files to be kept, got %q", got)
+	}
+	if got := stagedContent(t, dir, "b.txt"); got != "staged\n" {
+		t.Errorf("expected the index to be kept, got %q", got)
+	}
+
+	checkpoints, err := Checkpoints(ctx, dir, testSession)
+	if err != nil || len(checkpoints) != 1 || checkpoints[0].ID != id || checkpoints[0].CreatedAt.IsZero() {
+		t.Fatalf("expected one checkpoint, got %+v, %v", checkpoints, err)
+	}
+	if branches, _ := Branches(ctx, dir); len(branches) != 1 {
+		t.Errorf("expected checkpoints to stay out of branches, got %+v", branches)
+	}
+
+	if err := DeleteCheckpoints(ctx, dir, testSession); err != nil {
+		t.Fatalf("DeleteCheckpoints() error: %v", err)
+	}
+	if err := RestoreCheckpoint(ctx, dir, testSession, id); !errors.Is(err, ErrCheckpointNotFound) {
+		t.Errorf("expected deleted checkpoint to be gone, got %v", err)
+	}
+}
+
+func TestCheckpoint_OrderWithinOneSecond(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	commitFile(t, dir, "a.txt", "a\n")
+
+	// Several checkpoints usually share a commit date; creation order wins
+	var ids []string
+	for i := range 5 {
+		os.WriteFile(filepath.Join(dir, "a.txt"), []byte(fmt.Sprintf("turn %d\n", i)), 0644)
+		id, err := CreateCheckpoint(ctx, dir, testSession)
+		if err != nil {
+			t.Fatalf("CreateCheckpoint() error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	checkpoints, err := Checkpoints(ctx, dir, testSession)
+	if err != nil || len(checkpoints) != len(ids) {
+		t.Fatalf("expected %d checkpoints, got %+v, %v", len(ids), checkpoints, err)
+	}
+	for i, c := range checkpoints {
+		if c.ID != ids[i] {
+			t.Errorf("checkpoint %d: expected %s, got %s", i, ids[i], c.ID)
+		}
+	}
+
+	// Going back to an earlier state is a new, latest checkpoint
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("turn 0\n"), 0644)
+	id, _ := CreateCheckpoint(ctx, dir, testSession)
+	checkpoints, _ = Checkpoints(ctx, dir, testSession)
+	if id == ids[0] || checkpoints[len(checkpoints)-1].ID != id {
+		t.Errorf("expected a new latest checkpoint, got %s in %+v", id, checkpoints)
+	}
+}
+
+func TestCheckpoint_Rollback(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	commitFile(t, dir, "a.txt", "a\n")
+
+	var ids []string
+	for i := range 3 {
+		os.WriteFile(filepath.Join(dir, "a.txt"), []byte(fmt.Sprintf("turn %d\n", i)), 0644)
+		id, _ := CreateCheckpoint(ctx, dir, testSession)
+		ids = append(ids, id)
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("latest\n"), 0644)
+
+	if _, err := RollbackCheckpoint(ctx, dir, testSession, "0123456789abcdef0123456789abcdef01234567"); !errors.Is(err, ErrCheckpointNotFound) {
+		t.Errorf("expected unknown checkpoint, got %v", err)
+	}
+
+	backup, err := RollbackCheckpoint(ctx, dir, testSession, ids[0])
+	if err != nil {
+		t.Fatalf("RollbackCheckpoint() error: %v", err)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "turn 0\n" {
+		t.Errorf("expected a.txt rolled back, got %q", got)
+	}
+	if err := RestoreCheckpoint(ctx, dir, testSession, backup); err != nil {
+		t.Fatalf("expected the backup to undo the rollback: %v", err)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "latest\n" {
+		t.Errorf("expected a.txt back at latest, got %q", got)
+	}
+
+	// Pruning to the limit spares the rollback target, however old
+	top, _ := topLevel(ctx, dir)
+	if err := pruneCheckpoints(ctx, top, testSession, 2, ids[0]); err != nil {
+		t.Fatalf("pruneCheckpoints() error: %v", err)
+	}
+	checkpoints, _ := Checkpoints(ctx, dir, testSession)
+	if len(checkpoints) != 2 || checkpoints[0].ID != ids[0] || checkpoints[1].ID != backup {
+		t.Errorf("expected the target and the backup to remain, got %+v", checkpoints)
+	}
+}
+
+func TestCheckpoint_EmptyRepository(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("first\n"), 0644)
+	id, err := CreateCheckpoint(ctx, dir, testSession)
+	if err != nil {
+		t.Fatalf("CreateCheckpoint() error: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("second\n"), 0644)
+
+	if err := RestoreCheckpoint(ctx, dir, testSession, id); err != nil {
+		t.Fatalf("RestoreCheckpoint() error: %v", err)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "first\n" {
+		t.Errorf("expected a.txt restored, got %q", got)
+	}
+}
+
+func TestCheckpoint_NotRepository(t *testing.T) {
+	if _, err := CreateCheckpoint(context.Background(), t.TempDir(), testSession); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("expected not a repository, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CommitOptions configures Commit.
+type CommitOptions struct {
+	Message string
+	Amend   bool // replace HEAD; an empty Message keeps its message
+	SignOff bool // add a Signed-off-by trailer
+}
+
+// Commit records the staged changes and returns the new commit's hash.
+func Commit(ctx context.Context, dir string, opts CommitOptions) (string, error) {
+	if opts.Message == "" && !opts.Amend {
+		return "", fmt.Errorf("commit message is empty")
+	}
+	if !opts.Amend && !hasStagedChanges(ctx, dir) {
+		return "", &Error{Kind: KindNothingToCommit}
+	}
+
+	args := []string{"commit"}
+	if opts.Message != "" {
+		args = append(args, "--message", opts.Message)
+	} else {
+		args = append(args, "--no-edit")
+	}
+	if opts.Amend {
+		args = append(args, "--amend")
+	}
+	if opts.SignOff {
+		args = append(args, "--signoff")
+	}
+	if _, err := run(ctx, dir, args...); err != nil {
+		return "", err
+	}
+
+	hash, err := run(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(hash), nil
+}
+
+// hasStagedChanges reports whether the index differs from HEAD.
+func hasStagedChanges(ctx context.Context, dir string) bool {
+	cmd := exec.CommandContext(ctx, "git", "diff", "--cached", "--quiet")
+	cmd.Dir = dir
+	var exitErr *exec.ExitError
+	return errors.As(cmd.Run(), &exitErr) && exitErr.ExitCode() == 1
+}
+
+// LogEntry is a commit in the history.
+type LogEntry struct {
+	Hash        string    `json:"hash"`
+	Parents     []string  `json:"parents"`
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email"`
+	Date        time.Time `json:"date"`
+	Subject     string    `json:"subject"`
+}
+
+// LogOptions configures Log.
+type LogOptions struct {
+	Limit int    // most recent commits to return; 0 means DefaultLogLimit
+	Skip  int    // commits to skip first, for paging
+	Path  string // only commits touching this file or directory
+}
+
+// DefaultLogLimit is the number of commits Log returns by default.
+const DefaultLogLimit = 50
+
+// logFormat separates fields with US and ends each commit with RS, which
+// cannot appear in the fields.
+const logFormat = "--format=%H%x1f%P%x1f%an%x1f%ae%x1f%aI%x1f%s%x1e"
+
+// Log returns the commits reachable from HEAD, newest first. A repository
+// without commits has an empty log.
+func Log(ctx context.Context, dir string, opts LogOptions) ([]LogEntry, error) {
+	if _, err := run(ctx, dir, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return []LogEntry{}, nil
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLogLimit
+	}
+	args := []string{"log", logFormat, fmt.Sprintf("--max-count=%d", limit)}
+	if opts.Skip > 0 {
+		args = append(args, fmt.Sprintf("--skip=%d", opts.Skip))
+	}
+	if opts.Path != "" {
+		args = append(args, "--", opts.Path)
+	}
+	output, err := run(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseLog(output), nil
+}
+
+func parseLog(output string) []LogEntry {
+	entries := []LogEntry{}
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x1f")
+		if len(fields) != 6 {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339, fields[4])
+		entries = append(entries, LogEntry{
+			Hash:        fields[0],
+			Parents:     strings.Fields(fields[1]),
+			AuthorName:  fields[2],
+			AuthorEmail: fields[3],
+			Date:        date,
+			Subject:     fields[5],
+		})
+	}
+	return entries
+}
@@ -0,0 +1,90 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// commitFile writes content to name and commits it.
+func commitFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	runGit(t, dir, "add", name)
+	runGit(t, dir, "commit", "-m", "update "+name)
+}
+
+func TestCommit(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, err := Commit(ctx, dir, CommitOptions{Message: "empty"})
+	var gitErr *Error
+	if !errors.As(err, &gitErr) || gitErr.Kind != KindNothingToCommit {
+		t.Fatalf("expected nothing to commit, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0644)
+	runGit(t, dir, "add", "a.txt")
+	hash, err := Commit(ctx, dir, CommitOptions{Message: "add a", SignOff: true})
+	if err != nil {
+		t.Fatalf("Commit() error: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b\n"), 0644)
+	runGit(t, dir, "add", "b.txt")
+	amended, err := Commit(ctx, dir, CommitOptions{Amend: true})
+	if err != nil {
+		t.Fatalf("Commit(amend) error: %v", err)
+	}
+	if amended == hash {
+		t.Error("expected amend to create a new commit")
+	}
+
+	log, err := Log(ctx, dir, LogOptions{})
+	if err != nil {
+		t.Fatalf("Log() error: %v", err)
+	}
+	if len(log) != 1 || log[0].Hash != amended || log[0].Subject != "add a" {
+		t.Fatalf("expected the amended commit alone, got %+v", log)
+	}
+	body, _ := run(ctx, dir, "log", "-1", "--format=%b")
+	if !strings.Contains(body, "Signed-off-by: Test <test@test.com>") {
+		t.Errorf("expected sign-off trailer, got %q", body)
+	}
+}
+
+func TestLog(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	log, err := Log(ctx, dir, LogOptions{})
+	if err != nil || len(log) != 0 {
+		t.Fatalf("expected empty log before the first commit, got %v, %v", log, err)
+	}
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		commitFile(t, dir, name, name)
+	}
+
+	log, err = Log(ctx, dir, LogOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("Log() error: %v", err)
+	}
+	if len(log) != 2 || log[0].Subject != "update c.txt" || log[1].Subject != "update b.txt" {
+		t.Fatalf("expected the two newest commits, got %+v", log)
+	}
+	if len(log[0].Parents) != 1 || log[0].Parents[0] != log[1].Hash {
+		t.Errorf("expected parent link, got %v", log[0].Parents)
+	}
+	if log[0].AuthorEmail != "test@test.com" || log[0].Date.IsZero() {
+		t.Errorf("expected author and date, got %+v", log[0])
+	}
+}
@@ -436,6 +436,7 @@ type DiffResult struct {
 	Diff       string `json:"diff"`
 	OldContent string `json:"old_content"`
 	NewContent string `json:"new_content"`
+	Hash       string `json:"hash,omitempty"` // DiffHash of Diff, for selecting hunks
 }
 
 // DiffWithContent returns the unified diff along with old and new file contents.
@@ -468,6 +469,7 @@ func DiffWithContent(dir, path string, staged bool) (*DiffResult, error) {
 		Diff:       diff,
 		OldContent: oldContent,
 		NewContent: newContent,
+		Hash:       DiffHash(diff),
 	}, nil
 }
 
@@ -0,0 +1,263 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownRevision is returned for a revision that names no commit.
+var ErrUnknownRevision = errors.New("unknown revision")
+
+// CommitDetail is a commit with its message and the files it changed.
+type CommitDetail struct {
+	LogEntry
+	Body  string       `json:"body"`
+	Files []CommitFile `json:"files"`
+}
+
+// CommitFile is a file changed by a commit, diffed against the first parent.
+// The diff and contents are only filled in when the file is requested.
+type CommitFile struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"` // set for renames and copies
+	Status  string `json:"status"`             // "A", "M", "D", "R", "C" or "T"
+	Binary  bool   `json:"binary"`             // contents are left empty
+	DiffResult
+}
+
+// Show returns the commit rev and the files it changed. Without a path only
+// their names and statuses are listed, so large commits stay cheap; a
+// non-empty path limits Files to that file, with its diff and contents.
+func Show(ctx context.Context, dir, rev, path string) (*CommitDetail, error) {
+	hash, err := resolveCommit(ctx, dir, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := run(ctx, dir, "log", "-1", logFormat, hash)
+	if err != nil {
+		return nil, err
+	}
+	entries := parseLog(output)
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("failed to parse commit %s", hash)
+	}
+	body, err := run(ctx, dir, "log", "-1", "--format=%b", hash)
+	if err != nil {
+		return nil, err
+	}
+	detail := &CommitDetail{LogEntry: entries[0], Body: strings.TrimSpace(body), Files: []CommitFile{}}
+
+	// Merges are shown against their first parent, root commits against
+	// the empty tree
+	parent := ""
+	args := []string{"diff-tree", "--no-commit-id", "-r", "-M", "--name-status", "-z", "--root", hash}
+	if len(detail.Parents) > 0 {
+		parent = detail.Parents[0]
+		args = []string{"diff-tree", "-r", "-M", "--name-status", "-z", parent, hash}
+	}
+	output, err = run(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range parseNameStatus(output) {
+		if path == "" {
+			detail.Files = append(detail.Files, file)
+			continue
+		}
+		if file.Path != path && file.OldPath != path {
+			continue
+		}
+		if err := fillCommitDiff(ctx, dir, parent, hash, &file); err != nil {
+			return nil, err
+		}
+		detail.Files = append(detail.Files, file)
+	}
+	return detail, nil
+}
+
+// resolveCommit returns the full hash of the commit rev names.
+func resolveCommit(ctx context.Context, dir, rev string) (string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("%w: %q", ErrUnknownRevision, rev)
+	}
+	hash, err := run(ctx, dir, "rev-parse", "--verify", "--quiet", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrUnknownRevision, rev)
+	}
+	return strings.TrimSpace(hash), nil
+}
+
+// parseNameStatus parses "diff-tree --name-status -z" output.
+func parseNameStatus(output string) []CommitFile {
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+	var files []CommitFile
+	for i := 0; i+1 < len(fields); {
+		status := fields[i]
+		if status == "" {
+			break
+		}
+		file := CommitFile{Status: status[:1], Path: fields[i+1]}
+		i += 2
+		if (file.Status == "R" || file.Status == "C") && i < len(fields) {
+			file.OldPath, file.Path = file.Path, fields[i]
+			i++
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// fillCommitDiff sets the diff of file between parent and hash, with both
+// sides for text files. An empty parent diffs against the empty tree.
+func fillCommitDiff(ctx context.Context, dir, parent, hash string, file *CommitFile) error {
+	oldPath := file.Path
+	if file.OldPath != "" {
+		oldPath = file.OldPath
+	}
+	paths := []string{"--", file.Path}
+	if oldPath != file.Path {
+		paths = append(paths, oldPath)
+	}
+
+	args := []string{"diff", "-M"}
+	if parent == "" {
+		args = append(args, emptyTree(ctx, dir), hash)
+	} else {
+		args = append(args, parent, hash)
+	}
+	diff, err := run(ctx, dir, append(args, paths...)...)
+	if err != nil {
+		return err
+	}
+	file.Diff = diff
+
+	if isBinaryDiff(diff) {
+		file.Binary = true
+		return nil
+	}
+	if parent != "" && file.Status != "A" {
+		file.OldContent, _ = getFileFromRef(dir, parent, oldPath)
+	}
+	if file.Status != "D" {
+		file.NewContent, _ = getFileFromRef(dir, hash, file.Path)
+	}
+	return nil
+}
+
+// emptyTree returns the hash of the empty tree in the repository's object
+// format.
+func emptyTree(ctx context.Context, dir string) string {
+	hash, err := run(ctx, dir, "hash-object", "-t", "tree", "/dev/null")
+	if err != nil {
+		return "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	}
+	return strings.TrimSpace(hash)
+}
+
+func isBinaryDiff(diff string) bool {
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch" {
+			return true
+		}
+		if strings.HasPrefix(line, "@@") {
+			return false
+		}
+	}
+	return false
+}
+
+// BlameCommit is a commit that last changed some lines of a blamed file.
+type BlameCommit struct {
+	Hash        string    `json:"hash"`
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email"`
+	Date        time.Time `json:"date"`
+	Summary     string    `json:"summary"`
+}
+
+// BlameLine is one line of a blamed file.
+type BlameLine struct {
+	Line    int    `json:"line"` // 1-based
+	Hash    string `json:"hash"` // a key of Blame.Commits
+	Content string `json:"content"`
+}
+
+// Blame attributes each line of a file to the commit that last changed it.
+// Commits holds each commit once; uncommitted lines have an all-zero hash.
+type Blame struct {
+	Lines   []BlameLine            `json:"lines"`
+	Commits map[string]BlameCommit `json:"commits"`
+}
+
+// BlameFile blames path at rev, or the file in the worktree when rev is
+// empty.
+func BlameFile(ctx context.Context, dir, path, rev string) (*Blame, error) {
+	args := []string{"blame", "--porcelain"}
+	if rev != "" {
+		hash, err := resolveCommit(ctx, dir, rev)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, hash)
+	}
+	output, err := run(ctx, dir, append(args, "--", path)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlame(output), nil
+}
+
+// parseBlame parses "git blame --porcelain" output. Each line starts with a
+// "<hash> <orig> <final> [<count>]" header, followed by the commit's fields
+// the first time it appears, and ends with the content prefixed by a tab.
+func parseBlame(output string) *Blame {
+	blame := &Blame{Lines: []BlameLine{}, Commits: map[string]BlameCommit{}}
+	var current BlameLine
+	var commit BlameCommit
+	for _, line := range strings.Split(output, "\n") {
+		if content, ok := strings.CutPrefix(line, "\t"); ok {
+			current.Content = content
+			blame.Lines = append(blame.Lines, current)
+			if _, seen := blame.Commits[commit.Hash]; !seen {
+				blame.Commits[commit.Hash] = commit
+			}
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			commit.AuthorName = value
+		case "author-mail":
+			commit.AuthorEmail = strings.Trim(value, "<>")
+		case "author-time":
+			if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+				commit.Date = time.Unix(sec, 0).UTC()
+			}
+		case "summary":
+			commit.Summary = value
+		default:
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(key) < 40 {
+				continue
+			}
+			final, err := strconv.Atoi(fields[2])
+			if err != nil {
+				continue
+			}
+			current = BlameLine{Line: final, Hash: key}
+			if c, seen := blame.Commits[key]; seen {
+				commit = c
+			} else {
+				commit = BlameCommit{Hash: key}
+			}
+		}
+	}
+	return blame
+}
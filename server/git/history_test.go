@@ -0,0 +1,128 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog_PathAndSkip(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	commitFile(t, dir, "a.txt", "1\n")
+	commitFile(t, dir, "b.txt", "1\n")
+	commitFile(t, dir, "a.txt", "2\n")
+
+	log, err := Log(ctx, dir, LogOptions{Path: "a.txt"})
+	if err != nil {
+		t.Fatalf("Log() error: %v", err)
+	}
+	if len(log) != 2 {
+		t.Fatalf("expected 2 commits touching a.txt, got %d", len(log))
+	}
+
+	page, err := Log(ctx, dir, LogOptions{Limit: 1, Skip: 1})
+	if err != nil {
+		t.Fatalf("Log() error: %v", err)
+	}
+	if len(page) != 1 || page[0].Subject != "update b.txt" {
+		t.Errorf("expected the second commit, got %+v", page)
+	}
+}
+
+func TestShow(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	commitFile(t, dir, "a.txt", "old\n")
+	detail, err := Show(ctx, dir, "HEAD", "a.txt")
+	if err != nil {
+		t.Fatalf("Show(root) error: %v", err)
+	}
+	if len(detail.Files) != 1 || detail.Files[0].Status != "A" || detail.Files[0].NewContent != "old\n" {
+		t.Fatalf("expected a.txt to be added, got %+v", detail.Files)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("new\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "bin.dat"), []byte{0, 1, 2}, 0644)
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-m", "change", "-m", "details")
+
+	detail, err = Show(ctx, dir, "HEAD", "")
+	if err != nil {
+		t.Fatalf("Show() error: %v", err)
+	}
+	if detail.Subject != "change" || detail.Body != "details" || len(detail.Files) != 2 {
+		t.Fatalf("unexpected commit detail: %+v", detail)
+	}
+	// Without a path only names and statuses are listed
+	for _, f := range detail.Files {
+		if f.Status == "" || f.Diff != "" || f.OldContent != "" || f.NewContent != "" {
+			t.Errorf("expected %s without diff or contents: %+v", f.Path, f)
+		}
+	}
+
+	detail, err = Show(ctx, dir, "HEAD", "a.txt")
+	if err != nil || len(detail.Files) != 1 {
+		t.Fatalf("expected only a.txt, got %+v, %v", detail, err)
+	}
+	if f := detail.Files[0]; f.Status != "M" || f.OldContent != "old\n" || f.NewContent != "new\n" || f.Diff == "" {
+		t.Errorf("unexpected a.txt diff: %+v", f)
+	}
+	detail, _ = Show(ctx, dir, "HEAD", "bin.dat")
+	if f := detail.Files[0]; !f.Binary || f.NewContent != "" {
+		t.Errorf("expected bin.dat to be binary without contents: %+v", f)
+	}
+
+	runGit(t, dir, "mv", "a.txt", "c.txt")
+	runGit(t, dir, "commit", "-m", "rename")
+	detail, _ = Show(ctx, dir, "HEAD", "")
+	if len(detail.Files) != 1 || detail.Files[0].Status != "R" || detail.Files[0].OldPath != "a.txt" || detail.Files[0].Path != "c.txt" {
+		t.Errorf("expected rename, got %+v", detail.Files)
+	}
+
+	if _, err := Show(ctx, dir, "--all", ""); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("expected unknown revision, got %v", err)
+	}
+}
+
+func TestBlameFile(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	commitFile(t, dir, "a.txt", "one\ntwo\n")
+	first, _ := Log(ctx, dir, LogOptions{})
+	commitFile(t, dir, "a.txt", "one\nTWO\nthree\n")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\nTWO\nthree\nfour\n"), 0644)
+
+	blame, err := BlameFile(ctx, dir, "a.txt", "")
+	if err != nil {
+		t.Fatalf("BlameFile() error: %v", err)
+	}
+	if len(blame.Lines) != 4 {
+		t.Fatalf("expected 4 lines, got %+v", blame.Lines)
+	}
+	if blame.Lines[0].Hash != first[0].Hash || blame.Lines[0].Content != "one" {
+		t.Errorf("expected line 1 from the first commit, got %+v", blame.Lines[0])
+	}
+	if blame.Lines[1].Hash == first[0].Hash || blame.Lines[1].Line != 2 {
+		t.Errorf("expected line 2 from the second commit, got %+v", blame.Lines[1])
+	}
+	if c := blame.Commits[first[0].Hash]; c.Summary != "update a.txt" || c.AuthorEmail != "test@test.com" || c.Date.IsZero() {
+		t.Errorf("unexpected commit info: %+v", c)
+	}
+	if len(blame.Commits) != 3 {
+		t.Errorf("expected two commits and the uncommitted line, got %d", len(blame.Commits))
+	}
+
+	blame, err = BlameFile(ctx, dir, "a.txt", first[0].Hash)
+	if err != nil || len(blame.Lines) != 2 || blame.Lines[1].Content != "two" {
+		t.Errorf("expected blame at the first commit, got %+v, %v", blame, err)
+	}
+}
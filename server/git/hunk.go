@@ -0,0 +1,312 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSelection is returned for a hunk selection that does not match
+// the diff.
+var ErrInvalidSelection = errors.New("invalid hunk selection")
+
+// HunkSelection picks changes from one hunk of a file's diff.
+type HunkSelection struct {
+	Hunk  int         `json:"hunk"`            // 0-based index of the hunk in the diff
+	Lines []LineRange `json:"lines,omitempty"` // empty selects the whole hunk
+}
+
+// LineRange is a range of lines in a hunk's body, the lines after its "@@"
+// header, from Start up to but not including End, counting from 0.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// DiffHash identifies a diff so a selection made against it can be checked
+// before it is applied.
+func DiffHash(diff string) string {
+	sum := sha256.Sum256([]byte(diff))
+	return hex.EncodeToString(sum[:])
+}
+
+// StageHunks stages the selected changes of path's unstaged diff. hash is
+// the DiffHash of the diff the selection was made against; KindStale is
+// returned if the diff has changed since.
+func StageHunks(ctx context.Context, dir, path, hash string, sel []HunkSelection) error {
+	return applyHunks(ctx, dir, path, hash, sel, false, true, false)
+}
+
+// UnstageHunks unstages the selected changes of path's staged diff.
+func UnstageHunks(ctx context.Context, dir, path, hash string, sel []HunkSelection) error {
+	return applyHunks(ctx, dir, path, hash, sel, true, true, true)
+}
+
+// applyHunks builds a patch of the selected changes from path's staged or
+// unstaged diff and applies it to the index or the worktree, forward or in
+// reverse.
+func applyHunks(ctx context.Context, dir, path, hash string, sel []HunkSelection, staged, index, reverse bool) error {
+	patch, err := hunkPatch(dir, path, hash, sel, staged, reverse)
+	if err != nil {
+		return err
+	}
+	return applyPatch(ctx, dir, path, patch, index, reverse)
+}
+
+// hunkPatch checks a selection against path's staged or unstaged diff and
+// builds the patch of the selected changes.
+func hunkPatch(dir, path, hash string, sel []HunkSelection, staged, reverse bool) (string, error) {
+	if err := validatePath(path); err != nil {
+		return "", err
+	}
+	if len(sel) == 0 {
+		return "", fmt.Errorf("%w: nothing selected", ErrInvalidSelection)
+	}
+
+	diff, err := Diff(dir, path, staged)
+	if err != nil {
+		return "", err
+	}
+	if DiffHash(diff) != hash {
+		return "", &Error{Kind: KindStale}
+	}
+	return buildPatch(diff, sel, reverse)
+}
+
+// applyPatch applies patch to path with "git apply".
+func applyPatch(ctx context.Context, dir, path, patch string, index, reverse bool) error {
+	actualDir, _ := resolveSubmodulePath(dir, path)
+	args := []string{"apply", "--recount"}
+	if index {
+		args = append(args, "--cached")
+	}
+	if reverse {
+		args = append(args, "--reverse")
+	}
+	cmd := exec.CommandContext(ctx, "git", append(args, "-")...)
+	cmd.Dir = actualDir
+	cmd.Env = commandEnv()
+	cmd.Stdin = strings.NewReader(patch)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git apply failed: %w (output: %s)", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+type hunk struct {
+	oldStart, newStart int
+	section            string // text after the closing "@@"
+	lines              []string
+}
+
+// buildPatch keeps the selected changes of diff. Unselected changes become
+// context on the side the patch is applied to and are dropped from the
+// other: applied forward the old side must match, so an unselected "-" line
+// stays as context and an unselected "+" line goes; applied in reverse it
+// is the other way round.
+func buildPatch(diff string, sel []HunkSelection, reverse bool) (string, error) {
+	header, hunks, err := parseHunks(diff)
+	if err != nil {
+		return "", err
+	}
+	if isBinaryDiff(diff) {
+		return "", fmt.Errorf("%w: binary files cannot be split", ErrInvalidSelection)
+	}
+
+	selected := make([][]bool, len(hunks))
+	for _, s := range sel {
+		if s.Hunk < 0 || s.Hunk >= len(hunks) {
+			return "", fmt.Errorf("%w: no hunk %d", ErrInvalidSelection, s.Hunk)
+		}
+		h := hunks[s.Hunk]
+		if selected[s.Hunk] == nil {
+			selected[s.Hunk] = make([]bool, len(h.lines))
+		}
+		if len(s.Lines) == 0 {
+			for i := range h.lines {
+				selected[s.Hunk][i] = true
+			}
+		}
+		for _, r := range s.Lines {
+			if r.Start < 0 || r.End > len(h.lines) || r.Start >= r.End {
+				return "", fmt.Errorf("%w: lines %d-%d of hunk %d", ErrInvalidSelection, r.Start, r.End, s.Hunk)
+			}
+			for i := r.Start; i < r.End; i++ {
+				selected[s.Hunk][i] = true
+			}
+		}
+	}
+
+	var body strings.Builder
+	partial := false
+	delta := 0 // lines the changed side has gained over the matching side so far
+	for i, h := range hunks {
+		var lines []string
+		oldCount, newCount, changes := 0, 0, 0
+		kept := false // whether the previous line was kept, for "\" markers
+		for j, line := range h.lines {
+			op, isSelected := line[0], selected[i] != nil && selected[i][j]
+			if (op == '+' || op == '-') && !isSelected {
+				partial = true
+				if (op == '-') != reverse {
+					op = ' '
+				} else {
+					kept = false
+					continue
+				}
+			}
+			switch op {
+			case '\\':
+				if kept {
+					lines = append(lines, line)
+				}
+				continue
+			case ' ':
+				oldCount++
+				newCount++
+			case '-':
+				oldCount++
+				changes++
+			case '+':
+				newCount++
+				changes++
+			}
+			kept = true
+			lines = append(lines, string(op)+line[1:])
+		}
+		if changes == 0 {
+			continue
+		}
+
+		oldStart, newStart := h.oldStart, h.newStart
+		if reverse {
+			oldStart = hunkStart(newStart, newCount, oldCount, -delta)
+		} else {
+			newStart = hunkStart(oldStart, oldCount, newCount, delta)
+		}
+		delta += newCount - oldCount
+		fmt.Fprintf(&body, "@@ -%d,%d +%d,%d @@%s\n", oldStart, oldCount, newStart, newCount, h.section)
+		for _, line := range lines {
+			body.WriteString(line + "\n")
+		}
+	}
+	if body.Len() == 0 {
+		return "", fmt.Errorf("%w: no changes selected", ErrInvalidSelection)
+	}
+	return patchHeader(header, partial, reverse) + body.String(), nil
+}
+
+// hunkStart returns the start of the other side of a hunk whose side with
+// count lines starts at start. A side without lines names the line before
+// its position.
+func hunkStart(start, count, otherCount, delta int) int {
+	first := start + delta
+	if count == 0 {
+		first++
+	}
+	if otherCount == 0 {
+		return first - 1
+	}
+	return first
+}
+
+// patchHeader drops the blob hashes, which no longer match a partial patch.
+// A partial patch of a new or deleted file leaves the file in place, so it
+// becomes a modification.
+func patchHeader(header []string, partial, reverse bool) string {
+	var b strings.Builder
+	for _, line := range header {
+		switch {
+		case strings.HasPrefix(line, "index "):
+			continue
+		case partial && !reverse && strings.HasPrefix(line, "deleted file mode "):
+			continue
+		case partial && reverse && strings.HasPrefix(line, "new file mode "):
+			continue
+		case partial && !reverse && line == "+++ /dev/null":
+			line = "+++ b/" + strings.TrimPrefix(headerPath(header, "--- "), "a/")
+		case partial && reverse && line == "--- /dev/null":
+			line = "--- a/" + strings.TrimPrefix(headerPath(header, "+++ "), "b/")
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func headerPath(header []string, prefix string) string {
+	for _, line := range header {
+		if p, ok := strings.CutPrefix(line, prefix); ok {
+			return p
+		}
+	}
+	return ""
+}
+
+// parseHunks splits a single-file unified diff into its header and hunks.
+func parseHunks(diff string) ([]string, []hunk, error) {
+	var header []string
+	var hunks []hunk
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if strings.HasPrefix(line, "@@ ") {
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, nil, err
+			}
+			hunks = append(hunks, h)
+			continue
+		}
+		if len(hunks) == 0 {
+			header = append(header, line)
+			continue
+		}
+		if line == "" {
+			line = " " // some tools strip the space of empty context lines
+		}
+		switch line[0] {
+		case ' ', '+', '-', '\\':
+			hunks[len(hunks)-1].lines = append(hunks[len(hunks)-1].lines, line)
+		default:
+			return nil, nil, fmt.Errorf("unexpected diff line: %q", line)
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, nil, fmt.Errorf("%w: diff has no hunks", ErrInvalidSelection)
+	}
+	return header, hunks, nil
+}
+
+// parseHunkHeader parses "@@ -1,2 +1,3 @@ section".
+func parseHunkHeader(line string) (hunk, error) {
+	ranges, section, ok := strings.Cut(strings.TrimPrefix(line, "@@ "), " @@")
+	oldRange, newRange, ok2 := strings.Cut(ranges, " ")
+	if !ok || !ok2 {
+		return hunk{}, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	oldStart, err := rangeStart(oldRange, "-")
+	if err != nil {
+		return hunk{}, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	newStart, err := rangeStart(newRange, "+")
+	if err != nil {
+		return hunk{}, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	return hunk{oldStart: oldStart, newStart: newStart, section: section}, nil
+}
+
+func rangeStart(r, prefix string) (int, error) {
+	r, ok := strings.CutPrefix(r, prefix)
+	if !ok {
+		return 0, fmt.Errorf("missing %q", prefix)
+	}
+	start, _, _ := strings.Cut(r, ",")
+	return strconv.Atoi(start)
+}
@@ -0,0 +1,167 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// twoHunkFile commits a 20-line file and changes lines 2 and 18, giving an
+// unstaged diff with two hunks.
+func twoHunkFile(t *testing.T, dir string) {
+	t.Helper()
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, "line")
+	}
+	commitFile(t, dir, "a.txt", strings.Join(lines, "\n")+"\n")
+	lines[1] = "changed 2"
+	lines[17] = "changed 18"
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func stagedContent(t *testing.T, dir, path string) string {
+	t.Helper()
+	content, _ := getFileFromIndex(dir, path)
+	return content
+}
+
+func TestStageHunks(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	twoHunkFile(t, dir)
+
+	diff, _ := Diff(dir, "a.txt", false)
+	if err := StageHunks(ctx, dir, "a.txt", "stale", []HunkSelection{{Hunk: 0}}); !isKind(err, KindStale) {
+		t.Fatalf("expected stale error, got %v", err)
+	}
+	if err := StageHunks(ctx, dir, "a.txt", DiffHash(diff), []HunkSelection{{Hunk: 2}}); !errors.Is(err, ErrInvalidSelection) {
+		t.Fatalf("expected invalid selection, got %v", err)
+	}
+
+	if err := StageHunks(ctx, dir, "a.txt", DiffHash(diff), []HunkSelection{{Hunk: 1}}); err != nil {
+		t.Fatalf("StageHunks() error: %v", err)
+	}
+	index := stagedContent(t, dir, "a.txt")
+	if strings.Contains(index, "changed 2") || !strings.Contains(index, "changed 18") {
+		t.Errorf("expected only the second hunk staged, got %q", index)
+	}
+
+	// Unstage it again through the staged diff
+	staged, _ := Diff(dir, "a.txt", true)
+	if err := UnstageHunks(ctx, dir, "a.txt", DiffHash(staged), []HunkSelection{{Hunk: 0}}); err != nil {
+		t.Fatalf("UnstageHunks() error: %v", err)
+	}
+	if staged, _ := Diff(dir, "a.txt", true); staged != "" {
+		t.Errorf("expected nothing staged, got %q", staged)
+	}
+}
+
+func TestStageHunks_Lines(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	commitFile(t, dir, "a.txt", "one\ntwo\nthree\n")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\nTWO\nthree\nfour\n"), 0644)
+
+	// Body: " one", "-two", "+TWO", " three", "+four"
+	diff, _ := Diff(dir, "a.txt", false)
+	sel := []HunkSelection{{Hunk: 0, Lines: []LineRange{{Start: 4, End: 5}}}}
+	if err := StageHunks(ctx, dir, "a.txt", DiffHash(diff), sel); err != nil {
+		t.Fatalf("StageHunks() error: %v", err)
+	}
+	if index := stagedContent(t, dir, "a.txt"); index != "one\ntwo\nthree\nfour\n" {
+		t.Errorf("expected only the added line staged, got %q", index)
+	}
+
+	// The rest is discarded from the worktree
+	diff, _ = Diff(dir, "a.txt", false)
+	if _, err := NewTrash(t.TempDir()).DiscardHunks(ctx, dir, "a.txt", DiffHash(diff), []HunkSelection{{Hunk: 0}}); err != nil {
+		t.Fatalf("DiscardHunks() error: %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if string(content) != "one\ntwo\nthree\nfour\n" {
+		t.Errorf("expected the worktree to match the index, got %q", content)
+	}
+}
+
+func TestDiscardHunks_KeepsUnselected(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	twoHunkFile(t, dir)
+
+	before, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	trash := NewTrash(t.TempDir())
+
+	diff, _ := Diff(dir, "a.txt", false)
+	if _, err := trash.DiscardHunks(ctx, dir, "a.txt", "stale", []HunkSelection{{Hunk: 0}}); err == nil {
+		t.Fatal("expected a stale selection to be rejected")
+	}
+	entry, err := trash.DiscardHunks(ctx, dir, "a.txt", DiffHash(diff), []HunkSelection{{Hunk: 0}})
+	if err != nil {
+		t.Fatalf("DiscardHunks() error: %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if strings.Contains(string(content), "changed 2") || !strings.Contains(string(content), "changed 18") {
+		t.Errorf("expected only the first hunk discarded, got %q", content)
+	}
+
+	// The whole file as it was can be restored
+	if entries, _ := trash.List(); len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Fatalf("expected only the discard in the trash, got %+v", entries)
+	}
+	if _, err := trash.Restore(ctx, dir, entry.ID); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(content) != string(before) {
+		t.Errorf("expected the discarded hunk back, got %q", content)
+	}
+}
+
+func TestStageHunks_NewAndDeletedFile(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	commitFile(t, dir, "old.txt", "a\nb\n")
+
+	// Part of an untracked file
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("x\ny\n"), 0644)
+	diff, _ := Diff(dir, "new.txt", false)
+	sel := []HunkSelection{{Hunk: 0, Lines: []LineRange{{Start: 0, End: 1}}}}
+	if err := StageHunks(ctx, dir, "new.txt", DiffHash(diff), sel); err != nil {
+		t.Fatalf("StageHunks(new) error: %v", err)
+	}
+	if index := stagedContent(t, dir, "new.txt"); index != "x\n" {
+		t.Errorf("expected the first line staged, got %q", index)
+	}
+
+	// Part of a deletion keeps the file
+	os.Remove(filepath.Join(dir, "old.txt"))
+	diff, _ = Diff(dir, "old.txt", false)
+	if err := StageHunks(ctx, dir, "old.txt", DiffHash(diff), sel); err != nil {
+		t.Fatalf("StageHunks(deleted) error: %v", err)
+	}
+	if index := stagedContent(t, dir, "old.txt"); index != "b\n" {
+		t.Errorf("expected one line removed in the index, got %q", index)
+	}
+
+	// Unstaging part of the staged new file keeps it in the index
+	runGit(t, dir, "add", "new.txt")
+	staged, _ := Diff(dir, "new.txt", true)
+	if err := UnstageHunks(ctx, dir, "new.txt", DiffHash(staged), []HunkSelection{{Hunk: 0, Lines: []LineRange{{Start: 1, End: 2}}}}); err != nil {
+		t.Fatalf("UnstageHunks(new) error: %v", err)
+	}
+	if index := stagedContent(t, dir, "new.txt"); index != "x\n" {
+		t.Errorf("expected the second line unstaged, got %q", index)
+	}
+}
+
+func isKind(err error, kind string) bool {
+	var gitErr *Error
+	return errors.As(err, &gitErr) && gitErr.Kind == kind
+}
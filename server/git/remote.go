@@ -0,0 +1,102 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Fetch updates remote-tracking branches from all remotes and prunes those
+// deleted on the remote.
+func Fetch(ctx context.Context, dir string) error {
+	output, err := run(ctx, dir, "fetch", "--all", "--prune")
+	return classifyRemote(output, err)
+}
+
+// Pull rebases the current branch onto its upstream, stashing local changes
+// around the rebase. On a conflict the rebase is aborted, leaving the
+// worktree as it was, and KindConflict names the conflicting files.
+func Pull(ctx context.Context, dir string) error {
+	output, err := run(ctx, dir, "pull", "--rebase", "--autostash")
+	if err == nil {
+		return nil
+	}
+	if !strings.Contains(output, "CONFLICT") && !inRebase(ctx, dir) {
+		return classifyRemote(output, err)
+	}
+
+	files := conflictedFiles(ctx, dir)
+	if _, abortErr := run(ctx, dir, "rebase", "--abort"); abortErr != nil {
+		return abortErr
+	}
+	return &Error{Kind: KindConflict, Files: files, Output: output}
+}
+
+// PushOptions configures Push.
+type PushOptions struct {
+	// ForceWithLease overwrites the remote branch unless it moved since the
+	// last fetch.
+	ForceWithLease bool
+}
+
+// Push pushes the current branch to its upstream. A branch without an
+// upstream is pushed to a same-named branch on origin and tracks it.
+func Push(ctx context.Context, dir string, opts PushOptions) error {
+	args := []string{"push"}
+	if opts.ForceWithLease {
+		args = append(args, "--force-with-lease")
+	}
+	if _, err := run(ctx, dir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}"); err != nil {
+		args = append(args, "--set-upstream", "origin", "HEAD")
+	}
+
+	output, err := run(ctx, dir, args...)
+	if err != nil && (strings.Contains(output, "[rejected]") || strings.Contains(output, "[remote rejected]")) {
+		return &Error{Kind: KindRejected, Output: output}
+	}
+	return classifyRemote(output, err)
+}
+
+// classifyRemote turns a remote failure caused by credentials into KindAuth.
+func classifyRemote(output string, err error) error {
+	if err != nil && authFailed(output) {
+		return &Error{Kind: KindAuth, Output: output}
+	}
+	return err
+}
+
+// inRebase reports whether a rebase stopped partway.
+func inRebase(ctx context.Context, dir string) bool {
+	for _, name := range []string{"rebase-merge", "rebase-apply"} {
+		path, err := run(ctx, dir, "rev-parse", "--git-path", name)
+		if err == nil && isDir(dir, strings.TrimSpace(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictedFiles lists the paths with unresolved conflicts.
+func conflictedFiles(ctx context.Context, dir string) []string {
+	output, err := run(ctx, dir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files
+}
+
+// isDir reports whether path, relative to dir unless absolute, is a directory.
+func isDir(dir, path string) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
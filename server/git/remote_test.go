@@ -0,0 +1,95 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// setupClones creates a bare origin with one commit and two clones of it.
+func setupClones(t *testing.T) (string, string) {
+	t.Helper()
+	origin := t.TempDir()
+	runGit(t, origin, "init", "--bare")
+
+	seed, cleanup := setupTestRepo(t)
+	t.Cleanup(cleanup)
+	commitFile(t, seed, "a.txt", "a\n")
+	runGit(t, seed, "remote", "add", "origin", origin)
+	runGit(t, seed, "push", "origin", "HEAD:refs/heads/main")
+	runGit(t, origin, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	clone := func() string {
+		dir := t.TempDir()
+		if out, err := exec.Command("git", "clone", origin, dir).CombinedOutput(); err != nil {
+			t.Fatalf("git clone failed: %v\n%s", err, out)
+		}
+		runGit(t, dir, "config", "user.email", "test@test.com")
+		runGit(t, dir, "config", "user.name", "Test")
+		return dir
+	}
+	return clone(), clone()
+}
+
+func TestPushAndPull(t *testing.T) {
+	ctx := context.Background()
+	a, b := setupClones(t)
+
+	commitFile(t, a, "a.txt", "from a\n")
+	if err := Push(ctx, a, PushOptions{}); err != nil {
+		t.Fatalf("Push() error: %v", err)
+	}
+
+	// b is behind now, so its push is rejected
+	commitFile(t, b, "b.txt", "from b\n")
+	var gitErr *Error
+	if err := Push(ctx, b, PushOptions{}); !errors.As(err, &gitErr) || gitErr.Kind != KindRejected {
+		t.Fatalf("expected rejected push, got %v", err)
+	}
+
+	if err := Pull(ctx, b); err != nil {
+		t.Fatalf("Pull() error: %v", err)
+	}
+	if err := Push(ctx, b, PushOptions{}); err != nil {
+		t.Fatalf("Push() after pull error: %v", err)
+	}
+
+	// A new branch gets an upstream on its first push
+	CreateBranch(ctx, a, "feature", "", true)
+	if err := Push(ctx, a, PushOptions{}); err != nil {
+		t.Fatalf("Push() of new branch error: %v", err)
+	}
+	if err := Fetch(ctx, b); err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	branches, _ := Branches(ctx, a)
+	for _, br := range branches {
+		if br.Name == "feature" && br.Upstream != "origin/feature" {
+			t.Errorf("expected feature to track origin/feature, got %q", br.Upstream)
+		}
+	}
+}
+
+func TestPull_ConflictAborts(t *testing.T) {
+	ctx := context.Background()
+	a, b := setupClones(t)
+
+	commitFile(t, a, "a.txt", "from a\n")
+	if err := Push(ctx, a, PushOptions{}); err != nil {
+		t.Fatalf("Push() error: %v", err)
+	}
+	commitFile(t, b, "a.txt", "from b\n")
+	head, _ := run(ctx, b, "rev-parse", "HEAD")
+
+	var gitErr *Error
+	if err := Pull(ctx, b); !errors.As(err, &gitErr) || gitErr.Kind != KindConflict {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if len(gitErr.Files) != 1 || gitErr.Files[0] != "a.txt" {
+		t.Errorf("expected a.txt to conflict, got %v", gitErr.Files)
+	}
+	if after, _ := run(ctx, b, "rev-parse", "HEAD"); after != head || inRebase(ctx, b) {
+		t.Error("expected the rebase to be aborted")
+	}
+}
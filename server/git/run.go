@@ -0,0 +1,83 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Kinds of Error.
+const (
+	KindConflict        = "conflict"          // Files could not be merged
+	KindRejected        = "rejected"          // the remote refused the push
+	KindNothingToCommit = "nothing_to_commit" // the index matches HEAD
+	KindDirty           = "dirty"             // local changes would be overwritten
+	KindNotMerged       = "not_merged"        // the branch has unmerged commits
+	KindAuth            = "auth_failed"       // the remote refused the credentials
+	KindStale           = "stale"             // the diff changed since it was fetched
+)
+
+// Error is a git failure the user can act on, such as a conflict or a
+// rejected push.
+type Error struct {
+	Kind   string
+	Files  []string // conflicted paths for KindConflict
+	Output string   // git's output
+}
+
+func (e *Error) Error() string {
+	switch e.Kind {
+	case KindConflict:
+		return "merge conflict in " + strings.Join(e.Files, ", ")
+	case KindRejected:
+		return "push rejected by the remote; pull first"
+	case KindNothingToCommit:
+		return "nothing to commit"
+	case KindDirty:
+		return "local changes would be overwritten"
+	case KindNotMerged:
+		return "branch is not fully merged"
+	case KindAuth:
+		return "authentication with the remote failed"
+	case KindStale:
+		return "the diff has changed; reload it and select again"
+	}
+	return e.Kind
+}
+
+// run executes git in dir and returns its combined output. Credential
+// prompts are disabled so commands against remotes fail instead of hanging;
+// credentials come from the helper configured by Init.
+func run(ctx context.Context, dir string, args ...string) (string, error) {
+	return runEnv(ctx, dir, nil, args...)
+}
+
+// runEnv is run with additional environment variables.
+func runEnv(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = commandEnv(env...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("git %s failed: %w (output: %s)", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// commandEnv is the environment git runs in. The C locale keeps messages in
+// English, since conflicts and auth failures are recognized by their output.
+func commandEnv(extra ...string) []string {
+	return append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "LC_ALL=C"), extra...)
+}
+
+// authFailed reports whether git output shows rejected or missing credentials.
+func authFailed(output string) bool {
+	for _, s := range []string{"Authentication failed", "could not read Username", "Permission denied", "terminal prompts disabled"} {
+		if strings.Contains(output, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,489 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pockode/server/fsutil"
+)
+
+const (
+	// MaxTrashEntries is the number of discards kept; older ones are
+	// dropped.
+	MaxTrashEntries = 50
+	// MaxTrashFileSize is the largest file Discard keeps a copy of.
+	MaxTrashFileSize = 10 << 20
+)
+
+var (
+	// ErrNoChanges is returned when the paths to discard have no changes.
+	ErrNoChanges = errors.New("no changes to discard")
+	// ErrTrashNotFound is returned for an unknown or already restored
+	// discard.
+	ErrTrashNotFound = errors.New("discard not found")
+	// ErrTooLarge is returned when a file is too large to keep in the trash.
+	ErrTooLarge = errors.New("file too large to discard safely")
+)
+
+// TrashEntry describes a discard that can be restored.
+type TrashEntry struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Staged    bool      `json:"staged"` // the index was reset to HEAD too
+	Paths     []string  `json:"paths"`  // files discarded
+}
+
+// trashRecord is a TrashEntry with the discarded content.
+type trashRecord struct {
+	TrashEntry
+	Files []trashFile `json:"files"`
+}
+
+type trashFile struct {
+	Path     string    `json:"path"`
+	Worktree *snapshot `json:"worktree"`        // nil if the file was missing
+	Index    *snapshot `json:"index,omitempty"` // staged discards only
+	InIndex  bool      `json:"in_index"`
+	After    string    `json:"after"` // stateHash of the file after the discard
+}
+
+// snapshot is the content of a file in the worktree or the index.
+type snapshot struct {
+	Mode    string `json:"mode"` // git mode, e.g. "100644", "100755" or "120000"
+	Content []byte `json:"content"`
+}
+
+// Trash keeps the content thrown away by Discard and DiscardHunks so it can
+// be restored.
+type Trash struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewTrash returns a Trash that stores discards in dir.
+func NewTrash(dir string) *Trash {
+	return &Trash{dir: dir}
+}
+
+// Discard throws away the changes to paths in the worktree dir: tracked
+// files are restored from the index, or from HEAD together with the index
+// when staged is set, and untracked files are deleted. Paths may name
+// directories. The discarded content is kept first so Restore can bring it
+// back.
+func (t *Trash) Discard(ctx context.Context, dir string, paths []string, staged bool) (*TrashEntry, error) {
+	for _, path := range paths {
+		if err := validatePath(path); err != nil {
+			return nil, err
+		}
+	}
+	if len(paths) == 0 {
+		return nil, ErrNoChanges
+	}
+
+	tracked, untracked, err := discardable(ctx, dir, paths, staged)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracked) == 0 && len(untracked) == 0 {
+		return nil, ErrNoChanges
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	record := &trashRecord{TrashEntry: TrashEntry{
+		ID:        uuid.Must(uuid.NewV7()).String(),
+		CreatedAt: time.Now(),
+		Staged:    staged,
+		Paths:     slices.Concat(tracked, untracked),
+	}}
+	for _, path := range record.Paths {
+		file := trashFile{Path: path}
+		if file.Worktree, err = readWorktree(dir, path); err != nil {
+			return nil, err
+		}
+		if staged {
+			if file.Index, err = readIndex(ctx, dir, path); err != nil {
+				return nil, err
+			}
+			file.InIndex = file.Index != nil
+		}
+		record.Files = append(record.Files, file)
+	}
+	if err := t.save(record); err != nil {
+		return nil, fmt.Errorf("save trash: %w", err)
+	}
+
+	if len(tracked) > 0 {
+		args := []string{"--literal-pathspecs", "restore", "--worktree"}
+		if staged {
+			args = append(args, "--source=HEAD", "--staged")
+		}
+		if _, err := run(ctx, dir, append(append(args, "--"), tracked...)...); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range untracked {
+		if err := os.Remove(filepath.Join(dir, path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		removeEmptyParents(dir, path)
+	}
+
+	for i := range record.Files {
+		after, err := readWorktree(dir, record.Files[i].Path)
+		if err != nil {
+			return nil, err
+		}
+		record.Files[i].After = stateHash(after)
+	}
+	if err := t.save(record); err != nil {
+		return nil, fmt.Errorf("save trash: %w", err)
+	}
+	return &record.TrashEntry, nil
+}
+
+// DiscardHunks reverts the selected changes of path's unstaged diff in the
+// worktree dir. hash is the DiffHash of the diff the selection was made
+// against. The file's content is kept first so Restore can bring it back.
+func (t *Trash) DiscardHunks(ctx context.Context, dir, path, hash string, sel []HunkSelection) (*TrashEntry, error) {
+	patch, err := hunkPatch(dir, path, hash, sel, false, true)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	file := trashFile{Path: path}
+	if file.Worktree, err = readWorktree(dir, path); err != nil {
+		return nil, err
+	}
+	record := &trashRecord{
+		TrashEntry: TrashEntry{
+			ID:        uuid.Must(uuid.NewV7()).String(),
+			CreatedAt: time.Now(),
+			Paths:     []string{path},
+		},
+		Files: []trashFile{file},
+	}
+	if err := t.save(record); err != nil {
+		return nil, fmt.Errorf("save trash: %w", err)
+	}
+
+	if err := applyPatch(ctx, dir, path, patch, false, true); err != nil {
+		os.Remove(t.path(record.ID))
+		return nil, err
+	}
+
+	after, err := readWorktree(dir, path)
+	if err != nil {
+		return nil, err
+	}
+	record.Files[0].After = stateHash(after)
+	if err := t.save(record); err != nil {
+		return nil, fmt.Errorf("save trash: %w", err)
+	}
+	return &record.TrashEntry, nil
+}
+
+// Restore puts the content thrown away by discard id back into the
+// worktree dir, and into the index for a staged discard. If a file has
+// changed since the discard nothing is restored and KindDirty names the
+// changed files.
+func (t *Trash) Restore(ctx context.Context, dir, id string) (*TrashEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	record, err := t.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, file := range record.Files {
+		current, err := readWorktree(dir, file.Path)
+		if err != nil {
+			return nil, err
+		}
+		if file.After != "" && stateHash(current) != file.After {
+			changed = append(changed, file.Path)
+		}
+	}
+	if len(changed) > 0 {
+		return nil, &Error{Kind: KindDirty, Files: changed}
+	}
+
+	for _, file := range record.Files {
+		if err := writeWorktree(dir, file.Path, file.Worktree); err != nil {
+			return nil, err
+		}
+		if record.Staged {
+			if err := writeIndex(ctx, dir, file.Path, file.Index); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := os.Remove(t.path(id)); err != nil {
+		return nil, err
+	}
+	return &record.TrashEntry, nil
+}
+
+// List returns the discards that can be restored, newest first.
+func (t *Trash) List() ([]TrashEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids, err := t.ids()
+	if err != nil {
+		return nil, err
+	}
+	entries := []TrashEntry{}
+	for _, id := range slices.Backward(ids) {
+		data, err := os.ReadFile(t.path(id))
+		if err != nil {
+			return nil, err
+		}
+		var entry TrashEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// discardable lists the changed files below paths: tracked files that
+// differ from the index, or from HEAD when staged is set, and untracked
+// files that are not ignored.
+func discardable(ctx context.Context, dir string, paths []string, staged bool) (tracked, untracked []string, err error) {
+	args := []string{"--literal-pathspecs", "diff", "--name-only", "-z"}
+	if staged {
+		if _, err := run(ctx, dir, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+			return nil, nil, fmt.Errorf("no commits to restore from")
+		}
+		args = append(args, "HEAD")
+	}
+	output, err := run(ctx, dir, append(append(args, "--"), paths...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracked = splitNul(output)
+
+	output, err = run(ctx, dir, append([]string{"--literal-pathspecs", "ls-files", "--others", "--exclude-standard", "-z", "--"}, paths...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tracked, splitNul(output), nil
+}
+
+func splitNul(output string) []string {
+	var items []string
+	for _, item := range strings.Split(output, "\x00") {
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func readWorktree(dir, path string) (*snapshot, error) {
+	full := filepath.Join(dir, path)
+	info, err := os.Lstat(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(full)
+		if err != nil {
+			return nil, err
+		}
+		return &snapshot{Mode: "120000", Content: []byte(target)}, nil
+	case !info.Mode().IsRegular():
+		return nil, fmt.Errorf("cannot discard %s: not a regular file", path)
+	case info.Size() > MaxTrashFileSize:
+		return nil, fmt.Errorf("%w: %s", ErrTooLarge, path)
+	}
+
+	content, err := os.ReadFile(full)
+	if err != nil {
+		return nil, err
+	}
+	mode := "100644"
+	if info.Mode()&0111 != 0 {
+		mode = "100755"
+	}
+	return &snapshot{Mode: mode, Content: content}, nil
+}
+
+func writeWorktree(dir, path string, snap *snapshot) error {
+	full := filepath.Join(dir, path)
+	if err := os.Remove(full); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if snap == nil {
+		removeEmptyParents(dir, path)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+	if snap.Mode == "120000" {
+		return os.Symlink(string(snap.Content), full)
+	}
+	perm := fs.FileMode(0644)
+	if snap.Mode == "100755" {
+		perm = 0755
+	}
+	return os.WriteFile(full, snap.Content, perm)
+}
+
+func readIndex(ctx context.Context, dir, path string) (*snapshot, error) {
+	output, err := run(ctx, dir, "--literal-pathspecs", "ls-files", "--stage", "-z", "--", path)
+	if err != nil {
+		return nil, err
+	}
+	// "<mode> <hash> <stage>\t<path>"
+	info, _, ok := strings.Cut(strings.TrimSuffix(output, "\x00"), "\t")
+	fields := strings.Fields(info)
+	if !ok || len(fields) != 3 {
+		return nil, nil
+	}
+	if fields[0] == "160000" {
+		return nil, fmt.Errorf("cannot discard submodule %s", path)
+	}
+	content, err := run(ctx, dir, "cat-file", "blob", fields[1])
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{Mode: fields[0], Content: []byte(content)}, nil
+}
+
+func writeIndex(ctx context.Context, dir, path string, snap *snapshot) error {
+	if snap == nil {
+		_, err := run(ctx, dir, "update-index", "--force-remove", "--", path)
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "hash-object", "-w", "--stdin")
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(snap.Content)
+	hash, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("git hash-object failed: %w", err)
+	}
+	_, err = run(ctx, dir, "update-index", "--add", "--cacheinfo", snap.Mode+","+strings.TrimSpace(string(hash))+","+path)
+	return err
+}
+
+// stateHash identifies the state of a worktree file, including its absence.
+func stateHash(snap *snapshot) string {
+	if snap == nil {
+		return "missing"
+	}
+	h := sha256.New()
+	h.Write([]byte(snap.Mode))
+	h.Write([]byte{0})
+	h.Write(snap.Content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// removeEmptyParents removes the directories above path that are left
+// empty, up to dir.
+func removeEmptyParents(dir, path string) {
+	for parent := filepath.Dir(path); parent != "." && parent != "/"; parent = filepath.Dir(parent) {
+		if os.Remove(filepath.Join(dir, parent)) != nil {
+			return
+		}
+	}
+}
+
+func (t *Trash) path(id string) string {
+	return filepath.Join(t.dir, id+".json")
+}
+
+// ids returns the stored discard IDs, oldest first.
+func (t *Trash) ids() ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok {
+			ids = append(ids, id)
+		}
+	}
+	// UUIDv7 IDs sort by creation time
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (t *Trash) load(id string) (*trashRecord, error) {
+	if uuid.Validate(id) != nil {
+		return nil, ErrTrashNotFound
+	}
+	data, err := os.ReadFile(t.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrTrashNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var record trashRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// save writes record atomically and drops the oldest discards beyond
+// MaxTrashEntries.
+func (t *Trash) save(record *trashRecord) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := fsutil.WriteFileAtomic(t.path(record.ID), encoded); err != nil {
+		return err
+	}
+
+	ids, err := t.ids()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids[:max(0, len(ids)-MaxTrashEntries)] {
+		os.Remove(t.path(id))
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, dir, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return "<missing>"
+	}
+	return string(content)
+}
+
+func TestTrash_DiscardAndRestore(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	trash := NewTrash(t.TempDir())
+
+	commitFile(t, dir, "a.txt", "committed\n")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("edited\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "new"), 0755)
+	os.WriteFile(filepath.Join(dir, "new", "b.txt"), []byte("untracked\n"), 0755)
+
+	if _, err := trash.Discard(ctx, dir, []string{"missing.txt"}, false); !errors.Is(err, ErrNoChanges) {
+		t.Fatalf("expected no changes, got %v", err)
+	}
+
+	entry, err := trash.Discard(ctx, dir, []string{"a.txt", "new"}, false)
+	if err != nil {
+		t.Fatalf("Discard() error: %v", err)
+	}
+	if len(entry.Paths) != 2 {
+		t.Errorf("expected two discarded files, got %v", entry.Paths)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "committed\n" {
+		t.Errorf("expected a.txt restored from the index, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new")); !os.IsNotExist(err) {
+		t.Error("expected the untracked file and its directory to be deleted")
+	}
+
+	entries, _ := trash.List()
+	if len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Fatalf("expected the discard to be listed, got %+v", entries)
+	}
+
+	if _, err := trash.Restore(ctx, dir, entry.ID); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "edited\n" {
+		t.Errorf("expected the edit back, got %q", got)
+	}
+	info, err := os.Stat(filepath.Join(dir, "new", "b.txt"))
+	if err != nil || info.Mode()&0111 == 0 {
+		t.Errorf("expected the executable untracked file back, got %v, %v", info, err)
+	}
+
+	if _, err := trash.Restore(ctx, dir, entry.ID); !errors.Is(err, ErrTrashNotFound) {
+		t.Errorf("expected a restored discard to be gone, got %v", err)
+	}
+}
+
+func TestTrash_Staged(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	trash := NewTrash(t.TempDir())
+
+	commitFile(t, dir, "a.txt", "committed\n")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("staged\n"), 0644)
+	runGit(t, dir, "add", "a.txt")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("unstaged\n"), 0644)
+
+	entry, err := trash.Discard(ctx, dir, []string{"a.txt"}, true)
+	if err != nil {
+		t.Fatalf("Discard() error: %v", err)
+	}
+	if got := stagedContent(t, dir, "a.txt"); got != "committed\n" {
+		t.Errorf("expected the index reset to HEAD, got %q", got)
+	}
+
+	if _, err := trash.Restore(ctx, dir, entry.ID); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if got := stagedContent(t, dir, "a.txt"); got != "staged\n" {
+		t.Errorf("expected the staged content back, got %q", got)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "unstaged\n" {
+		t.Errorf("expected the worktree content back, got %q", got)
+	}
+}
+
+func TestTrash_RestoreRefusesChangedFiles(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	trash := NewTrash(t.TempDir())
+
+	commitFile(t, dir, "a.txt", "committed\n")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("edited\n"), 0644)
+	entry, err := trash.Discard(ctx, dir, []string{"a.txt"}, false)
+	if err != nil {
+		t.Fatalf("Discard() error: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("newer\n"), 0644)
+	_, err = trash.Restore(ctx, dir, entry.ID)
+	var gitErr *Error
+	if !errors.As(err, &gitErr) || gitErr.Kind != KindDirty || len(gitErr.Files) != 1 {
+		t.Fatalf("expected dirty error, got %v", err)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "newer\n" {
+		t.Errorf("expected the newer content to be kept, got %q", got)
+	}
+}
+
+func TestTrash_KeepsMaxEntries(t *testing.T) {
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+	trash := NewTrash(t.TempDir())
+
+	var first *TrashEntry
+	for i := range MaxTrashEntries + 1 {
+		os.WriteFile(filepath.Join(dir, "u.txt"), []byte{byte(i)}, 0644)
+		entry, err := trash.Discard(ctx, dir, []string{"u.txt"}, false)
+		if err != nil {
+			t.Fatalf("Discard() error: %v", err)
+		}
+		if first == nil {
+			first = entry
+		}
+	}
+
+	entries, _ := trash.List()
+	if len(entries) != MaxTrashEntries {
+		t.Errorf("expected %d entries, got %d", MaxTrashEntries, len(entries))
+	}
+	if _, err := trash.Restore(ctx, dir, first.ID); !errors.Is(err, ErrTrashNotFound) {
+		t.Errorf("expected the oldest discard to be dropped, got %v", err)
+	}
+}
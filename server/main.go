@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"embed"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -19,12 +20,23 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/pockode/server/agent"
 	"github.com/pockode/server/agent/claude"
+	"github.com/pockode/server/agent/fake"
+	"github.com/pockode/server/agent/lineproto"
+	"github.com/pockode/server/audit"
+	"github.com/pockode/server/auth"
+	"github.com/pockode/server/cli"
 	"github.com/pockode/server/command"
+	"github.com/pockode/server/export"
 	"github.com/pockode/server/git"
 	"github.com/pockode/server/logger"
 	"github.com/pockode/server/middleware"
+	"github.com/pockode/server/notify"
+	"github.com/pockode/server/policy"
 	"github.com/pockode/server/relay"
+	"github.com/pockode/server/schedule"
+	"github.com/pockode/server/search"
 	"github.com/pockode/server/settings"
 	"github.com/pockode/server/startup"
 	"github.com/pockode/server/worktree"
@@ -36,7 +48,7 @@ var version = "dev"
 //go:embed static/*
 var staticFS embed.FS
 
-func newHandler(token string, devMode bool, wsHandler *ws.RPCHandler) http.Handler {
+func newHandler(users *auth.Store, devMode bool, wsHandler *ws.RPCHandler, exportHandler http.Handler) http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
@@ -50,8 +62,9 @@ func newHandler(token string, devMode bool, wsHandler *ws.RPCHandler) http.Handl
 	})
 
 	mux.Handle("GET /ws", wsHandler)
+	mux.Handle("GET /api/sessions/{id}/export", exportHandler)
 
-	authedMux := middleware.Auth(token)(mux)
+	authedMux := middleware.Auth(users)(mux)
 
 	if !devMode {
 		return newSPAHandler(authedMux)
@@ -155,12 +168,67 @@ func findAvailablePort(startPort int) int {
 	return startPort
 }
 
+// newAgentRegistry registers the built-in claude backend plus any
+// line-protocol backends defined in <dataDir>/agents.json.
+// A non-nil fakeAgent is registered as "fake" and becomes the default.
+// defaultOverride (DEFAULT_AGENT) takes precedence over both.
+func newAgentRegistry(dataDir, defaultOverride string, fakeAgent agent.Agent) (*agent.Registry, error) {
+	agents := agent.NewRegistry()
+	agents.Register("claude", claude.New())
+
+	defaultName, configs, err := lineproto.LoadConfig(filepath.Join(dataDir, "agents.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, cfg := range configs {
+		agents.Register(cfg.Name, lineproto.New(cfg))
+	}
+
+	if fakeAgent != nil {
+		agents.Register("fake", fakeAgent)
+		defaultName = "fake"
+	}
+
+	if defaultOverride != "" {
+		defaultName = defaultOverride
+	}
+	if defaultName != "" {
+		if err := agents.SetDefault(defaultName); err != nil {
+			return nil, err
+		}
+	}
+	return agents, nil
+}
+
+// newFakeAgent builds the scripted agent selected by -fake-agent/FAKE_AGENT.
+// "echo" echoes every message; any other value is a script path.
+// Returns nil when spec is empty.
+func newFakeAgent(spec string) (agent.Agent, error) {
+	switch spec {
+	case "":
+		return nil, nil
+	case "echo":
+		return fake.New(fake.Script{}), nil
+	}
+	script, err := fake.LoadScript(spec)
+	if err != nil {
+		return nil, err
+	}
+	return fake.New(script), nil
+}
+
 func main() {
+	// Client subcommands talk to a running server instead of starting one
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	portFlag := flag.Int("port", 0, fmt.Sprintf("server port (default %d)", defaultPort))
 	tokenFlag := flag.String("auth-token", "", "authentication token (required)")
 	devModeFlag := flag.Bool("dev", false, "enable development mode")
 	relayFlag := flag.Bool("relay", true, "relay for remote access (use -relay=false to disable)")
 	versionFlag := flag.Bool("version", false, "print version and exit")
+	fakeAgentFlag := flag.String("fake-agent", "", `replay a scripted transcript instead of a real agent (script path or "echo")`)
 	flag.Parse()
 
 	if *versionFlag {
@@ -200,6 +268,11 @@ func main() {
 
 	devMode := *devModeFlag || os.Getenv("DEV_MODE") == "true"
 
+	fakeAgentSpec := *fakeAgentFlag
+	if fakeAgentSpec == "" {
+		fakeAgentSpec = os.Getenv("FAKE_AGENT")
+	}
+
 	dataDir := filepath.Join(workDir, ".pockode")
 	if envDataDir := os.Getenv("DATA_DIR"); envDataDir != "" {
 		dataDir = envDataDir
@@ -258,22 +331,105 @@ func main() {
 		os.Exit(1)
 	}
 
+	users, err := auth.NewStore(dataDir, token)
+	if err != nil {
+		slog.Error("failed to initialize user store", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize worktree setup hook
 	if err := worktree.InitSetupHook(dataDir); err != nil {
 		slog.Error("failed to initialize worktree setup hook", "error", err)
 		os.Exit(1)
 	}
 
+	// Initialize agent backends
+	fakeAgent, err := newFakeAgent(fakeAgentSpec)
+	if err != nil {
+		slog.Error("failed to load fake agent script", "error", err)
+		os.Exit(1)
+	}
+	agents, err := newAgentRegistry(dataDir, os.Getenv("DEFAULT_AGENT"), fakeAgent)
+	if err != nil {
+		slog.Error("failed to initialize agent backends", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize worktree registry and manager
-	claudeAgent := claude.New()
 	registry := worktree.NewRegistry(workDir, dataDir)
-	worktreeManager := worktree.NewManager(registry, claudeAgent, dataDir, idleTimeout)
+	worktreeManager := worktree.NewManager(registry, agents, dataDir, idleTimeout)
+
+	policyStore, err := policy.NewStore(dataDir)
+	if err != nil {
+		slog.Error("failed to initialize permission rules", "error", err)
+		os.Exit(1)
+	}
+	worktreeManager.SetPermissionPolicy(policyStore)
+
+	auditLog, err := audit.Open(dataDir, 0, 0)
+	if err != nil {
+		slog.Error("failed to open audit log", "error", err)
+		os.Exit(1)
+	}
+	worktreeManager.SetAuditLog(auditLog)
+
+	vapidSubject := os.Getenv("VAPID_SUBJECT")
+	if vapidSubject == "" {
+		vapidSubject = "https://pockode.com"
+	}
+	notifier, err := notify.NewService(dataDir, vapidSubject)
+	if err != nil {
+		slog.Error("failed to initialize notifications", "error", err)
+		os.Exit(1)
+	}
+	notifier.SetAudience(users)
+	worktreeManager.SetNotifier(notifier)
+
+	// Initialize search index and catch up on history written while stopped
+	searchIndex, err := search.Open(dataDir)
+	if err != nil {
+		slog.Error("failed to open search index", "error", err)
+		os.Exit(1)
+	}
+	worktreeManager.SetSearchIndex(searchIndex)
+	go func() {
+		dirs, err := worktreeManager.DataDirs()
+		if err == nil {
+			err = searchIndex.Sync(dirs)
+		}
+		if err != nil {
+			slog.Warn("failed to sync search index", "error", err)
+		}
+	}()
+
 	if err := worktreeManager.Start(); err != nil {
 		slog.Warn("failed to start worktree manager", "error", err)
 	}
 
-	wsHandler := ws.NewRPCHandler(token, version, devMode, commandStore, worktreeManager, settingsStore)
-	handler := newHandler(token, devMode, wsHandler)
+	scheduleStore, err := schedule.NewStore(dataDir)
+	if err != nil {
+		slog.Error("failed to load schedules", "error", err)
+		os.Exit(1)
+	}
+	scheduler := schedule.New(scheduleStore, func(ctx context.Context, s schedule.Schedule) (string, []json.RawMessage, error) {
+		return worktreeManager.SendPrompt(ctx, s.Worktree, worktree.Prompt{
+			SessionID: s.SessionID,
+			Title:     s.Name,
+			Mode:      s.Mode,
+			Agent:     agents.Default(),
+			User:      "schedule:" + s.Name,
+			Content:   s.Prompt,
+		})
+	})
+	scheduler.SetAuditor(auditLog)
+	scheduler.Start()
+
+	wsHandler := ws.NewRPCHandler(users, version, devMode, commandStore, worktreeManager, settingsStore, agents, searchIndex)
+	wsHandler.SetAuditLog(auditLog)
+	wsHandler.SetPolicyStore(policyStore)
+	wsHandler.SetNotifier(notifier)
+	wsHandler.SetScheduler(scheduler)
+	handler := newHandler(users, devMode, wsHandler, export.NewHandler(worktreeManager.DataDirs))
 
 	portStr := strconv.Itoa(port)
 	srv := &http.Server{
@@ -341,7 +497,11 @@ func main() {
 			relayManager.Stop()
 		}
 		wsHandler.Stop()
+		scheduler.Stop()
 		worktreeManager.Shutdown()
+		searchIndex.Close()
+		auditLog.Close()
+		notifier.Close()
 		close(shutdownDone)
 	}()
 
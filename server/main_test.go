@@ -4,11 +4,14 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/pockode/server/agent/claude"
+	"github.com/pockode/server/auth"
 	"github.com/pockode/server/command"
+	"github.com/pockode/server/export"
 	"github.com/pockode/server/settings"
 	"github.com/pockode/server/worktree"
 	"github.com/pockode/server/ws"
@@ -41,12 +44,14 @@ func TestHealthEndpoint(t *testing.T) {
 	workDir := t.TempDir()
 	cmdStore, _ := command.NewStore(dataDir)
 	settingsStore, _ := settings.NewStore(dataDir)
+	agents, _ := newAgentRegistry(dataDir, "", nil)
 	registry := worktree.NewRegistry(workDir, dataDir)
-	scopeManager := worktree.NewManager(registry, claude.New(), dataDir, 10*time.Minute)
+	scopeManager := worktree.NewManager(registry, agents, dataDir, 10*time.Minute)
 	defer scopeManager.Shutdown()
 
-	wsHandler := ws.NewRPCHandler("test-token", "test", true, cmdStore, scopeManager, settingsStore)
-	handler := newHandler("test-token", true, wsHandler)
+	users, _ := auth.NewStore(dataDir, "test-token")
+	wsHandler := ws.NewRPCHandler(users, "test", true, cmdStore, scopeManager, settingsStore, agents, nil)
+	handler := newHandler(users, true, wsHandler, export.NewHandler(scopeManager.DataDirs))
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	rec := httptest.NewRecorder()
 
@@ -66,12 +71,14 @@ func TestPingEndpoint(t *testing.T) {
 	workDir := t.TempDir()
 	cmdStore, _ := command.NewStore(dataDir)
 	settingsStore, _ := settings.NewStore(dataDir)
+	agents, _ := newAgentRegistry(dataDir, "", nil)
 	registry := worktree.NewRegistry(workDir, dataDir)
-	scopeManager := worktree.NewManager(registry, claude.New(), dataDir, 10*time.Minute)
+	scopeManager := worktree.NewManager(registry, agents, dataDir, 10*time.Minute)
 	defer scopeManager.Shutdown()
 
-	wsHandler := ws.NewRPCHandler(token, "test", true, cmdStore, scopeManager, settingsStore)
-	handler := newHandler(token, true, wsHandler)
+	users, _ := auth.NewStore(dataDir, token)
+	wsHandler := ws.NewRPCHandler(users, "test", true, cmdStore, scopeManager, settingsStore, agents, nil)
+	handler := newHandler(users, true, wsHandler, export.NewHandler(scopeManager.DataDirs))
 
 	t.Run("returns pong with valid token", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
@@ -103,3 +110,65 @@ func TestPingEndpoint(t *testing.T) {
 		}
 	})
 }
+
+func TestNewAgentRegistry(t *testing.T) {
+	t.Run("claude only by default", func(t *testing.T) {
+		agents, err := newAgentRegistry(t.TempDir(), "", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if agents.Default() != "claude" {
+			t.Errorf("got default %q, want %q", agents.Default(), "claude")
+		}
+	})
+
+	t.Run("loads agents.json", func(t *testing.T) {
+		dataDir := t.TempDir()
+		os.WriteFile(filepath.Join(dataDir, "agents.json"), []byte(`{"default":"echo","agents":[{"name":"echo","command":"cat"}]}`), 0644)
+
+		agents, err := newAgentRegistry(dataDir, "", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if agents.Default() != "echo" {
+			t.Errorf("got default %q, want %q", agents.Default(), "echo")
+		}
+		if !agents.Has("claude") {
+			t.Error("expected claude to remain registered")
+		}
+	})
+
+	t.Run("override wins", func(t *testing.T) {
+		dataDir := t.TempDir()
+		os.WriteFile(filepath.Join(dataDir, "agents.json"), []byte(`{"default":"echo","agents":[{"name":"echo","command":"cat"}]}`), 0644)
+
+		agents, err := newAgentRegistry(dataDir, "claude", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if agents.Default() != "claude" {
+			t.Errorf("got default %q, want %q", agents.Default(), "claude")
+		}
+	})
+
+	t.Run("fake agent becomes default", func(t *testing.T) {
+		fakeAgent, err := newFakeAgent("echo")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		agents, err := newAgentRegistry(t.TempDir(), "", fakeAgent)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if agents.Default() != "fake" {
+			t.Errorf("got default %q, want %q", agents.Default(), "fake")
+		}
+	})
+
+	t.Run("unknown override", func(t *testing.T) {
+		if _, err := newAgentRegistry(t.TempDir(), "nope", nil); err == nil {
+			t.Error("expected error for unknown default")
+		}
+	})
+}
@@ -1,12 +1,15 @@
 package middleware
 
 import (
-	"crypto/subtle"
 	"net/http"
 	"strings"
+
+	"github.com/pockode/server/auth"
 )
 
-func Auth(token string) func(http.Handler) http.Handler {
+// Auth requires a Bearer token known to users and attaches the caller's
+// identity to the request context.
+func Auth(users *auth.Store) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Health check and WebSocket bypass auth (WebSocket handles its own auth)
@@ -27,12 +30,13 @@ func Auth(token string) func(http.Handler) http.Handler {
 				return
 			}
 
-			if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(token)) != 1 {
+			identity, ok := users.Authenticate(parts[1])
+			if !ok {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
 		})
 	}
 }
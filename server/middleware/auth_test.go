@@ -4,12 +4,22 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/pockode/server/auth"
 )
 
 func TestAuth(t *testing.T) {
 	const validToken = "test-token"
 
-	handler := Auth(validToken)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	users, err := auth.NewStore(t.TempDir(), validToken)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	userToken, _, _ := users.Create("alice", auth.RoleViewer)
+
+	var gotIdentity auth.Identity
+	handler := Auth(users)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIdentity, _ = auth.IdentityFrom(r.Context())
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
 	}))
@@ -19,6 +29,7 @@ func TestAuth(t *testing.T) {
 		path       string
 		authHeader string
 		wantStatus int
+		wantUser   string
 	}{
 		{
 			name:       "health bypasses auth",
@@ -49,6 +60,14 @@ func TestAuth(t *testing.T) {
 			path:       "/api/ping",
 			authHeader: "Bearer " + validToken,
 			wantStatus: http.StatusOK,
+			wantUser:   auth.SharedTokenUser,
+		},
+		{
+			name:       "valid user token",
+			path:       "/api/ping",
+			authHeader: "Bearer " + userToken,
+			wantStatus: http.StatusOK,
+			wantUser:   "alice",
 		},
 	}
 
@@ -65,6 +84,9 @@ func TestAuth(t *testing.T) {
 			if rec.Code != tt.wantStatus {
 				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
 			}
+			if tt.wantUser != "" && gotIdentity.User != tt.wantUser {
+				t.Errorf("got user %q, want %q", gotIdentity.User, tt.wantUser)
+			}
 		})
 	}
 }
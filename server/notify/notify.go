@@ -0,0 +1,387 @@
+// Package notify alerts users who are away from the app when an agent needs
+// them, through Web Push subscriptions and generic webhooks.
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/auth"
+	"github.com/pockode/server/fsutil"
+	"github.com/pockode/server/policy"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrWebhookNotFound      = errors.New("webhook not found")
+)
+
+// Kind is the agent event a notification is about.
+type Kind string
+
+const (
+	KindPermission Kind = "permission_request"
+	KindQuestion   Kind = "ask_user_question"
+	KindDone       Kind = "done"
+	KindError      Kind = "error"
+)
+
+// needsAction reports whether the agent is blocked until someone answers.
+func (k Kind) needsAction() bool {
+	return k == KindPermission || k == KindQuestion
+}
+
+// Notification is the payload delivered to push subscriptions (as JSON) and
+// webhooks.
+type Notification struct {
+	Kind      Kind   `json:"kind"`
+	Worktree  string `json:"worktree"`
+	SessionID string `json:"session_id"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+}
+
+const maxBodyLength = 200
+
+// FromEvent describes an agent event that awaits user input. ok is false for
+// events nobody needs to be alerted about, such as the user's own interrupt.
+func FromEvent(sessionTitle string, event agent.AgentEvent) (Notification, bool) {
+	n := Notification{Title: sessionTitle}
+	if n.Title == "" {
+		n.Title = "Pockode"
+	}
+
+	switch e := event.(type) {
+	case agent.PermissionRequestEvent:
+		n.Kind = KindPermission
+		n.Body = "Allow " + e.ToolName + "? " + policy.Subject(e.ToolName, e.ToolInput)
+	case agent.AskUserQuestionEvent:
+		n.Kind = KindQuestion
+		n.Body = "Question"
+		if len(e.Questions) > 0 {
+			n.Body = e.Questions[0].Question
+		}
+	case agent.DoneEvent:
+		n.Kind = KindDone
+		n.Body = "Agent finished and is waiting for you"
+	case agent.ErrorEvent:
+		n.Kind = KindError
+		n.Body = "Error: " + e.Error
+	default:
+		return Notification{}, false
+	}
+
+	n.Body = truncate(n.Body, maxBodyLength)
+	return n, true
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+type fileData struct {
+	VAPID         vapidKeys                     `json:"vapid"`
+	Subscriptions map[string][]PushSubscription `json:"subscriptions,omitempty"` // by user
+	Webhooks      []Webhook                     `json:"webhooks,omitempty"`
+}
+
+// Service stores push subscriptions and webhooks in
+// <dataDir>/notifications.json and delivers notifications to them.
+type Service struct {
+	path    string
+	subject string // VAPID contact, a mailto: or https: URL
+	client  *http.Client
+
+	mu       sync.Mutex
+	data     fileData
+	audience Audience
+
+	inflight sync.WaitGroup
+}
+
+// NewService loads the notification settings, generating the server's VAPID
+// keys on first use.
+func NewService(dataDir, subject string) (*Service, error) {
+	s := &Service{
+		path:    filepath.Join(dataDir, "notifications.json"),
+		subject: subject,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.data); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.data.VAPID.PrivateKey == "" {
+		keys, err := generateVAPIDKeys()
+		if err != nil {
+			return nil, err
+		}
+		s.data.VAPID = keys
+		if err := s.save(s.data); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Audience resolves which role a user currently holds.
+type Audience interface {
+	RoleOf(user string) (auth.Role, bool)
+}
+
+// SetAudience limits push delivery to users audience still knows. Every
+// signed-in user can read every session, so any of them may be told about
+// it, but only operators can answer a prompt and receive its details.
+// Without an audience every subscription receives everything.
+// Call before the service sends notifications.
+func (s *Service) SetAudience(a Audience) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audience = a
+}
+
+// receives reports whether user's devices may be sent a notification of kind.
+func (s *Service) receives(user string, kind Kind) bool {
+	if s.audience == nil {
+		return true
+	}
+	role, ok := s.audience.RoleOf(user)
+	if !ok {
+		return false
+	}
+	return !kind.needsAction() || role.Allows(auth.RoleOperator)
+}
+
+// VAPIDPublicKey is the applicationServerKey browsers subscribe with.
+func (s *Service) VAPIDPublicKey() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.VAPID.PublicKey
+}
+
+// Subscribe stores a push subscription for user. A subscription with the
+// same endpoint is replaced, whichever user it belonged to.
+func (s *Service) Subscribe(user string, sub PushSubscription) error {
+	if err := sub.Validate(); err != nil {
+		return err
+	}
+	sub.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.cloneLocked()
+	data.removeEndpoint(sub.Endpoint)
+	data.Subscriptions[user] = append(data.Subscriptions[user], sub)
+	return s.commitLocked(data)
+}
+
+func (s *Service) Unsubscribe(user, endpoint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.ContainsFunc(s.data.Subscriptions[user], func(sub PushSubscription) bool { return sub.Endpoint == endpoint }) {
+		return ErrSubscriptionNotFound
+	}
+	data := s.cloneLocked()
+	data.removeEndpoint(endpoint)
+	return s.commitLocked(data)
+}
+
+// Subscriptions returns user's push subscriptions.
+func (s *Service) Subscriptions(user string) []PushSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.data.Subscriptions[user])
+}
+
+func (s *Service) Webhooks() []Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.data.Webhooks)
+}
+
+// AddWebhook validates and stores a webhook, assigning its ID and creation time.
+func (s *Service) AddWebhook(hook Webhook) (Webhook, error) {
+	hook.URL = strings.TrimSpace(hook.URL)
+	if err := hook.Validate(); err != nil {
+		return Webhook{}, err
+	}
+	hook.ID = uuid.Must(uuid.NewV7()).String()
+	hook.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.cloneLocked()
+	data.Webhooks = append(data.Webhooks, hook)
+	if err := s.commitLocked(data); err != nil {
+		return Webhook{}, err
+	}
+	return hook, nil
+}
+
+func (s *Service) RemoveWebhook(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.data.Webhooks, func(h Webhook) bool { return h.ID == id })
+	if i < 0 {
+		return ErrWebhookNotFound
+	}
+	data := s.cloneLocked()
+	data.Webhooks = slices.Delete(data.Webhooks, i, i+1)
+	return s.commitLocked(data)
+}
+
+// Notify delivers n to the push subscriptions of users allowed to see it and
+// to every webhook in the background. Subscriptions the push service reports
+// as gone are dropped.
+func (s *Service) Notify(n Notification) {
+	s.mu.Lock()
+	keys := s.data.VAPID
+	hooks := slices.Clone(s.data.Webhooks)
+	var subs []PushSubscription
+	for user, userSubs := range s.data.Subscriptions {
+		if s.receives(user, n.Kind) {
+			subs = append(subs, userSubs...)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(subs) == 0 && len(hooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(n)
+	if err != nil {
+		slog.Error("failed to encode notification", "error", err)
+		return
+	}
+
+	log := slog.With("sessionId", n.SessionID, "kind", n.Kind)
+	for _, sub := range subs {
+		s.inflight.Go(func() {
+			err := sendPush(s.client, keys, s.subject, sub, payload)
+			if errors.Is(err, errSubscriptionGone) {
+				log.Info("dropping expired push subscription", "endpoint", sub.Endpoint)
+				s.dropEndpoint(sub.Endpoint)
+				return
+			}
+			if err != nil {
+				log.Warn("failed to send push notification", "endpoint", sub.Endpoint, "error", err)
+			}
+		})
+	}
+	for _, hook := range hooks {
+		s.inflight.Go(func() {
+			if err := sendWebhook(s.client, hook, n); err != nil {
+				log.Warn("failed to send webhook notification", "webhookId", hook.ID, "error", err)
+			}
+		})
+	}
+}
+
+// Close waits for deliveries in flight.
+func (s *Service) Close() {
+	s.inflight.Wait()
+}
+
+func (s *Service) dropEndpoint(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.cloneLocked()
+	data.removeEndpoint(endpoint)
+	if err := s.commitLocked(data); err != nil {
+		slog.Error("failed to drop push subscription", "error", err)
+	}
+}
+
+// ForWorktree binds the service to one worktree for process managers.
+func (s *Service) ForWorktree(name string) *WorktreeNotifier {
+	return &WorktreeNotifier{service: s, worktree: name}
+}
+
+// WorktreeNotifier sends notifications on behalf of a single worktree.
+type WorktreeNotifier struct {
+	service  *Service
+	worktree string
+}
+
+func (w *WorktreeNotifier) NotifyEvent(sessionID, sessionTitle string, event agent.AgentEvent) {
+	n, ok := FromEvent(sessionTitle, event)
+	if !ok {
+		return
+	}
+	n.Worktree = w.worktree
+	n.SessionID = sessionID
+	w.service.Notify(n)
+}
+
+func (d *fileData) removeEndpoint(endpoint string) {
+	for user, subs := range d.Subscriptions {
+		subs = slices.DeleteFunc(subs, func(sub PushSubscription) bool { return sub.Endpoint == endpoint })
+		if len(subs) == 0 {
+			delete(d.Subscriptions, user)
+		} else {
+			d.Subscriptions[user] = subs
+		}
+	}
+}
+
+func (s *Service) cloneLocked() fileData {
+	data := fileData{
+		VAPID:         s.data.VAPID,
+		Subscriptions: make(map[string][]PushSubscription, len(s.data.Subscriptions)),
+		Webhooks:      slices.Clone(s.data.Webhooks),
+	}
+	for user, subs := range s.data.Subscriptions {
+		data.Subscriptions[user] = slices.Clone(subs)
+	}
+	return data
+}
+
+func (s *Service) commitLocked(data fileData) error {
+	if err := s.save(data); err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+func (s *Service) save(data fileData) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Mode 0600 keeps the VAPID private key private
+	return fsutil.WriteFileAtomic(s.path, encoded)
+}
@@ -0,0 +1,306 @@
+package notify
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"maps"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/auth"
+)
+
+type pushClient struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newPushClient(t *testing.T) pushClient {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return pushClient{key: key, auth: auth}
+}
+
+func (c pushClient) subscription(endpoint string) PushSubscription {
+	return PushSubscription{
+		Endpoint: endpoint,
+		Keys: PushKeys{
+			P256dh: base64.RawURLEncoding.EncodeToString(c.key.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(c.auth),
+		},
+	}
+}
+
+// decrypt reverses encryptPayload the way a browser would.
+func (c pushClient) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	salt := body[:16]
+	idLen := int(body[20])
+	asPublic := body[21 : 21+idLen]
+	ciphertext := body[21+idLen:]
+
+	peer, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		t.Fatalf("invalid sender key: %v", err)
+	}
+	shared, _ := c.key.ECDH(peer)
+	cek, nonce, _ := deriveContentKeys(shared, c.auth, salt, c.key.PublicKey().Bytes(), asPublic)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatalf("missing last-record delimiter")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func verifyVAPID(t *testing.T, header, publicKey string) {
+	t.Helper()
+	var jwt, k string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ", ") {
+		if v, ok := strings.CutPrefix(part, "t="); ok {
+			jwt = v
+		}
+		if v, ok := strings.CutPrefix(part, "k="); ok {
+			k = v
+		}
+	}
+	if k != publicKey {
+		t.Fatalf("expected k=%s, got %s", publicKey, k)
+	}
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed JWT %q", jwt)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(k)
+	pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), raw)
+	if err != nil {
+		t.Fatalf("invalid VAPID key: %v", err)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		t.Fatal("JWT signature does not verify")
+	}
+}
+
+func TestService_PushRoundTrip(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.Header, body}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	s, err := NewService(t.TempDir(), "mailto:ops@example.com")
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	s.client = server.Client()
+
+	client := newPushClient(t)
+	if err := s.Subscribe("alice", client.subscription(server.URL+"/push/1")); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	want := Notification{Kind: KindPermission, Worktree: "feature", SessionID: "s1", Title: "Fix tests", Body: "Allow Bash? make"}
+	s.Notify(want)
+	s.Close()
+
+	req := <-requests
+	if req.header.Get("Content-Encoding") != "aes128gcm" || req.header.Get("TTL") == "" {
+		t.Errorf("unexpected headers: %v", req.header)
+	}
+	verifyVAPID(t, req.header.Get("Authorization"), s.VAPIDPublicKey())
+
+	var got Notification
+	if err := json.Unmarshal(client.decrypt(t, req.body), &got); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestService_DropsExpiredSubscription(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	s, _ := NewService(dir, "mailto:ops@example.com")
+	s.client = server.Client()
+	s.Subscribe("alice", newPushClient(t).subscription(server.URL+"/push/1"))
+
+	s.Notify(Notification{Kind: KindDone, Title: "t", Body: "b"})
+	s.Close()
+
+	if subs := s.Subscriptions("alice"); len(subs) != 0 {
+		t.Errorf("expected expired subscription to be dropped, got %+v", subs)
+	}
+	if reloaded, _ := NewService(dir, ""); len(reloaded.Subscriptions("alice")) != 0 {
+		t.Error("expected drop to persist")
+	}
+}
+
+func TestService_Webhook(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	s, _ := NewService(t.TempDir(), "")
+	if _, err := s.AddWebhook(Webhook{URL: "ftp://example.com"}); err == nil {
+		t.Error("expected non-http URL to be rejected")
+	}
+	hook, err := s.AddWebhook(Webhook{URL: server.URL, Topic: "builds"})
+	if err != nil {
+		t.Fatalf("AddWebhook failed: %v", err)
+	}
+
+	s.Notify(Notification{Kind: KindQuestion, Worktree: "", SessionID: "s1", Title: "Refactor", Body: "Which package?"})
+	s.Close()
+
+	var payload map[string]any
+	json.Unmarshal(<-bodies, &payload)
+	if payload["text"] != "Refactor: Which package?" || payload["topic"] != "builds" || payload["message"] != "Which package?" || payload["priority"] != float64(4) {
+		t.Errorf("unexpected webhook payload: %v", payload)
+	}
+
+	if err := s.RemoveWebhook(hook.ID); err != nil {
+		t.Fatalf("RemoveWebhook failed: %v", err)
+	}
+	if err := s.RemoveWebhook(hook.ID); err != ErrWebhookNotFound {
+		t.Errorf("expected ErrWebhookNotFound, got %v", err)
+	}
+}
+
+type audience map[string]auth.Role
+
+func (a audience) RoleOf(user string) (auth.Role, bool) {
+	role, ok := a[user]
+	return role, ok
+}
+
+func TestService_Audience(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]int{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.URL.Path]++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	s, _ := NewService(t.TempDir(), "mailto:ops@example.com")
+	s.client = server.Client()
+	s.SetAudience(audience{"alice": auth.RoleOperator, "victor": auth.RoleViewer})
+	for _, user := range []string{"alice", "victor", "mallory"} {
+		s.Subscribe(user, newPushClient(t).subscription(server.URL+"/"+user))
+	}
+
+	s.Notify(Notification{Kind: KindPermission, Title: "t", Body: "Allow Bash? make"})
+	s.Notify(Notification{Kind: KindDone, Title: "t", Body: "b"})
+	s.Close()
+
+	// Viewers hear about finished turns but not prompts; unknown users get nothing
+	want := map[string]int{"/alice": 2, "/victor": 1}
+	if !maps.Equal(received, want) {
+		t.Errorf("received %v, want %v", received, want)
+	}
+}
+
+func TestService_Subscriptions(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewService(dir, "")
+	key := s.VAPIDPublicKey()
+
+	sub := newPushClient(t).subscription("https://push.example.com/abc")
+	if err := s.Subscribe("alice", PushSubscription{Endpoint: "http://push.example.com", Keys: sub.Keys}); err == nil {
+		t.Error("expected non-https endpoint to be rejected")
+	}
+	s.Subscribe("alice", sub)
+	// The same browser signing in as someone else moves the subscription
+	s.Subscribe("bob", sub)
+
+	reloaded, _ := NewService(dir, "")
+	if reloaded.VAPIDPublicKey() != key {
+		t.Error("expected VAPID key to persist")
+	}
+	if len(reloaded.Subscriptions("alice")) != 0 || len(reloaded.Subscriptions("bob")) != 1 {
+		t.Errorf("expected subscription to belong to bob only")
+	}
+
+	if err := reloaded.Unsubscribe("alice", sub.Endpoint); err != ErrSubscriptionNotFound {
+		t.Errorf("expected alice to have no subscription, got %v", err)
+	}
+	if err := reloaded.Unsubscribe("bob", sub.Endpoint); err != nil {
+		t.Errorf("Unsubscribe failed: %v", err)
+	}
+}
+
+func TestFromEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event agent.AgentEvent
+		kind  Kind
+		body  string
+		ok    bool
+	}{
+		{"permission", agent.PermissionRequestEvent{ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"rm -rf build"}`)}, KindPermission, "Allow Bash? rm -rf build", true},
+		{"question", agent.AskUserQuestionEvent{Questions: []agent.AskUserQuestion{{Question: "Which  database?"}}}, KindQuestion, "Which database?", true},
+		{"done", agent.DoneEvent{}, KindDone, "Agent finished and is waiting for you", true},
+		{"error", agent.ErrorEvent{Error: "CLI crashed"}, KindError, "Error: CLI crashed", true},
+		{"interrupted", agent.InterruptedEvent{}, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, ok := FromEvent("", tt.event)
+			if ok != tt.ok || n.Kind != tt.kind || n.Body != tt.body {
+				t.Errorf("got %+v (ok=%v)", n, ok)
+			}
+			if ok && n.Title != "Pockode" {
+				t.Errorf("expected default title, got %q", n.Title)
+			}
+		})
+	}
+
+	n, _ := FromEvent("t", agent.ErrorEvent{Error: strings.Repeat("x", 500)})
+	if len([]rune(n.Body)) != maxBodyLength {
+		t.Errorf("expected body truncated to %d runes, got %d", maxBodyLength, len([]rune(n.Body)))
+	}
+}
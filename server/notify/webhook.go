@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Webhook posts notifications as JSON to a URL. The body carries "text" for
+// Slack incoming webhooks and "topic"/"title"/"message" for ntfy, so one
+// format serves both.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Topic     string    `json:"topic,omitempty"` // ntfy topic when URL is the server root
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks a webhook before it is stored. Errors are user-facing.
+func (w Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	return nil
+}
+
+type webhookPayload struct {
+	Text      string `json:"text"`
+	Topic     string `json:"topic,omitempty"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+	Priority  int    `json:"priority,omitempty"`
+	Event     Kind   `json:"event"`
+	Worktree  string `json:"worktree"`
+	SessionID string `json:"session_id"`
+}
+
+func sendWebhook(client *http.Client, hook Webhook, n Notification) error {
+	payload := webhookPayload{
+		Text:      n.Title + ": " + n.Body,
+		Topic:     hook.Topic,
+		Title:     n.Title,
+		Message:   n.Body,
+		Event:     n.Kind,
+		Worktree:  n.Worktree,
+		SessionID: n.SessionID,
+	}
+	if n.Kind.needsAction() {
+		payload.Priority = 4 // ntfy "high"
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(hook.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// errSubscriptionGone means the push service no longer knows the
+// subscription and it should be dropped.
+var errSubscriptionGone = errors.New("push subscription expired")
+
+// PushSubscription is a browser PushSubscription as returned by
+// PushSubscription.toJSON().
+type PushSubscription struct {
+	Endpoint  string    `json:"endpoint"`
+	Keys      PushKeys  `json:"keys"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PushKeys struct {
+	P256dh string `json:"p256dh"` // base64url client public key
+	Auth   string `json:"auth"`   // base64url auth secret
+}
+
+// Validate checks a subscription before it is stored. Errors are user-facing.
+func (s PushSubscription) Validate() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("endpoint must be an https URL")
+	}
+	if _, err := decodePublicKey(s.Keys.P256dh); err != nil {
+		return errors.New("invalid p256dh key")
+	}
+	if auth, err := decodeBase64URL(s.Keys.Auth); err != nil || len(auth) != 16 {
+		return errors.New("invalid auth secret")
+	}
+	return nil
+}
+
+// vapidKeys identifies this server to push services (RFC 8292).
+type vapidKeys struct {
+	PublicKey  string `json:"public_key"`  // base64url uncompressed P-256 point
+	PrivateKey string `json:"private_key"` // base64url raw scalar
+}
+
+func generateVAPIDKeys() (vapidKeys, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return vapidKeys{}, err
+	}
+	pub, err := key.PublicKey.Bytes()
+	if err != nil {
+		return vapidKeys{}, err
+	}
+	priv, err := key.Bytes()
+	if err != nil {
+		return vapidKeys{}, err
+	}
+	return vapidKeys{
+		PublicKey:  base64.RawURLEncoding.EncodeToString(pub),
+		PrivateKey: base64.RawURLEncoding.EncodeToString(priv),
+	}, nil
+}
+
+func (k vapidKeys) signingKey() (*ecdsa.PrivateKey, error) {
+	raw, err := decodeBase64URL(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+}
+
+// authorization builds the VAPID Authorization header for endpoint.
+func (k vapidKeys) authorization(endpoint, subject string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	key, err := k.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS uses the fixed-width r||s form, not ASN.1
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	jwt := signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+	return fmt.Sprintf("vapid t=%s, k=%s", jwt, k.PublicKey), nil
+}
+
+const recordSize = 4096
+
+// encryptPayload encrypts payload for sub with the aes128gcm content
+// encoding (RFC 8188) keyed as described in RFC 8291.
+func encryptPayload(sub PushSubscription, payload []byte) ([]byte, error) {
+	uaPublic, err := decodePublicKey(sub.Keys.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decodeBase64URL(sub.Keys.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	cek, nonce, err := deriveContentKeys(sharedSecret, authSecret, salt, uaPublic.Bytes(), asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single record: the payload followed by the last-record delimiter
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	if len(plaintext)+gcm.Overhead() > recordSize {
+		return nil, errors.New("push payload too large")
+	}
+
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(recordSize))
+	body.WriteByte(byte(len(asPublic)))
+	body.Write(asPublic)
+	body.Write(gcm.Seal(nil, nonce, plaintext, nil))
+	return body.Bytes(), nil
+}
+
+func deriveContentKeys(sharedSecret, authSecret, salt, uaPublic, asPublic []byte) (cek, nonce []byte, err error) {
+	prkKey, err := hkdf.Extract(sha256.New, sharedSecret, authSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cek, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16); err != nil {
+		return nil, nil, err
+	}
+	if nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12); err != nil {
+		return nil, nil, err
+	}
+	return cek, nonce, nil
+}
+
+// sendPush delivers one encrypted message to a push service.
+func sendPush(client *http.Client, keys vapidKeys, subject string, sub PushSubscription, payload []byte) error {
+	body, err := encryptPayload(sub, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := keys.authorization(sub.Endpoint, subject)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", "high")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errSubscriptionGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service returned %s", resp.Status)
+	}
+	return nil
+}
+
+func decodePublicKey(s string) (*ecdh.PublicKey, error) {
+	raw, err := decodeBase64URL(s)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.P256().NewPublicKey(raw)
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers differ.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
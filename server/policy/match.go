@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// subjectFields names the input field a rule pattern is matched against, per tool.
+var subjectFields = map[string]string{
+	"Bash":         "command",
+	"Read":         "file_path",
+	"Edit":         "file_path",
+	"MultiEdit":    "file_path",
+	"Write":        "file_path",
+	"NotebookEdit": "notebook_path",
+	"Glob":         "pattern",
+	"Grep":         "pattern",
+	"WebFetch":     "url",
+	"WebSearch":    "query",
+}
+
+// pathTools take a file path as their subject.
+var pathTools = map[string]bool{
+	"Read":         true,
+	"Edit":         true,
+	"MultiEdit":    true,
+	"Write":        true,
+	"NotebookEdit": true,
+}
+
+// Subject returns the part of a tool input that rule patterns match. Paths
+// are cleaned, so "src/../.env" cannot pass for a file under src.
+func Subject(tool string, input json.RawMessage) string {
+	if field, ok := subjectFields[tool]; ok {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(input, &fields) == nil {
+			var value string
+			if json.Unmarshal(fields[field], &value) == nil {
+				if pathTools[tool] && value != "" {
+					value = filepath.Clean(value)
+				}
+				return value
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, input); err != nil {
+		return string(input)
+	}
+	return buf.String()
+}
+
+// matchGlob reports whether s matches pattern, where "*" matches any run of
+// characters (including none) and everything else matches literally.
+func matchGlob(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
+
+// isCompound reports whether a shell command chains, pipes, substitutes or
+// redirects, so it may run more than a pattern matching its start describes.
+// Quoting is ignored; a quoted operator still counts.
+func isCompound(command string) bool {
+	return strings.ContainsAny(command, ";&|`<>\n") || strings.Contains(command, "$(")
+}
@@ -0,0 +1,299 @@
+// Package policy stores permission rules that answer agent permission
+// requests without asking the user.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/pockode/server/fsutil"
+)
+
+var ErrRuleNotFound = errors.New("rule not found")
+
+// Action is what a matching rule does with a permission request.
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionDeny  Action = "deny"
+	ActionAsk   Action = "ask" // always ask the user, overriding broader rules
+)
+
+func (a Action) IsValid() bool {
+	switch a {
+	case ActionAllow, ActionDeny, ActionAsk:
+		return true
+	default:
+		return false
+	}
+}
+
+// Scope limits where a rule applies.
+type Scope string
+
+const (
+	ScopeGlobal   Scope = "global"
+	ScopeWorktree Scope = "worktree"
+	ScopeSession  Scope = "session"
+)
+
+func (s Scope) specificity() int {
+	switch s {
+	case ScopeSession:
+		return 2
+	case ScopeWorktree:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Rule matches permission requests by tool name and input.
+//
+// Tool is an exact tool name or "*". Pattern is a glob ("*" matches any run
+// of characters) tested against the request's subject: the command for
+// Bash, the path for file tools, the URL for WebFetch, and the compact JSON
+// input otherwise. An empty pattern matches any input. Paths are cleaned
+// before matching, and an allow pattern never matches a Bash command that
+// chains, pipes, substitutes or redirects.
+type Rule struct {
+	ID        string    `json:"id"`
+	Action    Action    `json:"action"`
+	Tool      string    `json:"tool"`
+	Pattern   string    `json:"pattern,omitempty"`
+	Scope     Scope     `json:"scope"`
+	Worktree  string    `json:"worktree,omitempty"`   // for ScopeWorktree; "" is the main worktree
+	SessionID string    `json:"session_id,omitempty"` // for ScopeSession
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks a rule before it is stored. Errors are user-facing.
+func (r Rule) Validate() error {
+	if !r.Action.IsValid() {
+		return fmt.Errorf("invalid action %q", r.Action)
+	}
+	if strings.TrimSpace(r.Tool) == "" {
+		return errors.New("tool is required")
+	}
+	return validateTarget(r.Scope, r.Worktree, r.SessionID)
+}
+
+// validateTarget checks that only the fields used by scope are set.
+func validateTarget(scope Scope, worktree, sessionID string) error {
+	switch scope {
+	case ScopeGlobal:
+		if worktree != "" || sessionID != "" {
+			return errors.New("global scope takes no worktree or session")
+		}
+	case ScopeWorktree:
+		if sessionID != "" {
+			return errors.New("worktree scope takes no session")
+		}
+	case ScopeSession:
+		if sessionID == "" {
+			return errors.New("session_id is required for session scope")
+		}
+		if worktree != "" {
+			return errors.New("session scope takes no worktree")
+		}
+	default:
+		return fmt.Errorf("invalid scope %q", scope)
+	}
+	return nil
+}
+
+func (r Rule) appliesTo(worktree, sessionID string) bool {
+	return targets(r.Scope, r.Worktree, r.SessionID, worktree, sessionID)
+}
+
+// targets reports whether a scoped setting covers a request from worktree and sessionID.
+func targets(scope Scope, scopeWorktree, scopeSession, worktree, sessionID string) bool {
+	switch scope {
+	case ScopeGlobal:
+		return true
+	case ScopeWorktree:
+		return scopeWorktree == worktree
+	case ScopeSession:
+		return scopeSession == sessionID
+	default:
+		return false
+	}
+}
+
+func (r Rule) matches(tool, subject string) bool {
+	if r.Tool != "*" && r.Tool != tool {
+		return false
+	}
+	if r.Pattern == "" {
+		return true
+	}
+	// An allow pattern describes one command; never let it cover what is
+	// chained or piped after it
+	if r.Action == ActionAllow && tool == "Bash" && isCompound(subject) {
+		return false
+	}
+	return matchGlob(r.Pattern, subject)
+}
+
+// actionPriority orders actions within one scope: deny beats ask beats allow.
+func actionPriority(a Action) int {
+	switch a {
+	case ActionDeny:
+		return 2
+	case ActionAsk:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type fileData struct {
+	Rules    []Rule    `json:"rules"`
+	Timeouts []Timeout `json:"timeouts,omitempty"`
+}
+
+// Store keeps rules and timeouts for all worktrees in <dataDir>/permissions.json.
+type Store struct {
+	path string
+
+	mu       sync.RWMutex
+	rules    []Rule
+	timeouts []Timeout
+}
+
+func NewStore(dataDir string) (*Store, error) {
+	s := &Store{path: filepath.Join(dataDir, "permissions.json")}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f fileData
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	s.rules = f.Rules
+	s.timeouts = f.Timeouts
+	return s, nil
+}
+
+// List returns all rules in creation order.
+func (s *Store) List() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.rules)
+}
+
+// Add validates and stores a rule, assigning its ID and creation time.
+func (s *Store) Add(r Rule) (Rule, error) {
+	r.Tool = strings.TrimSpace(r.Tool)
+	if err := r.Validate(); err != nil {
+		return Rule{}, err
+	}
+	r.ID = uuid.Must(uuid.NewV7()).String()
+	r.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := append(slices.Clone(s.rules), r)
+	if err := s.save(rules, s.timeouts); err != nil {
+		return Rule{}, err
+	}
+	s.rules = rules
+	return r, nil
+}
+
+func (s *Store) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.rules, func(r Rule) bool { return r.ID == id })
+	if i < 0 {
+		return ErrRuleNotFound
+	}
+	rules := slices.Delete(slices.Clone(s.rules), i, i+1)
+	if err := s.save(rules, s.timeouts); err != nil {
+		return err
+	}
+	s.rules = rules
+	return nil
+}
+
+// Decide finds the rule that governs a permission request. The most specific
+// scope with a match wins (session, then worktree, then global); within a
+// scope deny beats ask beats allow. ok is false when no rule matches.
+func (s *Store) Decide(worktree, sessionID, tool string, input json.RawMessage) (Rule, bool) {
+	subject := Subject(tool, input)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var best Rule
+	found := false
+	for _, r := range s.rules {
+		if !r.appliesTo(worktree, sessionID) || !r.matches(tool, subject) {
+			continue
+		}
+		if !found || outranks(r, best) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+func outranks(a, b Rule) bool {
+	if a.Scope.specificity() != b.Scope.specificity() {
+		return a.Scope.specificity() > b.Scope.specificity()
+	}
+	return actionPriority(a.Action) > actionPriority(b.Action)
+}
+
+// ForWorktree binds the store to one worktree for process managers.
+func (s *Store) ForWorktree(name string) *WorktreePolicy {
+	return &WorktreePolicy{store: s, worktree: name}
+}
+
+// WorktreePolicy evaluates rules on behalf of a single worktree.
+type WorktreePolicy struct {
+	store    *Store
+	worktree string
+}
+
+func (p *WorktreePolicy) Decide(sessionID, tool string, input json.RawMessage) (Rule, bool) {
+	return p.store.Decide(p.worktree, sessionID, tool, input)
+}
+
+func (p *WorktreePolicy) TimeoutFor(sessionID string) (Timeout, bool) {
+	return p.store.TimeoutFor(p.worktree, sessionID)
+}
+
+// save writes rules and timeouts; callers hold s.mu.
+func (s *Store) save(rules []Rule, timeouts []Timeout) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(fileData{Rules: rules, Timeouts: timeouts}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(s.path, data)
+}
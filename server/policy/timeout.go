@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var ErrTimeoutNotFound = errors.New("timeout not found")
+
+// TimeoutDecision is what happens to a permission request nobody answers in time.
+type TimeoutDecision string
+
+const (
+	TimeoutDeny     TimeoutDecision = "deny"
+	TimeoutAllow    TimeoutDecision = "allow"
+	TimeoutEscalate TimeoutDecision = "escalate" // notify again and keep waiting
+)
+
+func (d TimeoutDecision) IsValid() bool {
+	switch d {
+	case TimeoutDeny, TimeoutAllow, TimeoutEscalate:
+		return true
+	default:
+		return false
+	}
+}
+
+// Timeout bounds how long permission requests wait for a user. Each scope
+// target (global, one worktree, one session) holds at most one timeout.
+type Timeout struct {
+	Scope     Scope           `json:"scope"`
+	Worktree  string          `json:"worktree,omitempty"`   // for ScopeWorktree; "" is the main worktree
+	SessionID string          `json:"session_id,omitempty"` // for ScopeSession
+	Seconds   int             `json:"seconds"`
+	Decision  TimeoutDecision `json:"decision"`
+	UpdatedBy string          `json:"updated_by,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// After is how long a request waits before the decision applies.
+func (t Timeout) After() time.Duration {
+	return time.Duration(t.Seconds) * time.Second
+}
+
+// Validate checks a timeout before it is stored. Errors are user-facing.
+func (t Timeout) Validate() error {
+	if t.Seconds <= 0 {
+		return errors.New("seconds must be positive")
+	}
+	if !t.Decision.IsValid() {
+		return fmt.Errorf("invalid decision %q", t.Decision)
+	}
+	return validateTarget(t.Scope, t.Worktree, t.SessionID)
+}
+
+func (t Timeout) sameTarget(scope Scope, worktree, sessionID string) bool {
+	return t.Scope == scope && t.Worktree == worktree && t.SessionID == sessionID
+}
+
+// Timeouts returns all timeouts in the order they were first set.
+func (s *Store) Timeouts() []Timeout {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.timeouts)
+}
+
+// SetTimeout validates and stores t, replacing the timeout for the same target.
+func (s *Store) SetTimeout(t Timeout) (Timeout, error) {
+	if err := t.Validate(); err != nil {
+		return Timeout{}, err
+	}
+	t.UpdatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timeouts := slices.Clone(s.timeouts)
+	if i := slices.IndexFunc(timeouts, func(o Timeout) bool { return o.sameTarget(t.Scope, t.Worktree, t.SessionID) }); i >= 0 {
+		timeouts[i] = t
+	} else {
+		timeouts = append(timeouts, t)
+	}
+	if err := s.save(s.rules, timeouts); err != nil {
+		return Timeout{}, err
+	}
+	s.timeouts = timeouts
+	return t, nil
+}
+
+func (s *Store) ClearTimeout(scope Scope, worktree, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.timeouts, func(t Timeout) bool { return t.sameTarget(scope, worktree, sessionID) })
+	if i < 0 {
+		return ErrTimeoutNotFound
+	}
+	timeouts := slices.Delete(slices.Clone(s.timeouts), i, i+1)
+	if err := s.save(s.rules, timeouts); err != nil {
+		return err
+	}
+	s.timeouts = timeouts
+	return nil
+}
+
+// TimeoutFor returns the most specific timeout covering a session:
+// session, then worktree, then global. ok is false when requests wait forever.
+func (s *Store) TimeoutFor(worktree, sessionID string) (Timeout, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var best Timeout
+	found := false
+	for _, t := range s.timeouts {
+		if !targets(t.Scope, t.Worktree, t.SessionID, worktree, sessionID) {
+			continue
+		}
+		if !found || t.Scope.specificity() > best.Scope.specificity() {
+			best, found = t, true
+		}
+	}
+	return best, found
+}
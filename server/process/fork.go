@@ -0,0 +1,54 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"github.com/pockode/server/agent"
+)
+
+// pendingTranscript renders the history records the agent has not seen, such
+// as those a fork copied when the agent conversation could not be branched at
+// the fork point. It is sent ahead of the next message so the fresh
+// conversation starts from the same context. pending reports whether the
+// session has such records, even if none rendered.
+func (p *Process) pendingTranscript(ctx context.Context) (transcript string, pending bool) {
+	meta, found, err := p.sessionStore.Get(p.sessionID)
+	if err != nil || !found || meta.PendingTranscript == 0 {
+		return "", false
+	}
+
+	history, err := p.sessionStore.GetHistory(ctx, p.sessionID)
+	if err != nil {
+		slog.Error("failed to read pending transcript", "sessionId", p.sessionID, "error", err)
+		return "", false
+	}
+	return renderTranscript(history[:min(meta.PendingTranscript, len(history))]), true
+}
+
+// renderTranscript writes user messages, assistant text and tool calls as a
+// plain-text conversation. Other records carry nothing the agent needs.
+func renderTranscript(history []json.RawMessage) string {
+	var b strings.Builder
+	for _, raw := range history {
+		var record agent.EventRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			continue
+		}
+		switch record.Type {
+		case agent.EventTypeMessage:
+			b.WriteString("User: " + record.Content + "\n\n")
+		case agent.EventTypeText:
+			b.WriteString("Assistant: " + record.Content + "\n\n")
+		case agent.EventTypeToolCall:
+			b.WriteString("Assistant used " + record.ToolName + ": " + string(record.ToolInput) + "\n\n")
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "This conversation continues an earlier one. Its transcript follows for context; do not repeat its actions.\n\n<transcript>\n" +
+		b.String() + "</transcript>\n\n"
+}
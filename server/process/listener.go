@@ -6,9 +6,17 @@ import "github.com/pockode/server/agent"
 type ChatMessage struct {
 	SessionID string
 	Event     agent.AgentEvent
+
+	// Seq is the event's history sequence number, 0 if it was not recorded.
+	// PrevSeq is the Seq of the session's previous message, so subscribers
+	// that have seen less can tell they missed one; 0 if unknown.
+	Seq     int64
+	PrevSeq int64
 }
 
 // ChatMessageListener receives chat messages from ProcessManager.
+// Both methods are called in the order events occur and must not block.
 type ChatMessageListener interface {
 	OnChatMessage(msg ChatMessage)
+	OnQueueChange(event QueueChangeEvent)
 }
@@ -2,12 +2,17 @@ package process
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/pockode/server/agent"
 	"github.com/pockode/server/logger"
+	"github.com/pockode/server/policy"
 	"github.com/pockode/server/session"
 )
 
@@ -24,6 +29,31 @@ type StateChangeEvent struct {
 	State     ProcessState
 }
 
+// PermissionPolicy decides permission requests without asking the user.
+type PermissionPolicy interface {
+	Decide(sessionID, tool string, input json.RawMessage) (policy.Rule, bool)
+	// TimeoutFor returns how long requests in the session may wait for a user.
+	TimeoutFor(sessionID string) (policy.Timeout, bool)
+}
+
+// Notifier alerts users who are away from the app that a session awaits them.
+type Notifier interface {
+	NotifyEvent(sessionID, sessionTitle string, event agent.AgentEvent)
+}
+
+// Checkpointer snapshots the worktree before each turn so it can be rolled
+// back. It returns an empty ID when there is nothing to snapshot, and must
+// give up once ctx expires.
+type Checkpointer interface {
+	Checkpoint(ctx context.Context, sessionID string) (string, error)
+}
+
+// Auditor records decisions processes make without a user, such as
+// permission requests answered by policy or by timeout.
+type Auditor interface {
+	Record(actor, method string, params any)
+}
+
 // Manager manages agent processes.
 type Manager struct {
 	agent        agent.Agent
@@ -34,6 +64,9 @@ type Manager struct {
 	processesMu sync.Mutex
 	processes   map[string]*Process
 
+	// Held while a message starts a turn, so WhileIdle never overlaps one
+	turnMu sync.Mutex
+
 	// Message listener (ChatMessagesWatcher)
 	messageListener ChatMessageListener
 
@@ -43,6 +76,18 @@ type Manager struct {
 	// Called when process running state changes
 	onStateChange func(StateChangeEvent)
 
+	// Answers matching permission requests automatically
+	permissionPolicy PermissionPolicy
+
+	// Alerts away users when a process waits for input
+	notifier Notifier
+
+	// Snapshots the worktree at the start of each turn
+	checkpointer Checkpointer
+
+	// Records decisions made on a user's behalf
+	auditor Auditor
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -57,6 +102,20 @@ type Process struct {
 	mu         sync.Mutex
 	lastActive time.Time
 	state      ProcessState
+	inTurn     bool            // a message was sent and its turn has not ended
+	queue      []QueuedMessage // messages waiting for the current turn to end
+	paused     bool            // queue held after an interrupt until resumed
+	settled    chan struct{}   // closed when inTurn next becomes false
+	prompted   chan struct{}   // closed when a prompt only a person can answer is next shown
+
+	permissionTimers map[string]*time.Timer // by request ID, until answered
+	timedOut         map[string]bool        // requests answered by their timeout
+	planRequests     map[string]bool        // pending ExitPlanMode requests
+
+	// emitMu is held from recording an event to emitting it, so messages
+	// leave in sequence order
+	emitMu     sync.Mutex
+	emittedSeq int64
 }
 
 // NewManager creates a new manager with the given idle timeout.
@@ -84,24 +143,53 @@ func (m *Manager) SetOnStateChange(fn func(StateChangeEvent)) {
 	m.onStateChange = fn
 }
 
+// SetPermissionPolicy makes processes auto-answer permission requests that
+// match an allow or deny rule.
+func (m *Manager) SetPermissionPolicy(p PermissionPolicy) {
+	m.permissionPolicy = p
+}
+
+// SetNotifier makes processes send notifications when they await user input.
+func (m *Manager) SetNotifier(n Notifier) {
+	m.notifier = n
+}
+
+// SetCheckpointer makes processes snapshot the worktree before each turn and
+// link the snapshot to the message that starts it.
+func (m *Manager) SetCheckpointer(c Checkpointer) {
+	m.checkpointer = c
+}
+
+// SetAuditor makes processes record the decisions they make on a user's
+// behalf.
+func (m *Manager) SetAuditor(a Auditor) {
+	m.auditor = a
+}
+
 func (m *Manager) emitStateChange(sessionID string, state ProcessState) {
 	if m.onStateChange != nil {
 		m.onStateChange(StateChangeEvent{SessionID: sessionID, State: state})
 	}
 }
 
+func (m *Manager) emitQueueChange(sessionID string, queue []QueuedMessage, paused bool) {
+	if m.messageListener != nil {
+		m.messageListener.OnQueueChange(QueueChangeEvent{SessionID: sessionID, Queue: queue, Paused: paused})
+	}
+}
+
 // EmitMessage sends a message to the listener.
-func (m *Manager) EmitMessage(sessionID string, event agent.AgentEvent) {
+func (m *Manager) EmitMessage(msg ChatMessage) {
 	if m.messageListener != nil {
-		m.messageListener.OnChatMessage(ChatMessage{
-			SessionID: sessionID,
-			Event:     event,
-		})
+		m.messageListener.OnChatMessage(msg)
 	}
 }
 
 // GetOrCreateProcess returns an existing process or creates a new one.
-func (m *Manager) GetOrCreateProcess(ctx context.Context, sessionID string, resume bool, mode session.Mode) (*Process, bool, error) {
+// New processes are started with the mode and agent backend recorded in meta.
+func (m *Manager) GetOrCreateProcess(ctx context.Context, meta session.SessionMeta, resume bool) (*Process, bool, error) {
+	sessionID := meta.ID
+
 	m.processesMu.Lock()
 	defer m.processesMu.Unlock()
 
@@ -110,12 +198,27 @@ func (m *Manager) GetOrCreateProcess(ctx context.Context, sessionID string, resu
 		return proc, false, nil
 	}
 
+	// Re-read meta under the lock; SetMode or SetConfig may have changed it
+	// since the caller read it
+	if current, found, err := m.sessionStore.Get(sessionID); err == nil && found {
+		meta = current
+	}
+	mode, usage := meta.Mode, meta.Usage
+
 	// Use manager's context for process lifecycle, not request context
 	opts := agent.StartOptions{
 		WorkDir:   m.workDir,
 		SessionID: sessionID,
 		Resume:    resume,
 		Mode:      mode,
+		Backend:   meta.Agent,
+		Config:    meta.Config,
+	}
+	if resume {
+		opts.PriorCostUSD = usage.CostUSD
+	} else if meta.ForkedFrom != nil && meta.ForkedFrom.Resume {
+		opts.ForkFrom = meta.ForkedFrom.SessionID
+		opts.PriorCostUSD = meta.ForkedFrom.CostUSD
 	}
 	sess, err := m.agent.Start(m.ctx, opts)
 	if err != nil {
@@ -138,6 +241,8 @@ func (m *Manager) GetOrCreateProcess(ctx context.Context, sessionID string, resu
 				logger.LogPanic(r, "session crashed", "sessionId", sessionID)
 			}
 			m.remove(sessionID)
+			proc.dropQueue()
+			proc.stopPermissionTimers()
 			m.emitStateChange(sessionID, ProcessStateEnded)
 			slog.Info("process ended", "sessionId", sessionID)
 		}()
@@ -145,10 +250,63 @@ func (m *Manager) GetOrCreateProcess(ctx context.Context, sessionID string, resu
 	}()
 
 	m.emitStateChange(sessionID, ProcessStateIdle)
-	slog.Info("process created", "sessionId", sessionID, "resume", resume, "mode", mode)
+	slog.Info("process created", "sessionId", sessionID, "resume", resume, "mode", mode, "agent", meta.Agent)
 	return proc, true, nil
 }
 
+// SetMode persists a new mode for the session. The running process is closed
+// only when the mode actually changes, since agents read their permission
+// mode at startup.
+func (m *Manager) SetMode(ctx context.Context, sessionID string, mode session.Mode) error {
+	return m.updateStartOptions(sessionID,
+		func(meta session.SessionMeta) bool { return meta.Mode == mode },
+		func() error { return m.sessionStore.SetMode(ctx, sessionID, mode) },
+		"mode", mode)
+}
+
+// SetConfig persists new agent overrides for the session. The running process
+// is closed only when the config actually changes, since agents read it at
+// startup.
+func (m *Manager) SetConfig(ctx context.Context, sessionID string, config session.AgentConfig) error {
+	return m.updateStartOptions(sessionID,
+		func(meta session.SessionMeta) bool { return meta.Config.Equal(config) },
+		func() error { return m.sessionStore.SetConfig(ctx, sessionID, config) },
+		"model", config.Model)
+}
+
+// updateStartOptions persists a session setting that agents read at startup
+// and closes the running process unless unchanged reports the setting already
+// applies. It holds the same lock as GetOrCreateProcess, so no process can
+// start with the old setting after the change.
+func (m *Manager) updateStartOptions(sessionID string, unchanged func(session.SessionMeta) bool, persist func() error, logArgs ...any) error {
+	m.processesMu.Lock()
+	meta, found, err := m.sessionStore.Get(sessionID)
+	if err != nil || !found || unchanged(meta) {
+		m.processesMu.Unlock()
+		if err == nil && !found {
+			err = session.ErrSessionNotFound
+		}
+		return err
+	}
+	if err := persist(); err != nil {
+		m.processesMu.Unlock()
+		return err
+	}
+	proc := m.processes[sessionID]
+	delete(m.processes, sessionID)
+	callback := m.onProcessEnd
+	m.processesMu.Unlock()
+
+	if proc != nil {
+		proc.agentSession.Close()
+		slog.Info("process closed", append([]any{"sessionId", sessionID}, logArgs...)...)
+		if callback != nil {
+			go callback()
+		}
+	}
+	return nil
+}
+
 // GetProcess returns an existing process or nil.
 // Use this to check if a process is running without creating one.
 func (m *Manager) GetProcess(sessionID string) *Process {
@@ -179,6 +337,29 @@ func (m *Manager) ProcessCount() int {
 	return len(m.processes)
 }
 
+// ErrTurnInProgress is returned by WhileIdle when a session has a turn in
+// progress.
+var ErrTurnInProgress = errors.New("a session has a turn in progress")
+
+// WhileIdle runs fn if no session has a turn in progress, including one
+// waiting for a permission answer, and holds back new turns until fn
+// returns. Otherwise it returns ErrTurnInProgress.
+func (m *Manager) WhileIdle(fn func() error) error {
+	m.turnMu.Lock()
+	defer m.turnMu.Unlock()
+
+	m.processesMu.Lock()
+	procs := slices.Collect(maps.Values(m.processes))
+	m.processesMu.Unlock()
+
+	for _, proc := range procs {
+		if proc.InTurn() {
+			return ErrTurnInProgress
+		}
+	}
+	return fn()
+}
+
 // SetOnProcessEnd sets a callback to be called when any process ends.
 func (m *Manager) SetOnProcessEnd(callback func()) {
 	m.processesMu.Lock()
@@ -266,7 +447,7 @@ func (m *Manager) runIdleReaper() {
 func (m *Manager) reapIdle() {
 	now := time.Now()
 	procs := m.removeWhere(func(p *Process) bool {
-		return now.Sub(p.getLastActive()) > m.idleTimeout
+		return now.Sub(p.getLastActive()) > m.idleTimeout && !p.awaitingTimeout()
 	})
 	for _, proc := range procs {
 		proc.agentSession.Close()
@@ -275,15 +456,102 @@ func (m *Manager) reapIdle() {
 }
 
 // SendMessage sends a message to the agent and sets running state.
-func (p *Process) SendMessage(prompt string) error {
+func (p *Process) SendMessage(prompt string, attachments ...agent.Attachment) error {
 	p.SetRunning()
-	return p.agentSession.SendMessage(prompt)
+	return p.agentSession.SendMessage(prompt, attachments...)
 }
 
 // SendPermissionResponse sends a permission response and sets running state.
+// Returns ErrPermissionTimedOut if the request's timeout already answered it.
 func (p *Process) SendPermissionResponse(data agent.PermissionRequestData, choice agent.PermissionChoice) error {
+	if !p.claimPermission(data.RequestID) {
+		return ErrPermissionTimedOut
+	}
 	p.SetRunning()
-	return p.agentSession.SendPermissionResponse(data, choice)
+	if err := p.agentSession.SendPermissionResponse(data, choice); err != nil {
+		return err
+	}
+	p.resolvePlanRequest(p.manager.ctx, data.RequestID, choice != agent.PermissionDeny)
+	return nil
+}
+
+// policyDecision returns the allow or deny rule that answers a permission
+// request. Ask rules and unmatched requests go to the user.
+func (p *Process) policyDecision(event agent.AgentEvent) (policy.Rule, bool) {
+	req, ok := event.(agent.PermissionRequestEvent)
+	// Approving a plan lifts plan mode, which only a user may do
+	if !ok || p.manager.permissionPolicy == nil || req.ToolName == exitPlanModeTool {
+		return policy.Rule{}, false
+	}
+	rule, ok := p.manager.permissionPolicy.Decide(p.sessionID, req.ToolName, req.ToolInput)
+	if !ok || rule.Action == policy.ActionAsk {
+		return policy.Rule{}, false
+	}
+	return rule, true
+}
+
+// answerByPolicy responds to a permission request on the user's behalf and
+// records the rule that did so.
+func (p *Process) answerByPolicy(ctx context.Context, req agent.PermissionRequestEvent, rule policy.Rule) {
+	log := slog.With("sessionId", p.sessionID, "requestId", req.RequestID, "ruleId", rule.ID)
+
+	resp := agent.PermissionResponseEvent{RequestID: req.RequestID, Choice: "allow", RuleID: rule.ID}
+	if rule.Action == policy.ActionDeny {
+		resp.Choice = "deny"
+	}
+	if err := p.respondAutomatically(ctx, req, resp); err != nil {
+		log.Error("failed to send policy permission response", "error", err)
+		return
+	}
+
+	p.auditPermission("policy", "permission.policy", req, resp.Choice, rule.ID)
+	log.Info("permission answered by policy", "tool", req.ToolName, "choice", resp.Choice)
+}
+
+// permissionDecision is the audited params of a permission request answered
+// without a user.
+type permissionDecision struct {
+	SessionID string          `json:"session_id"`
+	RequestID string          `json:"request_id"`
+	Tool      string          `json:"tool"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	Choice    string          `json:"choice"`
+	RuleID    string          `json:"rule_id,omitempty"`
+}
+
+func (p *Process) auditPermission(actor, method string, req agent.PermissionRequestEvent, choice, ruleID string) {
+	if p.manager.auditor == nil {
+		return
+	}
+	p.manager.auditor.Record(actor, method, permissionDecision{
+		SessionID: p.sessionID,
+		RequestID: req.RequestID,
+		Tool:      req.ToolName,
+		Input:     req.ToolInput,
+		Choice:    choice,
+		RuleID:    ruleID,
+	})
+}
+
+// respondAutomatically sends resp to the agent on nobody's behalf, then
+// records and broadcasts it so clients mark the request as answered.
+func (p *Process) respondAutomatically(ctx context.Context, req agent.PermissionRequestEvent, resp agent.PermissionResponseEvent) error {
+	choice := agent.PermissionAllow
+	if resp.Choice == "deny" {
+		choice = agent.PermissionDeny
+	}
+	data := agent.PermissionRequestData{
+		RequestID: req.RequestID,
+		ToolInput: req.ToolInput,
+		ToolUseID: req.ToolUseID,
+	}
+	if err := p.agentSession.SendPermissionResponse(data, choice); err != nil {
+		return err
+	}
+	p.resolvePlanRequest(ctx, req.RequestID, choice != agent.PermissionDeny)
+
+	p.record(ctx, resp)
+	return nil
 }
 
 // SendQuestionResponse sends a question response and sets running state.
@@ -339,6 +607,49 @@ func (p *Process) SetIdle() {
 	p.manager.emitStateChange(p.sessionID, ProcessStateIdle)
 }
 
+// notify alerts away users that the process awaits input, unless the session
+// is muted or a queued message will start the next turn right away.
+func (p *Process) notify(event agent.AgentEvent) {
+	if p.manager.notifier == nil {
+		return
+	}
+	if event.EventType() == agent.EventTypeDone && len(p.Queue()) > 0 {
+		return
+	}
+
+	meta, found, err := p.sessionStore.Get(p.sessionID)
+	if err != nil || !found || meta.Muted {
+		return
+	}
+	p.manager.notifier.NotifyEvent(p.sessionID, meta.Title, event)
+}
+
+// record appends event to history and emits it with its sequence number.
+func (p *Process) record(ctx context.Context, event agent.AgentEvent) {
+	p.emitMu.Lock()
+	defer p.emitMu.Unlock()
+	p.emitLocked(event, p.appendToHistory(ctx, event))
+}
+
+// appendToHistory records event and returns its sequence number, or 0 if it
+// could not be recorded.
+func (p *Process) appendToHistory(ctx context.Context, event agent.AgentEvent) int64 {
+	seq, err := p.sessionStore.AppendToHistory(ctx, p.sessionID, agent.NewEventRecord(event))
+	if err != nil {
+		slog.Error("failed to append to history", "sessionId", p.sessionID, "type", event.EventType(), "error", err)
+	}
+	return seq
+}
+
+// emitLocked sends a recorded event to the listener. Caller must hold p.emitMu.
+func (p *Process) emitLocked(event agent.AgentEvent, seq int64) {
+	msg := ChatMessage{SessionID: p.sessionID, Event: event, Seq: seq, PrevSeq: p.emittedSeq}
+	if seq > 0 {
+		p.emittedSeq = seq
+	}
+	p.manager.EmitMessage(msg)
+}
+
 // streamEvents routes events to history and emits to the event listener.
 func (p *Process) streamEvents(ctx context.Context) {
 	log := slog.With("sessionId", p.sessionID)
@@ -352,20 +663,57 @@ func (p *Process) streamEvents(ctx context.Context) {
 		// Ensure running state on event (handles edge cases like resumed sessions)
 		p.SetRunning()
 
-		// Persist to history
-		if err := p.sessionStore.AppendToHistory(ctx, p.sessionID, agent.NewEventRecord(event)); err != nil {
-			log.Error("failed to append to history", "error", err)
+		// Tracked before clients can see and answer it
+		if req, ok := event.(agent.PermissionRequestEvent); ok {
+			p.trackPlanRequest(req)
+		}
+
+		// Decided before anything is recorded or shown
+		rule, autoAnswer := p.policyDecision(event)
+
+		// Persist to history, holding emitMu until the event is emitted
+		p.emitMu.Lock()
+		seq := p.appendToHistory(ctx, event)
+
+		if usage, ok := event.(agent.UsageEvent); ok {
+			if err := p.sessionStore.AddUsage(ctx, p.sessionID, usage.Usage); err != nil {
+				log.Error("failed to record usage", "error", err)
+			}
 		}
 
-		if eventType.AwaitsUserInput() {
+		if eventType.AwaitsUserInput() && !autoAnswer {
 			p.SetIdle()
 			if err := p.sessionStore.Touch(ctx, p.sessionID); err != nil {
 				log.Error("failed to touch session", "error", err)
 			}
+			p.notify(event)
 		}
 
-		// Emit to listener (ChatMessagesWatcher)
-		p.manager.EmitMessage(p.sessionID, event)
+		// Emit to listener (ChatMessagesWatcher). A request answered by
+		// policy is only kept in history; clients see the response alone, so
+		// nobody is prompted for it
+		if !autoAnswer {
+			p.emitLocked(event, seq)
+		}
+		p.emitMu.Unlock()
+
+		switch e := event.(type) {
+		case agent.PermissionRequestEvent:
+			if autoAnswer {
+				p.answerByPolicy(ctx, e, rule)
+			} else if !p.startPermissionTimer(e) {
+				p.setPrompted()
+			}
+		case agent.AskUserQuestionEvent:
+			p.setPrompted()
+		case agent.RequestCancelledEvent:
+			p.claimPermission(e.RequestID)
+			p.resolvePlanRequest(ctx, e.RequestID, false)
+		}
+
+		if endsTurn(eventType) {
+			p.endTurn(ctx, eventType)
+		}
 	}
 
 	log.Info("event stream ended")
@@ -2,11 +2,16 @@ package process
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/pockode/server/agent"
+	"github.com/pockode/server/policy"
 	"github.com/pockode/server/session"
 )
 
@@ -20,13 +25,16 @@ type startCall struct {
 	sessionID string
 	resume    bool
 	mode      session.Mode
+	backend   string
+	config    session.AgentConfig
+	forkFrom  string
 }
 
 func (m *mockAgent) Start(ctx context.Context, opts agent.StartOptions) (agent.Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.startCalls = append(m.startCalls, startCall{opts.SessionID, opts.Resume, opts.Mode})
+	m.startCalls = append(m.startCalls, startCall{opts.SessionID, opts.Resume, opts.Mode, opts.Backend, opts.Config, opts.ForkFrom})
 
 	if m.sessions == nil {
 		m.sessions = make(map[string]*mockSession)
@@ -43,13 +51,44 @@ type mockSession struct {
 	events   chan agent.AgentEvent
 	closed   bool
 	closedMu sync.Mutex
+	sent     []string
+	attached []agent.Attachment
+	answers  map[string]agent.PermissionChoice // permission responses by request ID
 }
 
 func (s *mockSession) Events() <-chan agent.AgentEvent { return s.events }
-func (s *mockSession) SendMessage(prompt string) error { return nil }
+func (s *mockSession) SendMessage(prompt string, attachments ...agent.Attachment) error {
+	s.closedMu.Lock()
+	defer s.closedMu.Unlock()
+	s.sent = append(s.sent, prompt)
+	s.attached = append(s.attached, attachments...)
+	return nil
+}
+func (s *mockSession) sentAttachments() []agent.Attachment {
+	s.closedMu.Lock()
+	defer s.closedMu.Unlock()
+	return append([]agent.Attachment(nil), s.attached...)
+}
+func (s *mockSession) sentMessages() []string {
+	s.closedMu.Lock()
+	defer s.closedMu.Unlock()
+	return append([]string(nil), s.sent...)
+}
 func (s *mockSession) SendPermissionResponse(data agent.PermissionRequestData, choice agent.PermissionChoice) error {
+	s.closedMu.Lock()
+	defer s.closedMu.Unlock()
+	if s.answers == nil {
+		s.answers = make(map[string]agent.PermissionChoice)
+	}
+	s.answers[data.RequestID] = choice
 	return nil
 }
+func (s *mockSession) answer(requestID string) (agent.PermissionChoice, bool) {
+	s.closedMu.Lock()
+	defer s.closedMu.Unlock()
+	choice, ok := s.answers[requestID]
+	return choice, ok
+}
 func (s *mockSession) SendQuestionResponse(data agent.QuestionRequestData, answers map[string]string) error {
 	return nil
 }
@@ -74,7 +113,7 @@ func TestManager_GetOrCreateProcess_NewSession(t *testing.T) {
 	m := NewManager(mock, "/tmp", store, 10*time.Minute)
 	defer m.Shutdown()
 
-	proc, created, err := m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
+	proc, created, err := m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -101,8 +140,8 @@ func TestManager_GetOrCreateProcess_ExistingSession(t *testing.T) {
 	m := NewManager(mock, "/tmp", store, 10*time.Minute)
 	defer m.Shutdown()
 
-	proc1, _, _ := m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
-	proc2, created, _ := m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
+	proc1, _, _ := m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
+	proc2, created, _ := m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
 
 	if created {
 		t.Error("expected created=false for existing session")
@@ -115,6 +154,167 @@ func TestManager_GetOrCreateProcess_ExistingSession(t *testing.T) {
 	}
 }
 
+func TestManager_GetOrCreateProcess_UsesSessionSettings(t *testing.T) {
+	store, _ := session.NewFileStore(t.TempDir())
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+
+	meta := session.SessionMeta{ID: "sess-1", Mode: session.ModeYolo, Agent: "codex", Config: session.AgentConfig{Model: "opus"}}
+	if _, _, err := m.GetOrCreateProcess(context.Background(), meta, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(mock.startCalls) != 1 {
+		t.Fatalf("expected 1 start call, got %d", len(mock.startCalls))
+	}
+	if mock.startCalls[0].backend != "codex" {
+		t.Errorf("expected backend=codex, got %q", mock.startCalls[0].backend)
+	}
+	if mock.startCalls[0].mode != session.ModeYolo {
+		t.Errorf("expected mode=yolo, got %q", mock.startCalls[0].mode)
+	}
+	if mock.startCalls[0].config.Model != "opus" {
+		t.Errorf("expected model=opus, got %q", mock.startCalls[0].config.Model)
+	}
+}
+
+func TestManager_GetOrCreateProcess_ForkedSession(t *testing.T) {
+	store, _ := session.NewFileStore(t.TempDir())
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+
+	forked := session.SessionMeta{ID: "fork-1", Mode: session.ModeDefault, ForkedFrom: &session.ForkOrigin{SessionID: "sess-1", Resume: true}}
+	if _, _, err := m.GetOrCreateProcess(context.Background(), forked, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.Close("fork-1")
+	if _, _, err := m.GetOrCreateProcess(context.Background(), forked, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fresh := session.SessionMeta{ID: "fork-2", Mode: session.ModeDefault, ForkedFrom: &session.ForkOrigin{SessionID: "sess-1"}}
+	if _, _, err := m.GetOrCreateProcess(context.Background(), fresh, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(mock.startCalls) != 3 {
+		t.Fatalf("expected 3 start calls, got %d", len(mock.startCalls))
+	}
+	if mock.startCalls[0].forkFrom != "sess-1" {
+		t.Errorf("expected first start to fork from sess-1, got %q", mock.startCalls[0].forkFrom)
+	}
+	if mock.startCalls[1].forkFrom != "" {
+		t.Errorf("expected resumed start not to fork, got %q", mock.startCalls[1].forkFrom)
+	}
+	if mock.startCalls[2].forkFrom != "" {
+		t.Errorf("expected non-resumable fork to start fresh, got %q", mock.startCalls[2].forkFrom)
+	}
+}
+
+func TestManager_SetMode(t *testing.T) {
+	ctx := context.Background()
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(ctx, "sess-1")
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+
+	stale, _, _ := store.Get("sess-1")
+	m.GetOrCreateProcess(ctx, stale, false)
+	sess := mock.sessions["sess-1"]
+
+	if err := m.SetMode(ctx, "sess-1", session.ModeYolo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !sess.isClosed() || m.HasProcess("sess-1") {
+		t.Error("expected the process to be closed on a mode change")
+	}
+
+	// A start that read meta before the change still uses the new mode
+	m.GetOrCreateProcess(ctx, stale, true)
+	if len(mock.startCalls) != 2 || mock.startCalls[1].mode != session.ModeYolo {
+		t.Errorf("expected restart in yolo mode, got %+v", mock.startCalls)
+	}
+
+	if err := m.SetMode(ctx, "sess-1", session.ModeYolo); err != nil || !m.HasProcess("sess-1") {
+		t.Errorf("expected an unchanged mode to keep the process, got %v", err)
+	}
+	if err := m.SetMode(ctx, "missing", session.ModeYolo); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("expected session not found, got %v", err)
+	}
+}
+
+func TestManager_SetConfig(t *testing.T) {
+	ctx := context.Background()
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(ctx, "sess-1")
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+
+	stale, _, _ := store.Get("sess-1")
+	m.GetOrCreateProcess(ctx, stale, false)
+	sess := mock.sessions["sess-1"]
+
+	config := session.AgentConfig{Model: "opus", AllowedTools: []string{}}
+	if err := m.SetConfig(ctx, "sess-1", config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !sess.isClosed() || m.HasProcess("sess-1") {
+		t.Error("expected the process to be closed on a config change")
+	}
+
+	// A start that read meta before the change still uses the new config
+	m.GetOrCreateProcess(ctx, stale, true)
+	if len(mock.startCalls) != 2 || mock.startCalls[1].config.Model != "opus" {
+		t.Errorf("expected restart with the new model, got %+v", mock.startCalls)
+	}
+
+	// Nil and empty tool lists configure the agent the same way
+	if err := m.SetConfig(ctx, "sess-1", session.AgentConfig{Model: "opus"}); err != nil || !m.HasProcess("sess-1") {
+		t.Errorf("expected an unchanged config to keep the process, got %v", err)
+	}
+	if err := m.SetConfig(ctx, "missing", config); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("expected session not found, got %v", err)
+	}
+}
+
+func TestProcess_PlanApproval_LeavesPlanMode(t *testing.T) {
+	ctx := context.Background()
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(ctx, "sess-1")
+	store.SetMode(ctx, "sess-1", session.ModePlan)
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+
+	meta, _, _ := store.Get("sess-1")
+	proc, _, _ := m.GetOrCreateProcess(ctx, meta, false)
+	sess := mock.sessions["sess-1"]
+
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r1", ToolName: "Bash"}
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r2", ToolName: "ExitPlanMode"}
+	waitFor(t, func() bool {
+		history, _ := store.GetHistory(ctx, "sess-1")
+		return len(history) == 2
+	})
+
+	proc.SendPermissionResponse(agent.PermissionRequestData{RequestID: "r1"}, agent.PermissionAllow)
+	if meta, _, _ := store.Get("sess-1"); meta.Mode != session.ModePlan {
+		t.Errorf("expected other approvals to keep plan mode, got %q", meta.Mode)
+	}
+
+	proc.SendPermissionResponse(agent.PermissionRequestData{RequestID: "r2"}, agent.PermissionAllow)
+	if meta, _, _ := store.Get("sess-1"); meta.Mode != session.ModeDefault {
+		t.Errorf("expected an approved plan to leave plan mode, got %q", meta.Mode)
+	}
+	if !m.HasProcess("sess-1") {
+		t.Error("expected the process to keep running")
+	}
+}
+
 func TestManager_IdleReaper(t *testing.T) {
 	store, _ := session.NewFileStore(t.TempDir())
 	mock := &mockAgent{}
@@ -122,7 +322,7 @@ func TestManager_IdleReaper(t *testing.T) {
 	m := NewManager(mock, "/tmp", store, idleTimeout)
 	defer m.Shutdown()
 
-	_, _, _ = m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
+	_, _, _ = m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
 
 	time.Sleep(idleTimeout * 2)
 
@@ -141,7 +341,7 @@ func TestManager_Touch_PreventsReaping(t *testing.T) {
 	m := NewManager(mock, "/tmp", store, idleTimeout)
 	defer m.Shutdown()
 
-	_, _, _ = m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
+	_, _, _ = m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
 
 	// Touch periodically for 2x idleTimeout
 	// Reaper runs multiple times, but process survives due to Touch
@@ -164,8 +364,8 @@ func TestManager_Shutdown_ClosesAllProcesses(t *testing.T) {
 	mock := &mockAgent{}
 	m := NewManager(mock, "/tmp", store, 10*time.Minute)
 
-	_, _, _ = m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
-	_, _, _ = m.GetOrCreateProcess(context.Background(), "sess-2", false, session.ModeDefault)
+	_, _, _ = m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
+	_, _, _ = m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-2", Mode: session.ModeDefault}, false)
 
 	m.Shutdown()
 
@@ -189,8 +389,8 @@ func TestManager_Close_SpecificProcess(t *testing.T) {
 	m := NewManager(mock, "/tmp", store, 10*time.Minute)
 	defer m.Shutdown()
 
-	_, _, _ = m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
-	_, _, _ = m.GetOrCreateProcess(context.Background(), "sess-2", false, session.ModeDefault)
+	_, _, _ = m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
+	_, _, _ = m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-2", Mode: session.ModeDefault}, false)
 
 	m.Close("sess-1")
 
@@ -220,7 +420,7 @@ func TestManager_HasProcess(t *testing.T) {
 	}
 
 	// Create process
-	_, _, _ = m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
+	_, _, _ = m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
 
 	if !m.HasProcess("sess-1") {
 		t.Error("expected HasProcess to return true after process creation")
@@ -234,7 +434,7 @@ func TestManager_StreamingEvents_PreventsReaping(t *testing.T) {
 	m := NewManager(mock, "/tmp", store, idleTimeout)
 	defer m.Shutdown()
 
-	_, _, _ = m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
+	_, _, _ = m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
 
 	// Send events periodically for 2x idleTimeout
 	// Process should survive because streamEvents calls touch() on each event
@@ -266,7 +466,7 @@ func TestProcess_SetRunning_EmitsStateChange(t *testing.T) {
 		events = append(events, e)
 	})
 
-	proc, _, _ := m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
+	proc, _, _ := m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
 
 	// Initial state is idle, creation emits idle
 	if len(events) != 1 || events[0].State != ProcessStateIdle {
@@ -297,7 +497,7 @@ func TestProcess_SetIdle_EmitsStateChange(t *testing.T) {
 		events = append(events, e)
 	})
 
-	proc, _, _ := m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
+	proc, _, _ := m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
 	proc.SetRunning()
 
 	// SetIdle should emit idle
@@ -324,7 +524,7 @@ func TestProcess_SendMessage_SetsRunning(t *testing.T) {
 		events = append(events, e)
 	})
 
-	proc, _, _ := m.GetOrCreateProcess(context.Background(), "sess-1", false, session.ModeDefault)
+	proc, _, _ := m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
 
 	if proc.State() != ProcessStateIdle {
 		t.Fatalf("expected initial state to be idle")
@@ -339,3 +539,303 @@ func TestProcess_SendMessage_SetsRunning(t *testing.T) {
 		t.Errorf("expected running event after SendMessage, got %v", events)
 	}
 }
+
+func TestProcess_UsageEvent_RecordedInStore(t *testing.T) {
+	_, sess, _, store := newQueueTestProcess(t)
+
+	usage := session.Usage{InputTokens: 10, OutputTokens: 5, CostUSD: 0.001, Turns: 1}
+	sess.events <- agent.UsageEvent{Usage: usage}
+	sess.events <- agent.DoneEvent{}
+
+	waitFor(t, func() bool {
+		meta, _, _ := store.Get("sess-1")
+		return meta.Usage == usage
+	})
+}
+
+func TestProcess_PermissionPolicy_AutoAnswers(t *testing.T) {
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(context.Background(), "sess-1")
+	rules, _ := policy.NewStore(t.TempDir())
+	allow, _ := rules.Add(policy.Rule{Action: policy.ActionAllow, Tool: "Bash", Pattern: "npm test*", Scope: policy.ScopeGlobal})
+	rules.Add(policy.Rule{Action: policy.ActionDeny, Tool: "Bash", Pattern: "rm *", Scope: policy.ScopeGlobal})
+
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+	m.SetPermissionPolicy(rules.ForWorktree(""))
+	auditor := &mockAuditor{}
+	m.SetAuditor(auditor)
+	listener := &recordingListener{}
+	m.SetMessageListener(listener)
+
+	m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1"}, false)
+	sess := mock.sessions["sess-1"]
+
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r1", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"npm test -- --watch=false"}`)}
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r2", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"rm -rf build"}`)}
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r3", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"make"}`)}
+
+	// r3 is the last event; once it is in history the earlier ones were answered
+	waitFor(t, func() bool {
+		history, _ := store.GetHistory(context.Background(), "sess-1")
+		return len(history) == 5
+	})
+
+	if choice, ok := sess.answer("r1"); !ok || choice != agent.PermissionAllow {
+		t.Errorf("expected r1 to be allowed by policy, got %v %v", choice, ok)
+	}
+	if choice, ok := sess.answer("r2"); !ok || choice != agent.PermissionDeny {
+		t.Errorf("expected r2 to be denied by policy, got %v %v", choice, ok)
+	}
+	if _, ok := sess.answer("r3"); ok {
+		t.Error("expected r3 to be left for the user")
+	}
+
+	history, _ := store.GetHistory(context.Background(), "sess-1")
+	var responses []agent.EventRecord
+	for _, raw := range history {
+		var record agent.EventRecord
+		json.Unmarshal(raw, &record)
+		if record.Type == agent.EventTypePermissionResponse {
+			responses = append(responses, record)
+		}
+	}
+	if len(responses) != 2 || responses[0].RequestID != "r1" || responses[0].RuleID != allow.ID || responses[1].Choice != "deny" {
+		t.Errorf("expected policy responses in history, got %+v", responses)
+	}
+	// Clients only see the prompt left for the user and the policy responses
+	var emitted []string
+	for _, msg := range listener.emitted() {
+		emitted = append(emitted, string(msg.Event.EventType()))
+	}
+	if want := []string{"permission_response", "permission_response", "permission_request"}; !slices.Equal(emitted, want) {
+		t.Errorf("expected %v to be emitted, got %v", want, emitted)
+	}
+
+	if got := auditor.recorded(); len(got) != 2 || got[0] != "policy permission.policy r1 allow "+allow.ID || !strings.HasPrefix(got[1], "policy permission.policy r2 deny ") {
+		t.Errorf("expected policy decisions to be audited, got %q", got)
+	}
+}
+
+type mockAuditor struct {
+	mu        sync.Mutex
+	decisions []string
+}
+
+func (a *mockAuditor) Record(actor, method string, params any) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	d := params.(permissionDecision)
+	a.decisions = append(a.decisions, actor+" "+method+" "+d.RequestID+" "+d.Choice+" "+d.RuleID)
+}
+
+func (a *mockAuditor) recorded() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.decisions)
+}
+
+func TestProcess_PermissionPolicy_LeavesPlanApprovalToUser(t *testing.T) {
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(context.Background(), "sess-1")
+	rules, _ := policy.NewStore(t.TempDir())
+	rules.Add(policy.Rule{Action: policy.ActionAllow, Tool: "*", Scope: policy.ScopeGlobal})
+
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+	m.SetPermissionPolicy(rules.ForWorktree(""))
+
+	m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModePlan}, false)
+	sess := mock.sessions["sess-1"]
+
+	sess.events <- agent.PermissionRequestEvent{RequestID: "plan", ToolName: "ExitPlanMode", ToolInput: json.RawMessage(`{"plan":"do it"}`)}
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r1", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"ls"}`)}
+	waitFor(t, func() bool {
+		_, ok := sess.answer("r1")
+		return ok
+	})
+	if _, ok := sess.answer("plan"); ok {
+		t.Error("expected plan approval to be left for the user")
+	}
+}
+
+type mockNotifier struct {
+	mu     sync.Mutex
+	events []agent.EventType
+	titles []string
+}
+
+func (n *mockNotifier) NotifyEvent(sessionID, sessionTitle string, event agent.AgentEvent) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event.EventType())
+	n.titles = append(n.titles, sessionTitle)
+}
+
+func (n *mockNotifier) notified() []agent.EventType {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return slices.Clone(n.events)
+}
+
+func TestProcess_NotifiesWhenAwaitingInput(t *testing.T) {
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(context.Background(), "sess-1")
+	store.Update(context.Background(), "sess-1", "Fix flaky test")
+
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+	notifier := &mockNotifier{}
+	m.SetNotifier(notifier)
+
+	m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1"}, false)
+	sess := mock.sessions["sess-1"]
+
+	sess.events <- agent.TextEvent{Content: "working"}
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r1", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"make"}`)}
+	sess.events <- agent.DoneEvent{}
+	waitFor(t, func() bool { return len(notifier.notified()) == 2 })
+
+	if got := notifier.notified(); got[0] != agent.EventTypePermissionRequest || got[1] != agent.EventTypeDone {
+		t.Errorf("unexpected notifications: %v", got)
+	}
+	if notifier.titles[0] != "Fix flaky test" {
+		t.Errorf("expected session title, got %q", notifier.titles[0])
+	}
+
+	// Muted sessions stay quiet
+	store.SetMuted(context.Background(), "sess-1", true)
+	sess.events <- agent.ErrorEvent{Error: "boom"}
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r2", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"make"}`)}
+	waitFor(t, func() bool {
+		history, _ := store.GetHistory(context.Background(), "sess-1")
+		return len(history) == 5
+	})
+	if got := notifier.notified(); len(got) != 2 {
+		t.Errorf("expected no notifications for muted session, got %v", got)
+	}
+}
+
+func TestProcess_PermissionTimeout(t *testing.T) {
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(context.Background(), "sess-1")
+	rules, _ := policy.NewStore(t.TempDir())
+	rules.SetTimeout(policy.Timeout{Scope: policy.ScopeGlobal, Seconds: 1, Decision: policy.TimeoutDeny})
+
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+	m.SetPermissionPolicy(rules.ForWorktree(""))
+	auditor := &mockAuditor{}
+	m.SetAuditor(auditor)
+
+	proc, _, _ := m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1"}, false)
+	sess := mock.sessions["sess-1"]
+
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r1", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"ls"}`)}
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r2", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"rm -rf /tmp/x"}`)}
+	waitFor(t, func() bool {
+		history, _ := store.GetHistory(context.Background(), "sess-1")
+		return len(history) == 2
+	})
+
+	// Answering in time stops the timer
+	if err := proc.SendPermissionResponse(agent.PermissionRequestData{RequestID: "r1"}, agent.PermissionAllow); err != nil {
+		t.Fatalf("SendPermissionResponse failed: %v", err)
+	}
+
+	waitFor(t, func() bool {
+		_, ok := sess.answer("r2")
+		return ok
+	})
+	if choice, _ := sess.answer("r2"); choice != agent.PermissionDeny {
+		t.Errorf("expected r2 to be denied by timeout, got %v", choice)
+	}
+	if choice, _ := sess.answer("r1"); choice != agent.PermissionAllow {
+		t.Errorf("expected user answer for r1 to stand, got %v", choice)
+	}
+
+	if err := proc.SendPermissionResponse(agent.PermissionRequestData{RequestID: "r2"}, agent.PermissionAllow); err != ErrPermissionTimedOut {
+		t.Errorf("expected ErrPermissionTimedOut for late answer, got %v", err)
+	}
+
+	waitFor(t, func() bool {
+		history, _ := store.GetHistory(context.Background(), "sess-1")
+		return len(history) == 3
+	})
+	history, _ := store.GetHistory(context.Background(), "sess-1")
+	var record agent.EventRecord
+	json.Unmarshal(history[2], &record)
+	if record.Type != agent.EventTypePermissionResponse || record.RequestID != "r2" || record.Choice != "deny" || record.Reason != agent.PermissionReasonTimeout {
+		t.Errorf("expected timeout response in history, got %+v", record)
+	}
+	if got := auditor.recorded(); !slices.Equal(got, []string{"timeout permission.timeout r2 deny "}) {
+		t.Errorf("expected the timeout decision to be audited, got %q", got)
+	}
+}
+
+func TestManager_PermissionTimeout_PreventsReaping(t *testing.T) {
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(context.Background(), "sess-1")
+	rules, _ := policy.NewStore(t.TempDir())
+	rules.SetTimeout(policy.Timeout{Scope: policy.ScopeGlobal, Seconds: 1, Decision: policy.TimeoutDeny})
+
+	mock := &mockAgent{}
+	idleTimeout := 50 * time.Millisecond
+	m := NewManager(mock, "/tmp", store, idleTimeout)
+	defer m.Shutdown()
+	m.SetPermissionPolicy(rules.ForWorktree(""))
+
+	m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1"}, false)
+	sess := mock.sessions["sess-1"]
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r1", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"ls"}`)}
+
+	// The reaper runs several times before the timeout answers
+	time.Sleep(idleTimeout * 4)
+	if m.GetProcess("sess-1") == nil || sess.isClosed() {
+		t.Fatal("expected a process waiting for a permission timeout to survive")
+	}
+
+	waitFor(t, func() bool {
+		_, ok := sess.answer("r1")
+		return ok
+	})
+	if choice, _ := sess.answer("r1"); choice != agent.PermissionDeny {
+		t.Errorf("expected r1 to be denied by timeout, got %v", choice)
+	}
+}
+
+func TestProcess_PendingTranscript_SentWithFirstMessage(t *testing.T) {
+	ctx := context.Background()
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(ctx, "src")
+	store.AppendToHistory(ctx, "src", agent.NewEventRecord(agent.MessageEvent{Content: "first"}))
+	store.AppendToHistory(ctx, "src", agent.NewEventRecord(agent.TextEvent{Content: "one"}))
+	fork, _ := store.Fork(ctx, "fork", session.ForkOrigin{SessionID: "src", Records: 2})
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	defer m.Shutdown()
+
+	// An interrupt or permission response may start the process before the
+	// first message; the transcript still goes with that message
+	proc, _, _ := m.GetOrCreateProcess(ctx, fork, true)
+	sess := mock.sessions["fork"]
+	proc.Submit(ctx, "", "retry", nil)
+	sent := sess.sentMessages()
+	if len(sent) != 1 || !strings.Contains(sent[0], "User: first") || !strings.HasSuffix(sent[0], "retry") {
+		t.Fatalf("expected the transcript before the first message, got %q", sent)
+	}
+
+	sess.events <- agent.DoneEvent{}
+	waitFor(t, func() bool { return !proc.InTurn() })
+	proc.Submit(ctx, "", "again", nil)
+	if sent := sess.sentMessages(); len(sent) != 2 || sent[1] != "again" {
+		t.Errorf("expected the transcript only once, got %q", sent)
+	}
+	if meta, _, _ := store.Get("fork"); meta.PendingTranscript != 0 {
+		t.Errorf("expected the pending transcript cleared, got %d", meta.PendingTranscript)
+	}
+}
@@ -0,0 +1,42 @@
+package process
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/session"
+)
+
+// exitPlanModeTool is the tool the agent calls to ask for plan approval.
+const exitPlanModeTool = "ExitPlanMode"
+
+// trackPlanRequest remembers a pending plan approval request.
+func (p *Process) trackPlanRequest(req agent.PermissionRequestEvent) {
+	if req.ToolName != exitPlanModeTool {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.planRequests == nil {
+		p.planRequests = make(map[string]bool)
+	}
+	p.planRequests[req.RequestID] = true
+}
+
+// resolvePlanRequest records the session as out of plan mode when a plan
+// approval request is allowed. The agent has already left plan mode itself,
+// so the process keeps running.
+func (p *Process) resolvePlanRequest(ctx context.Context, requestID string, allowed bool) {
+	p.mu.Lock()
+	pending := p.planRequests[requestID]
+	delete(p.planRequests, requestID)
+	p.mu.Unlock()
+
+	if !pending || !allowed {
+		return
+	}
+	if err := p.sessionStore.SetMode(ctx, p.sessionID, session.ModeDefault); err != nil {
+		slog.Error("failed to leave plan mode", "sessionId", p.sessionID, "error", err)
+	}
+}
@@ -0,0 +1,350 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pockode/server/agent"
+)
+
+var ErrQueuedMessageNotFound = errors.New("queued message not found")
+
+// QueuedMessage is a user message waiting for the current turn to finish.
+type QueuedMessage struct {
+	ID          string             `json:"id"`
+	Content     string             `json:"content"`
+	Attachments []agent.Attachment `json:"attachments,omitempty"`
+	User        string             `json:"user,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// QueueChangeEvent carries a snapshot of a session's outbound queue.
+type QueueChangeEvent struct {
+	SessionID string
+	Queue     []QueuedMessage
+	Paused    bool
+}
+
+// endsTurn reports whether an event finishes the agent's turn, after which
+// the next queued message may be delivered. Permission requests and
+// questions pause a turn without ending it.
+func endsTurn(eventType agent.EventType) bool {
+	switch eventType {
+	case agent.EventTypeDone, agent.EventTypeInterrupted, agent.EventTypeError:
+		return true
+	default:
+		return false
+	}
+}
+
+// Submit sends a user message, or queues it while a turn is in progress.
+// Messages are delivered in submission order, one per turn.
+// user is recorded as the sender. Returns the message and whether it was queued.
+func (p *Process) Submit(ctx context.Context, user, content string, attachments []agent.Attachment) (QueuedMessage, bool, error) {
+	msg := QueuedMessage{
+		ID:          uuid.Must(uuid.NewV7()).String(),
+		Content:     content,
+		Attachments: attachments,
+		User:        user,
+		CreatedAt:   time.Now(),
+	}
+
+	p.mu.Lock()
+	if p.paused && !p.inTurn {
+		// Sending a message resumes a queue paused by an interrupt; the
+		// messages queued before it still go first
+		p.queue = append(p.queue, msg)
+		p.paused = false
+		p.inTurn = true
+		p.mu.Unlock()
+
+		p.deliverQueued(ctx)
+		return msg, true, nil
+	}
+	if p.inTurn || len(p.queue) > 0 {
+		p.queue = append(p.queue, msg)
+		queue, paused := p.queueLocked(), p.paused
+		p.mu.Unlock()
+
+		p.manager.emitQueueChange(p.sessionID, queue, paused)
+		return msg, true, nil
+	}
+	p.inTurn = true
+	p.mu.Unlock()
+
+	if err := p.deliver(ctx, msg, false); err != nil {
+		p.setInTurn(false)
+		return msg, false, err
+	}
+	return msg, false, nil
+}
+
+// Queue returns a snapshot of the queued messages.
+func (p *Process) Queue() []QueuedMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queueLocked()
+}
+
+// QueuePaused reports whether the queue is held after an interrupt.
+func (p *Process) QueuePaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// ResumeQueue delivers the next queued message after an interrupt paused the
+// queue. It does nothing when the queue is not paused.
+func (p *Process) ResumeQueue(ctx context.Context) {
+	p.mu.Lock()
+	if !p.paused || p.inTurn {
+		p.mu.Unlock()
+		return
+	}
+	p.paused = false
+	p.inTurn = true
+	p.mu.Unlock()
+
+	p.deliverQueued(ctx)
+}
+
+// UpdateQueued replaces the content of a queued message.
+func (p *Process) UpdateQueued(id, content string) error {
+	p.mu.Lock()
+	i := p.queueIndexLocked(id)
+	if i < 0 {
+		p.mu.Unlock()
+		return ErrQueuedMessageNotFound
+	}
+	p.queue[i].Content = content
+	queue, paused := p.queueLocked(), p.paused
+	p.mu.Unlock()
+
+	p.manager.emitQueueChange(p.sessionID, queue, paused)
+	return nil
+}
+
+// CancelQueued removes a message from the queue before it is delivered.
+func (p *Process) CancelQueued(id string) error {
+	p.mu.Lock()
+	i := p.queueIndexLocked(id)
+	if i < 0 {
+		p.mu.Unlock()
+		return ErrQueuedMessageNotFound
+	}
+	p.queue = append(p.queue[:i], p.queue[i+1:]...)
+	if len(p.queue) == 0 {
+		p.paused = false
+	}
+	queue, paused := p.queueLocked(), p.paused
+	p.mu.Unlock()
+
+	p.manager.emitQueueChange(p.sessionID, queue, paused)
+	return nil
+}
+
+// deliver checkpoints the worktree, records the message in history and sends
+// it to the agent after any pending transcript. Emitted messages are also sent
+// to subscribers; the sender of a direct message already shows it.
+func (p *Process) deliver(ctx context.Context, msg QueuedMessage, emit bool) error {
+	// A rollback through WhileIdle waits for the turn to start, or the turn
+	// for the rollback to finish
+	p.manager.turnMu.Lock()
+	defer p.manager.turnMu.Unlock()
+
+	checkpoint, err := p.checkpoint(ctx)
+	event := agent.MessageEvent{Content: msg.Content, Attachments: msg.Attachments, User: msg.User, Checkpoint: checkpoint}
+	if emit {
+		p.record(ctx, event)
+	} else {
+		p.appendToHistory(ctx, event)
+	}
+	if err != nil {
+		p.record(ctx, agent.WarningEvent{
+			Message: "The worktree could not be snapshotted before this message, so it cannot be rolled back to here",
+			Code:    "checkpoint_failed",
+		})
+	}
+	transcript, pending := p.pendingTranscript(ctx)
+	if err := p.SendMessage(transcript+msg.Content, msg.Attachments...); err != nil {
+		return err
+	}
+	if pending {
+		if err := p.sessionStore.ClearPendingTranscript(ctx, p.sessionID); err != nil {
+			slog.Error("failed to clear pending transcript", "sessionId", p.sessionID, "error", err)
+		}
+	}
+	return nil
+}
+
+// checkpointTimeout bounds the snapshot taken before a turn, so a large or
+// slow worktree cannot hold the message back for long.
+var checkpointTimeout = 10 * time.Second
+
+// checkpoint snapshots the worktree before a turn. A failed or overdue
+// snapshot is logged and returned, but does not hold back the message.
+func (p *Process) checkpoint(ctx context.Context) (string, error) {
+	if p.manager.checkpointer == nil {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, checkpointTimeout)
+	defer cancel()
+	id, err := p.manager.checkpointer.Checkpoint(ctx, p.sessionID)
+	if err != nil {
+		slog.Error("failed to checkpoint worktree", "sessionId", p.sessionID, "error", err)
+		return "", err
+	}
+	return id, nil
+}
+
+// endTurn marks the current turn finished and delivers the next queued message.
+// After an interrupt the queue is paused instead, so the user decides whether
+// the queued messages still apply.
+func (p *Process) endTurn(ctx context.Context, eventType agent.EventType) {
+	if eventType == agent.EventTypeInterrupted {
+		p.mu.Lock()
+		if len(p.queue) > 0 {
+			p.paused = true
+			queue := p.queueLocked()
+			p.setSettledLocked()
+			p.mu.Unlock()
+
+			p.manager.emitQueueChange(p.sessionID, queue, true)
+			return
+		}
+		p.mu.Unlock()
+	}
+	p.deliverQueued(ctx)
+}
+
+// deliverQueued delivers the next queued message in the turn already marked
+// in progress, or settles when the queue is empty. Delivered messages are also
+// emitted so every subscriber sees them leave the queue.
+func (p *Process) deliverQueued(ctx context.Context) {
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 {
+			p.setSettledLocked()
+			p.mu.Unlock()
+			return
+		}
+		next := p.queue[0]
+		p.queue = p.queue[1:]
+		queue := p.queueLocked()
+		p.mu.Unlock()
+
+		p.manager.emitQueueChange(p.sessionID, queue, false)
+
+		err := p.deliver(ctx, next, true)
+		if err == nil {
+			return
+		}
+		slog.Error("failed to deliver queued message", "sessionId", p.sessionID, "queueId", next.ID, "error", err)
+	}
+}
+
+// dropQueue discards undelivered messages when the process ends.
+func (p *Process) dropQueue() {
+	p.mu.Lock()
+	dropped := len(p.queue)
+	p.queue = nil
+	p.paused = false
+	p.setSettledLocked()
+	p.mu.Unlock()
+
+	if dropped > 0 {
+		slog.Warn("queued messages dropped", "sessionId", p.sessionID, "count", dropped)
+		p.manager.emitQueueChange(p.sessionID, []QueuedMessage{}, false)
+	}
+}
+
+func (p *Process) setInTurn(inTurn bool) {
+	p.mu.Lock()
+	if inTurn {
+		p.inTurn = true
+	} else {
+		p.setSettledLocked()
+	}
+	p.mu.Unlock()
+}
+
+// InTurn reports whether a turn is in progress, including one paused on a
+// permission request or question.
+func (p *Process) InTurn() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inTurn
+}
+
+// Settled returns a channel that is closed once no turn is in progress and
+// the queue is empty, including when the process ends.
+func (p *Process) Settled() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.inTurn {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	if p.settled == nil {
+		p.settled = make(chan struct{})
+	}
+	return p.settled
+}
+
+// Prompted returns a channel that is closed the next time the agent shows a
+// question, or a permission request that neither policy nor a timeout will
+// answer. Callers with nobody to answer, such as schedules, give up then.
+func (p *Process) Prompted() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.prompted == nil {
+		p.prompted = make(chan struct{})
+	}
+	return p.prompted
+}
+
+func (p *Process) setPrompted() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.prompted != nil {
+		close(p.prompted)
+		p.prompted = nil
+	}
+}
+
+// setSettledLocked ends the turn and wakes Settled waiters. Caller must hold p.mu.
+func (p *Process) setSettledLocked() {
+	p.inTurn = false
+	if p.settled != nil {
+		close(p.settled)
+		p.settled = nil
+	}
+}
+
+// queueLocked returns a copy of the queue for broadcast, with attachment
+// content dropped. Caller must hold p.mu.
+func (p *Process) queueLocked() []QueuedMessage {
+	queue := make([]QueuedMessage, len(p.queue))
+	copy(queue, p.queue)
+	for i := range queue {
+		queue[i].Attachments = agent.WithoutData(queue[i].Attachments)
+	}
+	return queue
+}
+
+// queueIndexLocked returns the index of a queued message or -1. Caller must hold p.mu.
+func (p *Process) queueIndexLocked(id string) int {
+	for i, msg := range p.queue {
+		if msg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,427 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/session"
+)
+
+type recordingListener struct {
+	mu       sync.Mutex
+	queues   [][]QueuedMessage
+	paused   bool
+	messages []ChatMessage
+}
+
+func (l *recordingListener) OnChatMessage(msg ChatMessage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingListener) emitted() []ChatMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.messages)
+}
+
+func (l *recordingListener) OnQueueChange(event QueueChangeEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queues = append(l.queues, event.Queue)
+	l.paused = event.Paused
+}
+
+func (l *recordingListener) lastPaused() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.paused
+}
+
+func (l *recordingListener) lastQueue() []QueuedMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queues) == 0 {
+		return nil
+	}
+	return l.queues[len(l.queues)-1]
+}
+
+func newQueueTestProcess(t *testing.T) (*Process, *mockSession, *recordingListener, session.Store) {
+	t.Helper()
+	store, _ := session.NewFileStore(t.TempDir())
+	store.Create(context.Background(), "sess-1")
+	mock := &mockAgent{}
+	m := NewManager(mock, "/tmp", store, 10*time.Minute)
+	t.Cleanup(m.Shutdown)
+
+	listener := &recordingListener{}
+	m.SetMessageListener(listener)
+
+	proc, _, err := m.GetOrCreateProcess(context.Background(), session.SessionMeta{ID: "sess-1", Mode: session.ModeDefault}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return proc, mock.sessions["sess-1"], listener, store
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestProcess_Submit_QueuesDuringTurn(t *testing.T) {
+	proc, sess, listener, store := newQueueTestProcess(t)
+	ctx := context.Background()
+
+	if _, queued, _ := proc.Submit(ctx, "", "first", nil); queued {
+		t.Fatal("expected first message to be sent immediately")
+	}
+	second, queued, _ := proc.Submit(ctx, "alice", "second", nil)
+	if !queued {
+		t.Fatal("expected second message to be queued")
+	}
+	proc.Submit(ctx, "", "third", nil)
+
+	if got := sess.sentMessages(); !slices.Equal(got, []string{"first"}) {
+		t.Fatalf("expected only first to be sent, got %v", got)
+	}
+	if queue := listener.lastQueue(); len(queue) != 2 || queue[0].ID != second.ID {
+		t.Fatalf("expected 2 queued messages, got %+v", queue)
+	}
+
+	// Permission requests pause the turn without ending it
+	sess.events <- agent.PermissionRequestEvent{RequestID: "r1"}
+	time.Sleep(20 * time.Millisecond)
+	if len(sess.sentMessages()) != 1 {
+		t.Fatal("expected queue to hold while a permission request is pending")
+	}
+
+	sess.events <- agent.DoneEvent{}
+	waitFor(t, func() bool { return len(sess.sentMessages()) == 2 })
+	if len(proc.Queue()) != 1 {
+		t.Errorf("expected 1 message left in queue, got %d", len(proc.Queue()))
+	}
+
+	sess.events <- agent.ErrorEvent{Error: "failed"}
+	waitFor(t, func() bool { return len(sess.sentMessages()) == 3 })
+	if got := sess.sentMessages(); !slices.Equal(got, []string{"first", "second", "third"}) {
+		t.Errorf("expected delivery in order, got %v", got)
+	}
+
+	history, _ := store.GetHistory(ctx, "sess-1")
+	var messages, senders []string
+	for _, raw := range history {
+		var record agent.EventRecord
+		json.Unmarshal(raw, &record)
+		if record.Type == agent.EventTypeMessage {
+			messages = append(messages, record.Content)
+			senders = append(senders, record.User)
+		}
+	}
+	if !slices.Equal(messages, []string{"first", "second", "third"}) {
+		t.Errorf("expected delivered messages in history order, got %v", messages)
+	}
+	if !slices.Equal(senders, []string{"", "alice", ""}) {
+		t.Errorf("expected queued sender to be kept, got %v", senders)
+	}
+}
+
+func TestProcess_Interrupt_PausesQueue(t *testing.T) {
+	proc, sess, listener, _ := newQueueTestProcess(t)
+	ctx := context.Background()
+
+	proc.Submit(ctx, "", "first", nil)
+	proc.Submit(ctx, "", "second", nil)
+
+	sess.events <- agent.InterruptedEvent{}
+	waitFor(t, func() bool { return listener.lastPaused() })
+	if proc.InTurn() || len(sess.sentMessages()) != 1 || !proc.QueuePaused() {
+		t.Fatalf("expected the queue to hold after an interrupt, sent %v", sess.sentMessages())
+	}
+
+	proc.ResumeQueue(ctx)
+	if got := sess.sentMessages(); !slices.Equal(got, []string{"first", "second"}) {
+		t.Fatalf("expected resume to deliver the queued message, got %v", got)
+	}
+	if proc.QueuePaused() || listener.lastPaused() {
+		t.Error("expected the queue to be unpaused after resume")
+	}
+}
+
+func TestProcess_Interrupt_SubmitResumesQueueInOrder(t *testing.T) {
+	proc, sess, _, _ := newQueueTestProcess(t)
+	ctx := context.Background()
+
+	proc.Submit(ctx, "", "first", nil)
+	proc.Submit(ctx, "", "second", nil)
+	sess.events <- agent.InterruptedEvent{}
+	waitFor(t, proc.QueuePaused)
+
+	if _, queued, _ := proc.Submit(ctx, "", "third", nil); !queued {
+		t.Error("expected the new message to wait behind the earlier queued one")
+	}
+	if got := sess.sentMessages(); !slices.Equal(got, []string{"first", "second"}) {
+		t.Fatalf("expected the earlier queued message to go first, got %v", got)
+	}
+
+	sess.events <- agent.DoneEvent{}
+	waitFor(t, func() bool { return len(sess.sentMessages()) == 3 })
+}
+
+func TestProcess_Interrupt_CancelLastQueuedUnpauses(t *testing.T) {
+	proc, sess, _, _ := newQueueTestProcess(t)
+	ctx := context.Background()
+
+	proc.Submit(ctx, "", "first", nil)
+	second, _, _ := proc.Submit(ctx, "", "second", nil)
+	sess.events <- agent.InterruptedEvent{}
+	waitFor(t, proc.QueuePaused)
+
+	proc.CancelQueued(second.ID)
+	if proc.QueuePaused() {
+		t.Error("expected an empty queue not to stay paused")
+	}
+	if _, queued, _ := proc.Submit(ctx, "", "third", nil); queued {
+		t.Error("expected the next message to be sent immediately")
+	}
+}
+
+func TestProcess_QueuedAttachments_BroadcastWithoutData(t *testing.T) {
+	proc, sess, listener, _ := newQueueTestProcess(t)
+	ctx := context.Background()
+	image := agent.Attachment{Type: agent.AttachmentImage, Name: "shot.png", MediaType: "image/png", Data: "iVBORw0KGgo="}
+
+	proc.Submit(ctx, "", "first", nil)
+	proc.Submit(ctx, "", "look", []agent.Attachment{image})
+
+	queue := listener.lastQueue()
+	if len(queue) != 1 || len(queue[0].Attachments) != 1 || queue[0].Attachments[0].Data != "" || queue[0].Attachments[0].Name != "shot.png" {
+		t.Fatalf("expected the queue broadcast without image data, got %+v", queue)
+	}
+
+	sess.events <- agent.DoneEvent{}
+	waitFor(t, func() bool { return len(sess.sentMessages()) == 2 })
+	if sent := sess.sentAttachments(); len(sent) != 1 || sent[0].Data != image.Data {
+		t.Errorf("expected the agent to get the image data, got %+v", sent)
+	}
+}
+
+type countingCheckpointer struct {
+	mu    sync.Mutex
+	calls int
+}
+
+// Checkpoint fails its second call, which must not hold back the message.
+func (c *countingCheckpointer) Checkpoint(ctx context.Context, sessionID string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if c.calls == 2 {
+		return "", errors.New("snapshot failed")
+	}
+	return fmt.Sprintf("%s-cp%d", sessionID, c.calls), nil
+}
+
+func TestProcess_Submit_Checkpoints(t *testing.T) {
+	proc, sess, listener, store := newQueueTestProcess(t)
+	proc.manager.SetCheckpointer(&countingCheckpointer{})
+	ctx := context.Background()
+
+	proc.Submit(ctx, "", "first", nil)
+	proc.Submit(ctx, "", "second", nil)
+	proc.Submit(ctx, "", "third", nil)
+	sess.events <- agent.DoneEvent{}
+	sess.events <- agent.DoneEvent{}
+	waitFor(t, func() bool { return len(sess.sentMessages()) == 3 })
+
+	history, _ := store.GetHistory(ctx, "sess-1")
+	var checkpoints []string
+	for _, raw := range history {
+		var record agent.EventRecord
+		json.Unmarshal(raw, &record)
+		if record.Type == agent.EventTypeMessage {
+			checkpoints = append(checkpoints, record.Checkpoint)
+		}
+	}
+	if !slices.Equal(checkpoints, []string{"sess-1-cp1", "", "sess-1-cp3"}) {
+		t.Errorf("expected each turn to link its checkpoint, got %v", checkpoints)
+	}
+
+	// The failed snapshot is recorded and shown after its message
+	var warnings []agent.EventRecord
+	for _, raw := range history {
+		var record agent.EventRecord
+		json.Unmarshal(raw, &record)
+		if record.Type == agent.EventTypeWarning {
+			warnings = append(warnings, record)
+		}
+	}
+	if len(warnings) != 1 || warnings[0].Code != "checkpoint_failed" {
+		t.Errorf("expected one checkpoint warning, got %+v", warnings)
+	}
+	if !slices.ContainsFunc(listener.emitted(), func(m ChatMessage) bool { return m.Event.EventType() == agent.EventTypeWarning }) {
+		t.Error("expected the checkpoint warning to be emitted")
+	}
+}
+
+// blockingCheckpointer never finishes a snapshot before its context expires.
+type blockingCheckpointer struct{}
+
+func (blockingCheckpointer) Checkpoint(ctx context.Context, sessionID string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestProcess_Submit_CheckpointTimeout(t *testing.T) {
+	saved := checkpointTimeout
+	checkpointTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { checkpointTimeout = saved })
+
+	proc, sess, _, _ := newQueueTestProcess(t)
+	proc.manager.SetCheckpointer(blockingCheckpointer{})
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := proc.Submit(context.Background(), "", "hello", nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a stuck snapshot not to hold back the message")
+	}
+	if sent := sess.sentMessages(); len(sent) != 1 {
+		t.Errorf("expected the message to be sent, got %v", sent)
+	}
+}
+
+func TestProcess_UpdateAndCancelQueued(t *testing.T) {
+	proc, sess, listener, _ := newQueueTestProcess(t)
+	ctx := context.Background()
+
+	proc.Submit(ctx, "", "first", nil)
+	edited, _, _ := proc.Submit(ctx, "", "typo", nil)
+	cancelled, _, _ := proc.Submit(ctx, "", "never mind", nil)
+
+	if err := proc.UpdateQueued(edited.ID, "fixed"); err != nil {
+		t.Fatalf("UpdateQueued failed: %v", err)
+	}
+	if err := proc.CancelQueued(cancelled.ID); err != nil {
+		t.Fatalf("CancelQueued failed: %v", err)
+	}
+	if err := proc.CancelQueued("missing"); err != ErrQueuedMessageNotFound {
+		t.Errorf("expected ErrQueuedMessageNotFound, got %v", err)
+	}
+
+	queue := listener.lastQueue()
+	if len(queue) != 1 || queue[0].Content != "fixed" {
+		t.Fatalf("unexpected queue: %+v", queue)
+	}
+
+	sess.events <- agent.DoneEvent{}
+	waitFor(t, func() bool { return len(sess.sentMessages()) == 2 })
+	if got := sess.sentMessages(); got[1] != "fixed" {
+		t.Errorf("expected edited content to be delivered, got %q", got[1])
+	}
+}
+
+func TestProcess_QueueDroppedOnProcessEnd(t *testing.T) {
+	proc, sess, listener, _ := newQueueTestProcess(t)
+	ctx := context.Background()
+
+	proc.Submit(ctx, "", "first", nil)
+	proc.Submit(ctx, "", "second", nil)
+
+	sess.Close()
+	waitFor(t, func() bool {
+		queue := listener.lastQueue()
+		return queue != nil && len(queue) == 0
+	})
+}
+
+func TestProcess_Settled(t *testing.T) {
+	proc, sess, _, _ := newQueueTestProcess(t)
+	ctx := context.Background()
+
+	select {
+	case <-proc.Settled():
+	default:
+		t.Fatal("expected an idle process to be settled")
+	}
+
+	proc.Submit(ctx, "", "first", nil)
+	proc.Submit(ctx, "", "second", nil)
+	settled := proc.Settled()
+
+	sess.events <- agent.DoneEvent{}
+	waitFor(t, func() bool { return len(sess.sentMessages()) == 2 })
+	select {
+	case <-settled:
+		t.Fatal("expected queued message to keep the process unsettled")
+	default:
+	}
+
+	sess.events <- agent.DoneEvent{}
+	select {
+	case <-settled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for process to settle")
+	}
+}
+
+func TestManager_WhileIdle(t *testing.T) {
+	proc, sess, _, _ := newQueueTestProcess(t)
+	ctx := context.Background()
+
+	proc.Submit(ctx, "", "first", nil)
+	err := proc.manager.WhileIdle(func() error {
+		t.Error("expected fn not to run during a turn")
+		return nil
+	})
+	if !errors.Is(err, ErrTurnInProgress) {
+		t.Errorf("expected ErrTurnInProgress, got %v", err)
+	}
+
+	sess.events <- agent.DoneEvent{}
+	waitFor(t, func() bool { return !proc.InTurn() })
+
+	// A message sent while fn runs starts its turn afterwards
+	entered, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- proc.manager.WhileIdle(func() error {
+			close(entered)
+			<-release
+			return nil
+		})
+	}()
+	<-entered
+	go proc.Submit(ctx, "", "second", nil)
+	time.Sleep(50 * time.Millisecond)
+	if sent := sess.sentMessages(); len(sent) != 1 {
+		t.Fatalf("expected the message to wait for fn, got %v", sent)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("WhileIdle failed: %v", err)
+	}
+	waitFor(t, func() bool { return len(sess.sentMessages()) == 2 })
+}
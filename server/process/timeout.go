@@ -0,0 +1,120 @@
+package process
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/logger"
+	"github.com/pockode/server/policy"
+)
+
+var ErrPermissionTimedOut = errors.New("permission request already answered by timeout")
+
+// startPermissionTimer applies the configured default decision if nobody
+// answers req in time. It reports whether the timeout will answer req rather
+// than escalate it.
+func (p *Process) startPermissionTimer(req agent.PermissionRequestEvent) bool {
+	if p.manager.permissionPolicy == nil {
+		return false
+	}
+	timeout, ok := p.manager.permissionPolicy.TimeoutFor(p.sessionID)
+	if !ok {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.permissionTimers == nil {
+		p.permissionTimers = make(map[string]*time.Timer)
+	}
+	p.permissionTimers[req.RequestID] = time.AfterFunc(timeout.After(), func() {
+		p.expirePermission(req, timeout)
+	})
+	return timeout.Decision != policy.TimeoutEscalate
+}
+
+// claimPermission stops the timer of a request being answered or cancelled.
+// It returns false if the timeout has already answered the request.
+func (p *Process) claimPermission(requestID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if timer, ok := p.permissionTimers[requestID]; ok {
+		timer.Stop()
+		delete(p.permissionTimers, requestID)
+	}
+	return !p.timedOut[requestID]
+}
+
+// awaitingTimeout reports whether a request is waiting for its timeout. The
+// idle reaper spares such processes so the timeout can still answer.
+func (p *Process) awaitingTimeout() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.permissionTimers) > 0
+}
+
+// stopPermissionTimers cancels all timers when the process ends.
+func (p *Process) stopPermissionTimers() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, timer := range p.permissionTimers {
+		timer.Stop()
+	}
+	p.permissionTimers = nil
+}
+
+func (p *Process) expirePermission(req agent.PermissionRequestEvent, timeout policy.Timeout) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.LogPanic(r, "permission timeout crashed", "sessionId", p.sessionID)
+		}
+	}()
+
+	p.mu.Lock()
+	if _, pending := p.permissionTimers[req.RequestID]; !pending {
+		// Answered or cancelled while the timer fired
+		p.mu.Unlock()
+		return
+	}
+	delete(p.permissionTimers, req.RequestID)
+	if timeout.Decision != policy.TimeoutEscalate {
+		if p.timedOut == nil {
+			p.timedOut = make(map[string]bool)
+		}
+		p.timedOut[req.RequestID] = true
+	}
+	p.mu.Unlock()
+
+	log := slog.With("sessionId", p.sessionID, "requestId", req.RequestID, "tool", req.ToolName, "after", timeout.After())
+
+	if timeout.Decision == policy.TimeoutEscalate {
+		// The request keeps waiting; make sure someone hears about it,
+		// even in a muted session
+		if p.manager.notifier != nil {
+			meta, _, _ := p.sessionStore.Get(p.sessionID)
+			p.manager.notifier.NotifyEvent(p.sessionID, meta.Title, req)
+		}
+		p.auditPermission("timeout", "permission.timeout", req, string(timeout.Decision), "")
+		log.Info("permission request escalated after timeout")
+		return
+	}
+
+	resp := agent.PermissionResponseEvent{
+		RequestID: req.RequestID,
+		Choice:    string(timeout.Decision),
+		Reason:    agent.PermissionReasonTimeout,
+	}
+	p.touch()
+	p.SetRunning()
+	if err := p.respondAutomatically(p.manager.ctx, req, resp); err != nil {
+		log.Error("failed to send timeout permission response", "error", err)
+		return
+	}
+
+	p.auditPermission("timeout", "permission.timeout", req, resp.Choice, "")
+	log.Info("permission answered by timeout", "choice", resp.Choice)
+}
@@ -0,0 +1,374 @@
+package rpc
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pockode/server/git"
+	"github.com/pockode/server/notify"
+	"github.com/pockode/server/policy"
+	"github.com/pockode/server/schedule"
+	"github.com/pockode/server/session"
+)
+
+// ProtocolVersion is the version of the protocol spoken by this build.
+// It is bumped only for changes old clients cannot cope with, like removed
+// methods or fields whose meaning changed. Additions are announced as
+// capabilities or discovered through rpc.describe instead.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest client protocol version still served.
+const MinProtocolVersion = 1
+
+// Capabilities name optional features. A server only reports, and only
+// describes the methods of, the features it was started with.
+const (
+	CapabilityAudit       = "audit"
+	CapabilityPermissions = "permissions"
+	CapabilityNotify      = "notify"
+	CapabilitySchedule    = "schedule"
+)
+
+// Method describes an RPC method. Params and Result are zero values of the
+// wire types; a nil Params takes no params and a nil Result replies null.
+type Method struct {
+	Name       string
+	Params     any
+	Result     any
+	Capability string // "" = always available
+}
+
+// Methods lists every Client → Server method.
+var Methods = []Method{
+	{Name: "auth", Params: AuthParams{}, Result: AuthResult{}},
+	{Name: "rpc.describe", Result: Document{}},
+
+	{Name: "worktree.list", Result: WorktreeListResult{}},
+	{Name: "worktree.create", Params: WorktreeCreateParams{}, Result: WorktreeCreateResult{}},
+	{Name: "worktree.delete", Params: WorktreeDeleteParams{}, Result: struct{}{}},
+	{Name: "worktree.switch", Params: WorktreeSwitchParams{}, Result: WorktreeSwitchResult{}},
+	{Name: "worktree.subscribe", Result: WorktreeSubscribeResult{}},
+	{Name: "worktree.unsubscribe", Params: WorktreeUnsubscribeParams{}, Result: struct{}{}},
+
+	{Name: "command.list", Result: CommandListResult{}},
+	{Name: "agent.list", Result: AgentListResult{}},
+
+	{Name: "settings.subscribe", Result: SettingsSubscribeResult{}},
+	{Name: "settings.unsubscribe", Params: SettingsUnsubscribeParams{}, Result: struct{}{}},
+	{Name: "settings.update", Params: SettingsUpdateParams{}, Result: struct{}{}},
+
+	{Name: "token.list", Result: TokenListResult{}},
+	{Name: "token.create", Params: TokenCreateParams{}, Result: TokenCreateResult{}},
+	{Name: "token.revoke", Params: TokenRevokeParams{}, Result: struct{}{}},
+
+	{Name: "permissions.list", Params: PermissionsListParams{}, Result: PermissionsListResult{}, Capability: CapabilityPermissions},
+	{Name: "permissions.add", Params: PermissionsAddParams{}, Result: policy.Rule{}, Capability: CapabilityPermissions},
+	{Name: "permissions.remove", Params: PermissionsRemoveParams{}, Result: struct{}{}, Capability: CapabilityPermissions},
+	{Name: "permissions.timeout.list", Result: PermissionsTimeoutListResult{}, Capability: CapabilityPermissions},
+	{Name: "permissions.timeout.set", Params: PermissionsTimeoutSetParams{}, Result: policy.Timeout{}, Capability: CapabilityPermissions},
+	{Name: "permissions.timeout.clear", Params: PermissionsTimeoutClearParams{}, Result: struct{}{}, Capability: CapabilityPermissions},
+
+	{Name: "notify.vapid_key", Result: NotifyVAPIDKeyResult{}, Capability: CapabilityNotify},
+	{Name: "notify.subscribe", Params: NotifySubscribeParams{}, Result: struct{}{}, Capability: CapabilityNotify},
+	{Name: "notify.unsubscribe", Params: NotifyUnsubscribeParams{}, Result: struct{}{}, Capability: CapabilityNotify},
+	{Name: "notify.webhook.list", Result: NotifyWebhookListResult{}, Capability: CapabilityNotify},
+	{Name: "notify.webhook.add", Params: NotifyWebhookAddParams{}, Result: notify.Webhook{}, Capability: CapabilityNotify},
+	{Name: "notify.webhook.remove", Params: NotifyWebhookRemoveParams{}, Result: struct{}{}, Capability: CapabilityNotify},
+
+	{Name: "schedule.list", Result: ScheduleListResult{}, Capability: CapabilitySchedule},
+	{Name: "schedule.create", Params: ScheduleCreateParams{}, Result: schedule.Schedule{}, Capability: CapabilitySchedule},
+	{Name: "schedule.update", Params: ScheduleUpdateParams{}, Result: schedule.Schedule{}, Capability: CapabilitySchedule},
+	{Name: "schedule.delete", Params: ScheduleDeleteParams{}, Result: struct{}{}, Capability: CapabilitySchedule},
+	{Name: "schedule.run", Params: ScheduleRunParams{}, Result: schedule.Run{}, Capability: CapabilitySchedule},
+	{Name: "schedule.runs", Params: ScheduleRunsParams{}, Result: ScheduleRunsResult{}, Capability: CapabilitySchedule},
+
+	{Name: "audit.list", Params: AuditListParams{}, Result: AuditListResult{}, Capability: CapabilityAudit},
+	{Name: "audit.verify", Result: AuditVerifyResult{}, Capability: CapabilityAudit},
+
+	{Name: "chat.messages.subscribe", Params: ChatMessagesSubscribeParams{}, Result: ChatMessagesSubscribeResult{}},
+	{Name: "chat.messages.unsubscribe", Params: ChatMessagesUnsubscribeParams{}, Result: struct{}{}},
+	{Name: "chat.message", Params: MessageParams{}, Result: MessageResult{}},
+	{Name: "chat.interrupt", Params: InterruptParams{}, Result: struct{}{}},
+	{Name: "chat.queue.list", Params: ChatQueueListParams{}, Result: ChatQueueListResult{}},
+	{Name: "chat.queue.update", Params: ChatQueueUpdateParams{}, Result: struct{}{}},
+	{Name: "chat.queue.cancel", Params: ChatQueueCancelParams{}, Result: struct{}{}},
+	{Name: "chat.queue.resume", Params: ChatQueueResumeParams{}, Result: struct{}{}},
+	{Name: "chat.permission_response", Params: PermissionResponseParams{}, Result: struct{}{}},
+	{Name: "chat.question_response", Params: QuestionResponseParams{}, Result: struct{}{}},
+
+	{Name: "session.create", Params: SessionCreateParams{}, Result: SessionListItem{}},
+	{Name: "session.delete", Params: SessionDeleteParams{}, Result: struct{}{}},
+	{Name: "session.update_title", Params: SessionUpdateTitleParams{}, Result: struct{}{}},
+	{Name: "session.set_mode", Params: SessionSetModeParams{}, Result: struct{}{}},
+	{Name: "session.set_agent", Params: SessionSetAgentParams{}, Result: struct{}{}},
+	{Name: "session.set_muted", Params: SessionSetMutedParams{}, Result: struct{}{}},
+	{Name: "session.get_config", Params: SessionGetConfigParams{}, Result: session.AgentConfig{}},
+	{Name: "session.set_config", Params: SessionSetConfigParams{}, Result: struct{}{}},
+	{Name: "session.fork", Params: SessionForkParams{}, Result: SessionListItem{}},
+	{Name: "session.export", Params: SessionExportParams{}, Result: SessionExportResult{}},
+	{Name: "session.import", Params: SessionImportParams{}, Result: SessionListItem{}},
+	{Name: "session.checkpoints", Params: SessionCheckpointsParams{}, Result: SessionCheckpointsResult{}},
+	{Name: "session.rollback", Params: SessionRollbackParams{}, Result: SessionRollbackResult{}},
+	{Name: "session.approve_plan", Params: SessionApprovePlanParams{}, Result: struct{}{}},
+	{Name: "session.search", Params: SessionSearchParams{}, Result: SessionSearchResult{}},
+	{Name: "session.list.subscribe", Result: SessionListSubscribeResult{}},
+	{Name: "session.list.unsubscribe", Params: SessionListUnsubscribeParams{}, Result: struct{}{}},
+
+	{Name: "usage.session", Params: UsageSessionParams{}, Result: UsageSessionResult{}},
+	{Name: "usage.worktree", Result: UsageWorktreeResult{}},
+	{Name: "usage.daily", Params: UsageDailyParams{}, Result: UsageDailyResult{}},
+
+	{Name: "file.get", Params: FileGetParams{}, Result: FileGetResult{}},
+	{Name: "file.write", Params: FileWriteParams{}},
+
+	{Name: "git.status", Result: git.GitStatus{}},
+	{Name: "git.subscribe", Result: GitSubscribeResult{}},
+	{Name: "git.unsubscribe", Params: GitUnsubscribeParams{}, Result: struct{}{}},
+	{Name: "git.diff.subscribe", Params: GitDiffSubscribeParams{}, Result: GitDiffSubscribeResult{}},
+	{Name: "git.diff.unsubscribe", Params: GitDiffUnsubscribeParams{}, Result: struct{}{}},
+	{Name: "git.add", Params: GitPathsParams{}},
+	{Name: "git.reset", Params: GitPathsParams{}},
+	{Name: "git.hunk.stage", Params: GitHunksParams{}},
+	{Name: "git.hunk.unstage", Params: GitHunksParams{}},
+	{Name: "git.hunk.discard", Params: GitHunksParams{}, Result: git.TrashEntry{}},
+	{Name: "git.discard", Params: GitDiscardParams{}, Result: git.TrashEntry{}},
+	{Name: "git.discard.restore", Params: GitDiscardRestoreParams{}, Result: git.TrashEntry{}},
+	{Name: "git.discard.list", Result: GitDiscardListResult{}},
+	{Name: "git.commit", Params: GitCommitParams{}, Result: GitCommitResult{}},
+	{Name: "git.log", Params: GitLogParams{}, Result: GitLogResult{}},
+	{Name: "git.show", Params: GitShowParams{}, Result: git.CommitDetail{}},
+	{Name: "git.blame", Params: GitBlameParams{}, Result: git.Blame{}},
+	{Name: "git.branch.list", Result: GitBranchListResult{}},
+	{Name: "git.branch.create", Params: GitBranchCreateParams{}},
+	{Name: "git.branch.checkout", Params: GitBranchCheckoutParams{}},
+	{Name: "git.branch.delete", Params: GitBranchDeleteParams{}},
+	{Name: "git.fetch"},
+	{Name: "git.pull"},
+	{Name: "git.push", Params: GitPushParams{}},
+
+	{Name: "fs.subscribe", Params: FSSubscribeParams{}, Result: FSSubscribeResult{}},
+	{Name: "fs.unsubscribe", Params: FSUnsubscribeParams{}, Result: struct{}{}},
+}
+
+// Notifications lists every Server → Client notification. "chat.*" stands
+// for "chat.<event type>" of each agent event.
+var Notifications = []Method{
+	{Name: "chat.*", Params: ChatEventParams{}},
+	{Name: "chat.queue", Params: ChatQueueParams{}},
+	{Name: "session.list.changed", Params: SessionListChangedParams{}},
+	{Name: "settings.changed", Params: SettingsChangedParams{}},
+	{Name: "worktree.changed", Params: ChangedParams{}},
+	{Name: "worktree.deleted", Params: WorktreeDeletedParams{}},
+	{Name: "git.changed", Params: ChangedParams{}},
+	{Name: "git.diff.changed", Params: GitDiffChangedParams{}},
+	{Name: "fs.changed", Params: ChangedParams{}},
+}
+
+// Document is an OpenRPC document describing the methods a server offers.
+// Notifications, which OpenRPC has no notion of, are listed separately in
+// the same form.
+type Document struct {
+	OpenRPC       string       `json:"openrpc"`
+	Info          DocumentInfo `json:"info"`
+	Methods       []MethodDoc  `json:"methods"`
+	Notifications []MethodDoc  `json:"x-notifications"`
+	Components    Components   `json:"components"`
+}
+
+type DocumentInfo struct {
+	Title              string   `json:"title"`
+	Version            string   `json:"version"`
+	ProtocolVersion    int      `json:"x-protocol-version"`
+	MinProtocolVersion int      `json:"x-min-protocol-version"`
+	Capabilities       []string `json:"x-capabilities"`
+}
+
+// MethodDoc is an OpenRPC method object. Params are passed by name, one
+// descriptor per field of the params object.
+type MethodDoc struct {
+	Name           string              `json:"name"`
+	ParamStructure string              `json:"paramStructure"`
+	Params         []ContentDescriptor `json:"params"`
+	Result         *ContentDescriptor  `json:"result,omitempty"`
+	Role           string              `json:"x-role,omitempty"` // least role allowed to call the method
+}
+
+type ContentDescriptor struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required,omitempty"`
+	Schema   Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]Schema `json:"schemas"`
+}
+
+// Schema is a JSON Schema object.
+type Schema map[string]any
+
+// Describe builds the document for a server of version offering
+// capabilities. Methods of other capabilities are left out.
+func Describe(version string, capabilities []string) Document {
+	b := &schemaBuilder{defs: make(map[string]Schema)}
+
+	doc := Document{
+		OpenRPC: "1.2.6",
+		Info: DocumentInfo{
+			Title:              "pockode",
+			Version:            version,
+			ProtocolVersion:    ProtocolVersion,
+			MinProtocolVersion: MinProtocolVersion,
+			Capabilities:       capabilities,
+		},
+		Methods:       []MethodDoc{},
+		Notifications: []MethodDoc{},
+	}
+	for _, m := range Methods {
+		if m.Capability != "" && !slices.Contains(capabilities, m.Capability) {
+			continue
+		}
+		md := b.method(m)
+		if m.Result == nil {
+			md.Result = &ContentDescriptor{Name: "result", Schema: Schema{"type": "null"}}
+		} else {
+			md.Result = &ContentDescriptor{Name: "result", Schema: b.schema(reflect.TypeOf(m.Result))}
+		}
+		doc.Methods = append(doc.Methods, md)
+	}
+	for _, n := range Notifications {
+		doc.Notifications = append(doc.Notifications, b.method(n))
+	}
+	doc.Components.Schemas = b.defs
+	return doc
+}
+
+// schemaBuilder derives JSON Schemas from Go types the way encoding/json
+// marshals them. Named structs are shared through components.
+type schemaBuilder struct {
+	defs map[string]Schema
+}
+
+var (
+	timeType    = reflect.TypeFor[time.Time]()
+	rawJSONType = reflect.TypeFor[json.RawMessage]()
+)
+
+func (b *schemaBuilder) method(m Method) MethodDoc {
+	md := MethodDoc{Name: m.Name, ParamStructure: "by-name", Params: []ContentDescriptor{}}
+	if m.Params == nil {
+		return md
+	}
+	obj := b.object(reflect.TypeOf(m.Params))
+	required, _ := obj["required"].([]string)
+	props, _ := obj["properties"].(map[string]Schema)
+	for _, f := range obj["x-order"].([]string) {
+		md.Params = append(md.Params, ContentDescriptor{
+			Name:     f,
+			Required: slices.Contains(required, f),
+			Schema:   props[f],
+		})
+	}
+	return md
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case rawJSONType:
+		return Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t).clean()
+		}
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := b.defs[name]; !ok {
+			b.defs[name] = nil // placeholder for recursive types
+			b.defs[name] = b.object(t).clean()
+		}
+		return Schema{"$ref": "#/components/schemas/" + name}
+	default:
+		return Schema{}
+	}
+}
+
+// object describes a struct's JSON object. Fields of embedded structs are
+// inlined, like encoding/json does. The field order is kept in "x-order"
+// until clean removes it.
+func (b *schemaBuilder) object(t reflect.Type) Schema {
+	props := map[string]Schema{}
+	var order, required []string
+
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					walk(ft)
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if _, dup := props[name]; !dup {
+				order = append(order, name)
+			}
+			props[name] = b.schema(f.Type)
+			if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+				required = append(required, name)
+			}
+		}
+	}
+	walk(t)
+
+	s := Schema{"type": "object", "properties": props, "x-order": order}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (s Schema) clean() Schema {
+	delete(s, "x-order")
+	return s
+}
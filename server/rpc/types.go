@@ -6,32 +6,82 @@ import (
 	"encoding/json"
 
 	"github.com/pockode/server/agent"
+	"github.com/pockode/server/audit"
+	"github.com/pockode/server/auth"
 	"github.com/pockode/server/command"
 	"github.com/pockode/server/contents"
 	"github.com/pockode/server/git"
+	"github.com/pockode/server/notify"
+	"github.com/pockode/server/policy"
+	"github.com/pockode/server/process"
+	"github.com/pockode/server/schedule"
+	"github.com/pockode/server/search"
 	"github.com/pockode/server/session"
 	"github.com/pockode/server/settings"
 )
 
 // Client → Server
 
+// AuthParams authenticates a connection. ProtocolVersion is the client's
+// protocol version; clients predating negotiation omit it.
 type AuthParams struct {
-	Token    string `json:"token"`
-	Worktree string `json:"worktree,omitempty"` // empty = main worktree
+	Token           string `json:"token"`
+	Worktree        string `json:"worktree,omitempty"` // empty = main worktree
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
 }
 
+// AuthResult describes the server. Clients compare the protocol versions to
+// decide whether they can talk to it and use Capabilities to hide features
+// it was started without.
 type AuthResult struct {
-	Version      string `json:"version"`
-	Title        string `json:"title"`
-	WorkDir      string `json:"work_dir"`
-	WorktreeName string `json:"worktree_name"`
+	Version            string    `json:"version"`
+	ProtocolVersion    int       `json:"protocol_version"`
+	MinProtocolVersion int       `json:"min_protocol_version"`
+	Capabilities       []string  `json:"capabilities"`
+	Title              string    `json:"title"`
+	WorkDir            string    `json:"work_dir"`
+	WorktreeName       string    `json:"worktree_name"`
+	User               string    `json:"user"`
+	Role               auth.Role `json:"role"`
 }
 
 type MessageParams struct {
+	SessionID   string             `json:"session_id"`
+	Content     string             `json:"content"`
+	Attachments []agent.Attachment `json:"attachments,omitempty"`
+}
+
+// MessageResult is returned by chat.message.
+// QueueID is set when the message was queued behind a running turn.
+type MessageResult struct {
+	QueueID string `json:"queue_id,omitempty"`
+}
+
+type ChatQueueListParams struct {
 	SessionID string `json:"session_id"`
+}
+
+type ChatQueueListResult struct {
+	Queue  []process.QueuedMessage `json:"queue"`
+	Paused bool                    `json:"paused,omitempty"`
+}
+
+type ChatQueueUpdateParams struct {
+	SessionID string `json:"session_id"`
+	ID        string `json:"id"`
 	Content   string `json:"content"`
 }
 
+type ChatQueueCancelParams struct {
+	SessionID string `json:"session_id"`
+	ID        string `json:"id"`
+}
+
+// ChatQueueResumeParams resumes a queue paused by an interrupt.
+type ChatQueueResumeParams struct {
+	SessionID string `json:"session_id"`
+}
+
 type InterruptParams struct {
 	SessionID string `json:"session_id"`
 }
@@ -54,6 +104,10 @@ type QuestionResponseParams struct {
 
 // Session management
 
+type SessionCreateParams struct {
+	Agent string `json:"agent,omitempty"` // agent backend name (empty = server default)
+}
+
 type SessionDeleteParams struct {
 	SessionID string `json:"session_id"`
 }
@@ -68,6 +122,87 @@ type SessionSetModeParams struct {
 	Mode      session.Mode `json:"mode"`
 }
 
+type SessionSetAgentParams struct {
+	SessionID string `json:"session_id"`
+	Agent     string `json:"agent"`
+}
+
+type SessionSetMutedParams struct {
+	SessionID string `json:"session_id"`
+	Muted     bool   `json:"muted"`
+}
+
+type SessionGetConfigParams struct {
+	SessionID string `json:"session_id"`
+}
+
+type SessionSetConfigParams struct {
+	SessionID string              `json:"session_id"`
+	Config    session.AgentConfig `json:"config"`
+}
+
+// SessionForkParams selects the history prefix to copy into a new session.
+// Index is the last record to include; omitted copies the whole history.
+type SessionForkParams struct {
+	SessionID string `json:"session_id"`
+	Index     *int   `json:"index,omitempty"`
+}
+
+// SessionExportParams selects a session and an export format:
+// "markdown", "html" or "json" (a bundle for session.import).
+type SessionExportParams struct {
+	SessionID string `json:"session_id"`
+	Format    string `json:"format"`
+}
+
+type SessionExportResult struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     string `json:"content"`
+}
+
+// SessionImportParams carries a JSON bundle produced by session.export.
+// The import always gets a new session ID.
+type SessionImportParams struct {
+	Bundle json.RawMessage `json:"bundle"`
+}
+
+type SessionApprovePlanParams struct {
+	SessionID string       `json:"session_id"`
+	Mode      session.Mode `json:"mode"`                 // mode to continue in: "default" or "yolo" (empty = default)
+	RequestID string       `json:"request_id,omitempty"` // pending ExitPlanMode permission request, if any
+}
+
+type SessionCheckpointsParams struct {
+	SessionID string `json:"session_id"`
+}
+
+// SessionCheckpoint is a worktree snapshot with the message whose turn it
+// precedes. Seq is that message's history record, 0 for snapshots taken by
+// session.rollback.
+type SessionCheckpoint struct {
+	git.Checkpoint
+	Seq     int64  `json:"seq,omitempty"`
+	Message string `json:"message,omitempty"`
+	User    string `json:"user,omitempty"`
+}
+
+// SessionCheckpointsResult lists checkpoints oldest first.
+type SessionCheckpointsResult struct {
+	Checkpoints []SessionCheckpoint `json:"checkpoints"`
+}
+
+type SessionRollbackParams struct {
+	SessionID    string `json:"session_id"`
+	CheckpointID string `json:"checkpoint_id"`
+}
+
+// SessionRollbackResult holds the snapshot taken right before rolling back,
+// so the rollback itself can be undone.
+type SessionRollbackResult struct {
+	Backup string `json:"backup,omitempty"`
+}
+
 // File namespace
 
 type FileGetParams struct {
@@ -101,6 +236,7 @@ type GitDiffSubscribeResult struct {
 	Diff       string `json:"diff"`
 	OldContent string `json:"old_content"`
 	NewContent string `json:"new_content"`
+	Hash       string `json:"hash,omitempty"`
 }
 
 type GitDiffUnsubscribeParams struct {
@@ -112,6 +248,158 @@ type GitPathsParams struct {
 	Paths []string `json:"paths"`
 }
 
+// GitHunksParams is used for git.hunk.stage, git.hunk.unstage and
+// git.hunk.discard. Hash is the diff's hash from git.diff.subscribe.
+type GitHunksParams struct {
+	Path  string              `json:"path"`
+	Hash  string              `json:"hash"`
+	Hunks []git.HunkSelection `json:"hunks"`
+}
+
+type GitDiscardParams struct {
+	Paths  []string `json:"paths"`
+	Staged bool     `json:"staged"` // also reset the index to HEAD
+}
+
+type GitDiscardRestoreParams struct {
+	ID string `json:"id"`
+}
+
+type GitDiscardListResult struct {
+	Entries []git.TrashEntry `json:"entries"`
+}
+
+type GitCommitParams struct {
+	Message string `json:"message"`
+	Amend   bool   `json:"amend"`
+	SignOff bool   `json:"sign_off"`
+}
+
+type GitCommitResult struct {
+	Hash string `json:"hash"`
+}
+
+type GitLogParams struct {
+	Limit int    `json:"limit,omitempty"`
+	Skip  int    `json:"skip,omitempty"`
+	Path  string `json:"path,omitempty"`
+}
+
+type GitLogResult struct {
+	Commits []git.LogEntry `json:"commits"`
+	HasMore bool           `json:"has_more"`
+}
+
+type GitShowParams struct {
+	Rev  string `json:"rev"`
+	Path string `json:"path,omitempty"` // only this file, with its diff; empty lists files without diffs
+}
+
+type GitBlameParams struct {
+	Path string `json:"path"`
+	Rev  string `json:"rev,omitempty"` // empty blames the worktree file
+}
+
+type GitBranchListResult struct {
+	Branches []git.Branch `json:"branches"`
+}
+
+type GitBranchCreateParams struct {
+	Name       string `json:"name"`
+	StartPoint string `json:"start_point,omitempty"`
+	Checkout   bool   `json:"checkout"`
+}
+
+type GitBranchCheckoutParams struct {
+	Name string `json:"name"`
+}
+
+type GitBranchDeleteParams struct {
+	Name  string `json:"name"`
+	Force bool   `json:"force"`
+}
+
+type GitPushParams struct {
+	ForceWithLease bool `json:"force_with_lease"`
+}
+
+// CodeGitError is the error code of git failures the user can act on, such
+// as a conflict or a rejected push. The error's data is a GitErrorData.
+const CodeGitError int64 = -32001
+
+type GitErrorData struct {
+	Kind   string   `json:"kind"`
+	Files  []string `json:"files,omitempty"`
+	Output string   `json:"output,omitempty"`
+}
+
+// Agent namespace
+
+type AgentInfo struct {
+	Name      string `json:"name"`
+	IsDefault bool   `json:"is_default"`
+}
+
+type AgentListResult struct {
+	Agents []AgentInfo `json:"agents"`
+}
+
+// SessionSearchParams filters session.search. Worktree is a pointer because
+// "" names the main worktree; omit it to search all worktrees.
+// From and To are inclusive YYYY-MM-DD dates (UTC).
+type SessionSearchParams struct {
+	Query    string            `json:"query"`
+	Worktree *string           `json:"worktree,omitempty"`
+	Types    []agent.EventType `json:"types,omitempty"`
+	From     string            `json:"from,omitempty"`
+	To       string            `json:"to,omitempty"`
+	Limit    int               `json:"limit,omitempty"`
+}
+
+type SessionSearchResult struct {
+	Results []search.Result `json:"results"`
+}
+
+// Usage namespace
+
+type UsageSessionParams struct {
+	SessionID string `json:"session_id"`
+}
+
+type UsageDay struct {
+	Date  string        `json:"date"` // YYYY-MM-DD (UTC)
+	Usage session.Usage `json:"usage"`
+}
+
+type UsageSessionResult struct {
+	SessionID string        `json:"session_id"`
+	Total     session.Usage `json:"total"`
+	Days      []UsageDay    `json:"days"`
+}
+
+type UsageSessionItem struct {
+	SessionID string        `json:"session_id"`
+	Title     string        `json:"title"`
+	Usage     session.Usage `json:"usage"`
+}
+
+type UsageWorktreeResult struct {
+	Worktree string             `json:"worktree"`
+	Total    session.Usage      `json:"total"`
+	Sessions []UsageSessionItem `json:"sessions"`
+}
+
+// UsageDailyParams bounds usage.daily to an inclusive date range.
+// Empty bounds are open-ended.
+type UsageDailyParams struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+type UsageDailyResult struct {
+	Days []UsageDay `json:"days"`
+}
+
 // Command namespace
 
 type CommandListResult struct {
@@ -172,13 +460,23 @@ type SessionListUnsubscribeParams struct {
 
 type ChatMessagesSubscribeParams struct {
 	SessionID string `json:"session_id"`
+	// AfterSeq resumes from the last history record the client has seen.
+	AfterSeq int64 `json:"after_seq,omitempty"`
 }
 
+// ChatMessagesSubscribeResult holds the history records after AfterSeq; the
+// record History[i] has sequence number AfterSeq+i+1 and Seq is the last one.
+// AfterSeq is 0, replacing the client's history, when the requested seq is
+// beyond the session's history.
 type ChatMessagesSubscribeResult struct {
-	ID      string            `json:"id"`
-	History []json.RawMessage `json:"history"`
-	State   string            `json:"state"` // "idle" | "running" | "ended"
-	Mode    session.Mode      `json:"mode"`
+	ID          string                  `json:"id"`
+	History     []json.RawMessage       `json:"history"`
+	AfterSeq    int64                   `json:"after_seq"`
+	Seq         int64                   `json:"seq"`
+	State       string                  `json:"state"` // "idle" | "running" | "ended"
+	Mode        session.Mode            `json:"mode"`
+	Queue       []process.QueuedMessage `json:"queue"`
+	QueuePaused bool                    `json:"queue_paused,omitempty"`
 }
 
 type ChatMessagesUnsubscribeParams struct {
@@ -246,6 +544,56 @@ type AskUserQuestionParams struct {
 	Questions []agent.AskUserQuestion `json:"questions"`
 }
 
+// ChatEventParams is sent as "chat.<event type>" to chat.messages subscribers.
+// Seq is the event's history sequence number; events at or below the
+// subscriber's last seen seq are duplicates. PrevSeq is the seq of the
+// previous event sent, so a subscriber that has seen less missed an event and
+// should resubscribe with after_seq.
+type ChatEventParams struct {
+	ID      string `json:"id"` // subscription ID
+	Seq     int64  `json:"seq,omitempty"`
+	PrevSeq int64  `json:"prev_seq,omitempty"`
+	agent.EventRecord
+}
+
+// ChatQueueParams is sent as "chat.queue" with the session's full outbound
+// queue. Paused is set while an interrupt holds the queue.
+type ChatQueueParams struct {
+	ID     string                  `json:"id"`
+	Queue  []process.QueuedMessage `json:"queue"`
+	Paused bool                    `json:"paused,omitempty"`
+}
+
+// SessionListChangedParams is sent as "session.list.changed". Session is set
+// for "create" and "update"; SessionID for "delete".
+type SessionListChangedParams struct {
+	ID        string           `json:"id"`
+	Operation string           `json:"operation"`
+	Session   *SessionListItem `json:"session,omitempty"`
+	SessionID string           `json:"sessionId,omitempty"`
+}
+
+// SettingsChangedParams is sent as "settings.changed".
+type SettingsChangedParams struct {
+	ID       string            `json:"id"`
+	Settings settings.Settings `json:"settings"`
+}
+
+// GitDiffChangedParams is sent as "git.diff.changed".
+type GitDiffChangedParams struct {
+	ID         string `json:"id"`
+	Diff       string `json:"diff"`
+	OldContent string `json:"old_content"`
+	NewContent string `json:"new_content"`
+	Hash       string `json:"hash,omitempty"`
+}
+
+// ChangedParams is sent by subscriptions that only signal a change
+// ("worktree.changed", "git.changed", "fs.changed").
+type ChangedParams struct {
+	ID string `json:"id"`
+}
+
 // Settings namespace
 
 type SettingsSubscribeResult struct {
@@ -253,6 +601,182 @@ type SettingsSubscribeResult struct {
 	Settings settings.Settings `json:"settings"`
 }
 
+type SettingsUnsubscribeParams struct {
+	ID string `json:"id"`
+}
+
 type SettingsUpdateParams struct {
 	Settings settings.Settings `json:"settings"`
 }
+
+// Token namespace
+
+type TokenListResult struct {
+	Tokens []auth.TokenInfo `json:"tokens"`
+}
+
+type TokenCreateParams struct {
+	User string    `json:"user"`
+	Role auth.Role `json:"role"`
+}
+
+// TokenCreateResult carries the new secret. It cannot be retrieved again.
+type TokenCreateResult struct {
+	Token string         `json:"token"`
+	Info  auth.TokenInfo `json:"info"`
+}
+
+type TokenRevokeParams struct {
+	ID string `json:"id"`
+}
+
+// Audit namespace
+
+// AuditListParams filters audit.list. Worktree is a pointer because "" names
+// the main worktree; omit it to list all. Method matches exactly, or as a
+// namespace prefix when it ends in "." (e.g. "git."). From and To are
+// inclusive YYYY-MM-DD dates (UTC). BeforeSeq pages backwards.
+type AuditListParams struct {
+	Actor     string  `json:"actor,omitempty"`
+	Worktree  *string `json:"worktree,omitempty"`
+	Method    string  `json:"method,omitempty"`
+	From      string  `json:"from,omitempty"`
+	To        string  `json:"to,omitempty"`
+	BeforeSeq int64   `json:"before_seq,omitempty"`
+	Limit     int     `json:"limit,omitempty"`
+}
+
+// AuditListResult lists entries newest first.
+type AuditListResult struct {
+	Entries []audit.Entry `json:"entries"`
+}
+
+type AuditVerifyResult struct {
+	audit.VerifyResult
+	OK bool `json:"ok"`
+}
+
+// Permissions namespace
+
+// PermissionsListParams filters permissions.list; omitted fields match all rules.
+type PermissionsListParams struct {
+	Scope     policy.Scope `json:"scope,omitempty"`
+	Worktree  *string      `json:"worktree,omitempty"`
+	SessionID string       `json:"session_id,omitempty"`
+}
+
+type PermissionsListResult struct {
+	Rules []policy.Rule `json:"rules"`
+}
+
+// PermissionsAddParams describes a new rule. Worktree applies to worktree
+// scope ("" = main); SessionID applies to session scope.
+type PermissionsAddParams struct {
+	Action    policy.Action `json:"action"`
+	Tool      string        `json:"tool"`
+	Pattern   string        `json:"pattern,omitempty"`
+	Scope     policy.Scope  `json:"scope"`
+	Worktree  string        `json:"worktree,omitempty"`
+	SessionID string        `json:"session_id,omitempty"`
+}
+
+type PermissionsRemoveParams struct {
+	ID string `json:"id"`
+}
+
+type PermissionsTimeoutListResult struct {
+	Timeouts []policy.Timeout `json:"timeouts"`
+}
+
+// PermissionsTimeoutSetParams replaces the timeout of one scope target.
+type PermissionsTimeoutSetParams struct {
+	Scope     policy.Scope           `json:"scope"`
+	Worktree  string                 `json:"worktree,omitempty"`
+	SessionID string                 `json:"session_id,omitempty"`
+	Seconds   int                    `json:"seconds"`
+	Decision  policy.TimeoutDecision `json:"decision"`
+}
+
+type PermissionsTimeoutClearParams struct {
+	Scope     policy.Scope `json:"scope"`
+	Worktree  string       `json:"worktree,omitempty"`
+	SessionID string       `json:"session_id,omitempty"`
+}
+
+// Notify namespace
+
+type NotifyVAPIDKeyResult struct {
+	PublicKey string `json:"public_key"`
+}
+
+// NotifySubscribeParams is the browser's PushSubscription.toJSON().
+type NotifySubscribeParams struct {
+	Endpoint string          `json:"endpoint"`
+	Keys     notify.PushKeys `json:"keys"`
+}
+
+type NotifyUnsubscribeParams struct {
+	Endpoint string `json:"endpoint"`
+}
+
+type NotifyWebhookListResult struct {
+	Webhooks []notify.Webhook `json:"webhooks"`
+}
+
+type NotifyWebhookAddParams struct {
+	URL   string `json:"url"`
+	Topic string `json:"topic,omitempty"`
+}
+
+type NotifyWebhookRemoveParams struct {
+	ID string `json:"id"`
+}
+
+// Schedule namespace
+
+type ScheduleListResult struct {
+	Schedules []schedule.Schedule `json:"schedules"`
+}
+
+// ScheduleCreateParams describes a new schedule. Without SessionID each run
+// starts a new session in Mode. Enabled defaults to true.
+type ScheduleCreateParams struct {
+	Name      string       `json:"name"`
+	Cron      string       `json:"cron"`
+	Worktree  string       `json:"worktree,omitempty"`
+	SessionID string       `json:"session_id,omitempty"`
+	Mode      session.Mode `json:"mode,omitempty"`
+	Prompt    string       `json:"prompt"`
+	Enabled   *bool        `json:"enabled,omitempty"`
+}
+
+// ScheduleUpdateParams changes the given fields of a schedule.
+type ScheduleUpdateParams struct {
+	ID        string        `json:"id"`
+	Name      *string       `json:"name,omitempty"`
+	Cron      *string       `json:"cron,omitempty"`
+	Worktree  *string       `json:"worktree,omitempty"`
+	SessionID *string       `json:"session_id,omitempty"`
+	Mode      *session.Mode `json:"mode,omitempty"`
+	Prompt    *string       `json:"prompt,omitempty"`
+	Enabled   *bool         `json:"enabled,omitempty"`
+}
+
+type ScheduleDeleteParams struct {
+	ID string `json:"id"`
+}
+
+type ScheduleRunParams struct {
+	ID string `json:"id"`
+}
+
+// ScheduleRunsParams filters schedule.runs; an empty ScheduleID returns runs
+// of all schedules.
+type ScheduleRunsParams struct {
+	ScheduleID string `json:"schedule_id,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+}
+
+type ScheduleRunsResult struct {
+	Runs []schedule.Run `json:"runs"`
+}
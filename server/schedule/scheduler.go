@@ -0,0 +1,266 @@
+// Package schedule runs agent prompts on cron schedules.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/logger"
+)
+
+// TriggerCron marks runs started by the schedule itself rather than a user.
+const TriggerCron = "cron"
+
+// maxRunDuration bounds how long a run may keep its turn going before it is
+// interrupted and recorded as failed.
+const maxRunDuration = 2 * time.Hour
+
+// Scheduler fires enabled schedules and records the outcome of each run.
+// A schedule never runs twice at once; a firing that overlaps a running
+// turn is recorded as skipped.
+type Scheduler struct {
+	store  *Store
+	send   SendFunc
+	maxRun time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wake   chan struct{}
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	active map[string]bool // schedule IDs with a run in progress
+
+	auditor Auditor
+}
+
+// Auditor records scheduled runs, which prompt the agent without a user.
+type Auditor interface {
+	Record(actor, worktree, method string, params any)
+}
+
+// SendFunc delivers a schedule's prompt and waits for the agent to settle.
+// It returns the session used and the history records written meanwhile.
+// When ctx expires it should stop the turn and return an error.
+type SendFunc func(ctx context.Context, sched Schedule) (sessionID string, records []json.RawMessage, err error)
+
+func New(store *Store, send SendFunc) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		store:  store,
+		send:   send,
+		maxRun: maxRunDuration,
+		ctx:    ctx,
+		cancel: cancel,
+		wake:   make(chan struct{}, 1),
+		active: make(map[string]bool),
+	}
+	store.onChange = s.reschedule
+	return s
+}
+
+// SetAuditor makes the scheduler record each finished run.
+// Call before Start.
+func (s *Scheduler) SetAuditor(a Auditor) {
+	s.auditor = a
+}
+
+func (s *Scheduler) Store() *Store {
+	return s.store
+}
+
+// Start begins firing schedules in the background.
+func (s *Scheduler) Start() {
+	s.wg.Go(s.loop)
+}
+
+// Stop stops firing schedules and waits for running turns to be recorded.
+// Interrupted waits are recorded as failed; the agent turns themselves are
+// left to the process manager.
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// RunNow starts a run of the schedule immediately, whether or not it is
+// enabled. trigger names who asked for it.
+func (s *Scheduler) RunNow(id, trigger string) (Run, error) {
+	sched, ok := s.store.Get(id)
+	if !ok {
+		return Run{}, ErrScheduleNotFound
+	}
+	return s.start(sched, trigger)
+}
+
+// reschedule wakes the loop so it picks up changed schedules.
+func (s *Scheduler) reschedule() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+type nextRun struct {
+	cron string
+	at   time.Time
+}
+
+func (s *Scheduler) loop() {
+	next := make(map[string]nextRun)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		now := time.Now()
+		var earliest time.Time
+
+		enabled := make(map[string]bool)
+		for _, sched := range s.store.List() {
+			if !sched.Enabled {
+				continue
+			}
+			enabled[sched.ID] = true
+
+			n, ok := next[sched.ID]
+			if !ok || n.cron != sched.Cron {
+				cron, err := ParseCron(sched.Cron)
+				if err != nil {
+					continue // validated on write
+				}
+				n = nextRun{cron: sched.Cron, at: cron.Next(now)}
+			}
+			if !n.at.IsZero() && !n.at.After(now) {
+				if _, err := s.start(sched, TriggerCron); err != nil {
+					slog.Error("failed to start scheduled run", "scheduleId", sched.ID, "error", err)
+				}
+				cron, _ := ParseCron(sched.Cron)
+				n.at = cron.Next(now)
+			}
+			next[sched.ID] = n
+
+			if !n.at.IsZero() && (earliest.IsZero() || n.at.Before(earliest)) {
+				earliest = n.at
+			}
+		}
+		for id := range next {
+			if !enabled[id] {
+				delete(next, id)
+			}
+		}
+
+		wait := time.Hour
+		if !earliest.IsZero() {
+			wait = min(time.Until(earliest), wait)
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// start records a new run and executes it in the background, or records a
+// skipped run if the schedule is already running.
+func (s *Scheduler) start(sched Schedule, trigger string) (Run, error) {
+	run := Run{
+		ID:         uuid.Must(uuid.NewV7()).String(),
+		ScheduleID: sched.ID,
+		Trigger:    trigger,
+		Status:     RunRunning,
+		StartedAt:  time.Now(),
+	}
+
+	s.mu.Lock()
+	if s.active[sched.ID] {
+		s.mu.Unlock()
+		run.Status = RunSkipped
+		run.Error = "previous run still in progress"
+		run.FinishedAt = &run.StartedAt
+		return run, s.store.addRun(run)
+	}
+	s.active[sched.ID] = true
+	s.mu.Unlock()
+
+	if err := s.store.addRun(run); err != nil {
+		s.setInactive(sched.ID)
+		return Run{}, err
+	}
+
+	s.wg.Go(func() {
+		defer s.setInactive(sched.ID)
+		defer func() {
+			if r := recover(); r != nil {
+				logger.LogPanic(r, "scheduled run crashed", "scheduleId", sched.ID)
+			}
+		}()
+		s.execute(sched, run)
+	})
+	return run, nil
+}
+
+func (s *Scheduler) setInactive(id string) {
+	s.mu.Lock()
+	delete(s.active, id)
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) execute(sched Schedule, run Run) {
+	log := slog.With("scheduleId", sched.ID, "runId", run.ID, "trigger", run.Trigger)
+	log.Info("scheduled run started", "name", sched.Name)
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.maxRun)
+	defer cancel()
+
+	sessionID, records, err := s.send(ctx, sched)
+	run.SessionID = sessionID
+	run.Status = RunFailed
+	if err == nil {
+		run.Status, err = outcome(records)
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	finished := time.Now()
+	run.FinishedAt = &finished
+
+	if err := s.store.finishRun(run); err != nil {
+		log.Error("failed to record scheduled run", "error", err)
+	}
+	if s.auditor != nil {
+		s.auditor.Record("schedule:"+sched.Name, sched.Worktree, "schedule.run", run)
+	}
+	log.Info("scheduled run finished", "sessionId", sessionID, "status", run.Status, "error", run.Error)
+}
+
+// outcome derives a run's status from the last turn-ending record written
+// during the run.
+func outcome(records []json.RawMessage) (RunStatus, error) {
+	for i := len(records) - 1; i >= 0; i-- {
+		var rec agent.EventRecord
+		if err := json.Unmarshal(records[i], &rec); err != nil {
+			continue
+		}
+		switch rec.Type {
+		case agent.EventTypeDone:
+			return RunSucceeded, nil
+		case agent.EventTypeInterrupted:
+			return RunInterrupted, nil
+		case agent.EventTypeError:
+			if rec.Error == "" {
+				return RunFailed, errors.New("agent error")
+			}
+			return RunFailed, errors.New(rec.Error)
+		}
+	}
+	return RunFailed, errors.New("agent process ended without finishing the turn")
+}
@@ -0,0 +1,271 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/session"
+)
+
+// stubSender plays scripted outcomes, holding each until released.
+type stubSender struct {
+	release chan struct{}
+	records [][]json.RawMessage
+	calls   []Schedule
+	mu      sync.Mutex
+}
+
+func (s *stubSender) send(ctx context.Context, sched Schedule) (string, []json.RawMessage, error) {
+	s.mu.Lock()
+	n := len(s.calls)
+	s.calls = append(s.calls, sched)
+	s.mu.Unlock()
+
+	<-s.release
+	sessionID := sched.SessionID
+	if sessionID == "" {
+		sessionID = fmt.Sprintf("session-%d", n)
+	}
+	return sessionID, s.records[n], nil
+}
+
+func record(t *testing.T, rec agent.EventRecord) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatalf("failed to marshal record: %v", err)
+	}
+	return data
+}
+
+func newTestScheduler(t *testing.T, sender *stubSender) (*Scheduler, string) {
+	t.Helper()
+	dataDir := t.TempDir()
+
+	store, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+
+	s := New(store, sender.send)
+	s.Start()
+	t.Cleanup(s.Stop)
+	return s, dataDir
+}
+
+func waitForRun(t *testing.T, s *Scheduler, runID string) Run {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, r := range s.Store().Runs("", 0) {
+			if r.ID == runID && r.Status != RunRunning {
+				return r
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for run %s", runID)
+	return Run{}
+}
+
+func TestStore_Validate(t *testing.T) {
+	s, _ := NewStore(t.TempDir())
+
+	tests := []Schedule{
+		{Cron: "@daily", Prompt: "hi"},
+		{Name: "n", Cron: "@daily"},
+		{Name: "n", Cron: "every day", Prompt: "hi"},
+		{Name: "n", Cron: "@daily", Prompt: "hi", Mode: "reckless"},
+	}
+	for _, sched := range tests {
+		if _, err := s.Create(sched); err == nil {
+			t.Errorf("Create(%+v) expected error", sched)
+		}
+	}
+
+	// Prompts are left to permission rules and timeouts, so any mode will do
+	for _, mode := range []session.Mode{"", session.ModeDefault, session.ModePlan} {
+		if _, err := s.Create(Schedule{Name: "n", Cron: "@daily", Prompt: "hi", Mode: mode}); err != nil {
+			t.Errorf("Create with mode %q failed: %v", mode, err)
+		}
+	}
+
+	if _, err := s.Update(Schedule{ID: "missing", Name: "n", Cron: "@daily", Prompt: "hi", Mode: session.ModeYolo}); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("expected ErrScheduleNotFound, got %v", err)
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	tests := []struct {
+		records []agent.EventRecord
+		want    RunStatus
+		wantErr string
+	}{
+		{[]agent.EventRecord{{Type: agent.EventTypeMessage}, {Type: agent.EventTypeText}, {Type: agent.EventTypeDone}}, RunSucceeded, ""},
+		{[]agent.EventRecord{{Type: agent.EventTypeDone}, {Type: agent.EventTypeInterrupted}}, RunInterrupted, ""},
+		{[]agent.EventRecord{{Type: agent.EventTypeError, Error: "quota exceeded"}}, RunFailed, "quota exceeded"},
+		{[]agent.EventRecord{{Type: agent.EventTypeMessage}}, RunFailed, "agent process ended without finishing the turn"},
+	}
+
+	for _, tt := range tests {
+		var raw []json.RawMessage
+		for _, rec := range tt.records {
+			raw = append(raw, record(t, rec))
+		}
+		got, err := outcome(raw)
+		gotErr := ""
+		if err != nil {
+			gotErr = err.Error()
+		}
+		if got != tt.want || gotErr != tt.wantErr {
+			t.Errorf("outcome(%v) = %s, %q; want %s, %q", tt.records, got, gotErr, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestScheduler_RunNow(t *testing.T) {
+	sender := &stubSender{
+		release: make(chan struct{}),
+		records: [][]json.RawMessage{
+			{record(t, agent.EventRecord{Type: agent.EventTypeDone})},
+			{record(t, agent.EventRecord{Type: agent.EventTypeError, Error: "quota exceeded"})},
+		},
+	}
+	s, dataDir := newTestScheduler(t, sender)
+
+	sched, err := s.Store().Create(Schedule{Name: "Nightly report", Cron: "0 3 * * *", Mode: session.ModeYolo, Prompt: "summarize", CreatedBy: "alice"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := s.RunNow("missing", "alice"); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("expected ErrScheduleNotFound, got %v", err)
+	}
+
+	first, err := s.RunNow(sched.ID, "alice")
+	if err != nil {
+		t.Fatalf("RunNow failed: %v", err)
+	}
+	if first.Status != RunRunning || first.Trigger != "alice" {
+		t.Fatalf("expected running run triggered by alice, got %+v", first)
+	}
+
+	// Overlapping runs are skipped
+	skipped, err := s.RunNow(sched.ID, "bob")
+	if err != nil || skipped.Status != RunSkipped {
+		t.Fatalf("expected skipped run, got %+v (err=%v)", skipped, err)
+	}
+
+	sender.release <- struct{}{}
+	first = waitForRun(t, s, first.ID)
+	if first.Status != RunSucceeded || first.SessionID != "session-0" || first.FinishedAt == nil {
+		t.Fatalf("expected succeeded run with a session, got %+v", first)
+	}
+
+	sched.SessionID = first.SessionID
+	if _, err := s.Store().Update(sched); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	second, _ := s.RunNow(sched.ID, TriggerCron)
+	sender.release <- struct{}{}
+	second = waitForRun(t, s, second.ID)
+	if second.Status != RunFailed || second.Error != "quota exceeded" || second.SessionID != first.SessionID {
+		t.Errorf("expected failed run in the same session, got %+v", second)
+	}
+	if sender.calls[1].SessionID != first.SessionID {
+		t.Errorf("expected updated schedule to be sent, got %+v", sender.calls[1])
+	}
+
+	reloaded, _ := NewStore(dataDir)
+	runs := reloaded.Runs(sched.ID, 0)
+	if len(runs) != 3 || runs[0].ID != second.ID {
+		t.Errorf("expected 3 runs newest first after reload, got %+v", runs)
+	}
+	if got := reloaded.Runs(sched.ID, 1); len(got) != 1 {
+		t.Errorf("expected limit to apply, got %d runs", len(got))
+	}
+
+	if err := reloaded.Delete(sched.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if len(reloaded.Runs(sched.ID, 0)) != 0 {
+		t.Error("expected runs to be removed with their schedule")
+	}
+}
+
+func TestScheduler_RunTimesOut(t *testing.T) {
+	store, _ := NewStore(t.TempDir())
+	s := New(store, func(ctx context.Context, sched Schedule) (string, []json.RawMessage, error) {
+		<-ctx.Done() // a turn paused on a permission prompt
+		return "session-0", nil, errors.New("run exceeded its maximum duration and was interrupted")
+	})
+	s.maxRun = 50 * time.Millisecond
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	sched, _ := store.Create(Schedule{Name: "n", Cron: "@daily", Prompt: "hi", Mode: session.ModeYolo})
+	run, err := s.RunNow(sched.ID, TriggerCron)
+	if err != nil {
+		t.Fatalf("RunNow failed: %v", err)
+	}
+	run = waitForRun(t, s, run.ID)
+	if run.Status != RunFailed || run.Error == "" {
+		t.Errorf("expected timed out run to fail, got %+v", run)
+	}
+
+	// The schedule is free to run again
+	next, _ := s.RunNow(sched.ID, TriggerCron)
+	if next.Status != RunRunning {
+		t.Errorf("expected next run to start, got %+v", next)
+	}
+}
+
+// chanAuditor passes recorded entries to the test.
+type chanAuditor chan string
+
+func (a chanAuditor) Record(actor, worktree, method string, params any) {
+	run := params.(Run)
+	a <- fmt.Sprintf("%s %s %s %s", actor, worktree, method, run.Status)
+}
+
+func TestScheduler_AuditsRuns(t *testing.T) {
+	store, _ := NewStore(t.TempDir())
+	s := New(store, func(ctx context.Context, sched Schedule) (string, []json.RawMessage, error) {
+		return "session-0", []json.RawMessage{record(t, agent.EventRecord{Type: agent.EventTypeDone})}, nil
+	})
+	auditor := make(chanAuditor, 1)
+	s.SetAuditor(auditor)
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	sched, _ := store.Create(Schedule{Name: "Nightly", Worktree: "feature", Cron: "@daily", Prompt: "hi"})
+	if _, err := s.RunNow(sched.ID, TriggerCron); err != nil {
+		t.Fatalf("RunNow failed: %v", err)
+	}
+	select {
+	case got := <-auditor:
+		if got != "schedule:Nightly feature schedule.run succeeded" {
+			t.Errorf("unexpected audit entry %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the run to be audited")
+	}
+}
+
+func TestStore_MarksInterruptedRunsFailed(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewStore(dir)
+	sched, _ := s.Create(Schedule{Name: "n", Cron: "@daily", Prompt: "hi", Mode: session.ModeYolo})
+	s.addRun(Run{ID: "r1", ScheduleID: sched.ID, Status: RunRunning, StartedAt: time.Now()})
+
+	reloaded, _ := NewStore(dir)
+	runs := reloaded.Runs(sched.ID, 0)
+	if len(runs) != 1 || runs[0].Status != RunFailed || runs[0].FinishedAt == nil {
+		t.Errorf("expected run left running by a restart to be failed, got %+v", runs)
+	}
+}
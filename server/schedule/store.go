@@ -0,0 +1,301 @@
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pockode/server/fsutil"
+	"github.com/pockode/server/session"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrRunNotFound      = errors.New("run not found")
+)
+
+// Schedule sends Prompt to an agent whenever Cron matches.
+//
+// With SessionID set, every run continues that session. Otherwise each run
+// starts a new session titled after the schedule in Mode. Nobody is there to
+// answer prompts, so permission requests must be settled by permission rules
+// or timeouts; a run that stops on any other prompt fails.
+type Schedule struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Cron      string       `json:"cron"`
+	Worktree  string       `json:"worktree"` // "" is the main worktree
+	SessionID string       `json:"session_id,omitempty"`
+	Mode      session.Mode `json:"mode,omitempty"`
+	Prompt    string       `json:"prompt"`
+	Enabled   bool         `json:"enabled"`
+	CreatedBy string       `json:"created_by,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Validate checks a schedule before it is stored. Errors are user-facing.
+func (s Schedule) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("name is required")
+	}
+	if strings.TrimSpace(s.Prompt) == "" {
+		return errors.New("prompt is required")
+	}
+	if _, err := ParseCron(s.Cron); err != nil {
+		return err
+	}
+	if s.Mode != "" && !s.Mode.IsValid() {
+		return errors.New("invalid mode")
+	}
+	return nil
+}
+
+// RunStatus is the outcome of a run.
+type RunStatus string
+
+const (
+	RunRunning     RunStatus = "running"
+	RunSucceeded   RunStatus = "succeeded"   // the turn ended with done
+	RunFailed      RunStatus = "failed"      // the turn ended with an error, or the run could not start
+	RunInterrupted RunStatus = "interrupted" // someone interrupted the turn
+	RunSkipped     RunStatus = "skipped"     // the previous run was still going
+)
+
+// Run records one execution of a schedule.
+type Run struct {
+	ID         string     `json:"id"`
+	ScheduleID string     `json:"schedule_id"`
+	Trigger    string     `json:"trigger"` // "cron" or the user who ran it manually
+	SessionID  string     `json:"session_id,omitempty"`
+	Status     RunStatus  `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// maxRunsPerSchedule bounds the run history kept for each schedule.
+const maxRunsPerSchedule = 50
+
+type fileData struct {
+	Schedules []Schedule `json:"schedules"`
+	Runs      []Run      `json:"runs,omitempty"` // oldest first
+}
+
+// Store keeps schedules and their recent runs in <dataDir>/schedules.json.
+type Store struct {
+	path string
+
+	mu   sync.RWMutex
+	data fileData
+
+	onChange func() // called after schedules change
+}
+
+func NewStore(dataDir string) (*Store, error) {
+	s := &Store{path: filepath.Join(dataDir, "schedules.json")}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &s.data); err != nil {
+		return nil, err
+	}
+
+	// Runs cut short by a restart never finished
+	now := time.Now()
+	for i := range s.data.Runs {
+		if s.data.Runs[i].Status == RunRunning {
+			s.data.Runs[i].Status = RunFailed
+			s.data.Runs[i].Error = "server stopped during run"
+			s.data.Runs[i].FinishedAt = &now
+		}
+	}
+	return s, nil
+}
+
+// List returns all schedules in creation order.
+func (s *Store) List() []Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.data.Schedules)
+}
+
+func (s *Store) Get(id string) (Schedule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.indexLocked(id)
+	if i < 0 {
+		return Schedule{}, false
+	}
+	return s.data.Schedules[i], true
+}
+
+// Create validates and stores a schedule, assigning its ID and timestamps.
+func (s *Store) Create(sched Schedule) (Schedule, error) {
+	if err := sched.Validate(); err != nil {
+		return Schedule{}, err
+	}
+	sched.ID = uuid.Must(uuid.NewV7()).String()
+	sched.CreatedAt = time.Now()
+	sched.UpdatedAt = sched.CreatedAt
+
+	err := s.update(func(data *fileData) error {
+		data.Schedules = append(data.Schedules, sched)
+		return nil
+	})
+	if err != nil {
+		return Schedule{}, err
+	}
+	return sched, nil
+}
+
+// Update replaces a schedule's settings, keeping its ID and creation fields.
+func (s *Store) Update(sched Schedule) (Schedule, error) {
+	if err := sched.Validate(); err != nil {
+		return Schedule{}, err
+	}
+
+	err := s.update(func(data *fileData) error {
+		i := slices.IndexFunc(data.Schedules, func(o Schedule) bool { return o.ID == sched.ID })
+		if i < 0 {
+			return ErrScheduleNotFound
+		}
+		sched.CreatedBy = data.Schedules[i].CreatedBy
+		sched.CreatedAt = data.Schedules[i].CreatedAt
+		sched.UpdatedAt = time.Now()
+		data.Schedules[i] = sched
+		return nil
+	})
+	if err != nil {
+		return Schedule{}, err
+	}
+	return sched, nil
+}
+
+// Delete removes a schedule and its run history.
+func (s *Store) Delete(id string) error {
+	return s.update(func(data *fileData) error {
+		i := slices.IndexFunc(data.Schedules, func(o Schedule) bool { return o.ID == id })
+		if i < 0 {
+			return ErrScheduleNotFound
+		}
+		data.Schedules = slices.Delete(data.Schedules, i, i+1)
+		data.Runs = slices.DeleteFunc(data.Runs, func(r Run) bool { return r.ScheduleID == id })
+		return nil
+	})
+}
+
+// Runs returns a schedule's runs, newest first. An empty scheduleID returns
+// runs of all schedules.
+func (s *Store) Runs(scheduleID string, limit int) []Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var runs []Run
+	for _, r := range slices.Backward(s.data.Runs) {
+		if scheduleID != "" && r.ScheduleID != scheduleID {
+			continue
+		}
+		runs = append(runs, r)
+		if limit > 0 && len(runs) == limit {
+			break
+		}
+	}
+	return runs
+}
+
+// addRun records a new run, dropping the schedule's oldest runs beyond the limit.
+func (s *Store) addRun(run Run) error {
+	return s.apply(func(data *fileData) error {
+		data.Runs = append(data.Runs, run)
+
+		count := 0
+		for _, r := range data.Runs {
+			if r.ScheduleID == run.ScheduleID {
+				count++
+			}
+		}
+		data.Runs = slices.DeleteFunc(data.Runs, func(r Run) bool {
+			if r.ScheduleID != run.ScheduleID || count <= maxRunsPerSchedule {
+				return false
+			}
+			count--
+			return true
+		})
+		return nil
+	})
+}
+
+// finishRun updates a run in place.
+func (s *Store) finishRun(run Run) error {
+	return s.apply(func(data *fileData) error {
+		i := slices.IndexFunc(data.Runs, func(r Run) bool { return r.ID == run.ID })
+		if i < 0 {
+			return ErrRunNotFound
+		}
+		data.Runs[i] = run
+		return nil
+	})
+}
+
+// update applies fn to a copy of the data, persists it and notifies onChange.
+func (s *Store) update(fn func(*fileData) error) error {
+	if err := s.apply(fn); err != nil {
+		return err
+	}
+	if s.onChange != nil {
+		s.onChange()
+	}
+	return nil
+}
+
+// apply applies fn to a copy of the data and persists it. Run bookkeeping
+// uses it directly since runs do not affect when schedules fire.
+func (s *Store) apply(fn func(*fileData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := fileData{
+		Schedules: slices.Clone(s.data.Schedules),
+		Runs:      slices.Clone(s.data.Runs),
+	}
+	if err := fn(&data); err != nil {
+		return err
+	}
+	if err := s.save(data); err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+func (s *Store) indexLocked(id string) int {
+	return slices.IndexFunc(s.data.Schedules, func(o Schedule) bool { return o.ID == id })
+}
+
+func (s *Store) save(data fileData) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(s.path, encoded)
+}
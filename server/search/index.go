@@ -0,0 +1,469 @@
+// Package search maintains a full-text index over session histories.
+//
+// The index is an in-memory inverted index (term → records) rebuilt on startup
+// from an append-only journal in <dataDir>/search/journal.jsonl. Session stores
+// report history writes through session.HistoryObserver, and the index reads
+// the new tail of history.jsonl, so it only ever scans each record once.
+package search
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/session"
+)
+
+const journalFile = "journal.jsonl"
+
+// entry is one journal line. "add" indexes a history record, "drop" removes a
+// session (or a whole worktree when SessionID is empty).
+type entry struct {
+	Op        string          `json:"op"`
+	Worktree  string          `json:"wt"`
+	SessionID string          `json:"sid,omitempty"`
+	Offset    int             `json:"off,omitempty"`
+	End       int64           `json:"end,omitempty"`
+	Type      agent.EventType `json:"type,omitempty"`
+	Time      int64           `json:"ts,omitempty"`
+	Terms     []string        `json:"terms,omitempty"`
+}
+
+const (
+	opAdd  = "add"
+	opDrop = "drop"
+)
+
+type sessionKey struct {
+	worktree  string
+	sessionID string
+}
+
+// sessionState tracks how far a session's history has been indexed.
+type sessionState struct {
+	title   string
+	records int   // history records consumed
+	end     int64 // byte offset in history.jsonl after the last consumed record
+}
+
+type doc struct {
+	key     sessionKey
+	offset  int // record index in history.jsonl
+	end     int64
+	typ     agent.EventType
+	time    time.Time
+	terms   []string
+	deleted bool
+}
+
+// Index is safe for concurrent use. Use a single instance per data directory.
+type Index struct {
+	dir string
+
+	mu       sync.Mutex
+	journal  *os.File
+	docs     []doc
+	postings map[string][]int // term → doc IDs, ascending
+	sessions map[sessionKey]*sessionState
+	dirs     map[string]string // worktree name → session store data dir
+	deleted  int
+}
+
+// Open loads the index from dataDir, compacting the journal if many records
+// were dropped since it was last written.
+func Open(dataDir string) (*Index, error) {
+	dir := filepath.Join(dataDir, "search")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	x := &Index{
+		dir:      dir,
+		postings: make(map[string][]int),
+		sessions: make(map[sessionKey]*sessionState),
+		dirs:     make(map[string]string),
+	}
+
+	if err := x.replay(); err != nil {
+		return nil, err
+	}
+	if x.deleted > 0 && x.deleted >= len(x.docs)/2 {
+		if err := x.compact(); err != nil {
+			return nil, fmt.Errorf("compact search journal: %w", err)
+		}
+	}
+
+	journal, err := os.OpenFile(x.journalPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	x.journal = journal
+
+	return x, nil
+}
+
+// Close releases the journal file.
+func (x *Index) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.journal == nil {
+		return nil
+	}
+	err := x.journal.Close()
+	x.journal = nil
+	return err
+}
+
+func (x *Index) journalPath() string {
+	return filepath.Join(x.dir, journalFile)
+}
+
+func (x *Index) replay() error {
+	file, err := os.Open(x.journalPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A trailing partial line is an interrupted write; the record is
+			// re-read from history on the next sync.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			slog.Warn("skipping corrupt search journal entry", "error", err)
+			continue
+		}
+		switch e.Op {
+		case opAdd:
+			x.addDoc(e)
+		case opDrop:
+			x.drop(e.Worktree, e.SessionID)
+		}
+	}
+}
+
+// compact rewrites the journal with live documents only.
+func (x *Index) compact() error {
+	tmp := x.journalPath() + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	enc := json.NewEncoder(writer)
+	live := make([]doc, 0, len(x.docs)-x.deleted)
+	for _, d := range x.docs {
+		if d.deleted {
+			continue
+		}
+		live = append(live, d)
+		if err := enc.Encode(d.entry()); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, x.journalPath()); err != nil {
+		return err
+	}
+
+	slog.Info("search journal compacted", "dropped", x.deleted, "kept", len(live))
+
+	x.docs = nil
+	x.postings = make(map[string][]int)
+	x.deleted = 0
+	for _, d := range live {
+		x.addDoc(d.entry())
+	}
+	return nil
+}
+
+func (d doc) entry() entry {
+	return entry{
+		Op:        opAdd,
+		Worktree:  d.key.worktree,
+		SessionID: d.key.sessionID,
+		Offset:    d.offset,
+		End:       d.end,
+		Type:      d.typ,
+		Time:      d.time.Unix(),
+		Terms:     d.terms,
+	}
+}
+
+// addDoc applies an add entry. Caller must hold x.mu (or be in Open).
+func (x *Index) addDoc(e entry) {
+	key := sessionKey{e.Worktree, e.SessionID}
+	id := len(x.docs)
+	x.docs = append(x.docs, doc{
+		key:    key,
+		offset: e.Offset,
+		end:    e.End,
+		typ:    e.Type,
+		time:   time.Unix(e.Time, 0),
+		terms:  e.Terms,
+	})
+	for _, term := range e.Terms {
+		x.postings[term] = append(x.postings[term], id)
+	}
+
+	st := x.state(key)
+	if e.Offset >= st.records {
+		st.records = e.Offset + 1
+		st.end = e.End
+	}
+}
+
+// drop removes a session, or every session of a worktree when sessionID is empty.
+// Postings keep the doc IDs; deleted docs are skipped at query time and
+// removed by compaction. Caller must hold x.mu (or be in Open).
+func (x *Index) drop(worktree, sessionID string) {
+	for i := range x.docs {
+		d := &x.docs[i]
+		if d.deleted || d.key.worktree != worktree || (sessionID != "" && d.key.sessionID != sessionID) {
+			continue
+		}
+		d.deleted = true
+		x.deleted++
+	}
+	for key := range x.sessions {
+		if key.worktree == worktree && (sessionID == "" || key.sessionID == sessionID) {
+			delete(x.sessions, key)
+		}
+	}
+}
+
+func (x *Index) state(key sessionKey) *sessionState {
+	st, ok := x.sessions[key]
+	if !ok {
+		st = &sessionState{}
+		x.sessions[key] = st
+	}
+	return st
+}
+
+// writeLocked appends an entry to the journal. Caller must hold x.mu.
+func (x *Index) writeLocked(e entry) {
+	if x.journal == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("failed to encode search journal entry", "error", err)
+		return
+	}
+	if _, err := x.journal.Write(append(data, '\n')); err != nil {
+		slog.Error("failed to write search journal", "error", err)
+	}
+}
+
+func (x *Index) dropLocked(worktree, sessionID string) {
+	x.drop(worktree, sessionID)
+	x.writeLocked(entry{Op: opDrop, Worktree: worktree, SessionID: sessionID})
+}
+
+// DropWorktree removes every session of a deleted worktree from the index.
+func (x *Index) DropWorktree(worktree string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.dropLocked(worktree, "")
+	delete(x.dirs, worktree)
+}
+
+// Sync brings the index up to date with the session stores in dirs
+// (worktree name → store data dir): new history records are indexed, and
+// sessions or worktrees that no longer exist are dropped. Records indexed by
+// Sync are dated by their history file's modification time.
+func (x *Index) Sync(dirs map[string]string) error {
+	x.mu.Lock()
+	for worktree, dir := range dirs {
+		x.dirs[worktree] = dir
+	}
+	var stale []string
+	for key := range x.sessions {
+		if _, ok := dirs[key.worktree]; !ok {
+			stale = append(stale, key.worktree)
+		}
+	}
+	for _, worktree := range stale {
+		x.dropLocked(worktree, "")
+	}
+	x.mu.Unlock()
+
+	var errs []error
+	for worktree, dir := range dirs {
+		if err := x.syncWorktree(worktree, dir); err != nil {
+			errs = append(errs, fmt.Errorf("sync worktree %q: %w", worktree, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (x *Index) syncWorktree(worktree, dir string) error {
+	sessions, err := session.ReadSessions(dir)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool, len(sessions))
+	for _, meta := range sessions {
+		present[meta.ID] = true
+		key := sessionKey{worktree, meta.ID}
+
+		// Lock per session so live writes are not blocked for the whole sync
+		x.mu.Lock()
+		x.state(key).title = meta.Title
+		if err := x.refreshLocked(key, time.Time{}); err != nil {
+			slog.Warn("failed to index session history", "worktree", worktree, "sessionId", meta.ID, "error", err)
+		}
+		x.mu.Unlock()
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for key := range x.sessions {
+		if key.worktree == worktree && !present[key.sessionID] {
+			x.dropLocked(worktree, key.sessionID)
+		}
+	}
+	return nil
+}
+
+// refreshLocked indexes history records written since the last refresh.
+// A history shorter than what was indexed has been rewritten, so the session
+// is re-indexed from the start. A zero at dates records by the file's
+// modification time. Caller must hold x.mu.
+func (x *Index) refreshLocked(key sessionKey, at time.Time) error {
+	dir, ok := x.dirs[key.worktree]
+	if !ok {
+		return nil
+	}
+
+	file, err := os.Open(session.HistoryPath(dir, key.sessionID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if at.IsZero() {
+		at = info.ModTime()
+	}
+
+	st := x.state(key)
+	if info.Size() < st.end {
+		title := st.title
+		x.dropLocked(key.worktree, key.sessionID)
+		st = x.state(key)
+		st.title = title
+	}
+	if info.Size() == st.end {
+		return nil
+	}
+
+	if _, err := file.Seek(st.end, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// EOF mid-line means a write is in progress; it is picked up next time
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		offset := st.records
+		st.records++
+		st.end += int64(len(line))
+
+		typ, terms := extract(line)
+		if len(terms) == 0 {
+			continue
+		}
+		e := entry{
+			Op:        opAdd,
+			Worktree:  key.worktree,
+			SessionID: key.sessionID,
+			Offset:    offset,
+			End:       st.end,
+			Type:      typ,
+			Time:      at.Unix(),
+			Terms:     terms,
+		}
+		x.addDoc(e)
+		x.writeLocked(e)
+	}
+}
+
+// Observer returns the session.HistoryObserver for a worktree's session store.
+func (x *Index) Observer(worktree, dataDir string) session.HistoryObserver {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.dirs[worktree] = dataDir
+	return &observer{index: x, worktree: worktree}
+}
+
+type observer struct {
+	index    *Index
+	worktree string
+}
+
+func (o *observer) OnHistoryChange(sessionID string) {
+	x := o.index
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.refreshLocked(sessionKey{o.worktree, sessionID}, time.Now()); err != nil {
+		slog.Warn("failed to index session history", "worktree", o.worktree, "sessionId", sessionID, "error", err)
+	}
+}
+
+func (o *observer) OnSessionChange(event session.SessionChangeEvent) {
+	x := o.index
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	key := sessionKey{o.worktree, event.Session.ID}
+	switch event.Op {
+	case session.OperationCreate, session.OperationUpdate:
+		x.state(key).title = event.Session.Title
+	case session.OperationDelete:
+		x.dropLocked(o.worktree, event.Session.ID)
+	}
+}
@@ -0,0 +1,272 @@
+package search
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/session"
+)
+
+var ctx = context.Background()
+
+// newTestStore opens an index and a session store wired to it as worktree name.
+func newTestStore(t *testing.T, x *Index, name string) (*session.FileStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := session.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	store.SetHistoryObserver(x.Observer(name, dir))
+	return store, dir
+}
+
+func openIndex(t *testing.T, dataDir string) *Index {
+	t.Helper()
+	x, err := Open(dataDir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { x.Close() })
+	return x
+}
+
+func appendEvents(t *testing.T, store *session.FileStore, sessionID string, events ...agent.AgentEvent) {
+	t.Helper()
+	for _, event := range events {
+		if _, err := store.AppendToHistory(ctx, sessionID, agent.NewEventRecord(event)); err != nil {
+			t.Fatalf("AppendToHistory failed: %v", err)
+		}
+	}
+}
+
+func search(t *testing.T, x *Index, q Query) []Result {
+	t.Helper()
+	results, err := x.Search(q)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	return results
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Fix the DB migration, fix it! a 42 " + strings.Repeat("x", 41))
+	want := []string{"fix", "the", "db", "migration", "it", "42"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Tokenize() = %v, want %v", got, want)
+	}
+}
+
+func TestIndex_LiveIndexing(t *testing.T) {
+	x := openIndex(t, t.TempDir())
+	store, _ := newTestStore(t, x, "")
+	sess, _ := store.Create(ctx, "s1")
+	store.Update(ctx, sess.ID, "Migrations")
+
+	appendEvents(t, store, sess.ID,
+		agent.MessageEvent{Content: "please fix the database migration"},
+		agent.TextEvent{Content: "I updated the migration script."},
+		agent.ToolCallEvent{ToolName: "Bash", ToolInput: []byte(`{"command":"make migrate"}`), ToolUseID: "t1"},
+		agent.DoneEvent{},
+	)
+
+	results := search(t, x, Query{Text: "migrat"})
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	r := results[0]
+	if r.SessionID != sess.ID || r.Title != "Migrations" || r.Total != 3 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if r.Matches[0].Offset != 0 || r.Matches[1].Offset != 1 || r.Matches[2].Offset != 2 {
+		t.Errorf("unexpected offsets: %+v", r.Matches)
+	}
+	if !strings.Contains(r.Matches[0].Snippet, "database migration") {
+		t.Errorf("unexpected snippet: %q", r.Matches[0].Snippet)
+	}
+
+	// All terms must match
+	results = search(t, x, Query{Text: "migration script"})
+	if len(results) != 1 || results[0].Total != 1 || results[0].Matches[0].Offset != 1 {
+		t.Errorf("expected only the text record, got %+v", results)
+	}
+
+	if results := search(t, x, Query{Text: "nonexistent"}); len(results) != 0 {
+		t.Errorf("expected no results, got %+v", results)
+	}
+	if _, err := x.Search(Query{Text: "a !"}); err != ErrEmptyQuery {
+		t.Errorf("expected ErrEmptyQuery, got %v", err)
+	}
+}
+
+func TestIndex_Filters(t *testing.T) {
+	x := openIndex(t, t.TempDir())
+	main, _ := newTestStore(t, x, "")
+	feature, _ := newTestStore(t, x, "feature")
+	s1, _ := main.Create(ctx, "s1")
+	s2, _ := feature.Create(ctx, "s2")
+	appendEvents(t, main, s1.ID, agent.MessageEvent{Content: "deploy the app"})
+	appendEvents(t, feature, s2.ID, agent.TextEvent{Content: "deploy finished"})
+
+	mainName := ""
+	results := search(t, x, Query{Text: "deploy", Worktree: &mainName})
+	if len(results) != 1 || results[0].Worktree != "" {
+		t.Errorf("expected main worktree result only, got %+v", results)
+	}
+
+	results = search(t, x, Query{Text: "deploy", Types: []agent.EventType{agent.EventTypeText}})
+	if len(results) != 1 || results[0].Worktree != "feature" {
+		t.Errorf("expected text result only, got %+v", results)
+	}
+
+	tomorrow := time.Now().Add(24 * time.Hour)
+	if results := search(t, x, Query{Text: "deploy", Since: tomorrow}); len(results) != 0 {
+		t.Errorf("expected no results after tomorrow, got %+v", results)
+	}
+	if results := search(t, x, Query{Text: "deploy", Until: tomorrow}); len(results) != 2 {
+		t.Errorf("expected 2 results before tomorrow, got %+v", results)
+	}
+	if results := search(t, x, Query{Text: "deploy", Limit: 1}); len(results) != 1 {
+		t.Errorf("expected limit to apply, got %+v", results)
+	}
+}
+
+func TestIndex_DeleteAndFork(t *testing.T) {
+	x := openIndex(t, t.TempDir())
+	store, _ := newTestStore(t, x, "")
+	sess, _ := store.Create(ctx, "s1")
+	appendEvents(t, store, sess.ID, agent.MessageEvent{Content: "refactor parser"}, agent.DoneEvent{})
+
+	if _, err := store.Fork(ctx, "s2", session.ForkOrigin{SessionID: sess.ID, Records: 2}); err != nil {
+		t.Fatalf("Fork failed: %v", err)
+	}
+	if results := search(t, x, Query{Text: "parser"}); len(results) != 2 {
+		t.Fatalf("expected source and fork, got %+v", results)
+	}
+
+	store.Delete(ctx, sess.ID)
+	results := search(t, x, Query{Text: "parser"})
+	if len(results) != 1 || results[0].SessionID != "s2" {
+		t.Errorf("expected only the fork after delete, got %+v", results)
+	}
+}
+
+func TestIndex_PersistsAcrossRestart(t *testing.T) {
+	dataDir := t.TempDir()
+	x := openIndex(t, dataDir)
+	store, dir := newTestStore(t, x, "")
+	sess, _ := store.Create(ctx, "s1")
+	appendEvents(t, store, sess.ID, agent.MessageEvent{Content: "first question"}, agent.DoneEvent{})
+	x.Close()
+
+	// Written while the index was closed
+	store.SetHistoryObserver(nil)
+	appendEvents(t, store, sess.ID, agent.MessageEvent{Content: "second question"})
+
+	x2 := openIndex(t, dataDir)
+	if results := search(t, x2, Query{Text: "first"}); len(results) != 1 {
+		t.Errorf("expected journaled record after reopen, got %+v", results)
+	}
+	if results := search(t, x2, Query{Text: "second"}); len(results) != 0 {
+		t.Errorf("expected unsynced record to be missing, got %+v", results)
+	}
+
+	if err := x2.Sync(map[string]string{"": dir}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	results := search(t, x2, Query{Text: "question"})
+	if len(results) != 1 || results[0].Total != 2 {
+		t.Fatalf("expected both records after sync, got %+v", results)
+	}
+	if results[0].Matches[1].Offset != 2 {
+		t.Errorf("expected synced record at offset 2, got %d", results[0].Matches[1].Offset)
+	}
+
+	// Sync is idempotent
+	x2.Sync(map[string]string{"": dir})
+	if results := search(t, x2, Query{Text: "question"}); results[0].Total != 2 {
+		t.Errorf("expected no duplicates after second sync, got %+v", results)
+	}
+}
+
+func TestIndex_SyncDropsMissingSessions(t *testing.T) {
+	dataDir := t.TempDir()
+	x := openIndex(t, dataDir)
+	store, dir := newTestStore(t, x, "feature")
+	sess, _ := store.Create(ctx, "s1")
+	appendEvents(t, store, sess.ID, agent.MessageEvent{Content: "cleanup"})
+
+	x.Sync(map[string]string{})
+	if results := search(t, x, Query{Text: "cleanup"}); len(results) != 0 {
+		t.Errorf("expected removed worktree to be dropped, got %+v", results)
+	}
+
+	x.Sync(map[string]string{"feature": dir})
+	if results := search(t, x, Query{Text: "cleanup"}); len(results) != 1 {
+		t.Fatalf("expected session to be re-indexed, got %+v", results)
+	}
+
+	store.SetHistoryObserver(nil)
+	store.Delete(ctx, sess.ID)
+	x.Sync(map[string]string{"feature": dir})
+	if results := search(t, x, Query{Text: "cleanup"}); len(results) != 0 {
+		t.Errorf("expected deleted session to be dropped, got %+v", results)
+	}
+}
+
+func TestIndex_RewrittenHistoryIsReindexed(t *testing.T) {
+	x := openIndex(t, t.TempDir())
+	store, dir := newTestStore(t, x, "")
+	sess, _ := store.Create(ctx, "s1")
+	appendEvents(t, store, sess.ID, agent.MessageEvent{Content: "alpha"}, agent.MessageEvent{Content: "beta"})
+
+	// Truncate to the first record, as a rollback would
+	path := session.HistoryPath(dir, sess.ID)
+	data, _ := os.ReadFile(path)
+	first := data[:strings.IndexByte(string(data), '\n')+1]
+	os.WriteFile(path, first, 0644)
+	x.Sync(map[string]string{"": dir})
+
+	if results := search(t, x, Query{Text: "beta"}); len(results) != 0 {
+		t.Errorf("expected truncated record to be gone, got %+v", results)
+	}
+	if results := search(t, x, Query{Text: "alpha"}); len(results) != 1 || results[0].Total != 1 {
+		t.Errorf("expected remaining record once, got %+v", results)
+	}
+}
+
+func TestIndex_CompactsOnOpen(t *testing.T) {
+	dataDir := t.TempDir()
+	x := openIndex(t, dataDir)
+	store, _ := newTestStore(t, x, "")
+	keep, _ := store.Create(ctx, "keep")
+	drop, _ := store.Create(ctx, "drop")
+	appendEvents(t, store, keep.ID, agent.MessageEvent{Content: "kept words"})
+	appendEvents(t, store, drop.ID, agent.MessageEvent{Content: "dropped words"}, agent.TextEvent{Content: "more dropped"})
+	store.Delete(ctx, drop.ID)
+	x.Close()
+
+	x2 := openIndex(t, dataDir)
+	if x2.deleted != 0 || len(x2.docs) != 1 {
+		t.Errorf("expected compacted index with 1 doc, got %d docs (%d deleted)", len(x2.docs), x2.deleted)
+	}
+	if results := search(t, x2, Query{Text: "words"}); len(results) != 1 || results[0].SessionID != "keep" {
+		t.Errorf("unexpected results after compaction: %+v", results)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("lorem ", 30) + "needle " + strings.Repeat("ipsum ", 30)
+	got := snippet(long, []string{"needle"})
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") || !strings.Contains(got, "needle") {
+		t.Errorf("unexpected snippet: %q", got)
+	}
+
+	if got := snippet("short\n\ttext", []string{"missing"}); got != "short text" {
+		t.Errorf("snippet() = %q, want %q", got, "short text")
+	}
+}
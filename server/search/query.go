@@ -0,0 +1,310 @@
+package search
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/session"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+
+	matchesPerResult = 5
+	minTermLen       = 2
+	maxTermLen       = 40
+	snippetBefore    = 40
+	snippetAfter     = 100
+)
+
+var ErrEmptyQuery = errors.New("query has no searchable terms")
+
+// Query selects history records containing every term of Text.
+// Each term matches indexed words it is a prefix of ("migrat" finds "migration").
+type Query struct {
+	Text     string
+	Worktree *string // nil searches every worktree; "" is the main worktree
+	Types    []agent.EventType
+	Since    time.Time // inclusive; zero = unbounded
+	Until    time.Time // exclusive; zero = unbounded
+	Limit    int       // max sessions; 0 = DefaultLimit
+}
+
+// Result is a session with matching history records, newest match last.
+type Result struct {
+	Worktree  string  `json:"worktree"`
+	SessionID string  `json:"session_id"`
+	Title     string  `json:"title"`
+	Total     int     `json:"total"` // matching records; Matches holds at most a few
+	Matches   []Match `json:"matches"`
+}
+
+type Match struct {
+	Offset  int             `json:"offset"` // record index in the session history
+	Type    agent.EventType `json:"type"`
+	Time    time.Time       `json:"time"`
+	Snippet string          `json:"snippet"`
+}
+
+// Search returns sessions ordered by number of matches, then by latest match.
+func (x *Index) Search(q Query) ([]Result, error) {
+	terms := Tokenize(q.Text)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	type hit struct {
+		result Result
+		latest time.Time
+		docs   []doc
+	}
+
+	x.mu.Lock()
+	ids := x.matchLocked(terms)
+	hits := make(map[sessionKey]*hit)
+	for _, id := range ids {
+		d := x.docs[id]
+		if d.deleted || !q.accepts(d) {
+			continue
+		}
+		h, ok := hits[d.key]
+		if !ok {
+			h = &hit{result: Result{Worktree: d.key.worktree, SessionID: d.key.sessionID}}
+			if st, ok := x.sessions[d.key]; ok {
+				h.result.Title = st.title
+			}
+			hits[d.key] = h
+		}
+		h.result.Total++
+		if d.time.After(h.latest) {
+			h.latest = d.time
+		}
+		h.docs = append(h.docs, d)
+	}
+	dirs := make(map[string]string, len(x.dirs))
+	for k, v := range x.dirs {
+		dirs[k] = v
+	}
+	x.mu.Unlock()
+
+	ranked := make([]*hit, 0, len(hits))
+	for _, h := range hits {
+		ranked = append(ranked, h)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].result.Total != ranked[j].result.Total {
+			return ranked[i].result.Total > ranked[j].result.Total
+		}
+		return ranked[i].latest.After(ranked[j].latest)
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	results := make([]Result, len(ranked))
+	for i, h := range ranked {
+		// Docs are in index order, which is history order within a session
+		docs := h.docs
+		if len(docs) > matchesPerResult {
+			docs = docs[len(docs)-matchesPerResult:]
+		}
+		snippets := readSnippets(dirs[h.result.Worktree], h.result.SessionID, docs, terms)
+		h.result.Matches = make([]Match, len(docs))
+		for j, d := range docs {
+			h.result.Matches[j] = Match{Offset: d.offset, Type: d.typ, Time: d.time, Snippet: snippets[d.offset]}
+		}
+		results[i] = h.result
+	}
+	return results, nil
+}
+
+func (q Query) accepts(d doc) bool {
+	if q.Worktree != nil && d.key.worktree != *q.Worktree {
+		return false
+	}
+	if len(q.Types) > 0 && !slices.Contains(q.Types, d.typ) {
+		return false
+	}
+	if !q.Since.IsZero() && d.time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !d.time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// matchLocked returns the doc IDs containing every term (as a word prefix),
+// ascending. Caller must hold x.mu.
+func (x *Index) matchLocked(terms []string) []int {
+	var result []int
+	for i, term := range terms {
+		var ids []int
+		for word, postings := range x.postings {
+			if strings.HasPrefix(word, term) {
+				ids = append(ids, postings...)
+			}
+		}
+		slices.Sort(ids)
+		ids = slices.Compact(ids)
+
+		if i == 0 {
+			result = ids
+		} else {
+			result = intersect(result, ids)
+		}
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+func intersect(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// Tokenize splits text into lowercase words, dropping words too short to be
+// useful and too long to be prose (hashes, base64).
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(fields))
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		n := utf8.RuneCountInString(f)
+		if n < minTermLen || n > maxTermLen || seen[f] {
+			continue
+		}
+		seen[f] = true
+		terms = append(terms, f)
+	}
+	return terms
+}
+
+// extract returns a history record's type and searchable terms.
+func extract(line []byte) (agent.EventType, []string) {
+	var record agent.EventRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return "", nil
+	}
+	return record.Type, Tokenize(recordText(record))
+}
+
+// recordText is the human-readable text of a record: messages, output and tool activity.
+func recordText(r agent.EventRecord) string {
+	parts := []string{r.Content, r.Message, r.Error, r.ToolName, r.ToolResult}
+	if len(r.ToolInput) > 0 {
+		parts = append(parts, string(r.ToolInput))
+	}
+	for _, q := range r.Questions {
+		parts = append(parts, q.Question)
+	}
+	return strings.Join(slices.DeleteFunc(parts, func(s string) bool { return s == "" }), "\n")
+}
+
+// readSnippets loads the records at the docs' offsets and cuts a snippet
+// around the first query term in each.
+func readSnippets(dir, sessionID string, docs []doc, terms []string) map[int]string {
+	snippets := make(map[int]string, len(docs))
+	if dir == "" {
+		return snippets
+	}
+
+	want := make(map[int]bool, len(docs))
+	last := 0
+	for _, d := range docs {
+		want[d.offset] = true
+		last = max(last, d.offset)
+	}
+
+	file, err := os.Open(session.HistoryPath(dir, sessionID))
+	if err != nil {
+		return snippets
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for offset := 0; offset <= last; offset++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		if !want[offset] {
+			continue
+		}
+		var record agent.EventRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue
+		}
+		snippets[offset] = snippet(recordText(record), terms)
+	}
+	return snippets
+}
+
+// snippet returns a window of text around the first occurrence of any term,
+// with whitespace collapsed.
+func snippet(text string, terms []string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	lower := strings.ToLower(text)
+
+	pos := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && (pos < 0 || i < pos) {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	// ToLower can change byte lengths for some scripts; fall back to the start
+	if len(lower) != len(text) {
+		pos = 0
+	}
+
+	runes := []rune(text)
+	center := utf8.RuneCountInString(text[:pos])
+	start := max(0, center-snippetBefore)
+	end := min(len(runes), center+snippetAfter)
+
+	s := string(runes[start:end])
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(runes) {
+		s += "…"
+	}
+	return s
+}
@@ -2,9 +2,11 @@ package session
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -23,11 +25,31 @@ type Store interface {
 	Update(ctx context.Context, sessionID string, title string) error
 	Activate(ctx context.Context, sessionID string) error
 	SetMode(ctx context.Context, sessionID string, mode Mode) error
-
-	// History persistence
+	SetAgent(ctx context.Context, sessionID string, agent string) error
+	SetConfig(ctx context.Context, sessionID string, config AgentConfig) error
+	// SetMuted silences notifications for the session without reordering the list.
+	SetMuted(ctx context.Context, sessionID string, muted bool) error
+	// ClearPendingTranscript records that the agent was sent the session's
+	// pending transcript.
+	ClearPendingTranscript(ctx context.Context, sessionID string) error
+	// Fork creates sessionID seeded with the first origin.Records history records
+	// of origin.SessionID. Mode, agent and config carry over; usage starts at zero.
+	Fork(ctx context.Context, sessionID string, origin ForkOrigin) (SessionMeta, error)
+	// Import adds a session with existing history, e.g. restored from an export.
+	Import(ctx context.Context, meta SessionMeta, history []json.RawMessage) (SessionMeta, error)
+	// AddUsage adds one turn's usage to the session totals and today's bucket.
+	AddUsage(ctx context.Context, sessionID string, usage Usage) error
+
+	// History persistence. A record's sequence number is its 1-based
+	// position in the history; records too large to load are returned as
+	// warnings in their place.
 	GetHistory(ctx context.Context, sessionID string) ([]json.RawMessage, error)
-	// AppendToHistory appends a JSON-serializable record to history (does not update timestamp).
-	AppendToHistory(ctx context.Context, sessionID string, record any) error
+	// GetHistoryWithSeq returns the history with the sequence number of its
+	// last record, read atomically with respect to appends.
+	GetHistoryWithSeq(ctx context.Context, sessionID string) ([]json.RawMessage, int64, error)
+	// AppendToHistory appends a JSON-serializable record to history and returns
+	// its sequence number (does not update timestamp).
+	AppendToHistory(ctx context.Context, sessionID string, record any) (int64, error)
 	// Touch updates the session's UpdatedAt and notifies listeners.
 	Touch(ctx context.Context, sessionID string) error
 
@@ -35,6 +57,14 @@ type Store interface {
 	SetOnChangeListener(listener OnChangeListener)
 }
 
+// HistoryObserver mirrors session data elsewhere, e.g. into a search index.
+// Calls are synchronous, so implementations should be quick.
+type HistoryObserver interface {
+	// OnHistoryChange is called after records are written to a session's history.
+	OnHistoryChange(sessionID string)
+	OnSessionChange(event SessionChangeEvent)
+}
+
 type indexData struct {
 	Sessions []SessionMeta `json:"sessions"`
 }
@@ -46,6 +76,10 @@ type FileStore struct {
 	mu       sync.RWMutex
 	sessions []SessionMeta // in-memory cache
 	listener OnChangeListener
+	observer HistoryObserver
+
+	historyMu sync.Mutex       // serializes history appends and reads
+	seqs      map[string]int64 // last sequence number by session, loaded on first append
 }
 
 func NewFileStore(dataDir string) (*FileStore, error) {
@@ -54,7 +88,7 @@ func NewFileStore(dataDir string) (*FileStore, error) {
 		return nil, err
 	}
 
-	store := &FileStore{dataDir: dataDir}
+	store := &FileStore{dataDir: dataDir, seqs: make(map[string]int64)}
 
 	idx, err := store.readIndexFromDisk()
 	if err != nil {
@@ -66,11 +100,34 @@ func NewFileStore(dataDir string) (*FileStore, error) {
 }
 
 func (s *FileStore) indexPath() string {
-	return filepath.Join(s.dataDir, "sessions", "index.json")
+	return indexPath(s.dataDir)
+}
+
+func indexPath(dataDir string) string {
+	return filepath.Join(dataDir, "sessions", "index.json")
+}
+
+// HistoryPath returns the history file of a session in a store's data directory.
+func HistoryPath(dataDir, sessionID string) string {
+	return filepath.Join(dataDir, "sessions", sessionID, "history.jsonl")
+}
+
+// ReadSessions loads the session index of dataDir without opening a store.
+// It is meant for read-only consumers such as the search indexer.
+func ReadSessions(dataDir string) ([]SessionMeta, error) {
+	idx, err := readIndexFile(indexPath(dataDir))
+	if err != nil {
+		return nil, err
+	}
+	return idx.Sessions, nil
 }
 
 func (s *FileStore) readIndexFromDisk() (indexData, error) {
-	data, err := os.ReadFile(s.indexPath())
+	return readIndexFile(s.indexPath())
+}
+
+func readIndexFile(path string) (indexData, error) {
+	data, err := os.ReadFile(path)
 	if os.IsNotExist(err) {
 		return indexData{Sessions: []SessionMeta{}}, nil
 	}
@@ -108,10 +165,31 @@ func (s *FileStore) SetOnChangeListener(listener OnChangeListener) {
 	s.listener = listener
 }
 
+// SetHistoryObserver registers an observer for history writes and session changes.
+func (s *FileStore) SetHistoryObserver(observer HistoryObserver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = observer
+}
+
+// notifyChange must be called with s.mu held.
 func (s *FileStore) notifyChange(event SessionChangeEvent) {
 	if s.listener != nil {
 		s.listener.OnSessionChange(event)
 	}
+	if s.observer != nil {
+		s.observer.OnSessionChange(event)
+	}
+}
+
+func (s *FileStore) notifyHistoryChange(sessionID string) {
+	s.mu.RLock()
+	observer := s.observer
+	s.mu.RUnlock()
+
+	if observer != nil {
+		observer.OnHistoryChange(sessionID)
+	}
 }
 
 func (s *FileStore) List() ([]SessionMeta, error) {
@@ -177,7 +255,11 @@ func (s *FileStore) Delete(ctx context.Context, sessionID string) error {
 	defer s.mu.Unlock()
 
 	sessionDir := filepath.Join(s.dataDir, "sessions", sessionID)
-	if err := os.RemoveAll(sessionDir); err != nil {
+	s.historyMu.Lock()
+	err := os.RemoveAll(sessionDir)
+	delete(s.seqs, sessionID)
+	s.historyMu.Unlock()
+	if err != nil {
 		return err
 	}
 
@@ -267,8 +349,250 @@ func (s *FileStore) SetMode(ctx context.Context, sessionID string, mode Mode) er
 	return ErrSessionNotFound
 }
 
+func (s *FileStore) SetAgent(ctx context.Context, sessionID string, agent string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.sessions {
+		if s.sessions[i].ID == sessionID {
+			s.sessions[i].Agent = agent
+			s.sessions[i].UpdatedAt = time.Now()
+			if err := s.persistIndex(); err != nil {
+				return err
+			}
+			s.notifyChange(SessionChangeEvent{Op: OperationUpdate, Session: s.sessions[i]})
+			return nil
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+func (s *FileStore) SetConfig(ctx context.Context, sessionID string, config AgentConfig) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.sessions {
+		if s.sessions[i].ID == sessionID {
+			s.sessions[i].Config = config
+			s.sessions[i].UpdatedAt = time.Now()
+			if err := s.persistIndex(); err != nil {
+				return err
+			}
+			s.notifyChange(SessionChangeEvent{Op: OperationUpdate, Session: s.sessions[i]})
+			return nil
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+func (s *FileStore) SetMuted(ctx context.Context, sessionID string, muted bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.sessions {
+		if s.sessions[i].ID == sessionID {
+			s.sessions[i].Muted = muted
+			if err := s.persistIndex(); err != nil {
+				return err
+			}
+			s.notifyChange(SessionChangeEvent{Op: OperationUpdate, Session: s.sessions[i]})
+			return nil
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+func (s *FileStore) ClearPendingTranscript(ctx context.Context, sessionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.sessions {
+		if s.sessions[i].ID == sessionID {
+			if s.sessions[i].PendingTranscript == 0 {
+				return nil
+			}
+			s.sessions[i].PendingTranscript = 0
+			return s.persistIndex()
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+func (s *FileStore) AddUsage(ctx context.Context, sessionID string, usage Usage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.sessions {
+		if s.sessions[i].ID == sessionID {
+			// Copy-on-write: metas returned by Get/List share the old map
+			day := time.Now().UTC().Format(UsageDayFormat)
+			daily := make(map[string]Usage, len(s.sessions[i].DailyUsage)+1)
+			for k, v := range s.sessions[i].DailyUsage {
+				daily[k] = v
+			}
+			daily[day] = daily[day].Add(usage)
+			s.sessions[i].DailyUsage = daily
+			s.sessions[i].Usage = s.sessions[i].Usage.Add(usage)
+			if err := s.persistIndex(); err != nil {
+				return err
+			}
+			s.notifyChange(SessionChangeEvent{Op: OperationUpdate, Session: s.sessions[i]})
+			return nil
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+func (s *FileStore) Fork(ctx context.Context, sessionID string, origin ForkOrigin) (SessionMeta, error) {
+	if _, found, _ := s.Get(origin.SessionID); !found {
+		return SessionMeta{}, ErrSessionNotFound
+	}
+
+	history, err := s.GetHistory(ctx, origin.SessionID)
+	if err != nil {
+		return SessionMeta{}, err
+	}
+	if origin.Records < 0 || origin.Records > len(history) {
+		return SessionMeta{}, ErrInvalidForkPoint
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var source *SessionMeta
+	for i := range s.sessions {
+		if s.sessions[i].ID == origin.SessionID {
+			source = &s.sessions[i]
+			break
+		}
+	}
+	if source == nil {
+		return SessionMeta{}, ErrSessionNotFound
+	}
+
+	origin.CostUSD = source.Usage.CostUSD
+	now := time.Now()
+	session := SessionMeta{
+		ID:         sessionID,
+		Title:      source.Title + " (fork)",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Mode:       source.Mode,
+		Agent:      source.Agent,
+		Config:     source.Config,
+		ForkedFrom: &origin,
+	}
+	if !origin.Resume {
+		session.PendingTranscript = origin.Records
+	}
+
+	if err := s.insertLocked(session, history[:origin.Records]); err != nil {
+		return SessionMeta{}, err
+	}
+	return session, nil
+}
+
+// Import adds a session with the given metadata and history, e.g. from an
+// exported bundle. A zero CreatedAt defaults to now; the session starts
+// inactive, so its agent begins a fresh conversation.
+func (s *FileStore) Import(ctx context.Context, meta SessionMeta, history []json.RawMessage) (SessionMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return SessionMeta{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sess := range s.sessions {
+		if sess.ID == meta.ID {
+			return SessionMeta{}, ErrSessionExists
+		}
+	}
+
+	now := time.Now()
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = now
+	}
+	meta.UpdatedAt = now
+	meta.Activated = false
+	if meta.Mode == "" {
+		meta.Mode = ModeDefault
+	}
+
+	if err := s.insertLocked(meta, history); err != nil {
+		return SessionMeta{}, err
+	}
+	return meta, nil
+}
+
+// insertLocked writes a new session's history and adds it to the index.
+// Caller must hold s.mu.
+func (s *FileStore) insertLocked(meta SessionMeta, history []json.RawMessage) error {
+	if err := s.writeHistory(meta.ID, history); err != nil {
+		return err
+	}
+
+	s.sessions = append([]SessionMeta{meta}, s.sessions...)
+
+	if err := s.persistIndex(); err != nil {
+		s.sessions = s.sessions[1:]
+		os.RemoveAll(filepath.Dir(s.historyPath(meta.ID)))
+		return err
+	}
+
+	s.notifyChange(SessionChangeEvent{Op: OperationCreate, Session: meta})
+	if s.observer != nil {
+		s.observer.OnHistoryChange(meta.ID)
+	}
+	return nil
+}
+
+// writeHistory replaces a session's history with records.
+func (s *FileStore) writeHistory(sessionID string, records []json.RawMessage) error {
+	path := s.historyPath(sessionID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, record := range records {
+		data = append(data, record...)
+		data = append(data, '\n')
+	}
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	delete(s.seqs, sessionID)
+	return os.WriteFile(path, data, 0644)
+}
+
 func (s *FileStore) historyPath(sessionID string) string {
-	return filepath.Join(s.dataDir, "sessions", sessionID, "history.jsonl")
+	return HistoryPath(s.dataDir, sessionID)
 }
 
 func (s *FileStore) GetHistory(ctx context.Context, sessionID string) ([]json.RawMessage, error) {
@@ -278,8 +602,54 @@ func (s *FileStore) GetHistory(ctx context.Context, sessionID string) ([]json.Ra
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	return readHistoryFile(s.historyPath(sessionID))
+}
+
+func (s *FileStore) GetHistoryWithSeq(ctx context.Context, sessionID string) ([]json.RawMessage, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
 
 	path := s.historyPath(sessionID)
+	history, err := readHistoryFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The counter that numbers appended records; it also counts records too
+	// long for readHistoryFile
+	seq, ok := s.seqs[sessionID]
+	if !ok {
+		if seq, err = countRecords(path); err != nil {
+			return nil, 0, err
+		}
+		s.seqs[sessionID] = seq
+	}
+	return history, seq, nil
+}
+
+// ReadHistory loads a session's history from dataDir without opening a store.
+// It is meant for read-only consumers such as exports.
+func ReadHistory(dataDir, sessionID string) ([]json.RawMessage, error) {
+	return readHistoryFile(HistoryPath(dataDir, sessionID))
+}
+
+// maxRecordSize bounds a history line that is loaded. Matches the CLI
+// output buffer size
+const maxRecordSize = 1024 * 1024
+
+// readHistoryFile loads the records of a history file. A line longer than
+// maxRecordSize is replaced by a warning, so record i always has sequence
+// number i+1.
+func readHistoryFile(path string) ([]json.RawMessage, error) {
 	file, err := os.Open(path)
 	if os.IsNotExist(err) {
 		return []json.RawMessage{}, nil
@@ -290,62 +660,130 @@ func (s *FileStore) GetHistory(ctx context.Context, sessionID string) ([]json.Ra
 	defer file.Close()
 
 	var records []json.RawMessage
-	scanner := bufio.NewScanner(file)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // Match CLI output buffer size
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
+	reader := bufio.NewReader(file)
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong {
+			// Copied since the reader reuses its buffer
+			line = append(line, chunk...)
+			if len(line) > maxRecordSize+len("\r\n") {
+				tooLong, line = true, nil
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
 			continue
 		}
-		// Make a copy since scanner reuses the buffer
-		record := make(json.RawMessage, len(line))
-		copy(record, line)
-		records = append(records, record)
-	}
-
-	if err := scanner.Err(); err != nil {
-		if errors.Is(err, bufio.ErrTooLong) {
-			// Buffer overflow: append warning and return partial results
-			warning := map[string]string{
-				"type":    "warning",
-				"message": "Some history entries were too large to load",
-				"code":    "history_buffer_overflow",
-			}
-			warningJSON, _ := json.Marshal(warning)
-			records = append(records, warningJSON)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte{'\n'}), []byte{'\r'})
+		switch {
+		case tooLong || len(line) > maxRecordSize:
+			records = append(records, historyOverflowWarning)
+		case len(line) > 0:
+			records = append(records, line)
+		}
+		line, tooLong = nil, false
+
+		if err != nil {
 			return records, nil
 		}
-		return nil, err
 	}
-
-	return records, nil
 }
 
-func (s *FileStore) AppendToHistory(ctx context.Context, sessionID string, record any) error {
+// historyOverflowWarning stands in for a record too large to load
+var historyOverflowWarning = json.RawMessage(`{"type":"warning","message":"Some history entries were too large to load","code":"history_buffer_overflow"}`)
+
+func (s *FileStore) AppendToHistory(ctx context.Context, sessionID string, record any) (int64, error) {
 	if err := ctx.Err(); err != nil {
-		return err
+		return 0, err
 	}
 
+	data, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+	data = append(data, '\n')
+
+	seq, err := s.appendRecord(sessionID, data)
+	if err != nil {
+		return 0, err
+	}
+
+	s.notifyHistoryChange(sessionID)
+	return seq, nil
+}
+
+// appendRecord writes one encoded record and returns its sequence number.
+func (s *FileStore) appendRecord(sessionID string, data []byte) (int64, error) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
 	path := s.historyPath(sessionID)
+	last, ok := s.seqs[sessionID]
+	if !ok {
+		n, err := countRecords(path)
+		if err != nil {
+			return 0, err
+		}
+		last = n
+	}
 
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return err
+		return 0, err
 	}
 
 	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer file.Close()
 
-	data, err := json.Marshal(record)
+	if _, err := file.Write(data); err != nil {
+		return 0, err
+	}
+
+	s.seqs[sessionID] = last + 1
+	return last + 1, nil
+}
+
+// countRecords returns the number of records in a history file, including
+// lines too long for readHistoryFile.
+func countRecords(path string) (int64, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer file.Close()
 
-	data = append(data, '\n')
-	_, err = file.Write(data)
-	return err
+	var n int64
+	reader := bufio.NewReader(file)
+	empty := true
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(bytes.TrimSuffix(chunk, []byte{'\n'})) > 0 {
+			empty = false
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if !empty {
+			n++
+		}
+		empty = true
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
 }
 
 func (s *FileStore) Touch(ctx context.Context, sessionID string) error {
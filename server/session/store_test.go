@@ -2,8 +2,10 @@ package session
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -185,6 +187,157 @@ func TestFileStore_ActivateNonExistent(t *testing.T) {
 	}
 }
 
+func TestFileStore_SetConfig(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir)
+	sess, _ := store.Create(ctx, "configured-session")
+
+	config := AgentConfig{Model: "opus", AllowedTools: []string{"Read"}, MaxTurns: 3}
+	if err := store.SetConfig(ctx, sess.ID, config); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+
+	// Reload from disk
+	store2, _ := NewFileStore(dir)
+	updated, _, _ := store2.Get(sess.ID)
+	if updated.Config.Model != "opus" || updated.Config.MaxTurns != 3 || len(updated.Config.AllowedTools) != 1 {
+		t.Errorf("unexpected config: %+v", updated.Config)
+	}
+
+	if err := store.SetConfig(ctx, "non-existent-id", config); err != ErrSessionNotFound {
+		t.Errorf("SetConfig non-existent should return ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestFileStore_AddUsage(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir)
+	sess, _ := store.Create(ctx, "metered-session")
+
+	turn := Usage{InputTokens: 100, OutputTokens: 50, CostUSD: 0.01, Turns: 1, DurationMS: 1000}
+	if err := store.AddUsage(ctx, sess.ID, turn); err != nil {
+		t.Fatalf("AddUsage failed: %v", err)
+	}
+	if err := store.AddUsage(ctx, sess.ID, turn); err != nil {
+		t.Fatalf("AddUsage failed: %v", err)
+	}
+
+	// Reload from disk
+	store2, _ := NewFileStore(dir)
+	updated, _, _ := store2.Get(sess.ID)
+	want := Usage{InputTokens: 200, OutputTokens: 100, CostUSD: 0.02, Turns: 2, DurationMS: 2000}
+	if updated.Usage != want {
+		t.Errorf("total = %+v, want %+v", updated.Usage, want)
+	}
+	today := time.Now().UTC().Format(UsageDayFormat)
+	if updated.DailyUsage[today] != want {
+		t.Errorf("daily[%s] = %+v, want %+v", today, updated.DailyUsage[today], want)
+	}
+	if !updated.UpdatedAt.Equal(sess.UpdatedAt) {
+		t.Error("AddUsage should not update UpdatedAt")
+	}
+
+	if err := store.AddUsage(ctx, "non-existent-id", turn); err != ErrSessionNotFound {
+		t.Errorf("AddUsage non-existent should return ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestFileStore_Fork(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir)
+	src, _ := store.Create(ctx, "source")
+	store.Update(ctx, src.ID, "Original")
+	store.SetMode(ctx, src.ID, ModeYolo)
+	store.SetConfig(ctx, src.ID, AgentConfig{Model: "opus"})
+	store.AddUsage(ctx, src.ID, Usage{Turns: 1})
+	for i := 0; i < 3; i++ {
+		store.AppendToHistory(ctx, src.ID, map[string]int{"n": i})
+	}
+
+	origin := ForkOrigin{SessionID: src.ID, Records: 2}
+	fork, err := store.Fork(ctx, "forked", origin)
+	if err != nil {
+		t.Fatalf("Fork failed: %v", err)
+	}
+	if fork.Title != "Original (fork)" || fork.Mode != ModeYolo || fork.Config.Model != "opus" {
+		t.Errorf("unexpected fork meta: %+v", fork)
+	}
+	if fork.Usage != (Usage{}) || fork.Activated {
+		t.Errorf("fork should start unused and inactive: %+v", fork)
+	}
+
+	// Reload from disk
+	store2, _ := NewFileStore(dir)
+	meta, found, _ := store2.Get("forked")
+	if !found || meta.ForkedFrom == nil || *meta.ForkedFrom != origin {
+		t.Errorf("expected fork origin %+v, got %+v", origin, meta.ForkedFrom)
+	}
+	history, _ := store2.GetHistory(ctx, "forked")
+	if len(history) != 2 || string(history[1]) != `{"n":1}` {
+		t.Errorf("unexpected fork history: %s", history)
+	}
+	sourceHistory, _ := store2.GetHistory(ctx, src.ID)
+	if len(sourceHistory) != 3 {
+		t.Errorf("source history should be untouched, got %d records", len(sourceHistory))
+	}
+
+	if _, err := store.Fork(ctx, "too-far", ForkOrigin{SessionID: src.ID, Records: 4}); err != ErrInvalidForkPoint {
+		t.Errorf("Fork past end should return ErrInvalidForkPoint, got %v", err)
+	}
+	if _, err := store.Fork(ctx, "orphan", ForkOrigin{SessionID: "non-existent-id"}); err != ErrSessionNotFound {
+		t.Errorf("Fork of non-existent should return ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestFileStore_Import(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir)
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	history := []json.RawMessage{json.RawMessage(`{"n":0}`), json.RawMessage(`{"n":1}`)}
+
+	meta, err := store.Import(ctx, SessionMeta{ID: "imported", Title: "Imported", CreatedAt: created, Activated: true}, history)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if meta.Activated || meta.Mode != ModeDefault || !meta.CreatedAt.Equal(created) || meta.UpdatedAt.IsZero() {
+		t.Errorf("unexpected imported meta: %+v", meta)
+	}
+
+	store2, _ := NewFileStore(dir)
+	got, _ := store2.GetHistory(ctx, "imported")
+	if len(got) != 2 || string(got[1]) != `{"n":1}` {
+		t.Errorf("unexpected imported history: %s", got)
+	}
+
+	if _, err := store.Import(ctx, SessionMeta{ID: "imported"}, nil); err != ErrSessionExists {
+		t.Errorf("duplicate Import should return ErrSessionExists, got %v", err)
+	}
+}
+
+func TestAgentConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  AgentConfig
+		wantErr bool
+	}{
+		{"empty", AgentConfig{}, false},
+		{"full", AgentConfig{Model: "sonnet", SystemPrompt: "x", AllowedTools: []string{"Bash(git:*)"}, MaxTurns: 10}, false},
+		{"negative max turns", AgentConfig{MaxTurns: -1}, true},
+		{"blank tool", AgentConfig{DisallowedTools: []string{" "}}, true},
+		{"comma in tool", AgentConfig{AllowedTools: []string{"Read,Edit"}}, true},
+		{"padded model", AgentConfig{Model: " opus"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestFileStore_Persistence(t *testing.T) {
 	dir := t.TempDir()
 
@@ -221,10 +374,10 @@ func TestFileStore_History(t *testing.T) {
 	record1 := map[string]string{"type": "message", "content": "hello"}
 	record2 := map[string]string{"type": "text", "content": "world"}
 
-	if err := store.AppendToHistory(ctx, sess.ID, record1); err != nil {
+	if _, err := store.AppendToHistory(ctx, sess.ID, record1); err != nil {
 		t.Fatalf("AppendToHistory failed: %v", err)
 	}
-	if err := store.AppendToHistory(ctx, sess.ID, record2); err != nil {
+	if _, err := store.AppendToHistory(ctx, sess.ID, record2); err != nil {
 		t.Fatalf("AppendToHistory failed: %v", err)
 	}
 
@@ -274,6 +427,56 @@ func TestFileStore_AppendToHistory_DoesNotUpdateTimestamp(t *testing.T) {
 	}
 }
 
+func TestFileStore_AppendToHistory_Seq(t *testing.T) {
+	dataDir := t.TempDir()
+	store, _ := NewFileStore(dataDir)
+	sess, _ := store.Create(ctx, "seq-session")
+
+	for want := int64(1); want <= 2; want++ {
+		seq, err := store.AppendToHistory(ctx, sess.ID, map[string]int64{"n": want})
+		if err != nil || seq != want {
+			t.Fatalf("expected seq %d, got %d (%v)", want, seq, err)
+		}
+	}
+
+	// A new store continues after the records on disk
+	reopened, _ := NewFileStore(dataDir)
+	if seq, _ := reopened.AppendToHistory(ctx, sess.ID, map[string]int64{"n": 3}); seq != 3 {
+		t.Errorf("expected seq 3 after reopening, got %d", seq)
+	}
+
+	reopened.Delete(ctx, sess.ID)
+	if seq, _ := reopened.AppendToHistory(ctx, sess.ID, map[string]int64{"n": 1}); seq != 1 {
+		t.Errorf("expected seq to restart after delete, got %d", seq)
+	}
+}
+
+func TestFileStore_GetHistoryWithSeq(t *testing.T) {
+	dataDir := t.TempDir()
+	store, _ := NewFileStore(dataDir)
+	sess, _ := store.Create(ctx, "seq-session")
+
+	store.AppendToHistory(ctx, sess.ID, map[string]string{"content": strings.Repeat("x", 2<<20)})
+	store.AppendToHistory(ctx, sess.ID, map[string]int{"n": 2})
+
+	// A record too long to load still counts, so the seq matches the next append
+	reopened, _ := NewFileStore(dataDir)
+	history, seq, err := reopened.GetHistoryWithSeq(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("GetHistoryWithSeq failed: %v", err)
+	}
+	if seq != 2 {
+		t.Errorf("expected seq 2, got %d (%d records loaded)", seq, len(history))
+	}
+	// It is replaced in place, so later records keep their positions
+	if len(history) != 2 || !strings.Contains(string(history[0]), "history_buffer_overflow") || string(history[1]) != `{"n":2}` {
+		t.Errorf("expected a warning followed by the second record, got %s", history)
+	}
+	if next, _ := reopened.AppendToHistory(ctx, sess.ID, map[string]int{"n": 3}); next != seq+1 {
+		t.Errorf("expected next seq %d, got %d", seq+1, next)
+	}
+}
+
 func TestFileStore_Delete_RemovesHistory(t *testing.T) {
 	store, _ := NewFileStore(t.TempDir())
 
@@ -2,10 +2,17 @@ package session
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
-var ErrSessionNotFound = errors.New("session not found")
+var (
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrInvalidForkPoint = errors.New("fork point out of range")
+	ErrSessionExists    = errors.New("session already exists")
+)
 
 // Mode represents the agent mode for a session.
 type Mode string
@@ -13,27 +20,117 @@ type Mode string
 const (
 	ModeDefault Mode = "default" // Normal mode with permission prompts
 	ModeYolo    Mode = "yolo"    // Skip all permission prompts (--dangerously-skip-permissions)
-	// ModePlan Mode = "plan"    // Planning mode (future)
+	ModePlan    Mode = "plan"    // Read-only planning until the plan is approved (--permission-mode plan)
 )
 
 // IsValid returns true if the mode is a known valid mode.
 func (m Mode) IsValid() bool {
 	switch m {
-	case ModeDefault, ModeYolo:
+	case ModeDefault, ModeYolo, ModePlan:
 		return true
 	default:
 		return false
 	}
 }
 
+// AgentConfig holds per-session overrides for the agent CLI.
+// Zero values mean "use the CLI default".
+type AgentConfig struct {
+	Model           string   `json:"model,omitempty"`
+	SystemPrompt    string   `json:"system_prompt,omitempty"` // appended to the default system prompt
+	AllowedTools    []string `json:"allowed_tools,omitempty"`
+	DisallowedTools []string `json:"disallowed_tools,omitempty"`
+	MaxTurns        int      `json:"max_turns,omitempty"`
+}
+
+// Equal reports whether c and o configure the agent the same way. Nil and
+// empty tool lists are equal.
+func (c AgentConfig) Equal(o AgentConfig) bool {
+	return c.Model == o.Model &&
+		c.SystemPrompt == o.SystemPrompt &&
+		c.MaxTurns == o.MaxTurns &&
+		slices.Equal(c.AllowedTools, o.AllowedTools) &&
+		slices.Equal(c.DisallowedTools, o.DisallowedTools)
+}
+
+// Validate reports malformed values that the CLI would reject.
+func (c AgentConfig) Validate() error {
+	if c.MaxTurns < 0 {
+		return errors.New("max_turns must not be negative")
+	}
+	if strings.TrimSpace(c.Model) != c.Model {
+		return errors.New("model must not have surrounding whitespace")
+	}
+	for _, tools := range [][]string{c.AllowedTools, c.DisallowedTools} {
+		for _, tool := range tools {
+			if strings.TrimSpace(tool) == "" {
+				return errors.New("tool names must not be empty")
+			}
+			if strings.Contains(tool, ",") {
+				return fmt.Errorf("tool name %q must not contain commas", tool)
+			}
+		}
+	}
+	return nil
+}
+
+// Usage is token and cost accounting for one or more agent turns.
+type Usage struct {
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	CostUSD             float64 `json:"cost_usd"`
+	Turns               int     `json:"turns"`
+	DurationMS          int64   `json:"duration_ms"` // wall time spent in turns
+}
+
+// Add returns the sum of u and o.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		InputTokens:         u.InputTokens + o.InputTokens,
+		OutputTokens:        u.OutputTokens + o.OutputTokens,
+		CacheCreationTokens: u.CacheCreationTokens + o.CacheCreationTokens,
+		CacheReadTokens:     u.CacheReadTokens + o.CacheReadTokens,
+		CostUSD:             u.CostUSD + o.CostUSD,
+		Turns:               u.Turns + o.Turns,
+		DurationMS:          u.DurationMS + o.DurationMS,
+	}
+}
+
+// UsageDayFormat is the key format of SessionMeta.DailyUsage (UTC dates).
+const UsageDayFormat = "2006-01-02"
+
+// ForkOrigin records where a forked session branched off.
+type ForkOrigin struct {
+	SessionID string `json:"session_id"`
+	Records   int    `json:"records"` // number of history records copied from the source
+	// Resume is true when the fork point matches the source agent's conversation,
+	// so the first process can branch that conversation instead of starting fresh.
+	Resume bool `json:"resume"`
+	// CostUSD is the source's recorded cost at the fork, which a branched
+	// conversation's running cost total starts from.
+	CostUSD float64 `json:"cost_usd,omitempty"`
+}
+
 // SessionMeta holds metadata for a chat session.
 type SessionMeta struct {
-	ID        string    `json:"id"`
-	Title     string    `json:"title"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Activated bool      `json:"activated"` // true after first message sent
-	Mode      Mode      `json:"mode"`      // agent mode (default, yolo, plan)
+	ID         string      `json:"id"`
+	Title      string      `json:"title"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Activated  bool        `json:"activated"`             // true after first message sent
+	Mode       Mode        `json:"mode"`                  // agent mode (default, yolo, plan)
+	Agent      string      `json:"agent,omitempty"`       // agent backend name (empty = server default)
+	Config     AgentConfig `json:"config,omitzero"`       // model, prompt and tool overrides
+	Usage      Usage       `json:"usage,omitzero"`        // lifetime totals
+	ForkedFrom *ForkOrigin `json:"forked_from,omitempty"` // set for sessions created by Fork
+	// PendingTranscript is the number of leading history records the agent has
+	// not seen, sent as a transcript ahead of the next message
+	PendingTranscript int  `json:"pending_transcript,omitempty"`
+	Muted             bool `json:"muted,omitempty"` // no push or webhook notifications
+
+	DailyUsage map[string]Usage `json:"daily_usage,omitempty"` // totals per UTC day (UsageDayFormat)
 }
 
 // Operation represents the type of change to the session list.
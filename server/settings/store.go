@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+
+	"github.com/pockode/server/fsutil"
 )
 
 // OnChangeListener is notified when settings are updated.
@@ -93,23 +95,5 @@ func (s *Store) save(settings Settings) error {
 		return err
 	}
 
-	// Atomic write: write to temp file then rename
-	tmp, err := os.CreateTemp(dir, "settings-*.json.tmp")
-	if err != nil {
-		return err
-	}
-	tmpPath := tmp.Name()
-
-	if _, err := tmp.Write(data); err != nil {
-		tmp.Close()
-		os.Remove(tmpPath)
-		return err
-	}
-
-	if err := tmp.Close(); err != nil {
-		os.Remove(tmpPath)
-		return err
-	}
-
-	return os.Rename(tmpPath, s.path)
+	return fsutil.WriteFileAtomic(s.path, data)
 }
@@ -6,8 +6,8 @@ import (
 	"log/slog"
 	"sync"
 
-	"github.com/pockode/server/agent"
 	"github.com/pockode/server/process"
+	"github.com/pockode/server/rpc"
 	"github.com/pockode/server/session"
 	"github.com/sourcegraph/jsonrpc2"
 )
@@ -17,7 +17,7 @@ import (
 type ChatMessagesWatcher struct {
 	*BaseWatcher
 	store session.Store
-	msgCh chan process.ChatMessage
+	msgCh chan chatUpdate
 
 	sessionMu    sync.RWMutex
 	sessionToIDs map[string][]string // sessionID -> subscription IDs
@@ -31,7 +31,7 @@ func NewChatMessagesWatcher(store session.Store) *ChatMessagesWatcher {
 	return &ChatMessagesWatcher{
 		BaseWatcher:  NewBaseWatcher("cm"),
 		store:        store,
-		msgCh:        make(chan process.ChatMessage, 256),
+		msgCh:        make(chan chatUpdate, 256),
 		sessionToIDs: make(map[string][]string),
 		idToSession:  make(map[string]string),
 	}
@@ -48,6 +48,13 @@ func (w *ChatMessagesWatcher) Stop() {
 	slog.Info("ChatMessagesWatcher stopped")
 }
 
+// chatUpdate is either an agent event or a queue snapshot. Both share one
+// channel so subscribers see them in the order they happened.
+type chatUpdate struct {
+	msg   *process.ChatMessage
+	queue *process.QueueChangeEvent
+}
+
 // OnChatMessage implements process.ChatMessageListener.
 // Called from Process.streamEvents(), must not block.
 func (w *ChatMessagesWatcher) OnChatMessage(msg process.ChatMessage) {
@@ -56,7 +63,7 @@ func (w *ChatMessagesWatcher) OnChatMessage(msg process.ChatMessage) {
 	}
 
 	select {
-	case w.msgCh <- msg:
+	case w.msgCh <- chatUpdate{msg: &msg}:
 	default:
 		slog.Warn("chat message dropped (buffer full)",
 			"sessionId", msg.SessionID,
@@ -64,44 +71,82 @@ func (w *ChatMessagesWatcher) OnChatMessage(msg process.ChatMessage) {
 	}
 }
 
+// OnQueueChange implements process.ChatMessageListener. Must not block.
+func (w *ChatMessagesWatcher) OnQueueChange(event process.QueueChangeEvent) {
+	if w.Context().Err() != nil {
+		return
+	}
+
+	select {
+	case w.msgCh <- chatUpdate{queue: &event}:
+	default:
+		slog.Warn("queue change dropped (buffer full)", "sessionId", event.SessionID)
+	}
+}
+
 func (w *ChatMessagesWatcher) messageLoop() {
 	for {
 		select {
 		case <-w.Context().Done():
 			return
-		case msg := <-w.msgCh:
-			w.notifyMessage(msg)
+		case update := <-w.msgCh:
+			if update.msg != nil {
+				w.notifyMessage(*update.msg)
+			} else {
+				w.notifyQueue(*update.queue)
+			}
 		}
 	}
 }
 
-func (w *ChatMessagesWatcher) notifyMessage(msg process.ChatMessage) {
-	sessionID := msg.SessionID
-	eventType := msg.Event.EventType()
-	method := "chat." + string(eventType)
+// notifyQueue sends the session's full outbound queue as "chat.queue".
+func (w *ChatMessagesWatcher) notifyQueue(event process.QueueChangeEvent) {
+	for _, sub := range w.sessionSubscriptions(event.SessionID) {
+		params := rpc.ChatQueueParams{ID: sub.ID, Queue: event.Queue, Paused: event.Paused}
+		if err := sub.Conn.Notify(context.Background(), "chat.queue", params); err != nil {
+			slog.Debug("failed to notify subscriber",
+				"id", sub.ID,
+				"sessionId", event.SessionID,
+				"error", err)
+		}
+	}
+}
 
-	// Get subscription IDs for this session
+// sessionSubscriptions returns the live subscriptions for a session.
+func (w *ChatMessagesWatcher) sessionSubscriptions(sessionID string) []*Subscription {
 	w.sessionMu.RLock()
 	ids := make([]string, len(w.sessionToIDs[sessionID]))
 	copy(ids, w.sessionToIDs[sessionID])
 	w.sessionMu.RUnlock()
 
-	if len(ids) == 0 {
+	subs := make([]*Subscription, 0, len(ids))
+	for _, id := range ids {
+		if sub := w.GetSubscription(id); sub != nil {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+func (w *ChatMessagesWatcher) notifyMessage(msg process.ChatMessage) {
+	sessionID := msg.SessionID
+	eventType := msg.Event.EventType()
+	method := "chat." + string(eventType)
+
+	subs := w.sessionSubscriptions(sessionID)
+	if len(subs) == 0 {
 		return
 	}
 
 	// Use EventRecord as the notification payload (single source of truth)
 	record := msg.Event.ToRecord()
 
-	for _, id := range ids {
-		sub := w.GetSubscription(id)
-		if sub == nil {
-			continue
-		}
-
+	for _, sub := range subs {
 		// Add subscription ID to params for client-side routing
-		params := notifyParams{
+		params := rpc.ChatEventParams{
 			ID:          sub.ID,
+			Seq:         msg.Seq,
+			PrevSeq:     msg.PrevSeq,
 			EventRecord: record,
 		}
 
@@ -114,19 +159,14 @@ func (w *ChatMessagesWatcher) notifyMessage(msg process.ChatMessage) {
 	}
 }
 
-// notifyParams embeds EventRecord with subscription ID for routing.
-type notifyParams struct {
-	ID string `json:"id"`
-	agent.EventRecord
-}
-
 // Subscribe registers a subscriber for a specific session.
-// Returns subscription ID and history.
+// Returns the subscription ID, the history and the sequence number of its
+// last record.
 func (w *ChatMessagesWatcher) Subscribe(
 	conn *jsonrpc2.Conn,
 	connID string,
 	sessionID string,
-) (string, []json.RawMessage, error) {
+) (string, []json.RawMessage, int64, error) {
 	id := w.GenerateID()
 	sub := &Subscription{
 		ID:     id,
@@ -144,13 +184,13 @@ func (w *ChatMessagesWatcher) Subscribe(
 	// Rare duplicates are acceptable; message loss is not.
 	w.AddSubscription(sub)
 
-	history, err := w.store.GetHistory(context.Background(), sessionID)
+	history, seq, err := w.store.GetHistoryWithSeq(context.Background(), sessionID)
 	if err != nil {
 		w.Unsubscribe(id)
-		return "", nil, err
+		return "", nil, 0, err
 	}
 
-	return id, history, nil
+	return id, history, seq, nil
 }
 
 // Unsubscribe removes a subscription.
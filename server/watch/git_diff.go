@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/pockode/server/git"
+	"github.com/pockode/server/rpc"
 	"github.com/sourcegraph/jsonrpc2"
 )
 
@@ -168,11 +169,12 @@ func (w *GitDiffWatcher) checkOne(sub *Subscription) {
 	data.lastHash = hash
 	w.dataMu.Unlock()
 
-	params := map[string]any{
-		"id":          sub.ID,
-		"diff":        result.Diff,
-		"old_content": result.OldContent,
-		"new_content": result.NewContent,
+	params := rpc.GitDiffChangedParams{
+		ID:         sub.ID,
+		Diff:       result.Diff,
+		OldContent: result.OldContent,
+		NewContent: result.NewContent,
+		Hash:       result.Hash,
 	}
 	if err := sub.Conn.Notify(context.Background(), "git.diff.changed", params); err != nil {
 		slog.Debug("failed to notify git diff change", "id", sub.ID, "error", err)
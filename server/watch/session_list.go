@@ -66,7 +66,7 @@ func (w *SessionListWatcher) notifyChange(event session.SessionChangeEvent) {
 	}
 
 	w.NotifyAll("session.list.changed", func(sub *Subscription) any {
-		params := sessionListChangedParams{
+		params := rpc.SessionListChangedParams{
 			ID:        sub.ID,
 			Operation: string(event.Op),
 		}
@@ -114,13 +114,6 @@ func (w *SessionListWatcher) Subscribe(conn *jsonrpc2.Conn, connID string) (stri
 	return id, items, nil
 }
 
-type sessionListChangedParams struct {
-	ID        string               `json:"id"`
-	Operation string               `json:"operation"`
-	Session   *rpc.SessionListItem `json:"session,omitempty"`
-	SessionID string               `json:"sessionId,omitempty"`
-}
-
 func (w *SessionListWatcher) NotifyProcessStateChange(sessionID string, state string) {
 	if !w.HasSubscriptions() {
 		return
@@ -133,7 +126,7 @@ func (w *SessionListWatcher) NotifyProcessStateChange(sessionID string, state st
 	}
 
 	w.NotifyAll("session.list.changed", func(sub *Subscription) any {
-		return sessionListChangedParams{
+		return rpc.SessionListChangedParams{
 			ID:        sub.ID,
 			Operation: "update",
 			Session: &rpc.SessionListItem{
@@ -42,8 +42,12 @@ func (m *mockSessionStore) GetHistory(ctx context.Context, sessionID string) ([]
 	return nil, nil
 }
 
-func (m *mockSessionStore) AppendToHistory(ctx context.Context, sessionID string, record any) error {
-	return nil
+func (m *mockSessionStore) GetHistoryWithSeq(ctx context.Context, sessionID string) ([]json.RawMessage, int64, error) {
+	return nil, 0, nil
+}
+
+func (m *mockSessionStore) AppendToHistory(ctx context.Context, sessionID string, record any) (int64, error) {
+	return 0, nil
 }
 
 func (m *mockSessionStore) Touch(ctx context.Context, sessionID string) error {
@@ -54,6 +58,34 @@ func (m *mockSessionStore) SetMode(ctx context.Context, sessionID string, mode s
 	return nil
 }
 
+func (m *mockSessionStore) SetAgent(ctx context.Context, sessionID string, agent string) error {
+	return nil
+}
+
+func (m *mockSessionStore) SetConfig(ctx context.Context, sessionID string, config session.AgentConfig) error {
+	return nil
+}
+
+func (m *mockSessionStore) SetMuted(ctx context.Context, sessionID string, muted bool) error {
+	return nil
+}
+
+func (m *mockSessionStore) ClearPendingTranscript(ctx context.Context, sessionID string) error {
+	return nil
+}
+
+func (m *mockSessionStore) Fork(ctx context.Context, sessionID string, origin session.ForkOrigin) (session.SessionMeta, error) {
+	return session.SessionMeta{}, nil
+}
+
+func (m *mockSessionStore) Import(ctx context.Context, meta session.SessionMeta, history []json.RawMessage) (session.SessionMeta, error) {
+	return session.SessionMeta{}, nil
+}
+
+func (m *mockSessionStore) AddUsage(ctx context.Context, sessionID string, usage session.Usage) error {
+	return nil
+}
+
 func (m *mockSessionStore) SetOnChangeListener(listener session.OnChangeListener) {
 	m.listener = listener
 }
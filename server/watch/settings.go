@@ -3,6 +3,7 @@ package watch
 import (
 	"log/slog"
 
+	"github.com/pockode/server/rpc"
 	"github.com/pockode/server/settings"
 	"github.com/sourcegraph/jsonrpc2"
 )
@@ -54,7 +55,7 @@ func (w *SettingsWatcher) notifyChange(s settings.Settings) {
 	}
 
 	w.NotifyAll("settings.changed", func(sub *Subscription) any {
-		return settingsChangedParams{
+		return rpc.SettingsChangedParams{
 			ID:       sub.ID,
 			Settings: s,
 		}
@@ -77,11 +78,6 @@ func (w *SettingsWatcher) Subscribe(conn *jsonrpc2.Conn, connID string) (string,
 	return id, w.store.Get()
 }
 
-type settingsChangedParams struct {
-	ID       string            `json:"id"`
-	Settings settings.Settings `json:"settings"`
-}
-
 // OnSettingsChange implements settings.OnChangeListener.
 // This method is called from the settings store's mutex, so it must not block.
 func (w *SettingsWatcher) OnSettingsChange(s settings.Settings) {
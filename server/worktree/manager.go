@@ -10,8 +10,13 @@ import (
 	"time"
 
 	"github.com/pockode/server/agent"
+	"github.com/pockode/server/audit"
+	"github.com/pockode/server/git"
+	"github.com/pockode/server/notify"
+	"github.com/pockode/server/policy"
 	"github.com/pockode/server/process"
 	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/search"
 	"github.com/pockode/server/session"
 	"github.com/pockode/server/watch"
 	"github.com/sourcegraph/jsonrpc2"
@@ -26,6 +31,10 @@ type Manager struct {
 	dataDir         string
 	idleTimeout     time.Duration
 	WorktreeWatcher *watch.WorktreeWatcher
+	searchIndex     *search.Index
+	policy          *policy.Store
+	notifier        *notify.Service
+	auditLog        *audit.Log
 
 	mu        sync.Mutex
 	worktrees map[string]*Worktree
@@ -46,6 +55,60 @@ func (m *Manager) Registry() *Registry {
 	return m.registry
 }
 
+// SetSearchIndex makes session stores created from now on feed idx.
+// Call before the manager serves requests.
+func (m *Manager) SetSearchIndex(idx *search.Index) {
+	m.searchIndex = idx
+}
+
+// SetPermissionPolicy makes worktrees created from now on auto-answer
+// permission requests matching rules in store.
+// Call before the manager serves requests.
+func (m *Manager) SetPermissionPolicy(store *policy.Store) {
+	m.policy = store
+}
+
+// SetAuditLog makes worktrees created from now on record permission requests
+// answered without a user.
+// Call before the manager serves requests.
+func (m *Manager) SetAuditLog(l *audit.Log) {
+	m.auditLog = l
+}
+
+// SetNotifier makes worktrees created from now on send notifications when
+// their sessions await user input.
+// Call before the manager serves requests.
+func (m *Manager) SetNotifier(service *notify.Service) {
+	m.notifier = service
+}
+
+// DataDirs returns the session store data directory of every worktree that
+// has one on disk, keyed by worktree name ("" = main).
+func (m *Manager) DataDirs() (map[string]string, error) {
+	dirs := map[string]string{"": m.worktreeDataDir("")}
+
+	entries, err := os.ReadDir(filepath.Join(m.dataDir, "worktrees"))
+	if os.IsNotExist(err) {
+		return dirs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs[e.Name()] = m.worktreeDataDir(e.Name())
+		}
+	}
+	return dirs, nil
+}
+
+func (m *Manager) worktreeDataDir(name string) string {
+	if name == "" {
+		return m.dataDir
+	}
+	return filepath.Join(m.dataDir, "worktrees", name)
+}
+
 func (m *Manager) Start() error {
 	return m.WorktreeWatcher.Start()
 }
@@ -122,10 +185,14 @@ func (m *Manager) ForceShutdown(name string) {
 		slog.Info("worktree force shutdown", "name", name)
 	}
 
-	wtDataDir := filepath.Join(m.dataDir, "worktrees", name)
+	wtDataDir := m.worktreeDataDir(name)
 	if err := os.RemoveAll(wtDataDir); err != nil {
 		slog.Warn("failed to remove worktree data directory", "path", wtDataDir, "error", err)
 	}
+
+	if m.searchIndex != nil {
+		m.searchIndex.DropWorktree(name)
+	}
 }
 
 func (m *Manager) Shutdown() {
@@ -147,17 +214,15 @@ func (m *Manager) Shutdown() {
 }
 
 func (m *Manager) create(name, workDir string) (*Worktree, error) {
-	var wtDataDir string
-	if name == "" {
-		wtDataDir = m.dataDir
-	} else {
-		wtDataDir = filepath.Join(m.dataDir, "worktrees", name)
-	}
+	wtDataDir := m.worktreeDataDir(name)
 
 	sessionStore, err := session.NewFileStore(wtDataDir)
 	if err != nil {
 		return nil, fmt.Errorf("create session store: %w", err)
 	}
+	if m.searchIndex != nil {
+		sessionStore.SetHistoryObserver(m.searchIndex.Observer(name, wtDataDir))
+	}
 
 	fsWatcher := watch.NewFSWatcher(workDir)
 	gitWatcher := watch.NewGitWatcher(workDir)
@@ -166,6 +231,16 @@ func (m *Manager) create(name, workDir string) (*Worktree, error) {
 	chatMessagesWatcher := watch.NewChatMessagesWatcher(sessionStore)
 	processManager := process.NewManager(m.agent, workDir, sessionStore, m.idleTimeout)
 	processManager.SetMessageListener(chatMessagesWatcher)
+	if m.policy != nil {
+		processManager.SetPermissionPolicy(m.policy.ForWorktree(name))
+	}
+	if m.notifier != nil {
+		processManager.SetNotifier(m.notifier.ForWorktree(name))
+	}
+	if m.auditLog != nil {
+		processManager.SetAuditor(m.auditLog.ForWorktree(name))
+	}
+	processManager.SetCheckpointer(checkpointer{workDir: workDir})
 	sessionListWatcher.SetProcessStateGetter(processManager)
 	processManager.SetOnStateChange(func(e process.StateChangeEvent) {
 		sessionListWatcher.NotifyProcessStateChange(e.SessionID, string(e.State))
@@ -181,6 +256,7 @@ func (m *Manager) create(name, workDir string) (*Worktree, error) {
 		SessionListWatcher:  sessionListWatcher,
 		ChatMessagesWatcher: chatMessagesWatcher,
 		ProcessManager:      processManager,
+		Trash:               git.NewTrash(filepath.Join(wtDataDir, "trash")),
 		watchers:            []watch.Watcher{fsWatcher, gitWatcher, gitDiffWatcher, sessionListWatcher, chatMessagesWatcher},
 		subscribers:         make(map[*jsonrpc2.Conn]struct{}),
 	}
@@ -39,3 +39,24 @@ func TestForceShutdown_RemovesDataDirectory(t *testing.T) {
 		t.Errorf("parent worktrees directory was unexpectedly removed")
 	}
 }
+
+func TestDataDirs(t *testing.T) {
+	dataDir := t.TempDir()
+	m := &Manager{dataDir: dataDir}
+
+	dirs, err := m.DataDirs()
+	if err != nil {
+		t.Fatalf("DataDirs failed: %v", err)
+	}
+	if len(dirs) != 1 || dirs[""] != dataDir {
+		t.Errorf("expected only the main worktree, got %v", dirs)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dataDir, "worktrees", "feature-1"), 0755); err != nil {
+		t.Fatalf("failed to create test directory: %v", err)
+	}
+	dirs, _ = m.DataDirs()
+	if dirs["feature-1"] != filepath.Join(dataDir, "worktrees", "feature-1") {
+		t.Errorf("expected feature-1 data dir, got %v", dirs)
+	}
+}
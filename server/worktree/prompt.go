@@ -0,0 +1,118 @@
+package worktree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/pockode/server/session"
+)
+
+// Prompt is a message sent without a connected client, e.g. by a schedule.
+type Prompt struct {
+	SessionID string       // session to continue; empty starts a new one
+	Title     string       // title of a new session
+	Mode      session.Mode // mode of a new session; empty keeps the default
+	Agent     string       // agent backend of a new session
+	User      string       // recorded as the sender
+	Content   string
+}
+
+// SendPrompt delivers p in the named worktree and waits until the session has
+// no turn in progress. It returns the session used and the history records
+// written while waiting. Nobody is there to answer prompts: if the agent asks
+// a question or a permission that no rule or timeout answers, or ctx expires
+// first, the turn is interrupted and an error returned.
+func (m *Manager) SendPrompt(ctx context.Context, name string, p Prompt) (string, []json.RawMessage, error) {
+	wt, err := m.Get(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("worktree unavailable: %w", err)
+	}
+	defer m.Release(wt)
+
+	sessionID := p.SessionID
+	if sessionID == "" {
+		if sessionID, err = createSession(ctx, wt.SessionStore, p); err != nil {
+			return "", nil, err
+		}
+	}
+
+	meta, found, err := wt.SessionStore.Get(sessionID)
+	if err != nil {
+		return sessionID, nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if !found {
+		return sessionID, nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	resume := meta.Activated
+	proc, created, err := wt.ProcessManager.GetOrCreateProcess(ctx, meta, resume)
+	if err != nil {
+		return sessionID, nil, err
+	}
+	if created && !resume {
+		if err := wt.SessionStore.Activate(ctx, sessionID); err != nil {
+			slog.Error("failed to activate session", "sessionId", sessionID, "error", err)
+		}
+	}
+
+	history, err := wt.SessionStore.GetHistory(ctx, sessionID)
+	if err != nil {
+		return sessionID, nil, err
+	}
+	since := len(history)
+
+	prompted := proc.Prompted()
+	if _, _, err := proc.Submit(ctx, p.User, p.Content, nil); err != nil {
+		return sessionID, nil, err
+	}
+
+	select {
+	case <-proc.Settled():
+	case <-prompted:
+		if err := proc.SendInterrupt(); err != nil {
+			slog.Error("failed to interrupt prompted run", "sessionId", sessionID, "error", err)
+		}
+		return sessionID, nil, errors.New("agent asked for input that no permission rule or timeout answers, so the turn was interrupted")
+	case <-ctx.Done():
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return sessionID, nil, errors.New("server stopped during run")
+		}
+		if err := proc.SendInterrupt(); err != nil {
+			slog.Error("failed to interrupt overdue run", "sessionId", sessionID, "error", err)
+		}
+		return sessionID, nil, errors.New("run exceeded its maximum duration and was interrupted")
+	}
+
+	history, err = wt.SessionStore.GetHistory(context.Background(), sessionID)
+	if err != nil {
+		return sessionID, nil, err
+	}
+	return sessionID, history[min(since, len(history)):], nil
+}
+
+func createSession(ctx context.Context, store session.Store, p Prompt) (string, error) {
+	sessionID := uuid.Must(uuid.NewV7()).String()
+	if _, err := store.Create(ctx, sessionID); err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+	if p.Title != "" {
+		if err := store.Update(ctx, sessionID, p.Title); err != nil {
+			return "", fmt.Errorf("failed to set session title: %w", err)
+		}
+	}
+	if p.Mode != "" {
+		if err := store.SetMode(ctx, sessionID, p.Mode); err != nil {
+			return "", fmt.Errorf("failed to set session mode: %w", err)
+		}
+	}
+	if p.Agent != "" {
+		if err := store.SetAgent(ctx, sessionID, p.Agent); err != nil {
+			return "", fmt.Errorf("failed to set session agent: %w", err)
+		}
+	}
+	return sessionID, nil
+}
@@ -0,0 +1,139 @@
+package worktree
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/agent/fake"
+	"github.com/pockode/server/policy"
+	"github.com/pockode/server/session"
+)
+
+func TestSendPrompt(t *testing.T) {
+	dataDir := t.TempDir()
+	script := fake.Script{Turns: []fake.Turn{
+		{Steps: []fake.Step{
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeText, Content: "all green"}},
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}},
+		}},
+	}}
+	m := NewManager(NewRegistry(t.TempDir(), dataDir), fake.New(script), dataDir, 10*time.Minute)
+	t.Cleanup(m.Shutdown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sessionID, records, err := m.SendPrompt(ctx, "", Prompt{Title: "Nightly", Mode: session.ModeYolo, Agent: "fake", User: "schedule:Nightly", Content: "run tests"})
+	if err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+
+	var types []agent.EventType
+	for _, raw := range records {
+		var rec agent.EventRecord
+		json.Unmarshal(raw, &rec)
+		types = append(types, rec.Type)
+	}
+	if len(types) == 0 || types[0] != agent.EventTypeMessage || types[len(types)-1] != agent.EventTypeDone {
+		t.Errorf("expected records from message to done, got %v", types)
+	}
+
+	wt, _ := m.Get("")
+	defer m.Release(wt)
+	meta, found, _ := wt.SessionStore.Get(sessionID)
+	if !found || meta.Title != "Nightly" || meta.Mode != session.ModeYolo || meta.Agent != "fake" || !meta.Activated {
+		t.Errorf("expected new titled session in yolo mode on the fake agent, got %+v", meta)
+	}
+
+	// Continuing the session only returns the new turn; the script is
+	// exhausted so the fake agent echoes
+	_, records, err = m.SendPrompt(ctx, "", Prompt{SessionID: sessionID, Content: "again"})
+	if err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+	var first agent.EventRecord
+	json.Unmarshal(records[0], &first)
+	if first.Type != agent.EventTypeMessage || first.Content != "again" {
+		t.Errorf("expected only the second turn, got first record %+v", first)
+	}
+
+	if _, _, err := m.SendPrompt(ctx, "", Prompt{SessionID: "missing", Content: "hi"}); err == nil {
+		t.Error("expected error for unknown session")
+	}
+}
+
+func TestSendPrompt_InterruptsOverdueRun(t *testing.T) {
+	dataDir := t.TempDir()
+	delay := 5000
+	script := fake.Script{Turns: []fake.Turn{
+		{Steps: []fake.Step{
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeText, Content: "still going"}, DelayMS: &delay},
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}},
+		}},
+	}}
+	m := NewManager(NewRegistry(t.TempDir(), dataDir), fake.New(script), dataDir, 10*time.Minute)
+	t.Cleanup(m.Shutdown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	sessionID, _, err := m.SendPrompt(ctx, "", Prompt{Title: "Nightly", Agent: "fake", Content: "deploy"})
+	if err == nil || !strings.Contains(err.Error(), "maximum duration") {
+		t.Fatalf("expected overdue run error, got %v", err)
+	}
+	waitForSettled(t, m, sessionID)
+}
+
+func TestSendPrompt_InterruptsUnansweredPrompt(t *testing.T) {
+	dataDir := t.TempDir()
+	script := fake.Script{Turns: []fake.Turn{
+		{Steps: []fake.Step{
+			{EventRecord: agent.EventRecord{Type: agent.EventTypePermissionRequest, RequestID: "r1", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"make"}`)}},
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}},
+		}},
+		{Steps: []fake.Step{
+			{EventRecord: agent.EventRecord{Type: agent.EventTypePermissionRequest, RequestID: "r2", ToolName: "Bash", ToolInput: json.RawMessage(`{"command":"rm -rf build"}`)}},
+			{EventRecord: agent.EventRecord{Type: agent.EventTypeDone}},
+		}},
+	}}
+	rules, _ := policy.NewStore(dataDir)
+	rules.Add(policy.Rule{Action: policy.ActionAllow, Tool: "Bash", Pattern: "make", Scope: policy.ScopeGlobal})
+	m := NewManager(NewRegistry(t.TempDir(), dataDir), fake.New(script), dataDir, 10*time.Minute)
+	m.SetPermissionPolicy(rules)
+	t.Cleanup(m.Shutdown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A request a rule answers does not stop the run
+	sessionID, _, err := m.SendPrompt(ctx, "", Prompt{Title: "Nightly", Agent: "fake", Content: "build"})
+	if err != nil {
+		t.Fatalf("expected the policy to answer the prompt, got %v", err)
+	}
+
+	// One nobody answers fails the run without waiting for its deadline
+	_, _, err = m.SendPrompt(ctx, "", Prompt{SessionID: sessionID, Content: "clean"})
+	if err == nil || !strings.Contains(err.Error(), "no permission rule or timeout") {
+		t.Fatalf("expected unanswered prompt error, got %v", err)
+	}
+	waitForSettled(t, m, sessionID)
+}
+
+func waitForSettled(t *testing.T, m *Manager, sessionID string) {
+	t.Helper()
+	wt, _ := m.Get("")
+	defer m.Release(wt)
+	proc := wt.ProcessManager.GetProcess(sessionID)
+	if proc == nil {
+		t.Fatal("expected process to keep running")
+	}
+	select {
+	case <-proc.Settled():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the turn to be interrupted")
+	}
+}
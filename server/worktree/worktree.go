@@ -2,9 +2,11 @@ package worktree
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
+	"github.com/pockode/server/git"
 	"github.com/pockode/server/process"
 	"github.com/pockode/server/session"
 	"github.com/pockode/server/watch"
@@ -22,6 +24,7 @@ type Worktree struct {
 	SessionListWatcher  *watch.SessionListWatcher
 	ChatMessagesWatcher *watch.ChatMessagesWatcher
 	ProcessManager      *process.Manager
+	Trash               *git.Trash // discarded changes, kept for undo
 
 	watchers []watch.Watcher // for unified lifecycle management
 
@@ -88,3 +91,17 @@ func (w *Worktree) Stop() {
 	}
 	w.ProcessManager.Shutdown()
 }
+
+// checkpointer snapshots the worktree into hidden git refs before each turn.
+// Worktrees outside a git repository get no checkpoints.
+type checkpointer struct {
+	workDir string
+}
+
+func (c checkpointer) Checkpoint(ctx context.Context, sessionID string) (string, error) {
+	id, err := git.CreateCheckpoint(ctx, c.workDir, sessionID)
+	if errors.Is(err, git.ErrNotRepository) {
+		return "", nil
+	}
+	return id, err
+}
@@ -0,0 +1,38 @@
+package ws
+
+import (
+	"github.com/pockode/server/audit"
+	"github.com/pockode/server/auth"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// isAudited reports whether calls to method are recorded: everything a
+// viewer cannot do.
+func isAudited(method string) bool {
+	return requiredRole(method) != auth.RoleViewer
+}
+
+// recordAudit appends the request to the audit log, if one is configured.
+func (h *rpcMethodHandler) recordAudit(req *jsonrpc2.Request, denied bool) {
+	if h.auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Actor:  h.identity.User,
+		Role:   string(h.identity.Role),
+		ConnID: h.state.getConnID(),
+		Method: req.Method,
+		Denied: denied,
+	}
+	if wt := h.state.getWorktree(); wt != nil {
+		entry.Worktree = wt.Name
+	}
+	if req.Params != nil {
+		entry.Params = audit.Params(*req.Params)
+	}
+
+	if _, err := h.auditLog.Append(entry); err != nil {
+		h.log.Error("failed to write audit entry", "method", req.Method, "error", err)
+	}
+}
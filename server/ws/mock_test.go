@@ -19,13 +19,18 @@ type mockSession struct {
 	closed        bool
 	interruptCh   chan struct{}
 	interruptOnce sync.Once
+	attachments   []agent.Attachment
 }
 
 func (s *mockSession) Events() <-chan agent.AgentEvent {
 	return s.events
 }
 
-func (s *mockSession) SendMessage(prompt string) error {
+func (s *mockSession) SendMessage(prompt string, attachments ...agent.Attachment) error {
+	s.mu.Lock()
+	s.attachments = append(s.attachments, attachments...)
+	s.mu.Unlock()
+
 	select {
 	case s.messageQueue <- prompt:
 		return nil
@@ -69,6 +74,7 @@ type mockAgent struct {
 	events    []agent.AgentEvent
 	startErr  error
 	sessionID string
+	holdTurn  bool // keep each turn running until interrupted
 
 	mu                sync.Mutex
 	messages          []string
@@ -137,6 +143,20 @@ func (m *mockAgent) Start(ctx context.Context, opts agent.StartOptions) (agent.S
 					}
 				}
 
+				if m.holdTurn {
+					select {
+					case <-sess.interruptCh:
+					case <-ctx.Done():
+						return
+					}
+					select {
+					case eventsChan <- agent.InterruptedEvent{}:
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+
 				hasDone := false
 				for _, e := range m.events {
 					if _, ok := e.(agent.DoneEvent); ok {
@@ -0,0 +1,78 @@
+package ws
+
+import "github.com/pockode/server/auth"
+
+// viewerMethods only read state, so any authenticated user may call them.
+var viewerMethods = map[string]bool{
+	"rpc.describe":              true,
+	"worktree.list":             true,
+	"worktree.switch":           true,
+	"worktree.subscribe":        true,
+	"worktree.unsubscribe":      true,
+	"command.list":              true,
+	"agent.list":                true,
+	"session.search":            true,
+	"settings.subscribe":        true,
+	"settings.unsubscribe":      true,
+	"chat.messages.subscribe":   true,
+	"chat.messages.unsubscribe": true,
+	"chat.queue.list":           true,
+	"session.get_config":        true,
+	"session.export":            true,
+	"session.checkpoints":       true,
+	"session.list.subscribe":    true,
+	"session.list.unsubscribe":  true,
+	"usage.session":             true,
+	"usage.worktree":            true,
+	"usage.daily":               true,
+	"file.get":                  true,
+	"git.status":                true,
+	"git.subscribe":             true,
+	"git.unsubscribe":           true,
+	"git.diff.subscribe":        true,
+	"git.diff.unsubscribe":      true,
+	"git.log":                   true,
+	"git.show":                  true,
+	"git.blame":                 true,
+	"git.discard.list":          true,
+	"git.branch.list":           true,
+	"fs.subscribe":              true,
+	"fs.unsubscribe":            true,
+	"permissions.list":          true,
+	"permissions.timeout.list":  true,
+	"schedule.list":             true,
+	"schedule.runs":             true,
+	// Push subscriptions only reach the caller's own devices
+	"notify.vapid_key":   true,
+	"notify.subscribe":   true,
+	"notify.unsubscribe": true,
+}
+
+// adminMethods manage the server itself or destroy data beyond a session.
+// Reading the audit trail and tokens is also reserved to admins.
+var adminMethods = map[string]bool{
+	"worktree.delete": true,
+	"settings.update": true,
+	"token.list":      true,
+	"token.create":    true,
+	"token.revoke":    true,
+	"audit.list":      true,
+	"audit.verify":    true,
+	// Webhook URLs often embed secrets
+	"notify.webhook.list":   true,
+	"notify.webhook.add":    true,
+	"notify.webhook.remove": true,
+}
+
+// requiredRole returns the least role allowed to call method.
+// Methods not listed change worktree or session state and need an operator.
+func requiredRole(method string) auth.Role {
+	switch {
+	case viewerMethods[method]:
+		return auth.RoleViewer
+	case adminMethods[method]:
+		return auth.RoleAdmin
+	default:
+		return auth.RoleOperator
+	}
+}
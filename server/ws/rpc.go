@@ -2,9 +2,9 @@ package ws
 
 import (
 	"context"
-	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -13,41 +13,94 @@ import (
 
 	"github.com/coder/websocket"
 	"github.com/google/uuid"
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/audit"
+	"github.com/pockode/server/auth"
 	"github.com/pockode/server/command"
+	"github.com/pockode/server/git"
 	"github.com/pockode/server/logger"
+	"github.com/pockode/server/notify"
+	"github.com/pockode/server/policy"
 	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/schedule"
+	"github.com/pockode/server/search"
 	"github.com/pockode/server/settings"
 	"github.com/pockode/server/watch"
 	"github.com/pockode/server/worktree"
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+// maxMessageSize bounds a single incoming WebSocket message once the
+// connection is authenticated. Until then only maxAuthMessageSize is read,
+// so unauthenticated clients cannot make the server buffer large messages.
+const (
+	maxMessageSize     = 64 << 20
+	maxAuthMessageSize = 64 << 10
+)
+
+// readLimiter is implemented by streams whose incoming message size is
+// raised after auth.
+type readLimiter interface {
+	SetReadLimit(n int64)
+}
+
 // RPCHandler handles JSON-RPC 2.0 over WebSocket.
 type RPCHandler struct {
-	token           string
+	users           *auth.Store
 	version         string
 	devMode         bool
 	commandStore    *command.Store
 	worktreeManager *worktree.Manager
 	settingsStore   *settings.Store
 	settingsWatcher *watch.SettingsWatcher
+	agents          *agent.Registry
+	searchIndex     *search.Index
+	auditLog        *audit.Log
+	policyStore     *policy.Store
+	notifier        *notify.Service
+	scheduler       *schedule.Scheduler
+
+	tokenConnsMu sync.Mutex
+	tokenConns   map[string]map[*jsonrpc2.Conn]struct{} // live connections per issued token
 }
 
-func NewRPCHandler(token, version string, devMode bool, commandStore *command.Store, worktreeManager *worktree.Manager, settingsStore *settings.Store) *RPCHandler {
+func NewRPCHandler(users *auth.Store, version string, devMode bool, commandStore *command.Store, worktreeManager *worktree.Manager, settingsStore *settings.Store, agents *agent.Registry, searchIndex *search.Index) *RPCHandler {
 	settingsWatcher := watch.NewSettingsWatcher(settingsStore)
 	settingsWatcher.Start()
 
 	return &RPCHandler{
-		token:           token,
+		users:           users,
 		version:         version,
 		devMode:         devMode,
 		commandStore:    commandStore,
 		worktreeManager: worktreeManager,
 		settingsStore:   settingsStore,
 		settingsWatcher: settingsWatcher,
+		agents:          agents,
+		searchIndex:     searchIndex,
 	}
 }
 
+// SetAuditLog enables recording of every non-viewer method call.
+func (h *RPCHandler) SetAuditLog(l *audit.Log) {
+	h.auditLog = l
+}
+
+// SetPolicyStore enables the permissions.* methods.
+func (h *RPCHandler) SetPolicyStore(store *policy.Store) {
+	h.policyStore = store
+}
+
+// SetNotifier enables the notify.* methods.
+func (h *RPCHandler) SetNotifier(service *notify.Service) {
+	h.notifier = service
+}
+
+// SetScheduler enables the schedule.* methods.
+func (h *RPCHandler) SetScheduler(s *schedule.Scheduler) {
+	h.scheduler = s
+}
+
 // Stop stops the RPC handler and releases resources.
 func (h *RPCHandler) Stop() {
 	h.settingsWatcher.Stop()
@@ -61,6 +114,8 @@ func (h *RPCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		slog.Error("failed to accept websocket", "error", err)
 		return
 	}
+	// Raised to maxMessageSize after auth for attachments and session bundles
+	conn.SetReadLimit(maxAuthMessageSize)
 
 	h.handleConnection(r.Context(), conn)
 }
@@ -88,10 +143,13 @@ func (h *RPCHandler) HandleStream(ctx context.Context, stream jsonrpc2.ObjectStr
 	}
 
 	handler := &rpcMethodHandler{
-		RPCHandler:    h,
-		state:         state,
-		log:           log,
-		authenticated: false,
+		RPCHandler: h,
+		state:      state,
+		log:        log,
+	}
+
+	if limiter, ok := stream.(readLimiter); ok {
+		state.limiter = limiter
 	}
 
 	rpcConn := jsonrpc2.NewConn(ctx, stream, jsonrpc2.AsyncHandler(handler))
@@ -99,6 +157,9 @@ func (h *RPCHandler) HandleStream(ctx context.Context, stream jsonrpc2.ObjectStr
 
 	<-rpcConn.DisconnectNotify()
 
+	if identity, _, ok := state.getIdentity(); ok {
+		h.untrackTokenConn(identity.TokenID, rpcConn)
+	}
 	state.cleanup(h.worktreeManager, h.settingsWatcher)
 	log.Info("connection closed")
 }
@@ -109,7 +170,19 @@ type rpcConnState struct {
 	connID   string
 	conn     *jsonrpc2.Conn
 	log      *slog.Logger
+	identity *auth.Identity     // set after auth
 	worktree *worktree.Worktree // set after auth
+	limiter  readLimiter        // nil for streams without a read limit
+}
+
+// getIdentity returns the authenticated user and a logger tagged with it.
+func (s *rpcConnState) getIdentity() (auth.Identity, *slog.Logger, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.identity == nil {
+		return auth.Identity{}, s.log, false
+	}
+	return *s.identity, s.log, true
 }
 
 func (s *rpcConnState) getConnID() string {
@@ -149,10 +222,9 @@ func (s *rpcConnState) cleanup(worktreeManager *worktree.Manager, settingsWatche
 
 type rpcMethodHandler struct {
 	*RPCHandler
-	state         *rpcConnState
-	log           *slog.Logger
-	authenticated bool
-	authMu        sync.Mutex
+	state    *rpcConnState
+	log      *slog.Logger
+	identity auth.Identity // zero until authenticated
 }
 
 func (h *rpcMethodHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
@@ -162,10 +234,11 @@ func (h *rpcMethodHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req
 		}
 	}()
 
-	h.log.Debug("received request", "method", req.Method, "id", req.ID)
+	identity, log, authenticated := h.state.getIdentity()
+	log.Debug("received request", "method", req.Method, "id", req.ID)
 
 	// Auth must be the first request
-	if !h.isAuthenticated() {
+	if !authenticated {
 		if req.Method != "auth" {
 			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest, "first request must be auth")
 			conn.Close()
@@ -175,8 +248,28 @@ func (h *rpcMethodHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req
 		return
 	}
 
+	// Requests run concurrently, so each gets its own handler bound to the caller
+	rh := &rpcMethodHandler{RPCHandler: h.RPCHandler, state: h.state, log: log, identity: identity}
+	rh.dispatch(ctx, conn, req)
+}
+
+func (h *rpcMethodHandler) dispatch(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	required := requiredRole(req.Method)
+	allowed := h.identity.Role.Allows(required)
+	if isAudited(req.Method) {
+		h.recordAudit(req, !allowed)
+	}
+	if !allowed {
+		h.log.Warn("permission denied", "method", req.Method, "role", h.identity.Role)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest, "permission denied: "+req.Method+" requires "+string(required)+" role")
+		return
+	}
+
 	// Methods that don't require worktree (manager-level operations)
 	switch req.Method {
+	case "rpc.describe":
+		h.handleDescribe(ctx, conn, req)
+		return
 	case "worktree.list":
 		h.handleWorktreeList(ctx, conn, req)
 		return
@@ -198,6 +291,12 @@ func (h *rpcMethodHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req
 	case "command.list":
 		h.handleCommandList(ctx, conn, req)
 		return
+	case "agent.list":
+		h.handleAgentList(ctx, conn, req)
+		return
+	case "session.search":
+		h.handleSessionSearch(ctx, conn, req)
+		return
 	case "settings.subscribe":
 		h.handleSettingsSubscribe(ctx, conn, req)
 		return
@@ -207,6 +306,75 @@ func (h *rpcMethodHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req
 	case "settings.update":
 		h.handleSettingsUpdate(ctx, conn, req)
 		return
+	case "token.list":
+		h.handleTokenList(ctx, conn, req)
+		return
+	case "token.create":
+		h.handleTokenCreate(ctx, conn, req)
+		return
+	case "token.revoke":
+		h.handleTokenRevoke(ctx, conn, req)
+		return
+	case "permissions.list":
+		h.handlePermissionsList(ctx, conn, req)
+		return
+	case "permissions.add":
+		h.handlePermissionsAdd(ctx, conn, req)
+		return
+	case "permissions.remove":
+		h.handlePermissionsRemove(ctx, conn, req)
+		return
+	case "permissions.timeout.list":
+		h.handlePermissionsTimeoutList(ctx, conn, req)
+		return
+	case "permissions.timeout.set":
+		h.handlePermissionsTimeoutSet(ctx, conn, req)
+		return
+	case "permissions.timeout.clear":
+		h.handlePermissionsTimeoutClear(ctx, conn, req)
+		return
+	case "notify.vapid_key":
+		h.handleNotifyVAPIDKey(ctx, conn, req)
+		return
+	case "notify.subscribe":
+		h.handleNotifySubscribe(ctx, conn, req)
+		return
+	case "notify.unsubscribe":
+		h.handleNotifyUnsubscribe(ctx, conn, req)
+		return
+	case "notify.webhook.list":
+		h.handleNotifyWebhookList(ctx, conn, req)
+		return
+	case "notify.webhook.add":
+		h.handleNotifyWebhookAdd(ctx, conn, req)
+		return
+	case "notify.webhook.remove":
+		h.handleNotifyWebhookRemove(ctx, conn, req)
+		return
+	case "schedule.list":
+		h.handleScheduleList(ctx, conn, req)
+		return
+	case "schedule.create":
+		h.handleScheduleCreate(ctx, conn, req)
+		return
+	case "schedule.update":
+		h.handleScheduleUpdate(ctx, conn, req)
+		return
+	case "schedule.delete":
+		h.handleScheduleDelete(ctx, conn, req)
+		return
+	case "schedule.run":
+		h.handleScheduleRun(ctx, conn, req)
+		return
+	case "schedule.runs":
+		h.handleScheduleRuns(ctx, conn, req)
+		return
+	case "audit.list":
+		h.handleAuditList(ctx, conn, req)
+		return
+	case "audit.verify":
+		h.handleAuditVerify(ctx, conn, req)
+		return
 	}
 
 	// All other methods require a valid worktree
@@ -227,6 +395,14 @@ func (h *rpcMethodHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req
 		h.handleMessage(ctx, conn, req, wt)
 	case "chat.interrupt":
 		h.handleInterrupt(ctx, conn, req, wt)
+	case "chat.queue.list":
+		h.handleChatQueueList(ctx, conn, req, wt)
+	case "chat.queue.update":
+		h.handleChatQueueUpdate(ctx, conn, req, wt)
+	case "chat.queue.cancel":
+		h.handleChatQueueCancel(ctx, conn, req, wt)
+	case "chat.queue.resume":
+		h.handleChatQueueResume(ctx, conn, req, wt)
 	case "chat.permission_response":
 		h.handlePermissionResponse(ctx, conn, req, wt)
 	case "chat.question_response":
@@ -240,10 +416,37 @@ func (h *rpcMethodHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req
 		h.handleSessionUpdateTitle(ctx, conn, req, wt)
 	case "session.set_mode":
 		h.handleSessionSetMode(ctx, conn, req, wt)
+	case "session.set_agent":
+		h.handleSessionSetAgent(ctx, conn, req, wt)
+	case "session.set_muted":
+		h.handleSessionSetMuted(ctx, conn, req, wt)
+	case "session.get_config":
+		h.handleSessionGetConfig(ctx, conn, req, wt)
+	case "session.set_config":
+		h.handleSessionSetConfig(ctx, conn, req, wt)
+	case "session.fork":
+		h.handleSessionFork(ctx, conn, req, wt)
+	case "session.export":
+		h.handleSessionExport(ctx, conn, req, wt)
+	case "session.import":
+		h.handleSessionImport(ctx, conn, req, wt)
+	case "session.approve_plan":
+		h.handleSessionApprovePlan(ctx, conn, req, wt)
+	case "session.checkpoints":
+		h.handleSessionCheckpoints(ctx, conn, req, wt)
+	case "session.rollback":
+		h.handleSessionRollback(ctx, conn, req, wt)
 	case "session.list.subscribe":
 		h.handleSessionListSubscribe(ctx, conn, req, wt)
 	case "session.list.unsubscribe":
 		h.handleWatcherUnsubscribe(ctx, conn, req, wt.SessionListWatcher, "session list")
+	// usage namespace
+	case "usage.session":
+		h.handleUsageSession(ctx, conn, req, wt)
+	case "usage.worktree":
+		h.handleUsageWorktree(ctx, conn, req, wt)
+	case "usage.daily":
+		h.handleUsageDaily(ctx, conn, req, wt)
 	// file namespace
 	case "file.get":
 		h.handleFileGet(ctx, conn, req, wt)
@@ -264,6 +467,40 @@ func (h *rpcMethodHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req
 		h.handleGitAdd(ctx, conn, req, wt)
 	case "git.reset":
 		h.handleGitReset(ctx, conn, req, wt)
+	case "git.hunk.stage":
+		h.handleGitHunks(ctx, conn, req, wt, git.StageHunks, "stage")
+	case "git.hunk.unstage":
+		h.handleGitHunks(ctx, conn, req, wt, git.UnstageHunks, "unstage")
+	case "git.hunk.discard":
+		h.handleGitHunkDiscard(ctx, conn, req, wt)
+	case "git.discard":
+		h.handleGitDiscard(ctx, conn, req, wt)
+	case "git.discard.restore":
+		h.handleGitDiscardRestore(ctx, conn, req, wt)
+	case "git.discard.list":
+		h.handleGitDiscardList(ctx, conn, req, wt)
+	case "git.commit":
+		h.handleGitCommit(ctx, conn, req, wt)
+	case "git.log":
+		h.handleGitLog(ctx, conn, req, wt)
+	case "git.show":
+		h.handleGitShow(ctx, conn, req, wt)
+	case "git.blame":
+		h.handleGitBlame(ctx, conn, req, wt)
+	case "git.branch.list":
+		h.handleGitBranchList(ctx, conn, req, wt)
+	case "git.branch.create":
+		h.handleGitBranchCreate(ctx, conn, req, wt)
+	case "git.branch.checkout":
+		h.handleGitBranchCheckout(ctx, conn, req, wt)
+	case "git.branch.delete":
+		h.handleGitBranchDelete(ctx, conn, req, wt)
+	case "git.fetch":
+		h.handleGitFetch(ctx, conn, req, wt)
+	case "git.pull":
+		h.handleGitPull(ctx, conn, req, wt)
+	case "git.push":
+		h.handleGitPush(ctx, conn, req, wt)
 	// fs namespace
 	case "fs.subscribe":
 		h.handleFSSubscribe(ctx, conn, req, wt)
@@ -274,18 +511,6 @@ func (h *rpcMethodHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req
 	}
 }
 
-func (h *rpcMethodHandler) isAuthenticated() bool {
-	h.authMu.Lock()
-	defer h.authMu.Unlock()
-	return h.authenticated
-}
-
-func (h *rpcMethodHandler) setAuthenticated() {
-	h.authMu.Lock()
-	h.authenticated = true
-	h.authMu.Unlock()
-}
-
 func (h *rpcMethodHandler) handleAuth(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
 	var params rpc.AuthParams
 	if err := unmarshalParams(req, &params); err != nil {
@@ -294,7 +519,17 @@ func (h *rpcMethodHandler) handleAuth(ctx context.Context, conn *jsonrpc2.Conn,
 		return
 	}
 
-	if subtle.ConstantTimeCompare([]byte(params.Token), []byte(h.token)) != 1 {
+	// Clients predating negotiation send no version and are served as before
+	if params.ProtocolVersion != 0 && params.ProtocolVersion < rpc.MinProtocolVersion {
+		h.log.Warn("unsupported protocol version", "version", params.ProtocolVersion)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest,
+			fmt.Sprintf("protocol version %d is no longer supported (server supports %d-%d)", params.ProtocolVersion, rpc.MinProtocolVersion, rpc.ProtocolVersion))
+		conn.Close()
+		return
+	}
+
+	identity, ok := h.users.Authenticate(params.Token)
+	if !ok {
 		h.log.Warn("invalid auth token")
 		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest, "invalid token")
 		conn.Close()
@@ -309,24 +544,46 @@ func (h *rpcMethodHandler) handleAuth(ctx context.Context, conn *jsonrpc2.Conn,
 		return
 	}
 
+	// Revoking a token closes its connections; re-check after tracking so a
+	// revoke that raced with this auth still closes this one
+	h.trackTokenConn(identity.TokenID, conn)
+	if _, ok := h.users.Authenticate(params.Token); !ok {
+		h.untrackTokenConn(identity.TokenID, conn)
+		h.log.Warn("auth token revoked during auth")
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest, "invalid token")
+		conn.Close()
+		return
+	}
+
+	log := h.log.With("user", identity.User)
+
 	h.state.mu.Lock()
 	h.state.worktree = wt
+	h.state.identity = &identity
+	h.state.log = log
+	if h.state.limiter != nil {
+		h.state.limiter.SetReadLimit(maxMessageSize)
+	}
 	h.state.mu.Unlock()
 
 	wt.Subscribe(conn)
 
-	h.setAuthenticated()
-	h.log.Info("authenticated", "worktree", wt.Name, "workDir", wt.WorkDir)
+	log.Info("authenticated", "role", identity.Role, "worktree", wt.Name, "workDir", wt.WorkDir)
 
 	title := filepath.Base(h.worktreeManager.Registry().MainDir())
 	result := rpc.AuthResult{
-		Version:      h.version,
-		Title:        title,
-		WorkDir:      wt.WorkDir,
-		WorktreeName: wt.Name,
+		Version:            h.version,
+		ProtocolVersion:    rpc.ProtocolVersion,
+		MinProtocolVersion: rpc.MinProtocolVersion,
+		Capabilities:       h.capabilities(),
+		Title:              title,
+		WorkDir:            wt.WorkDir,
+		WorktreeName:       wt.Name,
+		User:               identity.User,
+		Role:               identity.Role,
 	}
 	if err := conn.Reply(ctx, req.ID, result); err != nil {
-		h.log.Error("failed to send auth response", "error", err)
+		log.Error("failed to send auth response", "error", err)
 	}
 }
 
@@ -409,6 +666,10 @@ func (s *webSocketStream) WriteObject(v interface{}) error {
 	return s.conn.Write(context.Background(), websocket.MessageText, data)
 }
 
+func (s *webSocketStream) SetReadLimit(n int64) {
+	s.conn.SetReadLimit(n)
+}
+
 func (s *webSocketStream) Close() error {
 	return s.conn.Close(websocket.StatusNormalClosure, "")
 }
@@ -0,0 +1,25 @@
+package ws
+
+import (
+	"context"
+
+	"github.com/pockode/server/rpc"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *rpcMethodHandler) handleAgentList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	defaultName := h.agents.Default()
+	names := h.agents.Names()
+
+	result := rpc.AgentListResult{Agents: make([]rpc.AgentInfo, len(names))}
+	for i, name := range names {
+		result.Agents[i] = rpc.AgentInfo{
+			Name:      name,
+			IsDefault: name == defaultName,
+		}
+	}
+
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send agent list response", "error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package ws
+
+import (
+	"context"
+	"time"
+
+	"github.com/pockode/server/audit"
+	"github.com/pockode/server/rpc"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *rpcMethodHandler) handleAuditList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.AuditListParams
+	if req.Params != nil {
+		if err := unmarshalParams(req, &params); err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+			return
+		}
+	}
+
+	if h.auditLog == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "audit log is not enabled")
+		return
+	}
+
+	query := audit.Query{
+		Actor:     params.Actor,
+		Worktree:  params.Worktree,
+		Method:    params.Method,
+		BeforeSeq: params.BeforeSeq,
+		Limit:     params.Limit,
+	}
+	if params.From != "" {
+		from, err := time.Parse(time.DateOnly, params.From)
+		if err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid date: "+params.From)
+			return
+		}
+		query.Since = from
+	}
+	if params.To != "" {
+		to, err := time.Parse(time.DateOnly, params.To)
+		if err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid date: "+params.To)
+			return
+		}
+		query.Until = to.AddDate(0, 0, 1)
+	}
+
+	entries, err := h.auditLog.List(query)
+	if err != nil {
+		h.log.Error("failed to list audit entries", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to read audit log")
+		return
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.AuditListResult{Entries: entries}); err != nil {
+		h.log.Error("failed to send audit list response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleAuditVerify(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if h.auditLog == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "audit log is not enabled")
+		return
+	}
+
+	result, err := h.auditLog.Verify()
+	if err != nil {
+		h.log.Error("failed to verify audit log", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to verify audit log")
+		return
+	}
+	if !result.OK() {
+		h.log.Warn("audit log verification failed", "brokenSeq", result.BrokenSeq, "reason", result.Reason)
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.AuditVerifyResult{VerifyResult: result, OK: result.OK()}); err != nil {
+		h.log.Error("failed to send audit verify response", "error", err)
+	}
+}
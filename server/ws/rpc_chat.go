@@ -2,11 +2,17 @@ package ws
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
 	"unicode"
 
 	"github.com/pockode/server/agent"
+	"github.com/pockode/server/contents"
 	"github.com/pockode/server/process"
 	"github.com/pockode/server/rpc"
 	"github.com/pockode/server/worktree"
@@ -33,7 +39,7 @@ func (h *rpcMethodHandler) handleChatMessagesSubscribe(ctx context.Context, conn
 		return
 	}
 
-	id, history, err := wt.ChatMessagesWatcher.Subscribe(conn, h.state.connID, params.SessionID)
+	id, history, seq, err := wt.ChatMessagesWatcher.Subscribe(conn, h.state.connID, params.SessionID)
 	if err != nil {
 		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
 		return
@@ -42,15 +48,27 @@ func (h *rpcMethodHandler) handleChatMessagesSubscribe(ctx context.Context, conn
 	result := rpc.ChatMessagesSubscribeResult{
 		ID:      id,
 		History: history,
+		Seq:     seq,
 		State:   wt.ProcessManager.GetProcessState(params.SessionID),
 		Mode:    meta.Mode,
+		Queue:   []process.QueuedMessage{},
+	}
+	// Send only the delta to a client resuming within the history. Records
+	// too large to load are kept as placeholders, so record i has seq i+1
+	if params.AfterSeq > 0 && params.AfterSeq <= result.Seq && params.AfterSeq <= int64(len(history)) {
+		result.AfterSeq = params.AfterSeq
+		result.History = history[params.AfterSeq:]
+	}
+	if proc := wt.ProcessManager.GetProcess(params.SessionID); proc != nil {
+		result.Queue = proc.Queue()
+		result.QueuePaused = proc.QueuePaused()
 	}
 	if err := conn.Reply(ctx, req.ID, result); err != nil {
 		log.Error("failed to send subscribe response", "error", err)
 		return
 	}
 
-	log.Info("subscribed to chat messages", "subscriptionId", id, "state", result.State, "mode", meta.Mode)
+	log.Info("subscribed to chat messages", "subscriptionId", id, "state", result.State, "mode", meta.Mode, "afterSeq", result.AfterSeq)
 }
 
 func (h *rpcMethodHandler) handleMessage(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
@@ -62,6 +80,12 @@ func (h *rpcMethodHandler) handleMessage(ctx context.Context, conn *jsonrpc2.Con
 
 	log := h.log.With("sessionId", params.SessionID)
 
+	attachments, err := resolveAttachments(wt.WorkDir, params.Attachments)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+
 	proc, err := h.getOrCreateProcess(ctx, log, wt, params.SessionID)
 	if err != nil {
 		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
@@ -70,21 +94,102 @@ func (h *rpcMethodHandler) handleMessage(ctx context.Context, conn *jsonrpc2.Con
 
 	h.recordCommandIfSlash(params.Content)
 
-	log.Info("received prompt", "length", len(params.Content))
+	log.Info("received prompt", "length", len(params.Content), "attachments", len(attachments))
 
-	// Persist user message to history
-	event := agent.MessageEvent{Content: params.Content}
-	if err := wt.SessionStore.AppendToHistory(ctx, params.SessionID, agent.NewEventRecord(event)); err != nil {
-		log.Error("failed to append to history", "error", err)
+	// Sent now, or queued until the running turn ends; history is written on delivery
+	msg, queued, err := proc.Submit(ctx, h.identity.User, params.Content, attachments)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
+		return
 	}
 
-	if err := proc.SendMessage(params.Content); err != nil {
-		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
+	result := rpc.MessageResult{}
+	if queued {
+		result.QueueID = msg.ID
+		log.Info("message queued", "queueId", msg.ID)
+	}
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		log.Error("failed to send message response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleChatQueueList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.ChatQueueListParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	result := rpc.ChatQueueListResult{Queue: []process.QueuedMessage{}}
+	if proc := wt.ProcessManager.GetProcess(params.SessionID); proc != nil {
+		result.Queue = proc.Queue()
+		result.Paused = proc.QueuePaused()
+	}
+
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send queue list response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleChatQueueUpdate(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.ChatQueueUpdateParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	err := process.ErrQueuedMessageNotFound
+	if proc := wt.ProcessManager.GetProcess(params.SessionID); proc != nil {
+		err = proc.UpdateQueued(params.ID, params.Content)
+	}
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
 		return
 	}
 
 	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
-		log.Error("failed to send message response", "error", err)
+		h.log.Error("failed to send queue update response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleChatQueueCancel(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.ChatQueueCancelParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	err := process.ErrQueuedMessageNotFound
+	if proc := wt.ProcessManager.GetProcess(params.SessionID); proc != nil {
+		err = proc.CancelQueued(params.ID)
+	}
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+
+	h.log.Info("queued message cancelled", "sessionId", params.SessionID, "queueId", params.ID)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send queue cancel response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleChatQueueResume(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.ChatQueueResumeParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if proc := wt.ProcessManager.GetProcess(params.SessionID); proc != nil {
+		proc.ResumeQueue(ctx)
+	}
+
+	h.log.Info("queue resumed", "sessionId", params.SessionID)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send queue resume response", "error", err)
 	}
 }
 
@@ -138,13 +243,17 @@ func (h *rpcMethodHandler) handlePermissionResponse(ctx context.Context, conn *j
 	}
 	choice := parsePermissionChoice(params.Choice)
 	if err := proc.SendPermissionResponse(data, choice); err != nil {
+		if errors.Is(err, process.ErrPermissionTimedOut) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest, err.Error())
+			return
+		}
 		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
 		return
 	}
 
 	// Persist permission response to history
-	permEvent := agent.PermissionResponseEvent{RequestID: params.RequestID, Choice: params.Choice}
-	if err := wt.SessionStore.AppendToHistory(ctx, params.SessionID, agent.NewEventRecord(permEvent)); err != nil {
+	permEvent := agent.PermissionResponseEvent{RequestID: params.RequestID, Choice: params.Choice, User: h.identity.User}
+	if _, err := wt.SessionStore.AppendToHistory(ctx, params.SessionID, agent.NewEventRecord(permEvent)); err != nil {
 		log.Error("failed to append to history", "error", err)
 	}
 
@@ -180,8 +289,8 @@ func (h *rpcMethodHandler) handleQuestionResponse(ctx context.Context, conn *jso
 	}
 
 	// Persist question response to history
-	qEvent := agent.QuestionResponseEvent{RequestID: params.RequestID, Answers: params.Answers}
-	if err := wt.SessionStore.AppendToHistory(ctx, params.SessionID, agent.NewEventRecord(qEvent)); err != nil {
+	qEvent := agent.QuestionResponseEvent{RequestID: params.RequestID, Answers: params.Answers, User: h.identity.User}
+	if _, err := wt.SessionStore.AppendToHistory(ctx, params.SessionID, agent.NewEventRecord(qEvent)); err != nil {
 		log.Error("failed to append to history", "error", err)
 	}
 
@@ -236,7 +345,7 @@ func (h *rpcMethodHandler) getOrCreateProcess(ctx context.Context, log *slog.Log
 	}
 
 	resume := meta.Activated
-	proc, created, err := wt.ProcessManager.GetOrCreateProcess(ctx, sessionID, resume, meta.Mode)
+	proc, created, err := wt.ProcessManager.GetOrCreateProcess(ctx, meta, resume)
 	if err != nil {
 		return nil, err
 	}
@@ -254,3 +363,100 @@ func (h *rpcMethodHandler) getOrCreateProcess(ctx context.Context, log *slog.Log
 
 	return proc, nil
 }
+
+const (
+	maxAttachments    = 10
+	maxAttachmentSize = 5 << 20 // decoded bytes, matching the API image limit
+)
+
+// resolveAttachments validates client attachments and loads worktree file
+// references, so every returned attachment carries MediaType and base64 Data.
+// Errors are user-facing and safe to return as invalid params.
+func resolveAttachments(workDir string, in []agent.Attachment) ([]agent.Attachment, error) {
+	if len(in) > maxAttachments {
+		return nil, fmt.Errorf("too many attachments (max %d)", maxAttachments)
+	}
+
+	out := make([]agent.Attachment, 0, len(in))
+	for i, a := range in {
+		var (
+			resolved agent.Attachment
+			err      error
+		)
+		switch a.Type {
+		case agent.AttachmentImage:
+			resolved, err = resolveImageAttachment(a)
+		case agent.AttachmentFile:
+			resolved, err = resolveFileAttachment(workDir, a)
+		default:
+			err = fmt.Errorf("unknown type %q", a.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("attachment %d: %w", i, err)
+		}
+		out = append(out, resolved)
+	}
+	return out, nil
+}
+
+func resolveImageAttachment(a agent.Attachment) (agent.Attachment, error) {
+	if !agent.IsImageMediaType(a.MediaType) {
+		return agent.Attachment{}, fmt.Errorf("unsupported image type %q", a.MediaType)
+	}
+	data, err := base64.StdEncoding.DecodeString(a.Data)
+	if err != nil {
+		return agent.Attachment{}, errors.New("invalid base64 data")
+	}
+	if len(data) == 0 {
+		return agent.Attachment{}, errors.New("empty image")
+	}
+	if len(data) > maxAttachmentSize {
+		return agent.Attachment{}, fmt.Errorf("image exceeds %d bytes", maxAttachmentSize)
+	}
+	return agent.Attachment{Type: a.Type, Name: a.Name, MediaType: a.MediaType, Data: a.Data}, nil
+}
+
+func resolveFileAttachment(workDir string, a agent.Attachment) (agent.Attachment, error) {
+	if a.Path == "" {
+		return agent.Attachment{}, errors.New("path is required")
+	}
+	if err := contents.ValidatePath(workDir, a.Path); err != nil {
+		return agent.Attachment{}, errors.New("invalid path")
+	}
+	info, err := os.Stat(filepath.Join(workDir, a.Path))
+	if err != nil {
+		return agent.Attachment{}, fmt.Errorf("file not found: %s", a.Path)
+	}
+	if info.IsDir() {
+		return agent.Attachment{}, fmt.Errorf("not a file: %s", a.Path)
+	}
+	if info.Size() > maxAttachmentSize {
+		return agent.Attachment{}, fmt.Errorf("file exceeds %d bytes: %s", maxAttachmentSize, a.Path)
+	}
+
+	result, err := contents.GetContents(workDir, a.Path)
+	if err != nil {
+		return agent.Attachment{}, fmt.Errorf("failed to read %s", a.Path)
+	}
+	file := result.File
+
+	data := file.Content
+	if file.Encoding == contents.EncodingText {
+		data = base64.StdEncoding.EncodeToString([]byte(file.Content))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(a.Path)))
+	switch {
+	case agent.IsImageMediaType(mediaType), mediaType == "application/pdf":
+	case file.Encoding == contents.EncodingText:
+		mediaType = "text/plain"
+	default:
+		return agent.Attachment{}, fmt.Errorf("unsupported file type: %s", a.Path)
+	}
+
+	name := a.Name
+	if name == "" {
+		name = file.Path
+	}
+	return agent.Attachment{Type: a.Type, Name: name, Path: file.Path, MediaType: mediaType, Data: data}, nil
+}
@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/git"
+	"github.com/pockode/server/process"
+	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/worktree"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *rpcMethodHandler) handleSessionCheckpoints(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionCheckpointsParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+	if !h.checkpointSessionExists(ctx, conn, req.ID, wt, params.SessionID) {
+		return
+	}
+
+	checkpoints, err := git.Checkpoints(ctx, wt.WorkDir, params.SessionID)
+	if errors.Is(err, git.ErrNotRepository) {
+		checkpoints = nil
+	} else if err != nil {
+		h.log.Error("failed to list checkpoints", "sessionId", params.SessionID, "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to list checkpoints")
+		return
+	}
+
+	history, err := wt.SessionStore.GetHistory(ctx, params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to get history")
+		return
+	}
+
+	// Link each checkpoint to the first message whose turn it precedes; an
+	// unchanged worktree reuses the previous turn's checkpoint
+	messages := make(map[string]agent.EventRecord)
+	seqs := make(map[string]int64)
+	for i, raw := range history {
+		var record agent.EventRecord
+		if err := json.Unmarshal(raw, &record); err != nil || record.Checkpoint == "" {
+			continue
+		}
+		if _, ok := seqs[record.Checkpoint]; !ok {
+			messages[record.Checkpoint] = record
+			seqs[record.Checkpoint] = int64(i + 1) // history is positional; see session.Store
+		}
+	}
+
+	result := rpc.SessionCheckpointsResult{Checkpoints: []rpc.SessionCheckpoint{}}
+	for _, c := range checkpoints {
+		message := messages[c.ID]
+		result.Checkpoints = append(result.Checkpoints, rpc.SessionCheckpoint{
+			Checkpoint: c,
+			Seq:        seqs[c.ID],
+			Message:    message.Content,
+			User:       message.User,
+		})
+	}
+
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send session checkpoints response", "error", err)
+	}
+}
+
+// handleSessionRollback restores the worktree to a checkpoint. The current
+// state is checkpointed first, so the rollback can be rolled back in turn.
+func (h *rpcMethodHandler) handleSessionRollback(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionRollbackParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+	if params.CheckpointID == "" {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "checkpoint_id required")
+		return
+	}
+	if !h.checkpointSessionExists(ctx, conn, req.ID, wt, params.SessionID) {
+		return
+	}
+	// Any session's turn, even one waiting for a permission answer, would go
+	// on to edit the restored files; no turn may start until the rollback ends
+	var backup string
+	err := wt.ProcessManager.WhileIdle(func() error {
+		var err error
+		backup, err = git.RollbackCheckpoint(ctx, wt.WorkDir, params.SessionID, params.CheckpointID)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, process.ErrTurnInProgress):
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest, "a session in this worktree has a turn in progress")
+		case errors.Is(err, git.ErrNotRepository):
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest, "not a git repository")
+		case errors.Is(err, git.ErrCheckpointNotFound):
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "checkpoint not found")
+		default:
+			h.log.Error("failed to roll back session", "sessionId", params.SessionID, "checkpointId", params.CheckpointID, "error", err)
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to roll back")
+		}
+		return
+	}
+
+	h.log.Info("session rolled back", "sessionId", params.SessionID, "checkpointId", params.CheckpointID, "backup", backup)
+
+	if err := conn.Reply(ctx, req.ID, rpc.SessionRollbackResult{Backup: backup}); err != nil {
+		h.log.Error("failed to send session rollback response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) checkpointSessionExists(ctx context.Context, conn *jsonrpc2.Conn, id jsonrpc2.ID, wt *worktree.Worktree, sessionID string) bool {
+	_, found, err := wt.SessionStore.Get(sessionID)
+	if err != nil {
+		h.replyError(ctx, conn, id, jsonrpc2.CodeInternalError, "failed to get session")
+		return false
+	}
+	if !found {
+		h.replyError(ctx, conn, id, jsonrpc2.CodeInvalidParams, "session not found")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package ws
+
+import (
+	"context"
+
+	"github.com/pockode/server/rpc"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// capabilities lists the optional features this handler was set up with.
+func (h *RPCHandler) capabilities() []string {
+	caps := []string{}
+	if h.auditLog != nil {
+		caps = append(caps, rpc.CapabilityAudit)
+	}
+	if h.policyStore != nil {
+		caps = append(caps, rpc.CapabilityPermissions)
+	}
+	if h.notifier != nil {
+		caps = append(caps, rpc.CapabilityNotify)
+	}
+	if h.scheduler != nil {
+		caps = append(caps, rpc.CapabilitySchedule)
+	}
+	return caps
+}
+
+func (h *rpcMethodHandler) handleDescribe(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	doc := rpc.Describe(h.version, h.capabilities())
+	for i := range doc.Methods {
+		if doc.Methods[i].Name != "auth" {
+			doc.Methods[i].Role = string(requiredRole(doc.Methods[i].Name))
+		}
+	}
+
+	if err := conn.Reply(ctx, req.ID, doc); err != nil {
+		h.log.Error("failed to send describe response", "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pockode/server/export"
+	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/session"
+	"github.com/pockode/server/worktree"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *rpcMethodHandler) handleSessionExport(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionExportParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	format := export.Format(params.Format)
+	if format == "" {
+		format = export.FormatMarkdown
+	}
+	if !format.IsValid() {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid format")
+		return
+	}
+
+	meta, found, err := wt.SessionStore.Get(params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to get session")
+		return
+	}
+	if !found {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "session not found")
+		return
+	}
+
+	history, err := wt.SessionStore.GetHistory(ctx, params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to get history")
+		return
+	}
+
+	content, err := export.Render(format, meta, history, time.Now())
+	if err != nil {
+		h.log.Error("failed to render export", "sessionId", params.SessionID, "format", format, "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to export session")
+		return
+	}
+
+	result := rpc.SessionExportResult{
+		Filename:    export.FileName(meta, format),
+		ContentType: format.ContentType(),
+		Content:     string(content),
+	}
+
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send session export response", "error", err)
+	}
+}
+
+// handleSessionImport creates a new session from an exported bundle. The
+// import starts a fresh agent conversation, sent the imported history as a
+// transcript with its first message. Mode and agent config are not taken
+// from the bundle, which may come from anyone; the session starts in default
+// mode without overrides.
+func (h *rpcMethodHandler) handleSessionImport(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionImportParams
+	if err := unmarshalParams(req, &params); err != nil || len(params.Bundle) == 0 {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	bundle, err := export.ParseBundle(params.Bundle)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+
+	meta := session.SessionMeta{
+		ID:                uuid.Must(uuid.NewV7()).String(),
+		Title:             bundle.Session.Title,
+		CreatedAt:         bundle.Session.CreatedAt,
+		Mode:              session.ModeDefault,
+		PendingTranscript: len(bundle.History),
+	}
+	if meta.Title == "" {
+		meta.Title = "Imported Chat"
+	}
+	// An agent that is not configured here falls back to the server default
+	meta.Agent = h.agents.Default()
+	if h.agents.Has(bundle.Session.Agent) {
+		meta.Agent = bundle.Session.Agent
+	}
+
+	sess, err := wt.SessionStore.Import(ctx, meta, bundle.History)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to import session")
+		return
+	}
+
+	h.log.Info("session imported", "sessionId", sess.ID, "from", bundle.Session.ID, "records", len(bundle.History))
+
+	result := rpc.SessionListItem{
+		SessionMeta: sess,
+		State:       wt.ProcessManager.GetProcessState(sess.ID),
+	}
+
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send session import response", "error", err)
+	}
+}
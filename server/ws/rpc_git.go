@@ -63,6 +63,7 @@ func (h *rpcMethodHandler) handleGitDiffSubscribe(ctx context.Context, conn *jso
 		Diff:       result.Diff,
 		OldContent: result.OldContent,
 		NewContent: result.NewContent,
+		Hash:       result.Hash,
 	}
 	if err := conn.Reply(ctx, req.ID, response); err != nil {
 		h.log.Error("failed to send git diff subscribe response", "error", err)
@@ -150,3 +151,437 @@ func (h *rpcMethodHandler) handleGitReset(ctx context.Context, conn *jsonrpc2.Co
 		h.log.Error("failed to send git reset response", "error", err)
 	}
 }
+
+// gitHunksFunc applies selected hunks of a file's diff, like git.StageHunks.
+type gitHunksFunc func(ctx context.Context, dir, path, hash string, sel []git.HunkSelection) error
+
+func (h *rpcMethodHandler) handleGitHunks(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree, apply gitHunksFunc, op string) {
+	params, ok := h.gitHunksParams(ctx, conn, req, wt)
+	if !ok {
+		return
+	}
+
+	if err := apply(ctx, wt.WorkDir, params.Path, params.Hash, params.Hunks); err != nil {
+		h.replyGitHunksError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git hunks applied", "op", op, "path", params.Path, "hunks", len(params.Hunks))
+	if err := conn.Reply(ctx, req.ID, nil); err != nil {
+		h.log.Error("failed to send git hunk response", "op", op, "error", err)
+	}
+}
+
+// handleGitHunkDiscard reverts hunks in the worktree, keeping the file in the
+// trash so git.discard.restore can undo it.
+func (h *rpcMethodHandler) handleGitHunkDiscard(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	params, ok := h.gitHunksParams(ctx, conn, req, wt)
+	if !ok {
+		return
+	}
+
+	entry, err := wt.Trash.DiscardHunks(ctx, wt.WorkDir, params.Path, params.Hash, params.Hunks)
+	if err != nil {
+		if errors.Is(err, git.ErrTooLarge) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.replyGitHunksError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git hunks applied", "op", "discard", "path", params.Path, "hunks", len(params.Hunks), "trashId", entry.ID)
+	if err := conn.Reply(ctx, req.ID, entry); err != nil {
+		h.log.Error("failed to send git hunk response", "op", "discard", "error", err)
+	}
+}
+
+// gitHunksParams reads and checks the params of the git.hunk methods,
+// replying with an error if they are invalid.
+func (h *rpcMethodHandler) gitHunksParams(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) (rpc.GitHunksParams, bool) {
+	var params rpc.GitHunksParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return params, false
+	}
+
+	if params.Path == "" {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "path required")
+		return params, false
+	}
+	if params.Hash == "" {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "hash required")
+		return params, false
+	}
+	if len(params.Hunks) == 0 {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "hunks required")
+		return params, false
+	}
+	return params, h.validGitPath(ctx, conn, req.ID, wt.WorkDir, params.Path)
+}
+
+func (h *rpcMethodHandler) replyGitHunksError(ctx context.Context, conn *jsonrpc2.Conn, id jsonrpc2.ID, err error) {
+	if errors.Is(err, git.ErrInvalidSelection) {
+		h.replyError(ctx, conn, id, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+	h.replyGitError(ctx, conn, id, err)
+}
+
+func (h *rpcMethodHandler) handleGitDiscard(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitDiscardParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if len(params.Paths) == 0 {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "paths required")
+		return
+	}
+	for _, path := range params.Paths {
+		if path == "" {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid path")
+			return
+		}
+		if !h.validGitPath(ctx, conn, req.ID, wt.WorkDir, path) {
+			return
+		}
+	}
+
+	entry, err := wt.Trash.Discard(ctx, wt.WorkDir, params.Paths, params.Staged)
+	if err != nil {
+		if errors.Is(err, git.ErrNoChanges) || errors.Is(err, git.ErrTooLarge) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.replyGitError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git changes discarded", "trashId", entry.ID, "files", len(entry.Paths), "staged", params.Staged)
+	if err := conn.Reply(ctx, req.ID, entry); err != nil {
+		h.log.Error("failed to send git discard response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitDiscardRestore(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitDiscardRestoreParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	entry, err := wt.Trash.Restore(ctx, wt.WorkDir, params.ID)
+	if err != nil {
+		if errors.Is(err, git.ErrTrashNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.replyGitError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git discard restored", "trashId", entry.ID, "files", len(entry.Paths))
+	if err := conn.Reply(ctx, req.ID, entry); err != nil {
+		h.log.Error("failed to send git discard restore response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitDiscardList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	entries, err := wt.Trash.List()
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
+		return
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.GitDiscardListResult{Entries: entries}); err != nil {
+		h.log.Error("failed to send git discard list response", "error", err)
+	}
+}
+
+// replyGitError replies with CodeGitError and the failure's kind for a
+// git.Error, so clients can offer a fix such as pulling before a push.
+func (h *rpcMethodHandler) replyGitError(ctx context.Context, conn *jsonrpc2.Conn, id jsonrpc2.ID, err error) {
+	var gitErr *git.Error
+	if !errors.As(err, &gitErr) {
+		h.replyError(ctx, conn, id, jsonrpc2.CodeInternalError, err.Error())
+		return
+	}
+
+	rpcErr := &jsonrpc2.Error{Code: rpc.CodeGitError, Message: gitErr.Error()}
+	rpcErr.SetError(rpc.GitErrorData{Kind: gitErr.Kind, Files: gitErr.Files, Output: gitErr.Output})
+	if replyErr := conn.ReplyWithError(ctx, id, rpcErr); replyErr != nil {
+		h.log.Error("failed to send error response", "error", replyErr)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitCommit(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitCommitParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if strings.TrimSpace(params.Message) == "" && !params.Amend {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "message required")
+		return
+	}
+
+	hash, err := git.Commit(ctx, wt.WorkDir, git.CommitOptions{
+		Message: params.Message,
+		Amend:   params.Amend,
+		SignOff: params.SignOff,
+	})
+	if err != nil {
+		h.replyGitError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git commit", "hash", hash, "amend", params.Amend)
+	if err := conn.Reply(ctx, req.ID, rpc.GitCommitResult{Hash: hash}); err != nil {
+		h.log.Error("failed to send git commit response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitLog(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitLogParams
+	if req.Params != nil {
+		if err := unmarshalParams(req, &params); err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+			return
+		}
+	}
+
+	if params.Skip < 0 {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid skip")
+		return
+	}
+	if !h.validGitPath(ctx, conn, req.ID, wt.WorkDir, params.Path) {
+		return
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = git.DefaultLogLimit
+	}
+	// One extra commit tells whether another page follows
+	commits, err := git.Log(ctx, wt.WorkDir, git.LogOptions{Limit: limit + 1, Skip: params.Skip, Path: params.Path})
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
+		return
+	}
+
+	result := rpc.GitLogResult{Commits: commits}
+	if len(commits) > limit {
+		result.Commits, result.HasMore = commits[:limit], true
+	}
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send git log response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitShow(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitShowParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if params.Rev == "" {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "rev required")
+		return
+	}
+	if !h.validGitPath(ctx, conn, req.ID, wt.WorkDir, params.Path) {
+		return
+	}
+
+	detail, err := git.Show(ctx, wt.WorkDir, params.Rev, params.Path)
+	if err != nil {
+		if errors.Is(err, git.ErrUnknownRevision) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
+		return
+	}
+
+	if err := conn.Reply(ctx, req.ID, detail); err != nil {
+		h.log.Error("failed to send git show response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitBlame(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitBlameParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if params.Path == "" {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "path required")
+		return
+	}
+	if !h.validGitPath(ctx, conn, req.ID, wt.WorkDir, params.Path) {
+		return
+	}
+
+	blame, err := git.BlameFile(ctx, wt.WorkDir, params.Path, params.Rev)
+	if err != nil {
+		switch {
+		case errors.Is(err, git.ErrUnknownRevision):
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		case strings.Contains(err.Error(), "no such path"), strings.Contains(err.Error(), "cannot stat path"):
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "file not found")
+		default:
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
+		}
+		return
+	}
+
+	if err := conn.Reply(ctx, req.ID, blame); err != nil {
+		h.log.Error("failed to send git blame response", "error", err)
+	}
+}
+
+// validGitPath replies with an error and returns false if path escapes the
+// worktree. An empty path is valid.
+func (h *rpcMethodHandler) validGitPath(ctx context.Context, conn *jsonrpc2.Conn, id jsonrpc2.ID, workDir, path string) bool {
+	if err := contents.ValidatePath(workDir, path); err != nil {
+		if errors.Is(err, contents.ErrInvalidPath) {
+			h.replyError(ctx, conn, id, jsonrpc2.CodeInvalidParams, "invalid path")
+			return false
+		}
+		h.replyError(ctx, conn, id, jsonrpc2.CodeInternalError, err.Error())
+		return false
+	}
+	return true
+}
+
+func (h *rpcMethodHandler) handleGitBranchList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	branches, err := git.Branches(ctx, wt.WorkDir)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
+		return
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.GitBranchListResult{Branches: branches}); err != nil {
+		h.log.Error("failed to send git branch list response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitBranchCreate(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitBranchCreateParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if params.Name == "" {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "name required")
+		return
+	}
+
+	if err := git.CreateBranch(ctx, wt.WorkDir, params.Name, params.StartPoint, params.Checkout); err != nil {
+		if errors.Is(err, git.ErrUnknownRevision) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.replyGitError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git branch created", "branch", params.Name, "checkout", params.Checkout)
+	if err := conn.Reply(ctx, req.ID, nil); err != nil {
+		h.log.Error("failed to send git branch create response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitBranchCheckout(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitBranchCheckoutParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if params.Name == "" {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "name required")
+		return
+	}
+
+	if err := git.Checkout(ctx, wt.WorkDir, params.Name); err != nil {
+		h.replyGitError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git branch checked out", "branch", params.Name)
+	if err := conn.Reply(ctx, req.ID, nil); err != nil {
+		h.log.Error("failed to send git branch checkout response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitBranchDelete(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitBranchDeleteParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if params.Name == "" {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "name required")
+		return
+	}
+
+	if err := git.DeleteBranch(ctx, wt.WorkDir, params.Name, params.Force); err != nil {
+		h.replyGitError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git branch deleted", "branch", params.Name, "force", params.Force)
+	if err := conn.Reply(ctx, req.ID, nil); err != nil {
+		h.log.Error("failed to send git branch delete response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitFetch(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	if err := git.Fetch(ctx, wt.WorkDir); err != nil {
+		h.replyGitError(ctx, conn, req.ID, err)
+		return
+	}
+
+	if err := conn.Reply(ctx, req.ID, nil); err != nil {
+		h.log.Error("failed to send git fetch response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitPull(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	if err := git.Pull(ctx, wt.WorkDir); err != nil {
+		h.replyGitError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git pull")
+	if err := conn.Reply(ctx, req.ID, nil); err != nil {
+		h.log.Error("failed to send git pull response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleGitPush(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.GitPushParams
+	if req.Params != nil {
+		if err := unmarshalParams(req, &params); err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+			return
+		}
+	}
+
+	if err := git.Push(ctx, wt.WorkDir, git.PushOptions{ForceWithLease: params.ForceWithLease}); err != nil {
+		h.replyGitError(ctx, conn, req.ID, err)
+		return
+	}
+
+	h.log.Info("git push", "forceWithLease", params.ForceWithLease)
+	if err := conn.Reply(ctx, req.ID, nil); err != nil {
+		h.log.Error("failed to send git push response", "error", err)
+	}
+}
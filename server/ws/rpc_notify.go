@@ -0,0 +1,182 @@
+package ws
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pockode/server/notify"
+	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/session"
+	"github.com/pockode/server/worktree"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *rpcMethodHandler) handleNotifyVAPIDKey(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if h.notifier == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "notifications are not enabled")
+		return
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.NotifyVAPIDKeyResult{PublicKey: h.notifier.VAPIDPublicKey()}); err != nil {
+		h.log.Error("failed to send vapid key response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleNotifySubscribe(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.NotifySubscribeParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.notifier == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "notifications are not enabled")
+		return
+	}
+
+	sub := notify.PushSubscription{Endpoint: params.Endpoint, Keys: params.Keys}
+	if err := sub.Validate(); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+	if err := h.notifier.Subscribe(h.identity.User, sub); err != nil {
+		h.log.Error("failed to store push subscription", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to subscribe")
+		return
+	}
+
+	h.log.Info("push subscription added")
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send notify subscribe response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleNotifyUnsubscribe(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.NotifyUnsubscribeParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.notifier == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "notifications are not enabled")
+		return
+	}
+
+	if err := h.notifier.Unsubscribe(h.identity.User, params.Endpoint); err != nil {
+		if errors.Is(err, notify.ErrSubscriptionNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.log.Error("failed to remove push subscription", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to unsubscribe")
+		return
+	}
+
+	h.log.Info("push subscription removed")
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send notify unsubscribe response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleNotifyWebhookList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if h.notifier == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "notifications are not enabled")
+		return
+	}
+
+	webhooks := h.notifier.Webhooks()
+	if webhooks == nil {
+		webhooks = []notify.Webhook{}
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.NotifyWebhookListResult{Webhooks: webhooks}); err != nil {
+		h.log.Error("failed to send webhook list response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleNotifyWebhookAdd(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.NotifyWebhookAddParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.notifier == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "notifications are not enabled")
+		return
+	}
+
+	hook := notify.Webhook{URL: params.URL, Topic: params.Topic, CreatedBy: h.identity.User}
+	if err := hook.Validate(); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+
+	hook, err := h.notifier.AddWebhook(hook)
+	if err != nil {
+		h.log.Error("failed to add webhook", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to add webhook")
+		return
+	}
+
+	h.log.Info("webhook added", "webhookId", hook.ID)
+
+	if err := conn.Reply(ctx, req.ID, hook); err != nil {
+		h.log.Error("failed to send webhook add response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleNotifyWebhookRemove(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.NotifyWebhookRemoveParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.notifier == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "notifications are not enabled")
+		return
+	}
+
+	if err := h.notifier.RemoveWebhook(params.ID); err != nil {
+		if errors.Is(err, notify.ErrWebhookNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.log.Error("failed to remove webhook", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to remove webhook")
+		return
+	}
+
+	h.log.Info("webhook removed", "webhookId", params.ID)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send webhook remove response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleSessionSetMuted(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionSetMutedParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if err := wt.SessionStore.SetMuted(ctx, params.SessionID, params.Muted); err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "session not found")
+			return
+		}
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to set muted")
+		return
+	}
+
+	h.log.Info("session notifications changed", "sessionId", params.SessionID, "muted", params.Muted)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send session set muted response", "error", err)
+	}
+}
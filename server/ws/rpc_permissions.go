@@ -0,0 +1,196 @@
+package ws
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pockode/server/policy"
+	"github.com/pockode/server/rpc"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *rpcMethodHandler) handlePermissionsList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.PermissionsListParams
+	if req.Params != nil {
+		if err := unmarshalParams(req, &params); err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+			return
+		}
+	}
+
+	if h.policyStore == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "permission rules are not enabled")
+		return
+	}
+
+	rules := []policy.Rule{}
+	for _, r := range h.policyStore.List() {
+		if params.Scope != "" && r.Scope != params.Scope {
+			continue
+		}
+		if params.Worktree != nil && r.Worktree != *params.Worktree {
+			continue
+		}
+		if params.SessionID != "" && r.SessionID != params.SessionID {
+			continue
+		}
+		rules = append(rules, r)
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.PermissionsListResult{Rules: rules}); err != nil {
+		h.log.Error("failed to send permissions list response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handlePermissionsAdd(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.PermissionsAddParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.policyStore == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "permission rules are not enabled")
+		return
+	}
+
+	rule := policy.Rule{
+		Action:    params.Action,
+		Tool:      params.Tool,
+		Pattern:   params.Pattern,
+		Scope:     params.Scope,
+		Worktree:  params.Worktree,
+		SessionID: params.SessionID,
+		CreatedBy: h.identity.User,
+	}
+	if err := rule.Validate(); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+
+	rule, err := h.policyStore.Add(rule)
+	if err != nil {
+		h.log.Error("failed to add permission rule", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to add rule")
+		return
+	}
+
+	h.log.Info("permission rule added", "ruleId", rule.ID, "action", rule.Action, "tool", rule.Tool, "pattern", rule.Pattern, "scope", rule.Scope)
+
+	if err := conn.Reply(ctx, req.ID, rule); err != nil {
+		h.log.Error("failed to send permissions add response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handlePermissionsRemove(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.PermissionsRemoveParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.policyStore == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "permission rules are not enabled")
+		return
+	}
+
+	if err := h.policyStore.Remove(params.ID); err != nil {
+		if errors.Is(err, policy.ErrRuleNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.log.Error("failed to remove permission rule", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to remove rule")
+		return
+	}
+
+	h.log.Info("permission rule removed", "ruleId", params.ID)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send permissions remove response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handlePermissionsTimeoutList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if h.policyStore == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "permission rules are not enabled")
+		return
+	}
+
+	timeouts := h.policyStore.Timeouts()
+	if timeouts == nil {
+		timeouts = []policy.Timeout{}
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.PermissionsTimeoutListResult{Timeouts: timeouts}); err != nil {
+		h.log.Error("failed to send permissions timeout list response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handlePermissionsTimeoutSet(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.PermissionsTimeoutSetParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.policyStore == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "permission rules are not enabled")
+		return
+	}
+
+	timeout := policy.Timeout{
+		Scope:     params.Scope,
+		Worktree:  params.Worktree,
+		SessionID: params.SessionID,
+		Seconds:   params.Seconds,
+		Decision:  params.Decision,
+		UpdatedBy: h.identity.User,
+	}
+	if err := timeout.Validate(); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+
+	timeout, err := h.policyStore.SetTimeout(timeout)
+	if err != nil {
+		h.log.Error("failed to set permission timeout", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to set timeout")
+		return
+	}
+
+	h.log.Info("permission timeout set", "scope", timeout.Scope, "seconds", timeout.Seconds, "decision", timeout.Decision)
+
+	if err := conn.Reply(ctx, req.ID, timeout); err != nil {
+		h.log.Error("failed to send permissions timeout set response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handlePermissionsTimeoutClear(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.PermissionsTimeoutClearParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.policyStore == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "permission rules are not enabled")
+		return
+	}
+
+	if err := h.policyStore.ClearTimeout(params.Scope, params.Worktree, params.SessionID); err != nil {
+		if errors.Is(err, policy.ErrTimeoutNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.log.Error("failed to clear permission timeout", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to clear timeout")
+		return
+	}
+
+	h.log.Info("permission timeout cleared", "scope", params.Scope)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send permissions timeout clear response", "error", err)
+	}
+}
@@ -0,0 +1,226 @@
+package ws
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/schedule"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const defaultScheduleRunsLimit = 50
+
+func (h *rpcMethodHandler) handleScheduleList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if h.scheduler == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "schedules are not enabled")
+		return
+	}
+
+	schedules := h.scheduler.Store().List()
+	if schedules == nil {
+		schedules = []schedule.Schedule{}
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.ScheduleListResult{Schedules: schedules}); err != nil {
+		h.log.Error("failed to send schedule list response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleScheduleCreate(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.ScheduleCreateParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.scheduler == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "schedules are not enabled")
+		return
+	}
+
+	if _, err := h.worktreeManager.Registry().Resolve(params.Worktree); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "worktree not found")
+		return
+	}
+
+	sched := schedule.Schedule{
+		Name:      params.Name,
+		Cron:      params.Cron,
+		Worktree:  params.Worktree,
+		SessionID: params.SessionID,
+		Mode:      params.Mode,
+		Prompt:    params.Prompt,
+		Enabled:   params.Enabled == nil || *params.Enabled,
+		CreatedBy: h.identity.User,
+	}
+	if err := sched.Validate(); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+
+	sched, err := h.scheduler.Store().Create(sched)
+	if err != nil {
+		h.log.Error("failed to create schedule", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to create schedule")
+		return
+	}
+
+	h.log.Info("schedule created", "scheduleId", sched.ID, "cron", sched.Cron, "worktree", sched.Worktree)
+
+	if err := conn.Reply(ctx, req.ID, sched); err != nil {
+		h.log.Error("failed to send schedule create response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleScheduleUpdate(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.ScheduleUpdateParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.scheduler == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "schedules are not enabled")
+		return
+	}
+
+	sched, ok := h.scheduler.Store().Get(params.ID)
+	if !ok {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, schedule.ErrScheduleNotFound.Error())
+		return
+	}
+	if params.Name != nil {
+		sched.Name = *params.Name
+	}
+	if params.Cron != nil {
+		sched.Cron = *params.Cron
+	}
+	if params.Worktree != nil {
+		if _, err := h.worktreeManager.Registry().Resolve(*params.Worktree); err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "worktree not found")
+			return
+		}
+		sched.Worktree = *params.Worktree
+	}
+	if params.SessionID != nil {
+		sched.SessionID = *params.SessionID
+	}
+	if params.Mode != nil {
+		sched.Mode = *params.Mode
+	}
+	if params.Prompt != nil {
+		sched.Prompt = *params.Prompt
+	}
+	if params.Enabled != nil {
+		sched.Enabled = *params.Enabled
+	}
+	if err := sched.Validate(); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+
+	sched, err := h.scheduler.Store().Update(sched)
+	if err != nil {
+		if errors.Is(err, schedule.ErrScheduleNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.log.Error("failed to update schedule", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to update schedule")
+		return
+	}
+
+	h.log.Info("schedule updated", "scheduleId", sched.ID, "cron", sched.Cron, "enabled", sched.Enabled)
+
+	if err := conn.Reply(ctx, req.ID, sched); err != nil {
+		h.log.Error("failed to send schedule update response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleScheduleDelete(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.ScheduleDeleteParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.scheduler == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "schedules are not enabled")
+		return
+	}
+
+	if err := h.scheduler.Store().Delete(params.ID); err != nil {
+		if errors.Is(err, schedule.ErrScheduleNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.log.Error("failed to delete schedule", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to delete schedule")
+		return
+	}
+
+	h.log.Info("schedule deleted", "scheduleId", params.ID)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send schedule delete response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleScheduleRun(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.ScheduleRunParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if h.scheduler == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "schedules are not enabled")
+		return
+	}
+
+	run, err := h.scheduler.RunNow(params.ID, h.identity.User)
+	if err != nil {
+		if errors.Is(err, schedule.ErrScheduleNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.log.Error("failed to start schedule run", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to start run")
+		return
+	}
+
+	h.log.Info("schedule run requested", "scheduleId", params.ID, "runId", run.ID, "status", run.Status)
+
+	if err := conn.Reply(ctx, req.ID, run); err != nil {
+		h.log.Error("failed to send schedule run response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleScheduleRuns(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.ScheduleRunsParams
+	if req.Params != nil {
+		if err := unmarshalParams(req, &params); err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+			return
+		}
+	}
+
+	if h.scheduler == nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "schedules are not enabled")
+		return
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultScheduleRunsLimit
+	}
+	runs := h.scheduler.Store().Runs(params.ScheduleID, limit)
+	if runs == nil {
+		runs = []schedule.Run{}
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.ScheduleRunsResult{Runs: runs}); err != nil {
+		h.log.Error("failed to send schedule runs response", "error", err)
+	}
+}
@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/search"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// handleSessionSearch searches session histories across all worktrees.
+// It does not need a bound worktree.
+func (h *rpcMethodHandler) handleSessionSearch(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.SessionSearchParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	query := search.Query{
+		Text:     params.Query,
+		Worktree: params.Worktree,
+		Types:    params.Types,
+		Limit:    params.Limit,
+	}
+	if params.From != "" {
+		from, err := time.Parse(time.DateOnly, params.From)
+		if err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid date: "+params.From)
+			return
+		}
+		query.Since = from
+	}
+	if params.To != "" {
+		to, err := time.Parse(time.DateOnly, params.To)
+		if err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid date: "+params.To)
+			return
+		}
+		query.Until = to.AddDate(0, 0, 1)
+	}
+
+	results, err := h.searchIndex.Search(query)
+	if err != nil {
+		if errors.Is(err, search.ErrEmptyQuery) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "search failed")
+		return
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.SessionSearchResult{Results: results}); err != nil {
+		h.log.Error("failed to send session search response", "error", err)
+	}
+}
@@ -2,9 +2,12 @@ package ws
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 
 	"github.com/google/uuid"
+	"github.com/pockode/server/agent"
+	"github.com/pockode/server/git"
 	"github.com/pockode/server/rpc"
 	"github.com/pockode/server/session"
 	"github.com/pockode/server/worktree"
@@ -12,6 +15,24 @@ import (
 )
 
 func (h *rpcMethodHandler) handleSessionCreate(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	// Params are optional for backward compatibility
+	var params rpc.SessionCreateParams
+	if req.Params != nil {
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+			return
+		}
+	}
+
+	if params.Agent != "" && !h.agents.Has(params.Agent) {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "unknown agent")
+		return
+	}
+	// Record the backend now, so later default changes leave the session on it
+	if params.Agent == "" {
+		params.Agent = h.agents.Default()
+	}
+
 	sessionID := uuid.Must(uuid.NewV7()).String()
 
 	sess, err := wt.SessionStore.Create(ctx, sessionID)
@@ -20,7 +41,15 @@ func (h *rpcMethodHandler) handleSessionCreate(ctx context.Context, conn *jsonrp
 		return
 	}
 
-	h.log.Info("session created", "sessionId", sessionID)
+	if params.Agent != "" {
+		if err := wt.SessionStore.SetAgent(ctx, sessionID, params.Agent); err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to set agent")
+			return
+		}
+		sess.Agent = params.Agent
+	}
+
+	h.log.Info("session created", "sessionId", sessionID, "agent", sess.Agent)
 
 	result := rpc.SessionListItem{
 		SessionMeta: sess,
@@ -44,6 +73,9 @@ func (h *rpcMethodHandler) handleSessionDelete(ctx context.Context, conn *jsonrp
 		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to delete session")
 		return
 	}
+	if err := git.DeleteCheckpoints(ctx, wt.WorkDir, params.SessionID); err != nil && !errors.Is(err, git.ErrNotRepository) {
+		h.log.Warn("failed to delete session checkpoints", "sessionId", params.SessionID, "error", err)
+	}
 
 	h.log.Info("session deleted", "sessionId", params.SessionID)
 
@@ -92,10 +124,7 @@ func (h *rpcMethodHandler) handleSessionSetMode(ctx context.Context, conn *jsonr
 		return
 	}
 
-	// Close any running process for this session (mode change requires restart)
-	wt.ProcessManager.Close(params.SessionID)
-
-	if err := wt.SessionStore.SetMode(ctx, params.SessionID, params.Mode); err != nil {
+	if err := wt.ProcessManager.SetMode(ctx, params.SessionID, params.Mode); err != nil {
 		if errors.Is(err, session.ErrSessionNotFound) {
 			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "session not found")
 			return
@@ -111,6 +140,247 @@ func (h *rpcMethodHandler) handleSessionSetMode(ctx context.Context, conn *jsonr
 	}
 }
 
+// handleSessionFork creates a session from a prefix of another session's history.
+// The agent conversation is branched only when the whole history is forked at a
+// turn boundary; earlier fork points start a fresh conversation that is sent
+// the copied transcript with its first message.
+func (h *rpcMethodHandler) handleSessionFork(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionForkParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	source, found, err := wt.SessionStore.Get(params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to get session")
+		return
+	}
+	if !found {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "session not found")
+		return
+	}
+
+	history, err := wt.SessionStore.GetHistory(ctx, params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to get history")
+		return
+	}
+
+	records := len(history)
+	if params.Index != nil {
+		if *params.Index < 0 || *params.Index >= len(history) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "index out of range")
+			return
+		}
+		records = *params.Index + 1
+	}
+
+	origin := session.ForkOrigin{
+		SessionID: params.SessionID,
+		Records:   records,
+		Resume:    source.Activated && records == len(history) && endsAtTurnBoundary(history),
+	}
+
+	sessionID := uuid.Must(uuid.NewV7()).String()
+	sess, err := wt.SessionStore.Fork(ctx, sessionID, origin)
+	if err != nil {
+		if errors.Is(err, session.ErrInvalidForkPoint) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "index out of range")
+			return
+		}
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to fork session")
+		return
+	}
+
+	h.log.Info("session forked", "sessionId", sessionID, "from", params.SessionID, "records", records, "resume", origin.Resume)
+
+	result := rpc.SessionListItem{
+		SessionMeta: sess,
+		State:       wt.ProcessManager.GetProcessState(sessionID),
+	}
+
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send session fork response", "error", err)
+	}
+}
+
+// endsAtTurnBoundary reports whether the last history record finished a turn
+// or the process, i.e. the agent's conversation holds nothing beyond the
+// recorded history.
+func endsAtTurnBoundary(history []json.RawMessage) bool {
+	if len(history) == 0 {
+		return false
+	}
+	var record agent.EventRecord
+	if err := json.Unmarshal(history[len(history)-1], &record); err != nil {
+		return false
+	}
+	switch record.Type {
+	case agent.EventTypeDone, agent.EventTypeInterrupted, agent.EventTypeProcessEnded:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *rpcMethodHandler) handleSessionSetAgent(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionSetAgentParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if !h.agents.Has(params.Agent) {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "unknown agent")
+		return
+	}
+
+	meta, found, err := wt.SessionStore.Get(params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to get session")
+		return
+	}
+	if !found {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "session not found")
+		return
+	}
+	// A conversation cannot be resumed by a different backend
+	if meta.Activated {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest, "cannot change agent of a started session")
+		return
+	}
+
+	if err := wt.SessionStore.SetAgent(ctx, params.SessionID, params.Agent); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to set agent")
+		return
+	}
+
+	h.log.Info("session agent changed", "sessionId", params.SessionID, "agent", params.Agent)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send session set agent response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleSessionGetConfig(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionGetConfigParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	meta, found, err := wt.SessionStore.Get(params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to get session")
+		return
+	}
+	if !found {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "session not found")
+		return
+	}
+
+	if err := conn.Reply(ctx, req.ID, meta.Config); err != nil {
+		h.log.Error("failed to send session get config response", "error", err)
+	}
+}
+
+// handleSessionSetConfig replaces the session's agent config.
+// A running process is restarted so the next message picks up the new flags.
+func (h *rpcMethodHandler) handleSessionSetConfig(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionSetConfigParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if err := params.Config.Validate(); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+		return
+	}
+
+	if err := wt.ProcessManager.SetConfig(ctx, params.SessionID, params.Config); err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "session not found")
+			return
+		}
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to set config")
+		return
+	}
+
+	h.log.Info("session config changed", "sessionId", params.SessionID, "model", params.Config.Model)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send session set config response", "error", err)
+	}
+}
+
+// planApprovedPrompt is sent after leaving plan mode so the agent starts implementing.
+const planApprovedPrompt = "The plan has been approved. Proceed with the implementation."
+
+func (h *rpcMethodHandler) handleSessionApprovePlan(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.SessionApprovePlanParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if params.Mode == "" {
+		params.Mode = session.ModeDefault
+	}
+	if params.Mode != session.ModeDefault && params.Mode != session.ModeYolo {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid mode")
+		return
+	}
+
+	log := h.log.With("sessionId", params.SessionID)
+
+	meta, found, err := wt.SessionStore.Get(params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to get session")
+		return
+	}
+	if !found {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "session not found")
+		return
+	}
+	if meta.Mode != session.ModePlan {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidRequest, "session is not in plan mode")
+		return
+	}
+
+	if err := wt.ProcessManager.SetMode(ctx, params.SessionID, params.Mode); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to set mode")
+		return
+	}
+
+	// The plan-mode process was closed above, so the pending ExitPlanMode request
+	// is never answered directly; record it as allowed to resolve it in history.
+	if params.RequestID != "" {
+		permEvent := agent.PermissionResponseEvent{RequestID: params.RequestID, Choice: "allow", User: h.identity.User}
+		if _, err := wt.SessionStore.AppendToHistory(ctx, params.SessionID, agent.NewEventRecord(permEvent)); err != nil {
+			log.Error("failed to append to history", "error", err)
+		}
+	}
+
+	proc, err := h.getOrCreateProcess(ctx, log, wt, params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
+		return
+	}
+
+	if _, _, err := proc.Submit(ctx, h.identity.User, planApprovedPrompt, nil); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, err.Error())
+		return
+	}
+
+	log.Info("plan approved", "mode", params.Mode)
+
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		log.Error("failed to send approve plan response", "error", err)
+	}
+}
+
 func (h *rpcMethodHandler) handleSessionListSubscribe(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
 	connID := h.state.getConnID()
 	id, sessions, err := wt.SessionListWatcher.Subscribe(conn, connID)
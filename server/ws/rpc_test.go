@@ -2,20 +2,35 @@ package ws
 
 import (
 	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/coder/websocket"
 	"github.com/pockode/server/agent"
+	"github.com/pockode/server/audit"
+	"github.com/pockode/server/auth"
 	"github.com/pockode/server/command"
+	"github.com/pockode/server/git"
+	"github.com/pockode/server/notify"
+	"github.com/pockode/server/policy"
+	"github.com/pockode/server/process"
 	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/schedule"
+	"github.com/pockode/server/search"
 	"github.com/pockode/server/session"
 	"github.com/pockode/server/settings"
 	"github.com/pockode/server/worktree"
@@ -50,10 +65,56 @@ func newTestEnvWithWorkDir(t *testing.T, mock *mockAgent, workDir string) *testE
 		t.Fatalf("failed to create settings store: %v", err)
 	}
 
+	agents := agent.NewRegistry()
+	agents.Register("mock", mock)
+	agents.Register("alt", mock)
+
+	searchIndex, err := search.Open(dataDir)
+	if err != nil {
+		t.Fatalf("failed to open search index: %v", err)
+	}
+	t.Cleanup(func() { searchIndex.Close() })
+
 	registry := worktree.NewRegistry(workDir, dataDir)
-	worktreeManager := worktree.NewManager(registry, mock, dataDir, 10*time.Minute)
+	worktreeManager := worktree.NewManager(registry, agents, dataDir, 10*time.Minute)
+	worktreeManager.SetSearchIndex(searchIndex)
+
+	users, err := auth.NewStore(dataDir, "test-token")
+	if err != nil {
+		t.Fatalf("failed to create user store: %v", err)
+	}
+
+	auditLog, err := audit.Open(dataDir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+
+	policyStore, err := policy.NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create policy store: %v", err)
+	}
+	worktreeManager.SetPermissionPolicy(policyStore)
+
+	h := NewRPCHandler(users, "test", true, cmdStore, worktreeManager, settingsStore, agents, searchIndex)
+	h.SetAuditLog(auditLog)
+	h.SetPolicyStore(policyStore)
+
+	notifier, err := notify.NewService(dataDir, "mailto:test@example.com")
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	h.SetNotifier(notifier)
 
-	h := NewRPCHandler("test-token", "test", true, cmdStore, worktreeManager, settingsStore)
+	scheduleStore, err := schedule.NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create schedule store: %v", err)
+	}
+	scheduler := schedule.New(scheduleStore, func(ctx context.Context, s schedule.Schedule) (string, []json.RawMessage, error) {
+		return worktreeManager.SendPrompt(ctx, s.Worktree, worktree.Prompt{SessionID: s.SessionID, Title: s.Name, Mode: s.Mode, User: "schedule:" + s.Name, Content: s.Prompt})
+	})
+	scheduler.Start()
+	h.SetScheduler(scheduler)
 	server := httptest.NewServer(h)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -87,12 +148,39 @@ func newTestEnvWithWorkDir(t *testing.T, mock *mockAgent, workDir string) *testE
 		conn.Close(websocket.StatusNormalClosure, "")
 		cancel()
 		server.Close()
+		scheduler.Stop()
 		worktreeManager.Shutdown()
 	})
 
 	return env
 }
 
+// connectAs opens a second connection to the same server authenticated with token.
+func (e *testEnv) connectAs(token string) (*testEnv, rpcResponse) {
+	return e.connectWith(rpc.AuthParams{Token: token})
+}
+
+// connectWith opens a second connection to the same server and sends auth with params.
+func (e *testEnv) connectWith(params rpc.AuthParams) (*testEnv, rpcResponse) {
+	wsURL := "ws" + strings.TrimPrefix(e.server.URL, "http")
+	conn, _, err := websocket.Dial(e.ctx, wsURL, nil)
+	if err != nil {
+		e.t.Fatalf("failed to connect: %v", err)
+	}
+	e.t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+
+	other := &testEnv{
+		t:               e.t,
+		mock:            e.mock,
+		worktreeManager: e.worktreeManager,
+		server:          e.server,
+		conn:            conn,
+		ctx:             e.ctx,
+		cancel:          e.cancel,
+	}
+	return other, other.call("auth", params)
+}
+
 // getMainWorktree returns the main worktree for tests that need direct access to store/manager.
 func (e *testEnv) getMainWorktree() *worktree.Worktree {
 	wt, err := e.worktreeManager.Get("")
@@ -191,16 +279,43 @@ func (e *testEnv) skipN(n int) {
 	}
 }
 
+func TestHandler_ReadLimit_RaisedAfterAuth(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	sess, _ := env.getMainWorktree().SessionStore.Create(bgCtx, "big")
+
+	// Authenticated connections accept messages beyond the pre-auth limit
+	env.sendMessage(sess.ID, strings.Repeat("x", 2*maxAuthMessageSize))
+
+	wsURL := "ws" + strings.TrimPrefix(env.server.URL, "http")
+	conn, _, err := websocket.Dial(env.ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	req := rpcRequest{JSONRPC: "2.0", ID: 1, Method: "auth", Params: rpc.AuthParams{Token: strings.Repeat("x", 2*maxAuthMessageSize)}}
+	data, _ := json.Marshal(req)
+	if err := conn.Write(env.ctx, websocket.MessageText, data); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	if _, _, err := conn.Read(env.ctx); websocket.CloseStatus(err) != websocket.StatusMessageTooBig {
+		t.Errorf("expected an oversized message before auth to close the connection, got %v", err)
+	}
+}
+
 func TestHandler_Auth_InvalidToken(t *testing.T) {
 	dataDir := t.TempDir()
 	workDir := t.TempDir()
 	cmdStore, _ := command.NewStore(dataDir)
 	settingsStore, _ := settings.NewStore(dataDir)
 	registry := worktree.NewRegistry(workDir, dataDir)
-	worktreeManager := worktree.NewManager(registry, &mockAgent{}, dataDir, 10*time.Minute)
+	agents := agent.NewRegistry()
+	agents.Register("mock", &mockAgent{})
+	worktreeManager := worktree.NewManager(registry, agents, dataDir, 10*time.Minute)
 	defer worktreeManager.Shutdown()
 
-	h := NewRPCHandler("secret-token", "test", true, cmdStore, worktreeManager, settingsStore)
+	users, _ := auth.NewStore(dataDir, "secret-token")
+	h := NewRPCHandler(users, "test", true, cmdStore, worktreeManager, settingsStore, agents, nil)
 	server := httptest.NewServer(h)
 	defer server.Close()
 
@@ -244,10 +359,13 @@ func TestHandler_Auth_FirstMessageMustBeAuth(t *testing.T) {
 	cmdStore, _ := command.NewStore(dataDir)
 	settingsStore, _ := settings.NewStore(dataDir)
 	registry := worktree.NewRegistry(workDir, dataDir)
-	worktreeManager := worktree.NewManager(registry, &mockAgent{}, dataDir, 10*time.Minute)
+	agents := agent.NewRegistry()
+	agents.Register("mock", &mockAgent{})
+	worktreeManager := worktree.NewManager(registry, agents, dataDir, 10*time.Minute)
 	defer worktreeManager.Shutdown()
 
-	h := NewRPCHandler("test-token", "test", true, cmdStore, worktreeManager, settingsStore)
+	users, _ := auth.NewStore(dataDir, "test-token")
+	h := NewRPCHandler(users, "test", true, cmdStore, worktreeManager, settingsStore, agents, nil)
 	server := httptest.NewServer(h)
 	defer server.Close()
 
@@ -285,6 +403,127 @@ func TestHandler_Auth_FirstMessageMustBeAuth(t *testing.T) {
 	}
 }
 
+func TestHandler_TokensAndRoles(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+
+	create := func(user string, role auth.Role) string {
+		t.Helper()
+		resp := env.call("token.create", rpc.TokenCreateParams{User: user, Role: role})
+		if resp.Error != nil {
+			t.Fatalf("token.create failed: %s", resp.Error.Message)
+		}
+		var result rpc.TokenCreateResult
+		json.Unmarshal(resp.Result, &result)
+		if result.Token == "" || result.Info.User != user || result.Info.Role != role {
+			t.Fatalf("unexpected token create result: %+v", result)
+		}
+		return result.Token
+	}
+	viewerToken := create("vera", auth.RoleViewer)
+	operatorToken := create("olga", auth.RoleOperator)
+
+	resp := env.call("token.create", rpc.TokenCreateParams{User: "x", Role: "root"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "invalid role") {
+		t.Errorf("expected invalid role error, got %+v", resp)
+	}
+
+	viewer, resp := env.connectAs(viewerToken)
+	var authResult rpc.AuthResult
+	json.Unmarshal(resp.Result, &authResult)
+	if resp.Error != nil || authResult.User != "vera" || authResult.Role != auth.RoleViewer {
+		t.Fatalf("unexpected viewer auth: %+v %+v", resp.Error, authResult)
+	}
+	if resp := viewer.call("worktree.list", struct{}{}); resp.Error != nil {
+		t.Errorf("viewer should list worktrees: %s", resp.Error.Message)
+	}
+	resp = viewer.call("session.create", struct{}{})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "requires operator role") {
+		t.Errorf("expected viewer to be denied session.create, got %+v", resp)
+	}
+
+	operator, _ := env.connectAs(operatorToken)
+	resp = operator.call("session.create", struct{}{})
+	if resp.Error != nil {
+		t.Fatalf("operator session.create failed: %s", resp.Error.Message)
+	}
+	var sess rpc.SessionListItem
+	json.Unmarshal(resp.Result, &sess)
+	operator.sendMessage(sess.ID, "hello")
+
+	history, _ := env.getMainWorktree().SessionStore.GetHistory(bgCtx, sess.ID)
+	var record agent.EventRecord
+	if len(history) > 0 {
+		json.Unmarshal(history[0], &record)
+	}
+	if record.Type != agent.EventTypeMessage || record.User != "olga" {
+		t.Errorf("expected message attributed to olga, got %+v", record)
+	}
+
+	resp = operator.call("token.list", struct{}{})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "requires admin role") {
+		t.Errorf("expected operator to be denied token.list, got %+v", resp)
+	}
+
+	resp = env.call("token.list", struct{}{})
+	var list rpc.TokenListResult
+	json.Unmarshal(resp.Result, &list)
+	if len(list.Tokens) != 2 {
+		t.Fatalf("expected 2 tokens, got %+v", list.Tokens)
+	}
+
+	if resp := env.call("token.revoke", rpc.TokenRevokeParams{ID: list.Tokens[0].ID}); resp.Error != nil {
+		t.Fatalf("token.revoke failed: %s", resp.Error.Message)
+	}
+	if _, resp := env.connectAs(viewerToken); resp.Error == nil {
+		t.Error("expected revoked token to be rejected")
+	}
+	resp = env.call("token.revoke", rpc.TokenRevokeParams{ID: list.Tokens[0].ID})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "token not found") {
+		t.Errorf("expected token not found, got %+v", resp)
+	}
+}
+
+func TestHandler_TokenRevoke_ClosesConnections(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+
+	create := func(user string, role auth.Role) (string, string) {
+		t.Helper()
+		resp := env.call("token.create", rpc.TokenCreateParams{User: user, Role: role})
+		if resp.Error != nil {
+			t.Fatalf("token.create failed: %s", resp.Error.Message)
+		}
+		var result rpc.TokenCreateResult
+		json.Unmarshal(resp.Result, &result)
+		return result.Token, result.Info.ID
+	}
+	viewerToken, viewerID := create("vera", auth.RoleViewer)
+	operatorToken, _ := create("olga", auth.RoleOperator)
+
+	first, _ := env.connectAs(viewerToken)
+	second, _ := env.connectAs(viewerToken)
+	operator, _ := env.connectAs(operatorToken)
+
+	if resp := env.call("token.revoke", rpc.TokenRevokeParams{ID: viewerID}); resp.Error != nil {
+		t.Fatalf("token.revoke failed: %s", resp.Error.Message)
+	}
+
+	for i, viewer := range []*testEnv{first, second} {
+		ctx, cancel := context.WithTimeout(bgCtx, 2*time.Second)
+		_, _, err := viewer.conn.Read(ctx)
+		cancel()
+		if err == nil || errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("connection %d: expected revoked connection to be closed, got %v", i, err)
+		}
+	}
+
+	if resp := operator.call("worktree.list", struct{}{}); resp.Error != nil {
+		t.Errorf("expected other tokens to stay connected: %s", resp.Error.Message)
+	}
+	if resp := env.call("worktree.list", struct{}{}); resp.Error != nil {
+		t.Errorf("expected shared token to stay connected: %s", resp.Error.Message)
+	}
+}
+
 func TestHandler_ChatMessagesSubscribe(t *testing.T) {
 	env := newTestEnv(t, &mockAgent{})
 	env.getMainWorktree().SessionStore.Create(bgCtx, "sess")
@@ -596,6 +835,145 @@ func TestHandler_Message_SessionNotInStore(t *testing.T) {
 	}
 }
 
+func (m *mockAgent) sessionAttachments(sessionID string) []agent.Attachment {
+	m.mu.Lock()
+	sess := m.sessions[sessionID]
+	m.mu.Unlock()
+	if sess == nil {
+		return nil
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.attachments
+}
+
+func TestHandler_Message_WithAttachments(t *testing.T) {
+	workDir := t.TempDir()
+	os.WriteFile(filepath.Join(workDir, "notes.txt"), []byte("todo"), 0644)
+	mock := &mockAgent{}
+	env := newTestEnvWithWorkDir(t, mock, workDir)
+	store := env.getMainWorktree().SessionStore
+	sess, _ := store.Create(bgCtx, "attachments")
+
+	resp := env.call("chat.message", rpc.MessageParams{
+		SessionID: sess.ID,
+		Content:   "look",
+		Attachments: []agent.Attachment{
+			{Type: agent.AttachmentImage, Name: "shot.png", MediaType: "image/png", Data: "iVBORw0KGgo="},
+			{Type: agent.AttachmentFile, Path: "notes.txt"},
+		},
+	})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+
+	sent := mock.sessionAttachments(sess.ID)
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 attachments sent, got %d", len(sent))
+	}
+	if sent[1].MediaType != "text/plain" || sent[1].Data != "dG9kbw==" || sent[1].Name != "notes.txt" {
+		t.Errorf("unexpected resolved file attachment: %+v", sent[1])
+	}
+
+	history, _ := store.GetHistory(bgCtx, sess.ID)
+	if len(history) == 0 {
+		t.Fatal("expected message in history")
+	}
+	var record agent.EventRecord
+	json.Unmarshal(history[0], &record)
+	if len(record.Attachments) != 2 {
+		t.Fatalf("expected 2 attachments in history, got %d", len(record.Attachments))
+	}
+	if sent[0].Data != "iVBORw0KGgo=" {
+		t.Errorf("expected the agent to get the image data, got %+v", sent[0])
+	}
+	if record.Attachments[0].Data != "" || record.Attachments[0].Name != "shot.png" || record.Attachments[0].MediaType != "image/png" {
+		t.Errorf("expected image without data in history, got %+v", record.Attachments[0])
+	}
+	if record.Attachments[1].Data != "" || record.Attachments[1].Path != "notes.txt" {
+		t.Errorf("expected file reference without data in history, got %+v", record.Attachments[1])
+	}
+}
+
+func TestHandler_Message_InvalidAttachment(t *testing.T) {
+	tests := []struct {
+		name       string
+		attachment agent.Attachment
+		wantErr    string
+	}{
+		{"unsupported image type", agent.Attachment{Type: agent.AttachmentImage, MediaType: "image/bmp", Data: "AAAA"}, "unsupported image type"},
+		{"bad base64", agent.Attachment{Type: agent.AttachmentImage, MediaType: "image/png", Data: "!!"}, "invalid base64"},
+		{"path traversal", agent.Attachment{Type: agent.AttachmentFile, Path: "../secret"}, "invalid path"},
+		{"missing file", agent.Attachment{Type: agent.AttachmentFile, Path: "nope.txt"}, "file not found"},
+		{"unknown type", agent.Attachment{Type: "video"}, "unknown type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, &mockAgent{})
+			sess, _ := env.getMainWorktree().SessionStore.Create(bgCtx, "bad-attachment")
+
+			resp := env.call("chat.message", rpc.MessageParams{SessionID: sess.ID, Content: "x", Attachments: []agent.Attachment{tt.attachment}})
+			if resp.Error == nil || !strings.Contains(resp.Error.Message, tt.wantErr) {
+				t.Errorf("expected %q error, got %+v", tt.wantErr, resp)
+			}
+		})
+	}
+}
+
+func TestHandler_ChatQueue(t *testing.T) {
+	mock := &mockAgent{holdTurn: true}
+	env := newTestEnv(t, mock)
+	sess, _ := env.getMainWorktree().SessionStore.Create(bgCtx, "queue-session")
+
+	env.sendMessage(sess.ID, "first")
+
+	resp := env.call("chat.message", rpc.MessageParams{SessionID: sess.ID, Content: "second"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var result rpc.MessageResult
+	json.Unmarshal(resp.Result, &result)
+	if result.QueueID == "" {
+		t.Fatal("expected second message to be queued")
+	}
+
+	resp = env.call("chat.queue.update", rpc.ChatQueueUpdateParams{SessionID: sess.ID, ID: result.QueueID, Content: "edited"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+
+	resp = env.call("chat.queue.list", rpc.ChatQueueListParams{SessionID: sess.ID})
+	var list rpc.ChatQueueListResult
+	json.Unmarshal(resp.Result, &list)
+	if len(list.Queue) != 1 || list.Queue[0].Content != "edited" {
+		t.Fatalf("unexpected queue: %+v", list.Queue)
+	}
+
+	// Subscribers receive the current queue up front
+	sub := env.subscribeChatMessages(sess.ID)
+	if len(sub.Queue) != 1 || sub.Queue[0].ID != result.QueueID {
+		t.Errorf("expected queue in subscribe result, got %+v", sub.Queue)
+	}
+	env.call("chat.messages.unsubscribe", rpc.ChatMessagesUnsubscribeParams{ID: sub.ID})
+
+	resp = env.call("chat.queue.cancel", rpc.ChatQueueCancelParams{SessionID: sess.ID, ID: result.QueueID})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+
+	resp = env.call("chat.queue.list", rpc.ChatQueueListParams{SessionID: sess.ID})
+	json.Unmarshal(resp.Result, &list)
+	if len(list.Queue) != 0 {
+		t.Errorf("expected empty queue after cancel, got %+v", list.Queue)
+	}
+
+	resp = env.call("chat.queue.cancel", rpc.ChatQueueCancelParams{SessionID: sess.ID, ID: result.QueueID})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "queued message not found") {
+		t.Errorf("expected not found error, got %+v", resp)
+	}
+}
+
 // Session management tests
 
 func TestHandler_SessionListSubscribe(t *testing.T) {
@@ -650,6 +1028,9 @@ func TestHandler_SessionCreate(t *testing.T) {
 	if result.Activated {
 		t.Error("expected activated=false for new session")
 	}
+	if stored, _, _ := env.getMainWorktree().SessionStore.Get(result.ID); stored.Agent != "mock" {
+		t.Errorf("expected the default agent to be recorded, got %q", stored.Agent)
+	}
 }
 
 func TestHandler_SessionDelete(t *testing.T) {
@@ -736,128 +1117,982 @@ func TestHandler_SessionUpdateTitle_NotFound(t *testing.T) {
 	}
 }
 
-func TestHandler_ChatMessagesSubscribe_History(t *testing.T) {
+func TestHandler_AgentList(t *testing.T) {
 	env := newTestEnv(t, &mockAgent{})
-	store := env.getMainWorktree().SessionStore
-	sess, _ := store.Create(bgCtx, "with-history")
-	store.AppendToHistory(bgCtx, sess.ID, map[string]string{"type": "message", "content": "hello"})
-
-	result := env.subscribeChatMessages(sess.ID)
-
-	if len(result.History) != 1 {
-		t.Errorf("expected 1 history record, got %d", len(result.History))
-	}
-}
-
-// File/Git RPC tests
-
-// newWorkDirTestEnv is a convenience wrapper for tests that need a specific workDir.
-func newWorkDirTestEnv(t *testing.T, workDir string) *testEnv {
-	return newTestEnvWithWorkDir(t, &mockAgent{}, workDir)
-}
-
-func TestHandler_FileGet_ListRootDir(t *testing.T) {
-	workDir := t.TempDir()
-	env := newWorkDirTestEnv(t, workDir)
-	os.WriteFile(filepath.Join(workDir, "file.txt"), []byte("hello"), 0644)
-	os.Mkdir(filepath.Join(workDir, "subdir"), 0755)
-
-	resp := env.call("file.get", rpc.FileGetParams{Path: ""})
 
+	resp := env.call("agent.list", nil)
 	if resp.Error != nil {
 		t.Fatalf("unexpected error: %s", resp.Error.Message)
 	}
 
-	var result rpc.FileGetResult
+	var result rpc.AgentListResult
 	if err := json.Unmarshal(resp.Result, &result); err != nil {
-		t.Fatalf("failed to unmarshal result: %v", err)
-	}
-
-	if result.Type != "directory" {
-		t.Errorf("expected type 'directory', got %q", result.Type)
+		t.Fatalf("failed to unmarshal: %v", err)
 	}
-	if len(result.Entries) != 2 {
-		t.Fatalf("expected 2 entries, got %d", len(result.Entries))
+	if len(result.Agents) != 2 {
+		t.Fatalf("expected 2 agents, got %d", len(result.Agents))
 	}
-	if result.Entries[0].Name != "subdir" {
-		t.Errorf("expected first entry 'subdir', got %q", result.Entries[0].Name)
+	if result.Agents[0].Name != "mock" || !result.Agents[0].IsDefault {
+		t.Errorf("expected default 'mock' first, got %+v", result.Agents[0])
 	}
-	if result.Entries[1].Name != "file.txt" {
-		t.Errorf("expected second entry 'file.txt', got %q", result.Entries[1].Name)
+	if result.Agents[1].Name != "alt" || result.Agents[1].IsDefault {
+		t.Errorf("expected non-default 'alt', got %+v", result.Agents[1])
 	}
 }
 
-func TestHandler_FileGet_ListSubDir(t *testing.T) {
-	workDir := t.TempDir()
-	env := newWorkDirTestEnv(t, workDir)
-	os.MkdirAll(filepath.Join(workDir, "src"), 0755)
-	os.WriteFile(filepath.Join(workDir, "src", "main.go"), []byte("package main"), 0644)
-
-	resp := env.call("file.get", rpc.FileGetParams{Path: "src"})
+func TestHandler_SessionCreate_WithAgent(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
 
+	resp := env.call("session.create", rpc.SessionCreateParams{Agent: "alt"})
 	if resp.Error != nil {
 		t.Fatalf("unexpected error: %s", resp.Error.Message)
 	}
 
-	var result rpc.FileGetResult
-	json.Unmarshal(resp.Result, &result)
-
-	if result.Type != "directory" {
-		t.Errorf("expected type 'directory', got %q", result.Type)
+	var created session.SessionMeta
+	if err := json.Unmarshal(resp.Result, &created); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
 	}
-	if len(result.Entries) != 1 || result.Entries[0].Name != "main.go" {
-		t.Errorf("expected main.go, got %+v", result.Entries)
+	if created.Agent != "alt" {
+		t.Errorf("expected agent 'alt', got %q", created.Agent)
+	}
+
+	stored, _, _ := env.getMainWorktree().SessionStore.Get(created.ID)
+	if stored.Agent != "alt" {
+		t.Errorf("expected stored agent 'alt', got %q", stored.Agent)
 	}
 }
 
-func TestHandler_FileGet_ReadFile(t *testing.T) {
-	workDir := t.TempDir()
-	env := newWorkDirTestEnv(t, workDir)
-	os.WriteFile(filepath.Join(workDir, "hello.txt"), []byte("world"), 0644)
+func TestHandler_SessionCreate_UnknownAgent(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
 
-	resp := env.call("file.get", rpc.FileGetParams{Path: "hello.txt"})
+	resp := env.call("session.create", rpc.SessionCreateParams{Agent: "bogus"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "unknown agent") {
+		t.Errorf("expected unknown agent error, got %+v", resp)
+	}
+}
+
+func TestHandler_SessionSetAgent(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	sess, _ := wt.SessionStore.Create(bgCtx, "set-agent")
 
+	resp := env.call("session.set_agent", rpc.SessionSetAgentParams{SessionID: sess.ID, Agent: "alt"})
 	if resp.Error != nil {
 		t.Fatalf("unexpected error: %s", resp.Error.Message)
 	}
 
-	var result rpc.FileGetResult
-	json.Unmarshal(resp.Result, &result)
-
-	if result.Type != "file" {
-		t.Errorf("expected type 'file', got %q", result.Type)
-	}
-	if result.File == nil {
-		t.Fatal("expected file content")
-	}
-	if result.File.Content != "world" {
-		t.Errorf("expected content 'world', got %q", result.File.Content)
+	updated, _, _ := wt.SessionStore.Get(sess.ID)
+	if updated.Agent != "alt" {
+		t.Errorf("expected agent 'alt', got %q", updated.Agent)
 	}
 }
 
-func TestHandler_FileGet_NotFound(t *testing.T) {
-	env := newWorkDirTestEnv(t, t.TempDir())
-
-	resp := env.call("file.get", rpc.FileGetParams{Path: "nonexistent.txt"})
+func TestHandler_SessionSetAgent_AfterStart(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	sess, _ := wt.SessionStore.Create(bgCtx, "started")
+	env.sendMessage(sess.ID, "hello")
 
-	if resp.Error == nil {
-		t.Fatal("expected error")
-	}
-	if !strings.Contains(resp.Error.Message, "not found") {
-		t.Errorf("expected 'not found' error, got %q", resp.Error.Message)
+	resp := env.call("session.set_agent", rpc.SessionSetAgentParams{SessionID: sess.ID, Agent: "alt"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "started session") {
+		t.Errorf("expected started session error, got %+v", resp)
 	}
 }
 
-func TestHandler_FileGet_InvalidPath(t *testing.T) {
-	env := newWorkDirTestEnv(t, t.TempDir())
+func TestHandler_SessionSetConfig(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	sess, _ := wt.SessionStore.Create(bgCtx, "config-session")
+	env.sendMessage(sess.ID, "hello")
 
-	resp := env.call("file.get", rpc.FileGetParams{Path: "../etc/passwd"})
+	config := session.AgentConfig{Model: "opus", DisallowedTools: []string{"WebFetch"}, MaxTurns: 4}
+	resp := env.call("session.set_config", rpc.SessionSetConfigParams{SessionID: sess.ID, Config: config})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	if wt.ProcessManager.HasProcess(sess.ID) {
+		t.Error("expected process to be closed after config change")
+	}
 
-	if resp.Error == nil {
-		t.Fatal("expected error")
+	resp = env.call("session.get_config", rpc.SessionGetConfigParams{SessionID: sess.ID})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
 	}
-	if !strings.Contains(resp.Error.Message, "invalid path") {
-		t.Errorf("expected 'invalid path' error, got %q", resp.Error.Message)
+	var got session.AgentConfig
+	if err := json.Unmarshal(resp.Result, &got); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if got.Model != "opus" || got.MaxTurns != 4 || len(got.DisallowedTools) != 1 {
+		t.Errorf("unexpected config: %+v", got)
+	}
+}
+
+func TestHandler_SessionSetConfig_Invalid(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	sess, _ := env.getMainWorktree().SessionStore.Create(bgCtx, "bad-config")
+
+	resp := env.call("session.set_config", rpc.SessionSetConfigParams{SessionID: sess.ID, Config: session.AgentConfig{MaxTurns: -1}})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "max_turns") {
+		t.Errorf("expected max_turns error, got %+v", resp)
+	}
+}
+
+func TestHandler_SessionGetConfig_NotFound(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+
+	resp := env.call("session.get_config", rpc.SessionGetConfigParams{SessionID: "missing"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "session not found") {
+		t.Errorf("expected session not found error, got %+v", resp)
+	}
+}
+
+func TestHandler_SessionFork(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	src, _ := wt.SessionStore.Create(bgCtx, "fork-source")
+	wt.SessionStore.Activate(bgCtx, src.ID)
+	for _, event := range []agent.AgentEvent{
+		agent.MessageEvent{Content: "first"},
+		agent.TextEvent{Content: "one"},
+		agent.DoneEvent{},
+		agent.MessageEvent{Content: "second"},
+		agent.TextEvent{Content: "two"},
+		agent.DoneEvent{},
+	} {
+		wt.SessionStore.AppendToHistory(bgCtx, src.ID, agent.NewEventRecord(event))
+	}
+
+	fork := func(index *int) rpc.SessionListItem {
+		t.Helper()
+		resp := env.call("session.fork", rpc.SessionForkParams{SessionID: src.ID, Index: index})
+		if resp.Error != nil {
+			t.Fatalf("unexpected error: %s", resp.Error.Message)
+		}
+		var item rpc.SessionListItem
+		if err := json.Unmarshal(resp.Result, &item); err != nil {
+			t.Fatalf("failed to unmarshal: %v", err)
+		}
+		return item
+	}
+
+	// Whole history at a turn boundary branches the agent conversation
+	full := fork(nil)
+	if full.ForkedFrom == nil || full.ForkedFrom.Records != 6 || !full.ForkedFrom.Resume {
+		t.Errorf("unexpected full fork origin: %+v", full.ForkedFrom)
+	}
+
+	// Earlier fork points keep the prefix but start a fresh conversation
+	index := 2
+	partial := fork(&index)
+	if partial.ForkedFrom == nil || partial.ForkedFrom.Records != 3 || partial.ForkedFrom.Resume {
+		t.Errorf("unexpected partial fork origin: %+v", partial.ForkedFrom)
+	}
+	history, _ := wt.SessionStore.GetHistory(bgCtx, partial.ID)
+	if len(history) != 3 {
+		t.Errorf("expected 3 history records, got %d", len(history))
+	}
+
+	env.sendMessage(partial.ID, "retry")
+	updated, _, _ := wt.SessionStore.Get(partial.ID)
+	if !updated.Activated {
+		t.Error("expected forked session to be activated after first message")
+	}
+
+	// The fresh conversation gets the copied transcript with its first message
+	deadline := time.Now().Add(time.Second)
+	var sent []string
+	for {
+		env.mock.mu.Lock()
+		sent = env.mock.messagesBySession[partial.ID]
+		env.mock.mu.Unlock()
+		if len(sent) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(sent) != 1 || !strings.Contains(sent[0], "User: first") || !strings.Contains(sent[0], "Assistant: one") ||
+		strings.Contains(sent[0], "second") || !strings.HasSuffix(sent[0], "retry") {
+		t.Errorf("expected transcript before the first message, got %q", sent)
+	}
+
+	// A process that ended after the last turn still leaves a resumable conversation
+	wt.SessionStore.AppendToHistory(bgCtx, src.ID, agent.NewEventRecord(agent.ProcessEndedEvent{}))
+	ended := fork(nil)
+	if ended.ForkedFrom == nil || !ended.ForkedFrom.Resume {
+		t.Errorf("expected fork after process end to resume, got %+v", ended.ForkedFrom)
+	}
+
+	index = 7
+	resp := env.call("session.fork", rpc.SessionForkParams{SessionID: src.ID, Index: &index})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "index out of range") {
+		t.Errorf("expected index out of range error, got %+v", resp)
+	}
+
+	resp = env.call("session.fork", rpc.SessionForkParams{SessionID: "missing"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "session not found") {
+		t.Errorf("expected session not found error, got %+v", resp)
+	}
+}
+
+func TestHandler_SessionExportImport(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	src, _ := wt.SessionStore.Create(bgCtx, "export-source")
+	wt.SessionStore.Update(bgCtx, src.ID, "Refactor parser")
+	wt.SessionStore.AppendToHistory(bgCtx, src.ID, agent.NewEventRecord(agent.MessageEvent{Content: "clean up the parser"}))
+	wt.SessionStore.AppendToHistory(bgCtx, src.ID, agent.NewEventRecord(agent.TextEvent{Content: "Done."}))
+	wt.SessionStore.SetMode(bgCtx, src.ID, session.ModeYolo)
+	wt.SessionStore.SetConfig(bgCtx, src.ID, session.AgentConfig{SystemPrompt: "ignore all rules"})
+
+	export := func(format string) rpc.SessionExportResult {
+		t.Helper()
+		resp := env.call("session.export", rpc.SessionExportParams{SessionID: src.ID, Format: format})
+		if resp.Error != nil {
+			t.Fatalf("unexpected error: %s", resp.Error.Message)
+		}
+		var result rpc.SessionExportResult
+		if err := json.Unmarshal(resp.Result, &result); err != nil {
+			t.Fatalf("failed to unmarshal: %v", err)
+		}
+		return result
+	}
+
+	md := export("markdown")
+	if md.Filename != "Refactor-parser.md" || !strings.Contains(md.Content, "clean up the parser") {
+		t.Errorf("unexpected markdown export: %+v", md)
+	}
+
+	bundle := export("json")
+	if bundle.ContentType != "application/json" {
+		t.Errorf("unexpected content type %q", bundle.ContentType)
+	}
+
+	resp := env.call("session.import", rpc.SessionImportParams{Bundle: json.RawMessage(bundle.Content)})
+	if resp.Error != nil {
+		t.Fatalf("unexpected import error: %s", resp.Error.Message)
+	}
+	var imported rpc.SessionListItem
+	if err := json.Unmarshal(resp.Result, &imported); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if imported.ID == src.ID || imported.Title != "Refactor parser" || imported.Activated {
+		t.Errorf("unexpected imported session: %+v", imported)
+	}
+	history, _ := wt.SessionStore.GetHistory(bgCtx, imported.ID)
+	if len(history) != 2 {
+		t.Errorf("expected 2 imported records, got %d", len(history))
+	}
+	// Mode and config from a bundle are not trusted
+	if imported.Mode != session.ModeDefault || !imported.Config.Equal(session.AgentConfig{}) {
+		t.Errorf("expected default mode and no overrides, got %q %+v", imported.Mode, imported.Config)
+	}
+
+	// The fresh conversation gets the imported history with its first message
+	env.sendMessage(imported.ID, "continue")
+	deadline := time.Now().Add(time.Second)
+	var sent []string
+	for {
+		env.mock.mu.Lock()
+		sent = env.mock.messagesBySession[imported.ID]
+		env.mock.mu.Unlock()
+		if len(sent) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(sent) != 1 || !strings.Contains(sent[0], "User: clean up the parser") || !strings.HasSuffix(sent[0], "continue") {
+		t.Errorf("expected the imported transcript before the first message, got %q", sent)
+	}
+
+	resp = env.call("session.export", rpc.SessionExportParams{SessionID: src.ID, Format: "pdf"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "invalid format") {
+		t.Errorf("expected invalid format error, got %+v", resp)
+	}
+
+	resp = env.call("session.import", rpc.SessionImportParams{Bundle: json.RawMessage(`{"version":99}`)})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "newer than supported") {
+		t.Errorf("expected version error, got %+v", resp)
+	}
+}
+
+func TestHandler_AuditList(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	sess, _ := env.getMainWorktree().SessionStore.Create(bgCtx, "audited")
+
+	if resp := env.call("session.set_mode", rpc.SessionSetModeParams{SessionID: sess.ID, Mode: session.ModeYolo}); resp.Error != nil {
+		t.Fatalf("set_mode failed: %s", resp.Error.Message)
+	}
+	bigContent := strings.Repeat("x", 5000)
+	env.call("file.write", rpc.FileWriteParams{Path: "big.txt", Content: bigContent})
+	env.call("worktree.list", struct{}{}) // read-only, not audited
+
+	resp := env.call("token.create", rpc.TokenCreateParams{User: "vera", Role: auth.RoleViewer})
+	var created rpc.TokenCreateResult
+	json.Unmarshal(resp.Result, &created)
+	viewer, _ := env.connectAs(created.Token)
+	viewer.call("git.add", rpc.GitPathsParams{Paths: []string{"big.txt"}})
+
+	resp = env.call("audit.list", rpc.AuditListParams{})
+	if resp.Error != nil {
+		t.Fatalf("audit.list failed: %s", resp.Error.Message)
+	}
+	var result rpc.AuditListResult
+	json.Unmarshal(resp.Result, &result)
+
+	var methods []string
+	for _, e := range result.Entries {
+		methods = append(methods, e.Method)
+	}
+	want := []string{"audit.list", "git.add", "token.create", "file.write", "session.set_mode"}
+	if !slices.Equal(methods, want) {
+		t.Fatalf("expected %v, got %v", want, methods)
+	}
+
+	denied := result.Entries[1]
+	if denied.Actor != "vera" || !denied.Denied {
+		t.Errorf("expected denied entry for vera, got %+v", denied)
+	}
+	write := result.Entries[3]
+	if write.Actor != auth.SharedTokenUser || write.ConnID == "" || strings.Contains(string(write.Params), bigContent) {
+		t.Errorf("unexpected file.write entry: %+v", write)
+	}
+	if !strings.Contains(string(write.Params), "5000 bytes sha256:") {
+		t.Errorf("expected large content to be summarized, got %s", write.Params)
+	}
+
+	resp = env.call("audit.verify", struct{}{})
+	var verify rpc.AuditVerifyResult
+	json.Unmarshal(resp.Result, &verify)
+	if !verify.OK || verify.Entries != 6 {
+		t.Errorf("expected valid chain of 6 entries, got %+v", verify)
+	}
+
+	resp = viewer.call("audit.list", rpc.AuditListParams{})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "requires admin role") {
+		t.Errorf("expected viewer to be denied audit.list, got %+v", resp)
+	}
+}
+
+func TestHandler_PermissionRules(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+
+	resp := env.call("permissions.add", rpc.PermissionsAddParams{Action: policy.ActionAllow, Tool: "Bash", Pattern: "npm test*", Scope: policy.ScopeGlobal})
+	if resp.Error != nil {
+		t.Fatalf("permissions.add failed: %s", resp.Error.Message)
+	}
+	var global policy.Rule
+	json.Unmarshal(resp.Result, &global)
+	if global.ID == "" || global.CreatedBy != auth.SharedTokenUser {
+		t.Errorf("unexpected rule: %+v", global)
+	}
+
+	env.call("permissions.add", rpc.PermissionsAddParams{Action: policy.ActionDeny, Tool: "Write", Pattern: "*.env", Scope: policy.ScopeWorktree, Worktree: "feature"})
+
+	resp = env.call("permissions.add", rpc.PermissionsAddParams{Action: policy.ActionAllow, Tool: "Bash", Scope: policy.ScopeSession})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected invalid params for session rule without session, got %+v", resp)
+	}
+
+	feature := "feature"
+	resp = env.call("permissions.list", rpc.PermissionsListParams{Worktree: &feature})
+	var listed rpc.PermissionsListResult
+	json.Unmarshal(resp.Result, &listed)
+	if len(listed.Rules) != 1 || listed.Rules[0].Tool != "Write" {
+		t.Errorf("expected only the feature rule, got %+v", listed.Rules)
+	}
+
+	resp = env.call("token.create", rpc.TokenCreateParams{User: "vera", Role: auth.RoleViewer})
+	var created rpc.TokenCreateResult
+	json.Unmarshal(resp.Result, &created)
+	viewer, _ := env.connectAs(created.Token)
+	if resp := viewer.call("permissions.list", rpc.PermissionsListParams{}); resp.Error != nil {
+		t.Errorf("expected viewer to list rules, got %s", resp.Error.Message)
+	}
+	if resp := viewer.call("permissions.remove", rpc.PermissionsRemoveParams{ID: global.ID}); resp.Error == nil {
+		t.Error("expected viewer to be denied permissions.remove")
+	}
+
+	if resp := env.call("permissions.remove", rpc.PermissionsRemoveParams{ID: global.ID}); resp.Error != nil {
+		t.Fatalf("permissions.remove failed: %s", resp.Error.Message)
+	}
+	if resp := env.call("permissions.remove", rpc.PermissionsRemoveParams{ID: global.ID}); resp.Error == nil {
+		t.Error("expected error removing a missing rule")
+	}
+
+	resp = env.call("permissions.list", rpc.PermissionsListParams{})
+	json.Unmarshal(resp.Result, &listed)
+	if len(listed.Rules) != 1 {
+		t.Errorf("expected 1 rule after removal, got %+v", listed.Rules)
+	}
+}
+
+func TestHandler_PermissionTimeouts(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+
+	resp := env.call("permissions.timeout.set", rpc.PermissionsTimeoutSetParams{Scope: policy.ScopeWorktree, Seconds: 900, Decision: policy.TimeoutDeny})
+	var timeout policy.Timeout
+	json.Unmarshal(resp.Result, &timeout)
+	if resp.Error != nil || timeout.UpdatedBy != auth.SharedTokenUser {
+		t.Fatalf("unexpected permissions.timeout.set response: %+v", resp)
+	}
+
+	resp = env.call("permissions.timeout.set", rpc.PermissionsTimeoutSetParams{Scope: policy.ScopeGlobal, Seconds: -1, Decision: policy.TimeoutAllow})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected invalid params for negative seconds, got %+v", resp)
+	}
+
+	resp = env.call("permissions.timeout.list", struct{}{})
+	var listed rpc.PermissionsTimeoutListResult
+	json.Unmarshal(resp.Result, &listed)
+	if len(listed.Timeouts) != 1 || listed.Timeouts[0].Seconds != 900 {
+		t.Errorf("unexpected timeouts: %+v", listed.Timeouts)
+	}
+
+	if resp := env.call("permissions.timeout.clear", rpc.PermissionsTimeoutClearParams{Scope: policy.ScopeWorktree}); resp.Error != nil {
+		t.Fatalf("permissions.timeout.clear failed: %s", resp.Error.Message)
+	}
+	if resp := env.call("permissions.timeout.clear", rpc.PermissionsTimeoutClearParams{Scope: policy.ScopeWorktree}); resp.Error == nil {
+		t.Error("expected error clearing a missing timeout")
+	}
+}
+
+func TestHandler_Schedules(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+
+	resp := env.call("schedule.create", rpc.ScheduleCreateParams{Name: "Nightly", Cron: "every night", Prompt: "run tests"})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected invalid params for bad cron, got %+v", resp)
+	}
+	resp = env.call("schedule.create", rpc.ScheduleCreateParams{Name: "Nightly", Cron: "@daily", Worktree: "missing", Prompt: "run tests"})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected invalid params for unknown worktree, got %+v", resp)
+	}
+
+	resp = env.call("schedule.create", rpc.ScheduleCreateParams{Name: "Nightly", Cron: "0 3 * * *", Mode: session.ModeYolo, Prompt: "run tests"})
+	var sched schedule.Schedule
+	json.Unmarshal(resp.Result, &sched)
+	if resp.Error != nil || sched.ID == "" || !sched.Enabled || sched.CreatedBy != auth.SharedTokenUser {
+		t.Fatalf("unexpected schedule.create response: %+v", resp)
+	}
+
+	disabled := false
+	resp = env.call("schedule.update", rpc.ScheduleUpdateParams{ID: sched.ID, Enabled: &disabled})
+	json.Unmarshal(resp.Result, &sched)
+	if resp.Error != nil || sched.Enabled || sched.Cron != "0 3 * * *" {
+		t.Errorf("expected only enabled to change, got %+v", resp)
+	}
+
+	resp = env.call("schedule.list", struct{}{})
+	var listed rpc.ScheduleListResult
+	json.Unmarshal(resp.Result, &listed)
+	if len(listed.Schedules) != 1 || listed.Schedules[0].ID != sched.ID {
+		t.Errorf("unexpected schedules: %+v", listed.Schedules)
+	}
+
+	// Disabled schedules can still be run by hand
+	resp = env.call("schedule.run", rpc.ScheduleRunParams{ID: sched.ID})
+	var run schedule.Run
+	json.Unmarshal(resp.Result, &run)
+	if resp.Error != nil || run.Status != schedule.RunRunning {
+		t.Fatalf("unexpected schedule.run response: %+v", resp)
+	}
+
+	var runs rpc.ScheduleRunsResult
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		resp = env.call("schedule.runs", rpc.ScheduleRunsParams{ScheduleID: sched.ID})
+		json.Unmarshal(resp.Result, &runs)
+		if len(runs.Runs) == 1 && runs.Runs[0].Status != schedule.RunRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for run to finish: %+v", runs.Runs)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if runs.Runs[0].Status != schedule.RunSucceeded || runs.Runs[0].Trigger != auth.SharedTokenUser {
+		t.Errorf("expected succeeded run, got %+v", runs.Runs[0])
+	}
+	env.mock.mu.Lock()
+	got := env.mock.messagesBySession[runs.Runs[0].SessionID]
+	env.mock.mu.Unlock()
+	if len(got) != 1 || got[0] != "run tests" {
+		t.Errorf("expected prompt to be sent to the run's session, got %v", got)
+	}
+
+	resp = env.call("token.create", rpc.TokenCreateParams{User: "vera", Role: auth.RoleViewer})
+	var created rpc.TokenCreateResult
+	json.Unmarshal(resp.Result, &created)
+	viewer, _ := env.connectAs(created.Token)
+	if resp := viewer.call("schedule.runs", struct{}{}); resp.Error != nil {
+		t.Errorf("expected viewer to list runs, got %s", resp.Error.Message)
+	}
+	if resp := viewer.call("schedule.run", rpc.ScheduleRunParams{ID: sched.ID}); resp.Error == nil {
+		t.Error("expected viewer to be denied schedule.run")
+	}
+
+	if resp := env.call("schedule.delete", rpc.ScheduleDeleteParams{ID: sched.ID}); resp.Error != nil {
+		t.Fatalf("schedule.delete failed: %s", resp.Error.Message)
+	}
+	if resp := env.call("schedule.delete", rpc.ScheduleDeleteParams{ID: sched.ID}); resp.Error == nil {
+		t.Error("expected error deleting a missing schedule")
+	}
+}
+
+func TestHandler_Notify(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+
+	resp := env.call("token.create", rpc.TokenCreateParams{User: "vera", Role: auth.RoleViewer})
+	var created rpc.TokenCreateResult
+	json.Unmarshal(resp.Result, &created)
+	viewer, _ := env.connectAs(created.Token)
+
+	resp = viewer.call("notify.vapid_key", struct{}{})
+	var key rpc.NotifyVAPIDKeyResult
+	json.Unmarshal(resp.Result, &key)
+	if resp.Error != nil || key.PublicKey == "" {
+		t.Fatalf("expected VAPID key, got %+v", resp)
+	}
+
+	browserKey, _ := ecdh.P256().GenerateKey(rand.Reader)
+	keys := notify.PushKeys{
+		P256dh: base64.RawURLEncoding.EncodeToString(browserKey.PublicKey().Bytes()),
+		Auth:   base64.RawURLEncoding.EncodeToString(make([]byte, 16)),
+	}
+	if resp := viewer.call("notify.subscribe", rpc.NotifySubscribeParams{Endpoint: "https://push.example.com/1", Keys: keys}); resp.Error != nil {
+		t.Fatalf("notify.subscribe failed: %s", resp.Error.Message)
+	}
+	if resp := viewer.call("notify.subscribe", rpc.NotifySubscribeParams{Endpoint: "https://push.example.com/2"}); resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected invalid params for missing keys, got %+v", resp)
+	}
+	if resp := env.call("notify.unsubscribe", rpc.NotifyUnsubscribeParams{Endpoint: "https://push.example.com/1"}); resp.Error == nil {
+		t.Error("expected admin not to remove vera's subscription")
+	}
+	if resp := viewer.call("notify.unsubscribe", rpc.NotifyUnsubscribeParams{Endpoint: "https://push.example.com/1"}); resp.Error != nil {
+		t.Errorf("notify.unsubscribe failed: %s", resp.Error.Message)
+	}
+
+	if resp := viewer.call("notify.webhook.add", rpc.NotifyWebhookAddParams{URL: "https://ntfy.sh"}); resp.Error == nil {
+		t.Error("expected viewer to be denied notify.webhook.add")
+	}
+	resp = env.call("notify.webhook.add", rpc.NotifyWebhookAddParams{URL: "https://ntfy.sh", Topic: "pockode"})
+	var hook notify.Webhook
+	json.Unmarshal(resp.Result, &hook)
+	if resp.Error != nil || hook.ID == "" || hook.CreatedBy != auth.SharedTokenUser {
+		t.Fatalf("unexpected webhook add response: %+v", resp)
+	}
+	resp = env.call("notify.webhook.list", struct{}{})
+	var hooks rpc.NotifyWebhookListResult
+	json.Unmarshal(resp.Result, &hooks)
+	if len(hooks.Webhooks) != 1 || hooks.Webhooks[0].Topic != "pockode" {
+		t.Errorf("unexpected webhooks: %+v", hooks.Webhooks)
+	}
+	if resp := env.call("notify.webhook.remove", rpc.NotifyWebhookRemoveParams{ID: hook.ID}); resp.Error != nil {
+		t.Errorf("notify.webhook.remove failed: %s", resp.Error.Message)
+	}
+}
+
+func TestHandler_SessionSetMuted(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	sess, _ := wt.SessionStore.Create(bgCtx, "muted")
+
+	if resp := env.call("session.set_muted", rpc.SessionSetMutedParams{SessionID: sess.ID, Muted: true}); resp.Error != nil {
+		t.Fatalf("session.set_muted failed: %s", resp.Error.Message)
+	}
+	if meta, _, _ := wt.SessionStore.Get(sess.ID); !meta.Muted {
+		t.Error("expected session to be muted")
+	}
+
+	resp := env.call("session.set_muted", rpc.SessionSetMutedParams{SessionID: "missing", Muted: true})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected invalid params for unknown session, got %+v", resp)
+	}
+}
+
+func TestHandler_SessionSearch(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	sess, _ := wt.SessionStore.Create(bgCtx, "searchable")
+	wt.SessionStore.AppendToHistory(bgCtx, sess.ID, agent.NewEventRecord(agent.MessageEvent{Content: "fix the flaky migration test"}))
+
+	resp := env.call("session.search", rpc.SessionSearchParams{Query: "migration"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var result rpc.SessionSearchResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if len(result.Results) != 1 || result.Results[0].SessionID != sess.ID || result.Results[0].Matches[0].Offset != 0 {
+		t.Errorf("unexpected search results: %+v", result.Results)
+	}
+
+	resp = env.call("session.search", rpc.SessionSearchParams{Query: "migration", To: "2000-01-01"})
+	json.Unmarshal(resp.Result, &result)
+	if len(result.Results) != 0 {
+		t.Errorf("expected no results before range, got %+v", result.Results)
+	}
+
+	resp = env.call("session.search", rpc.SessionSearchParams{Query: "migration", From: "01/01/2000"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "invalid date") {
+		t.Errorf("expected invalid date error, got %+v", resp)
+	}
+
+	resp = env.call("session.search", rpc.SessionSearchParams{Query: "?"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "no searchable terms") {
+		t.Errorf("expected empty query error, got %+v", resp)
+	}
+}
+
+func TestHandler_Usage(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	s1, _ := wt.SessionStore.Create(bgCtx, "usage-1")
+	s2, _ := wt.SessionStore.Create(bgCtx, "usage-2")
+	wt.SessionStore.AddUsage(bgCtx, s1.ID, session.Usage{InputTokens: 100, CostUSD: 0.5, Turns: 1})
+	wt.SessionStore.AddUsage(bgCtx, s2.ID, session.Usage{InputTokens: 50, CostUSD: 0.25, Turns: 1})
+	today := time.Now().UTC().Format(session.UsageDayFormat)
+
+	resp := env.call("usage.session", rpc.UsageSessionParams{SessionID: s1.ID})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var sessResult rpc.UsageSessionResult
+	json.Unmarshal(resp.Result, &sessResult)
+	if sessResult.Total.InputTokens != 100 || len(sessResult.Days) != 1 || sessResult.Days[0].Date != today {
+		t.Errorf("unexpected session usage: %+v", sessResult)
+	}
+
+	resp = env.call("usage.worktree", nil)
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var wtResult rpc.UsageWorktreeResult
+	json.Unmarshal(resp.Result, &wtResult)
+	if wtResult.Total.InputTokens != 150 || wtResult.Total.Turns != 2 || len(wtResult.Sessions) != 2 {
+		t.Errorf("unexpected worktree usage: %+v", wtResult)
+	}
+
+	resp = env.call("usage.daily", rpc.UsageDailyParams{From: today})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var daily rpc.UsageDailyResult
+	json.Unmarshal(resp.Result, &daily)
+	if len(daily.Days) != 1 || daily.Days[0].Usage.CostUSD != 0.75 {
+		t.Errorf("unexpected daily usage: %+v", daily)
+	}
+
+	resp = env.call("usage.daily", rpc.UsageDailyParams{To: "2000-01-01"})
+	json.Unmarshal(resp.Result, &daily)
+	if len(daily.Days) != 0 {
+		t.Errorf("expected no days before range, got %+v", daily.Days)
+	}
+
+	resp = env.call("usage.daily", rpc.UsageDailyParams{From: "yesterday"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "invalid date") {
+		t.Errorf("expected invalid date error, got %+v", resp)
+	}
+
+	resp = env.call("usage.session", rpc.UsageSessionParams{SessionID: "missing"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "session not found") {
+		t.Errorf("expected session not found error, got %+v", resp)
+	}
+}
+
+func TestHandler_SessionSetMode_Plan(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	sess, _ := wt.SessionStore.Create(bgCtx, "plan-session")
+	env.sendMessage(sess.ID, "hello")
+
+	resp := env.call("session.set_mode", rpc.SessionSetModeParams{SessionID: sess.ID, Mode: session.ModePlan})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+
+	updated, _, _ := wt.SessionStore.Get(sess.ID)
+	if updated.Mode != session.ModePlan {
+		t.Errorf("expected mode %q, got %q", session.ModePlan, updated.Mode)
+	}
+	if wt.ProcessManager.HasProcess(sess.ID) {
+		t.Error("expected process to be closed after mode change")
+	}
+}
+
+func TestHandler_SessionSetMode_SameModeKeepsProcess(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	wt := env.getMainWorktree()
+	sess, _ := wt.SessionStore.Create(bgCtx, "same-mode")
+	env.sendMessage(sess.ID, "hello")
+
+	resp := env.call("session.set_mode", rpc.SessionSetModeParams{SessionID: sess.ID, Mode: session.ModeDefault})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+
+	if !wt.ProcessManager.HasProcess(sess.ID) {
+		t.Error("expected process to survive when mode is unchanged")
+	}
+}
+
+func TestHandler_SessionSetMode_Invalid(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	sess, _ := env.getMainWorktree().SessionStore.Create(bgCtx, "invalid-mode")
+
+	resp := env.call("session.set_mode", rpc.SessionSetModeParams{SessionID: sess.ID, Mode: "bogus"})
+
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "invalid mode") {
+		t.Errorf("expected invalid mode error, got %+v", resp)
+	}
+}
+
+func TestHandler_SessionApprovePlan(t *testing.T) {
+	mock := &mockAgent{}
+	env := newTestEnv(t, mock)
+	wt := env.getMainWorktree()
+	sess, _ := wt.SessionStore.Create(bgCtx, "approve")
+	wt.SessionStore.SetMode(bgCtx, sess.ID, session.ModePlan)
+
+	env.subscribeChatMessages(sess.ID)
+	env.sendMessage(sess.ID, "plan something")
+	env.skipN(1) // Done notification
+
+	resp := env.call("session.approve_plan", rpc.SessionApprovePlanParams{
+		SessionID: sess.ID,
+		Mode:      session.ModeYolo,
+		RequestID: "req-exit-plan",
+	})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	env.skipN(1) // Done notification for the continuation prompt
+
+	updated, _, _ := wt.SessionStore.Get(sess.ID)
+	if updated.Mode != session.ModeYolo {
+		t.Errorf("expected mode %q, got %q", session.ModeYolo, updated.Mode)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.startCalls) != 2 {
+		t.Fatalf("expected process restart (2 start calls), got %+v", mock.startCalls)
+	}
+	if mock.startCalls[0].mode != session.ModePlan {
+		t.Errorf("expected first start in plan mode, got %q", mock.startCalls[0].mode)
+	}
+	if second := mock.startCalls[1]; second.mode != session.ModeYolo || !second.resume {
+		t.Errorf("expected resumed yolo start, got %+v", second)
+	}
+	msgs := mock.messagesBySession[sess.ID]
+	if len(msgs) != 2 || msgs[1] != planApprovedPrompt {
+		t.Errorf("expected continuation prompt, got %v", msgs)
+	}
+}
+
+func TestHandler_SessionApprovePlan_NotInPlanMode(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	sess, _ := env.getMainWorktree().SessionStore.Create(bgCtx, "not-plan")
+
+	resp := env.call("session.approve_plan", rpc.SessionApprovePlanParams{SessionID: sess.ID})
+
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "not in plan mode") {
+		t.Errorf("expected not in plan mode error, got %+v", resp)
+	}
+}
+
+func TestHandler_SessionApprovePlan_InvalidMode(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	sess, _ := env.getMainWorktree().SessionStore.Create(bgCtx, "plan-invalid")
+
+	resp := env.call("session.approve_plan", rpc.SessionApprovePlanParams{SessionID: sess.ID, Mode: session.ModePlan})
+
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "invalid mode") {
+		t.Errorf("expected invalid mode error, got %+v", resp)
+	}
+}
+
+func TestHandler_ChatMessagesSubscribe_History(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	store := env.getMainWorktree().SessionStore
+	sess, _ := store.Create(bgCtx, "with-history")
+	store.AppendToHistory(bgCtx, sess.ID, map[string]string{"type": "message", "content": "hello"})
+
+	result := env.subscribeChatMessages(sess.ID)
+
+	if len(result.History) != 1 {
+		t.Errorf("expected 1 history record, got %d", len(result.History))
+	}
+}
+
+func TestHandler_ChatMessagesSubscribe_AfterSeq(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	store := env.getMainWorktree().SessionStore
+	sess, _ := store.Create(bgCtx, "resume")
+	for _, content := range []string{"one", "two", "three"} {
+		store.AppendToHistory(bgCtx, sess.ID, map[string]string{"type": "message", "content": content})
+	}
+
+	resp := env.call("chat.messages.subscribe", rpc.ChatMessagesSubscribeParams{SessionID: sess.ID, AfterSeq: 2})
+	var result rpc.ChatMessagesSubscribeResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+	if result.AfterSeq != 2 || result.Seq != 3 || len(result.History) != 1 {
+		t.Fatalf("expected only record 3, got after_seq=%d seq=%d with %d records", result.AfterSeq, result.Seq, len(result.History))
+	}
+	if !strings.Contains(string(result.History[0]), "three") {
+		t.Errorf("expected the last record, got %s", result.History[0])
+	}
+
+	// A seq beyond the history falls back to the full history
+	resp = env.call("chat.messages.subscribe", rpc.ChatMessagesSubscribeParams{SessionID: sess.ID, AfterSeq: 7})
+	result = rpc.ChatMessagesSubscribeResult{}
+	json.Unmarshal(resp.Result, &result)
+	if result.AfterSeq != 0 || len(result.History) != 3 {
+		t.Errorf("expected full history, got after_seq=%d with %d records", result.AfterSeq, len(result.History))
+	}
+}
+
+func TestHandler_ChatNotificationSeq(t *testing.T) {
+	mock := &mockAgent{
+		events: []agent.AgentEvent{
+			agent.TextEvent{Content: "Response"},
+			agent.DoneEvent{},
+		},
+	}
+	env := newTestEnv(t, mock)
+	env.getMainWorktree().SessionStore.Create(bgCtx, "sess")
+
+	env.subscribeChatMessages("sess")
+	env.sendMessage("sess", "hello")
+
+	// The user message is record 1 but is not sent back to its sender
+	want := []struct{ seq, prevSeq int64 }{{2, 0}, {3, 2}}
+	for _, w := range want {
+		var params rpc.ChatEventParams
+		json.Unmarshal(env.readNotification().Params, &params)
+		if params.Seq != w.seq || params.PrevSeq != w.prevSeq {
+			t.Errorf("expected seq=%d prev_seq=%d, got seq=%d prev_seq=%d", w.seq, w.prevSeq, params.Seq, params.PrevSeq)
+		}
+	}
+
+	result := env.subscribeChatMessages("sess")
+	if result.Seq != 3 {
+		t.Errorf("expected history to end at seq 3, got %d", result.Seq)
+	}
+}
+
+// File/Git RPC tests
+
+// newWorkDirTestEnv is a convenience wrapper for tests that need a specific workDir.
+func newWorkDirTestEnv(t *testing.T, workDir string) *testEnv {
+	return newTestEnvWithWorkDir(t, &mockAgent{}, workDir)
+}
+
+func TestHandler_FileGet_ListRootDir(t *testing.T) {
+	workDir := t.TempDir()
+	env := newWorkDirTestEnv(t, workDir)
+	os.WriteFile(filepath.Join(workDir, "file.txt"), []byte("hello"), 0644)
+	os.Mkdir(filepath.Join(workDir, "subdir"), 0755)
+
+	resp := env.call("file.get", rpc.FileGetParams{Path: ""})
+
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+
+	var result rpc.FileGetResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+
+	if result.Type != "directory" {
+		t.Errorf("expected type 'directory', got %q", result.Type)
+	}
+	if len(result.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(result.Entries))
+	}
+	if result.Entries[0].Name != "subdir" {
+		t.Errorf("expected first entry 'subdir', got %q", result.Entries[0].Name)
+	}
+	if result.Entries[1].Name != "file.txt" {
+		t.Errorf("expected second entry 'file.txt', got %q", result.Entries[1].Name)
+	}
+}
+
+func TestHandler_FileGet_ListSubDir(t *testing.T) {
+	workDir := t.TempDir()
+	env := newWorkDirTestEnv(t, workDir)
+	os.MkdirAll(filepath.Join(workDir, "src"), 0755)
+	os.WriteFile(filepath.Join(workDir, "src", "main.go"), []byte("package main"), 0644)
+
+	resp := env.call("file.get", rpc.FileGetParams{Path: "src"})
+
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+
+	var result rpc.FileGetResult
+	json.Unmarshal(resp.Result, &result)
+
+	if result.Type != "directory" {
+		t.Errorf("expected type 'directory', got %q", result.Type)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].Name != "main.go" {
+		t.Errorf("expected main.go, got %+v", result.Entries)
+	}
+}
+
+func TestHandler_FileGet_ReadFile(t *testing.T) {
+	workDir := t.TempDir()
+	env := newWorkDirTestEnv(t, workDir)
+	os.WriteFile(filepath.Join(workDir, "hello.txt"), []byte("world"), 0644)
+
+	resp := env.call("file.get", rpc.FileGetParams{Path: "hello.txt"})
+
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+
+	var result rpc.FileGetResult
+	json.Unmarshal(resp.Result, &result)
+
+	if result.Type != "file" {
+		t.Errorf("expected type 'file', got %q", result.Type)
+	}
+	if result.File == nil {
+		t.Fatal("expected file content")
+	}
+	if result.File.Content != "world" {
+		t.Errorf("expected content 'world', got %q", result.File.Content)
+	}
+}
+
+func TestHandler_FileGet_NotFound(t *testing.T) {
+	env := newWorkDirTestEnv(t, t.TempDir())
+
+	resp := env.call("file.get", rpc.FileGetParams{Path: "nonexistent.txt"})
+
+	if resp.Error == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(resp.Error.Message, "not found") {
+		t.Errorf("expected 'not found' error, got %q", resp.Error.Message)
+	}
+}
+
+func TestHandler_FileGet_InvalidPath(t *testing.T) {
+	env := newWorkDirTestEnv(t, t.TempDir())
+
+	resp := env.call("file.get", rpc.FileGetParams{Path: "../etc/passwd"})
+
+	if resp.Error == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(resp.Error.Message, "invalid path") {
+		t.Errorf("expected 'invalid path' error, got %q", resp.Error.Message)
 	}
 }
 
@@ -1063,6 +2298,292 @@ func TestHandler_GitDiffSubscribe_InvalidPath(t *testing.T) {
 	}
 }
 
+func TestHandler_GitHunkStage(t *testing.T) {
+	dir := setupGitRepo(t)
+	testFile := filepath.Join(dir, "test.txt")
+	os.WriteFile(testFile, []byte("one\ntwo\n"), 0644)
+	runGitIn(t, dir, "add", "test.txt")
+	runGitIn(t, dir, "commit", "-m", "initial")
+	os.WriteFile(testFile, []byte("one\ntwo\nthree\nfour\n"), 0644)
+
+	env := newWorkDirTestEnv(t, dir)
+	resp := env.call("git.diff.subscribe", rpc.GitDiffSubscribeParams{Path: "test.txt"})
+	var diff rpc.GitDiffSubscribeResult
+	json.Unmarshal(resp.Result, &diff)
+	if diff.Hash == "" {
+		t.Fatal("expected diff hash")
+	}
+
+	// Body: " one", " two", "+three", "+four"
+	params := rpc.GitHunksParams{
+		Path:  "test.txt",
+		Hash:  diff.Hash,
+		Hunks: []git.HunkSelection{{Hunk: 0, Lines: []git.LineRange{{Start: 2, End: 3}}}},
+	}
+	if resp := env.call("git.hunk.stage", params); resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	out, _ := exec.Command("git", "-C", dir, "show", ":test.txt").Output()
+	if string(out) != "one\ntwo\nthree\n" {
+		t.Errorf("expected one added line staged, got %q", out)
+	}
+
+	// The unstaged diff changed, so the old hash is stale
+	resp = env.call("git.hunk.stage", params)
+	var data rpc.GitErrorData
+	if resp.Error == nil || resp.Error.Code != rpc.CodeGitError || json.Unmarshal(*resp.Error.Data, &data) != nil || data.Kind != git.KindStale {
+		t.Errorf("expected stale error, got %+v", resp.Error)
+	}
+
+	resp = env.call("git.hunk.discard", rpc.GitHunksParams{Path: "test.txt", Hash: diff.Hash})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected hunks to be required, got %+v", resp.Error)
+	}
+
+	// Discarding the rest keeps the file in the trash
+	resp = env.call("git.diff.subscribe", rpc.GitDiffSubscribeParams{Path: "test.txt"})
+	json.Unmarshal(resp.Result, &diff)
+	resp = env.call("git.hunk.discard", rpc.GitHunksParams{Path: "test.txt", Hash: diff.Hash, Hunks: []git.HunkSelection{{Hunk: 0}}})
+	var entry git.TrashEntry
+	json.Unmarshal(resp.Result, &entry)
+	if resp.Error != nil || entry.ID == "" {
+		t.Fatalf("unexpected git.hunk.discard response: %+v", resp)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "one\ntwo\nthree\n" {
+		t.Errorf("expected the unstaged line discarded, got %q", content)
+	}
+	if resp := env.call("git.discard.restore", rpc.GitDiscardRestoreParams{ID: entry.ID}); resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "one\ntwo\nthree\nfour\n" {
+		t.Errorf("expected the discarded line restored, got %q", content)
+	}
+}
+
+func TestHandler_GitDiscardAndRestore(t *testing.T) {
+	dir := setupGitRepo(t)
+	testFile := filepath.Join(dir, "test.txt")
+	os.WriteFile(testFile, []byte("original"), 0644)
+	runGitIn(t, dir, "add", "test.txt")
+	runGitIn(t, dir, "commit", "-m", "initial")
+	os.WriteFile(testFile, []byte("agent edit"), 0644)
+	os.WriteFile(filepath.Join(dir, "stray.txt"), []byte("untracked"), 0644)
+	env := newWorkDirTestEnv(t, dir)
+
+	resp := env.call("git.discard", rpc.GitDiscardParams{Paths: []string{"test.txt", "stray.txt"}})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var entry git.TrashEntry
+	json.Unmarshal(resp.Result, &entry)
+	if content, _ := os.ReadFile(testFile); string(content) != "original" {
+		t.Errorf("expected test.txt to be reverted, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stray.txt")); !os.IsNotExist(err) {
+		t.Error("expected stray.txt to be deleted")
+	}
+
+	resp = env.call("git.discard.list", nil)
+	var list rpc.GitDiscardListResult
+	json.Unmarshal(resp.Result, &list)
+	if len(list.Entries) != 1 || list.Entries[0].ID != entry.ID || len(list.Entries[0].Paths) != 2 {
+		t.Fatalf("expected the discard to be listed, got %+v", list)
+	}
+
+	if resp := env.call("git.discard.restore", rpc.GitDiscardRestoreParams{ID: entry.ID}); resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "agent edit" {
+		t.Errorf("expected the edit to be restored, got %q", content)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "stray.txt")); string(content) != "untracked" {
+		t.Errorf("expected stray.txt to be restored, got %q", content)
+	}
+
+	resp = env.call("git.discard.restore", rpc.GitDiscardRestoreParams{ID: entry.ID})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected a restored discard to be gone, got %+v", resp.Error)
+	}
+	resp = env.call("git.discard", rpc.GitDiscardParams{Paths: []string{"../outside"}})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected invalid path error, got %+v", resp.Error)
+	}
+}
+
+func TestHandler_GitCommitAndLog(t *testing.T) {
+	dir := setupGitRepo(t)
+	os.WriteFile(filepath.Join(dir, "test.txt"), []byte("hello"), 0644)
+	runGitIn(t, dir, "add", "test.txt")
+	env := newWorkDirTestEnv(t, dir)
+
+	resp := env.call("git.commit", rpc.GitCommitParams{Message: "add test"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var commit rpc.GitCommitResult
+	json.Unmarshal(resp.Result, &commit)
+
+	resp = env.call("git.log", rpc.GitLogParams{})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var log rpc.GitLogResult
+	json.Unmarshal(resp.Result, &log)
+	if len(log.Commits) != 1 || log.Commits[0].Hash != commit.Hash || log.Commits[0].Subject != "add test" {
+		t.Errorf("expected the new commit in the log, got %+v", log.Commits)
+	}
+}
+
+func TestHandler_GitCommit_Errors(t *testing.T) {
+	dir := setupGitRepo(t)
+	env := newWorkDirTestEnv(t, dir)
+
+	resp := env.call("git.commit", rpc.GitCommitParams{})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Fatalf("expected invalid params without a message, got %+v", resp.Error)
+	}
+
+	resp = env.call("git.commit", rpc.GitCommitParams{Message: "empty"})
+	if resp.Error == nil || resp.Error.Code != rpc.CodeGitError {
+		t.Fatalf("expected git error, got %+v", resp.Error)
+	}
+	var data rpc.GitErrorData
+	if resp.Error.Data == nil || json.Unmarshal(*resp.Error.Data, &data) != nil || data.Kind != git.KindNothingToCommit {
+		t.Errorf("expected nothing_to_commit data, got %+v", resp.Error.Data)
+	}
+}
+
+func TestHandler_GitLog_Paging(t *testing.T) {
+	dir := setupGitRepo(t)
+	for i, name := range []string{"a.txt", "b.txt", "a.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(strconv.Itoa(i)), 0644)
+		runGitIn(t, dir, "add", name)
+		runGitIn(t, dir, "commit", "-m", "commit "+strconv.Itoa(i))
+	}
+	env := newWorkDirTestEnv(t, dir)
+
+	var page rpc.GitLogResult
+	resp := env.call("git.log", rpc.GitLogParams{Limit: 1, Path: "a.txt"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	json.Unmarshal(resp.Result, &page)
+	if len(page.Commits) != 1 || page.Commits[0].Subject != "commit 2" || !page.HasMore {
+		t.Fatalf("expected the first page of a.txt, got %+v", page)
+	}
+
+	resp = env.call("git.log", rpc.GitLogParams{Limit: 1, Skip: 1, Path: "a.txt"})
+	json.Unmarshal(resp.Result, &page)
+	if len(page.Commits) != 1 || page.Commits[0].Subject != "commit 0" || page.HasMore {
+		t.Errorf("expected the last page of a.txt, got %+v", page)
+	}
+
+	resp = env.call("git.log", rpc.GitLogParams{Path: "../outside"})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected invalid path error, got %+v", resp.Error)
+	}
+}
+
+func TestHandler_GitShowAndBlame(t *testing.T) {
+	dir := setupGitRepo(t)
+	os.WriteFile(filepath.Join(dir, "test.txt"), []byte("one\n"), 0644)
+	runGitIn(t, dir, "add", "test.txt")
+	runGitIn(t, dir, "commit", "-m", "initial")
+	os.WriteFile(filepath.Join(dir, "test.txt"), []byte("one\ntwo\n"), 0644)
+	runGitIn(t, dir, "commit", "-am", "second")
+	env := newWorkDirTestEnv(t, dir)
+
+	resp := env.call("git.show", rpc.GitShowParams{Rev: "HEAD"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var detail git.CommitDetail
+	json.Unmarshal(resp.Result, &detail)
+	if detail.Subject != "second" || len(detail.Files) != 1 || detail.Files[0].Path != "test.txt" || detail.Files[0].Diff != "" {
+		t.Fatalf("expected the changed files without diffs, got %+v", detail)
+	}
+
+	resp = env.call("git.show", rpc.GitShowParams{Rev: "HEAD", Path: "test.txt"})
+	json.Unmarshal(resp.Result, &detail)
+	if f := detail.Files[0]; f.Path != "test.txt" || f.OldContent != "one\n" || f.NewContent != "one\ntwo\n" || !strings.Contains(f.Diff, "+two") {
+		t.Errorf("unexpected file diff: %+v", f)
+	}
+
+	resp = env.call("git.show", rpc.GitShowParams{Rev: "nope"})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected invalid params for unknown rev, got %+v", resp.Error)
+	}
+
+	resp = env.call("git.blame", rpc.GitBlameParams{Path: "test.txt"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var blame git.Blame
+	json.Unmarshal(resp.Result, &blame)
+	if len(blame.Lines) != 2 || blame.Commits[blame.Lines[1].Hash].Summary != "second" {
+		t.Errorf("expected line 2 from the second commit, got %+v", blame)
+	}
+
+	resp = env.call("git.blame", rpc.GitBlameParams{Path: "missing.txt"})
+	if resp.Error == nil || resp.Error.Message != "file not found" {
+		t.Errorf("expected file not found, got %+v", resp.Error)
+	}
+}
+
+func TestHandler_GitBranch(t *testing.T) {
+	dir := setupGitRepo(t)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Test"), 0644)
+	runGitIn(t, dir, "add", ".")
+	runGitIn(t, dir, "commit", "-m", "initial")
+	env := newWorkDirTestEnv(t, dir)
+
+	listBranches := func() []git.Branch {
+		t.Helper()
+		resp := env.call("git.branch.list", nil)
+		if resp.Error != nil {
+			t.Fatalf("list failed: %s", resp.Error.Message)
+		}
+		var result rpc.GitBranchListResult
+		json.Unmarshal(resp.Result, &result)
+		return result.Branches
+	}
+	main := listBranches()[0].Name
+
+	resp := env.call("git.branch.create", rpc.GitBranchCreateParams{Name: "feature", Checkout: true})
+	if resp.Error != nil {
+		t.Fatalf("create failed: %s", resp.Error.Message)
+	}
+	os.WriteFile(filepath.Join(dir, "feature.txt"), []byte("feature"), 0644)
+	runGitIn(t, dir, "add", ".")
+	runGitIn(t, dir, "commit", "-m", "feature")
+
+	branches := listBranches()
+	if len(branches) != 2 {
+		t.Fatalf("expected 2 branches, got %+v", branches)
+	}
+	for _, b := range branches {
+		if b.Current != (b.Name == "feature") {
+			t.Errorf("expected feature to be current, got %+v", branches)
+		}
+	}
+
+	if resp := env.call("git.branch.checkout", rpc.GitBranchCheckoutParams{Name: main}); resp.Error != nil {
+		t.Fatalf("checkout failed: %s", resp.Error.Message)
+	}
+
+	resp = env.call("git.branch.delete", rpc.GitBranchDeleteParams{Name: "feature"})
+	var data rpc.GitErrorData
+	if resp.Error == nil || resp.Error.Code != rpc.CodeGitError || json.Unmarshal(*resp.Error.Data, &data) != nil || data.Kind != git.KindNotMerged {
+		t.Fatalf("expected not_merged error, got %+v", resp.Error)
+	}
+	if resp := env.call("git.branch.delete", rpc.GitBranchDeleteParams{Name: "feature", Force: true}); resp.Error != nil {
+		t.Fatalf("forced delete failed: %s", resp.Error.Message)
+	}
+	if branches := listBranches(); len(branches) != 1 {
+		t.Errorf("expected feature to be deleted, got %+v", branches)
+	}
+}
+
 // Worktree RPC tests
 // Unit tests for worktree logic are in worktree/registry_test.go.
 // These integration tests verify RPC layer behavior only.
@@ -1279,3 +2800,192 @@ func TestHandler_MissingParams(t *testing.T) {
 		t.Errorf("expected 'invalid params' error, got %q", resp.Error.Message)
 	}
 }
+
+func TestHandler_ProtocolNegotiation(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+
+	_, resp := env.connectWith(rpc.AuthParams{Token: "test-token", ProtocolVersion: rpc.ProtocolVersion})
+	if resp.Error != nil {
+		t.Fatalf("auth failed: %s", resp.Error.Message)
+	}
+	var result rpc.AuthResult
+	json.Unmarshal(resp.Result, &result)
+	if result.ProtocolVersion != rpc.ProtocolVersion || result.MinProtocolVersion != rpc.MinProtocolVersion {
+		t.Errorf("unexpected protocol versions %d-%d", result.MinProtocolVersion, result.ProtocolVersion)
+	}
+	for _, c := range []string{rpc.CapabilityAudit, rpc.CapabilityPermissions, rpc.CapabilityNotify, rpc.CapabilitySchedule} {
+		if !slices.Contains(result.Capabilities, c) {
+			t.Errorf("expected capability %q, got %v", c, result.Capabilities)
+		}
+	}
+
+	// Any version below the minimum; 0 means the client predates negotiation
+	_, resp = env.connectWith(rpc.AuthParams{Token: "test-token", ProtocolVersion: -1})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "no longer supported") {
+		t.Errorf("expected outdated client to be rejected, got %+v", resp.Error)
+	}
+}
+
+func TestHandler_Describe(t *testing.T) {
+	env := newTestEnv(t, &mockAgent{})
+	env.conn.SetReadLimit(-1)
+
+	resp := env.call("rpc.describe", nil)
+	if resp.Error != nil {
+		t.Fatalf("rpc.describe failed: %s", resp.Error.Message)
+	}
+	var doc rpc.Document
+	if err := json.Unmarshal(resp.Result, &doc); err != nil {
+		t.Fatalf("failed to unmarshal document: %v", err)
+	}
+	if doc.Info.ProtocolVersion != rpc.ProtocolVersion || doc.Info.Version != "test" {
+		t.Errorf("unexpected info %+v", doc.Info)
+	}
+
+	methods := make(map[string]rpc.MethodDoc)
+	for _, m := range doc.Methods {
+		methods[m.Name] = m
+	}
+	create, ok := methods["worktree.create"]
+	if !ok || create.Role != "operator" {
+		t.Fatalf("expected worktree.create for operators, got %+v", create)
+	}
+	var names []string
+	for _, p := range create.Params {
+		names = append(names, p.Name)
+		if p.Name == "name" && !p.Required {
+			t.Error("expected name to be required")
+		}
+		if p.Name == "base_branch" && p.Required {
+			t.Error("expected base_branch to be optional")
+		}
+	}
+	if strings.Join(names, ",") != "name,branch,base_branch" {
+		t.Errorf("unexpected params %v", names)
+	}
+	if methods["token.list"].Role != "admin" || methods["git.status"].Role != "viewer" {
+		t.Error("expected roles to be annotated")
+	}
+	if _, ok := doc.Components.Schemas["rpc.SessionListItem"]; !ok {
+		t.Error("expected named types in components")
+	}
+
+	// Every dispatched method is described
+	src, err := os.ReadFile("rpc.go")
+	if err != nil {
+		t.Fatalf("failed to read dispatcher: %v", err)
+	}
+	for _, m := range regexp.MustCompile(`case "([a-z_.]+)":`).FindAllStringSubmatch(string(src), -1) {
+		if _, ok := methods[m[1]]; !ok {
+			t.Errorf("method %s is not described", m[1])
+		}
+	}
+	if len(methods) != len(rpc.Methods) {
+		t.Errorf("expected all %d methods with every capability enabled, got %d", len(rpc.Methods), len(methods))
+	}
+}
+
+func TestHandler_Describe_OmitsDisabledCapabilities(t *testing.T) {
+	doc := rpc.Describe("test", nil)
+	for _, m := range doc.Methods {
+		if strings.HasPrefix(m.Name, "schedule.") || strings.HasPrefix(m.Name, "audit.") {
+			t.Errorf("expected %s to be left out without its capability", m.Name)
+		}
+	}
+}
+
+func TestHandler_SessionCheckpointsAndRollback(t *testing.T) {
+	dir := setupGitRepo(t)
+	testFile := filepath.Join(dir, "test.txt")
+	os.WriteFile(testFile, []byte("before turn"), 0644)
+	env := newTestEnvWithWorkDir(t, &mockAgent{events: []agent.AgentEvent{agent.DoneEvent{}}}, dir)
+	wt := env.getMainWorktree()
+	wt.SessionStore.Create(bgCtx, "sess")
+
+	env.sendMessage("sess", "edit the file")
+	select {
+	case <-wt.ProcessManager.GetProcess("sess").Settled():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the turn to end")
+	}
+	os.WriteFile(testFile, []byte("agent edit"), 0644)
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("created"), 0644)
+
+	resp := env.call("session.checkpoints", rpc.SessionCheckpointsParams{SessionID: "sess"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var list rpc.SessionCheckpointsResult
+	json.Unmarshal(resp.Result, &list)
+	if len(list.Checkpoints) != 1 || list.Checkpoints[0].Seq != 1 || list.Checkpoints[0].Message != "edit the file" {
+		t.Fatalf("expected the turn's checkpoint linked to its message, got %+v", list)
+	}
+
+	resp = env.call("session.rollback", rpc.SessionRollbackParams{SessionID: "sess", CheckpointID: list.Checkpoints[0].ID})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	var rollback rpc.SessionRollbackResult
+	json.Unmarshal(resp.Result, &rollback)
+	if content, _ := os.ReadFile(testFile); string(content) != "before turn" {
+		t.Errorf("expected test.txt rolled back, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Error("expected new.txt to be removed")
+	}
+
+	// The backup undoes the rollback
+	if resp := env.call("session.rollback", rpc.SessionRollbackParams{SessionID: "sess", CheckpointID: rollback.Backup}); resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "agent edit" {
+		t.Errorf("expected the backup to restore the edit, got %q", content)
+	}
+
+	resp = env.call("session.rollback", rpc.SessionRollbackParams{SessionID: "sess", CheckpointID: strings.Repeat("0", 40)})
+	if resp.Error == nil || resp.Error.Code != jsonrpc2.CodeInvalidParams {
+		t.Errorf("expected checkpoint not found, got %+v", resp.Error)
+	}
+
+	if resp := env.call("session.delete", rpc.SessionDeleteParams{SessionID: "sess"}); resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error.Message)
+	}
+	if checkpoints, _ := git.Checkpoints(bgCtx, dir, "sess"); len(checkpoints) != 0 {
+		t.Errorf("expected checkpoints deleted with the session, got %+v", checkpoints)
+	}
+}
+
+func TestHandler_SessionRollback_RejectsTurnInProgress(t *testing.T) {
+	dir := setupGitRepo(t)
+	env := newTestEnvWithWorkDir(t, &mockAgent{holdTurn: true, events: []agent.AgentEvent{
+		agent.PermissionRequestEvent{RequestID: "req-1", ToolName: "Bash"},
+	}}, dir)
+	wt := env.getMainWorktree()
+	wt.SessionStore.Create(bgCtx, "sess")
+	wt.SessionStore.Create(bgCtx, "other")
+
+	env.sendMessage("sess", "run the script")
+	deadline := time.Now().Add(2 * time.Second)
+	for wt.ProcessManager.GetProcessState("sess") != string(process.ProcessStateIdle) {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the permission request")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	checkpoints, _ := git.Checkpoints(bgCtx, dir, "sess")
+	if len(checkpoints) != 1 {
+		t.Fatalf("expected the turn's checkpoint, got %+v", checkpoints)
+	}
+
+	// Idle while the permission prompt waits, but still in the turn
+	resp := env.call("session.rollback", rpc.SessionRollbackParams{SessionID: "sess", CheckpointID: checkpoints[0].ID})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "turn in progress") {
+		t.Errorf("expected rollback to be rejected during the turn, got %+v", resp)
+	}
+
+	// Other sessions share the worktree the turn is editing
+	resp = env.call("session.rollback", rpc.SessionRollbackParams{SessionID: "other", CheckpointID: checkpoints[0].ID})
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "turn in progress") {
+		t.Errorf("expected another session's rollback to be rejected too, got %+v", resp)
+	}
+}
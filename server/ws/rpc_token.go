@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pockode/server/auth"
+	"github.com/pockode/server/rpc"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *rpcMethodHandler) handleTokenList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	result := rpc.TokenListResult{Tokens: h.users.List()}
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send token list response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleTokenCreate(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.TokenCreateParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	token, info, err := h.users.Create(params.User, params.Role)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidUser) || errors.Is(err, auth.ErrInvalidRole) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.log.Error("failed to create token", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to create token")
+		return
+	}
+
+	h.log.Info("token created", "tokenId", info.ID, "tokenUser", info.User, "tokenRole", info.Role)
+
+	if err := conn.Reply(ctx, req.ID, rpc.TokenCreateResult{Token: token, Info: info}); err != nil {
+		h.log.Error("failed to send token create response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleTokenRevoke(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params rpc.TokenRevokeParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	if err := h.users.Revoke(params.ID); err != nil {
+		if errors.Is(err, auth.ErrTokenNotFound) {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, err.Error())
+			return
+		}
+		h.log.Error("failed to revoke token", "error", err)
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to revoke token")
+		return
+	}
+
+	// Reply first: the caller's own connection may be among those closed
+	if err := conn.Reply(ctx, req.ID, struct{}{}); err != nil {
+		h.log.Error("failed to send token revoke response", "error", err)
+	}
+
+	closed := h.closeTokenConns(params.ID)
+	h.log.Info("token revoked", "tokenId", params.ID, "closedConnections", closed)
+}
+
+// trackTokenConn records a connection authenticated with an issued token.
+func (h *RPCHandler) trackTokenConn(tokenID string, conn *jsonrpc2.Conn) {
+	if tokenID == "" {
+		return
+	}
+	h.tokenConnsMu.Lock()
+	defer h.tokenConnsMu.Unlock()
+	if h.tokenConns == nil {
+		h.tokenConns = make(map[string]map[*jsonrpc2.Conn]struct{})
+	}
+	if h.tokenConns[tokenID] == nil {
+		h.tokenConns[tokenID] = make(map[*jsonrpc2.Conn]struct{})
+	}
+	h.tokenConns[tokenID][conn] = struct{}{}
+}
+
+func (h *RPCHandler) untrackTokenConn(tokenID string, conn *jsonrpc2.Conn) {
+	h.tokenConnsMu.Lock()
+	defer h.tokenConnsMu.Unlock()
+	delete(h.tokenConns[tokenID], conn)
+	if len(h.tokenConns[tokenID]) == 0 {
+		delete(h.tokenConns, tokenID)
+	}
+}
+
+// closeTokenConns disconnects every connection authenticated with a revoked
+// token and returns how many were closed.
+func (h *RPCHandler) closeTokenConns(tokenID string) int {
+	h.tokenConnsMu.Lock()
+	conns := h.tokenConns[tokenID]
+	delete(h.tokenConns, tokenID)
+	h.tokenConnsMu.Unlock()
+
+	// Each close waits for its peer's close handshake
+	for conn := range conns {
+		go conn.Close()
+	}
+	return len(conns)
+}
@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pockode/server/rpc"
+	"github.com/pockode/server/session"
+	"github.com/pockode/server/worktree"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *rpcMethodHandler) handleUsageSession(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.UsageSessionParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+
+	meta, found, err := wt.SessionStore.Get(params.SessionID)
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to get session")
+		return
+	}
+	if !found {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "session not found")
+		return
+	}
+
+	result := rpc.UsageSessionResult{
+		SessionID: meta.ID,
+		Total:     meta.Usage,
+		Days:      sortedUsageDays(meta.DailyUsage),
+	}
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send usage session response", "error", err)
+	}
+}
+
+func (h *rpcMethodHandler) handleUsageWorktree(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	sessions, err := wt.SessionStore.List()
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to list sessions")
+		return
+	}
+
+	result := rpc.UsageWorktreeResult{
+		Worktree: wt.Name,
+		Sessions: make([]rpc.UsageSessionItem, 0, len(sessions)),
+	}
+	for _, s := range sessions {
+		result.Total = result.Total.Add(s.Usage)
+		result.Sessions = append(result.Sessions, rpc.UsageSessionItem{
+			SessionID: s.ID,
+			Title:     s.Title,
+			Usage:     s.Usage,
+		})
+	}
+
+	if err := conn.Reply(ctx, req.ID, result); err != nil {
+		h.log.Error("failed to send usage worktree response", "error", err)
+	}
+}
+
+// handleUsageDaily sums the per-day usage of every session in the worktree.
+func (h *rpcMethodHandler) handleUsageDaily(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, wt *worktree.Worktree) {
+	var params rpc.UsageDailyParams
+	if err := unmarshalParams(req, &params); err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid params")
+		return
+	}
+	for _, date := range []string{params.From, params.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(session.UsageDayFormat, date); err != nil {
+			h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInvalidParams, "invalid date: "+date)
+			return
+		}
+	}
+
+	sessions, err := wt.SessionStore.List()
+	if err != nil {
+		h.replyError(ctx, conn, req.ID, jsonrpc2.CodeInternalError, "failed to list sessions")
+		return
+	}
+
+	totals := make(map[string]session.Usage)
+	for _, s := range sessions {
+		for date, usage := range s.DailyUsage {
+			// UsageDayFormat sorts lexically, so string comparison is a date comparison
+			if (params.From != "" && date < params.From) || (params.To != "" && date > params.To) {
+				continue
+			}
+			totals[date] = totals[date].Add(usage)
+		}
+	}
+
+	if err := conn.Reply(ctx, req.ID, rpc.UsageDailyResult{Days: sortedUsageDays(totals)}); err != nil {
+		h.log.Error("failed to send usage daily response", "error", err)
+	}
+}
+
+func sortedUsageDays(daily map[string]session.Usage) []rpc.UsageDay {
+	days := make([]rpc.UsageDay, 0, len(daily))
+	for date, usage := range daily {
+		days = append(days, rpc.UsageDay{Date: date, Usage: usage})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days
+}
@@ -0,0 +1,39 @@
+// Service worker for Web Push notifications sent when an agent awaits input.
+
+self.addEventListener("push", (event) => {
+	const payload = event.data ? event.data.json() : null;
+	if (!payload) return;
+
+	const needsAction =
+		payload.kind === "permission_request" ||
+		payload.kind === "ask_user_question";
+
+	event.waitUntil(
+		self.registration.showNotification(payload.title, {
+			body: payload.body,
+			tag: payload.session_id, // newer alerts replace older ones per session
+			renotify: true,
+			requireInteraction: needsAction,
+			data: payload,
+		}),
+	);
+});
+
+self.addEventListener("notificationclick", (event) => {
+	event.notification.close();
+	const { worktree, session_id } = event.notification.data ?? {};
+	const prefix = worktree ? `/w/${encodeURIComponent(worktree)}` : "";
+	const url = session_id ? `${prefix}/s/${session_id}` : "/";
+
+	event.waitUntil(
+		self.clients
+			.matchAll({ type: "window", includeUncontrolled: true })
+			.then((windows) => {
+				const existing = windows.find((w) => "focus" in w);
+				if (existing) {
+					return existing.focus().then((w) => w.navigate(url));
+				}
+				return self.clients.openWindow(url);
+			}),
+	);
+});
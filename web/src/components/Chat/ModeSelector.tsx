@@ -1,4 +1,4 @@
-import { Shield, Zap } from "lucide-react";
+import { ClipboardList, Shield, Zap } from "lucide-react";
 import { useEffect, useState } from "react";
 import type { SessionMode } from "../../types/message";
 
@@ -31,6 +31,13 @@ const modeConfig: Record<SessionMode, ModeConfig> = {
 		iconColor: "text-th-warning",
 		labelColor: "text-th-warning",
 	},
+	plan: {
+		label: "Plan",
+		description: "Plan first, edit after approval",
+		icon: ClipboardList,
+		iconColor: "text-th-accent",
+		labelColor: "text-th-accent",
+	},
 };
 
 function ModeSelector({ mode, onModeChange, disabled = false }: Props) {
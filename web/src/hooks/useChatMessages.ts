@@ -10,6 +10,7 @@ import { useSessionStore } from "../lib/sessionStore";
 import { type ConnectionStatus, useWSStore } from "../lib/wsStore";
 import type {
 	AssistantMessage,
+	ChatEventSeq,
 	Message,
 	PermissionResponseParams,
 	QuestionResponseParams,
@@ -61,6 +62,9 @@ export function useChatMessages({
 	const [isProcessRunning, setIsProcessRunning] = useState(false);
 	const [mode, setModeState] = useState<SessionMode>("default");
 	const subscriptionIdRef = useRef<string | null>(null);
+	// Last history record applied, to resume after it and drop duplicates
+	const lastSeqRef = useRef(0);
+	const [resyncKey, setResyncKey] = useState(0);
 
 	const status = useWSStore((state) => state.status);
 	const actions = useWSStore((state) => state.actions);
@@ -76,6 +80,19 @@ export function useChatMessages({
 	}, [sessionModeFromStore]);
 
 	const handleNotification = useCallback((notification: ServerNotification) => {
+		const { seq, prev_seq } = notification as ChatEventSeq;
+		if (seq !== undefined) {
+			if (seq <= lastSeqRef.current) {
+				return;
+			}
+			if ((prev_seq ?? 0) > lastSeqRef.current) {
+				// Events were lost in transit: resubscribe to fetch them
+				setResyncKey((key) => key + 1);
+				return;
+			}
+			lastSeqRef.current = seq;
+		}
+
 		setIsProcessRunning(notification.type !== "process_ended");
 
 		const event = normalizeEvent(notification);
@@ -88,9 +105,11 @@ export function useChatMessages({
 		setMessages([]);
 		setIsProcessRunning(false);
 		setModeState("default");
+		lastSeqRef.current = 0;
 	}, [sessionId]);
 
-	// Subscribe to chat events when connected
+	// Subscribe to chat events when connected, resuming after reconnects
+	// biome-ignore lint/correctness/useExhaustiveDependencies: resyncKey forces a resubscribe
 	useEffect(() => {
 		if (status !== "connected") {
 			return;
@@ -104,6 +123,7 @@ export function useChatMessages({
 				const result = await chatMessagesSubscribe(
 					sessionId,
 					handleNotification,
+					lastSeqRef.current,
 				);
 				if (cancelled) {
 					// Cleanup if component unmounted during subscribe
@@ -114,7 +134,12 @@ export function useChatMessages({
 				if (result.initial) {
 					setIsProcessRunning(result.initial.state !== "ended");
 					setModeState(result.initial.mode);
-					setMessages(replayHistory(result.initial.history));
+					const { history, after_seq, seq } = result.initial;
+					// A nonzero after_seq continues the messages shown so far
+					setMessages((prev) =>
+						after_seq ? replayHistory(history, prev) : replayHistory(history),
+					);
+					lastSeqRef.current = seq ?? 0;
 				}
 			} catch (err) {
 				console.error("Failed to subscribe to chat messages:", err);
@@ -136,7 +161,7 @@ export function useChatMessages({
 				subscriptionIdRef.current = null;
 			}
 		};
-	}, [status, sessionId, handleNotification]);
+	}, [status, sessionId, handleNotification, resyncKey]);
 
 	const sendUserMessageHandler = useCallback(
 		async (content: string): Promise<boolean> => {
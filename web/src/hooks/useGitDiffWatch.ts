@@ -43,6 +43,7 @@ export function useGitDiffWatch({
 			diff: params.diff,
 			old_content: params.old_content,
 			new_content: params.new_content,
+			hash: params.hash,
 		});
 	}, []);
 
@@ -57,6 +58,7 @@ export function useGitDiffWatch({
 					diff: initial.diff,
 					old_content: initial.old_content,
 					new_content: initial.new_content,
+					hash: initial.hash,
 				});
 				setIsLoading(false);
 			},
@@ -6,6 +6,7 @@ import type {
 	PermissionUpdate,
 	QuestionStatus,
 	ServerNotification,
+	Usage,
 	UserMessage,
 } from "../types/message";
 import { generateUUID } from "../utils/uuid";
@@ -39,6 +40,8 @@ export type NormalizedEvent =
 			type: "permission_response";
 			requestId: string;
 			choice: "deny" | "allow" | "always_allow";
+			ruleId?: string; // set when a permission rule answered the request
+			reason?: "timeout"; // set when nobody answered in time
 	  }
 	| {
 			type: "request_cancelled";
@@ -56,7 +59,8 @@ export type NormalizedEvent =
 			answers: Record<string, string> | null;
 	  }
 	| { type: "raw"; content: string }
-	| { type: "command_output"; content: string };
+	| { type: "command_output"; content: string }
+	| { type: "usage"; usage: Usage };
 
 // Convert snake_case server event to camelCase
 export function normalizeEvent(
@@ -115,6 +119,8 @@ export function normalizeEvent(
 				type: "permission_response",
 				requestId: record.request_id as string,
 				choice: record.choice as "deny" | "allow" | "always_allow",
+				ruleId: record.rule_id as string | undefined,
+				reason: record.reason as "timeout" | undefined,
 			};
 		case "request_cancelled":
 			return {
@@ -141,6 +147,8 @@ export function normalizeEvent(
 				type: "command_output",
 				content: (record.content as string) ?? "",
 			};
+		case "usage":
+			return { type: "usage", usage: (record.usage as Usage) ?? {} };
 		default:
 			// Fallback for unknown types - treat as raw
 			return { type: "raw", content: JSON.stringify(record) };
@@ -270,6 +278,11 @@ export function applyServerEvent(
 		);
 	}
 
+	// Usage is accounting data, not chat content
+	if (event.type === "usage") {
+		return messages;
+	}
+
 	// Tool result updates existing tool_call across all messages (may arrive after interrupt)
 	if (event.type === "tool_result") {
 		return updateToolResult(messages, event.toolUseId, event.toolResult);
@@ -471,8 +484,12 @@ export function applyUserMessage(
 	return [...finalized, userMessage, createAssistantMessage()];
 }
 
-export function replayHistory(records: unknown[]): Message[] {
-	let messages: Message[] = [];
+/** Replay history records, continuing from messages when resuming. */
+export function replayHistory(
+	records: unknown[],
+	initial: Message[] = [],
+): Message[] {
+	let messages = initial;
 
 	for (const record of records) {
 		const event = normalizeEvent(record as Record<string, unknown>);
@@ -0,0 +1,47 @@
+import type { NotifyActions } from "./rpc";
+
+/** Converts a base64url VAPID key to the form PushManager expects */
+function decodeKey(base64url: string): Uint8Array<ArrayBuffer> {
+	const base64 = base64url.replace(/-/g, "+").replace(/_/g, "/");
+	const raw = atob(base64.padEnd(Math.ceil(base64.length / 4) * 4, "="));
+	return Uint8Array.from(raw, (c) => c.charCodeAt(0));
+}
+
+export function isPushSupported(): boolean {
+	return "serviceWorker" in navigator && "PushManager" in window;
+}
+
+/**
+ * Asks for notification permission and registers this browser with the
+ * server. Returns false if the user declined.
+ */
+export async function enablePushNotifications(
+	actions: Pick<NotifyActions, "getVapidKey" | "subscribePush">,
+): Promise<boolean> {
+	if (!isPushSupported()) return false;
+	if ((await Notification.requestPermission()) !== "granted") return false;
+
+	const registration = await navigator.serviceWorker.register("/sw.js");
+	const applicationServerKey = decodeKey(await actions.getVapidKey());
+	const subscription =
+		(await registration.pushManager.getSubscription()) ??
+		(await registration.pushManager.subscribe({
+			userVisibleOnly: true,
+			applicationServerKey,
+		}));
+
+	await actions.subscribePush(subscription.toJSON());
+	return true;
+}
+
+export async function disablePushNotifications(
+	actions: Pick<NotifyActions, "unsubscribePush">,
+): Promise<void> {
+	if (!isPushSupported()) return;
+	const registration = await navigator.serviceWorker.getRegistration();
+	const subscription = await registration?.pushManager.getSubscription();
+	if (!subscription) return;
+
+	await actions.unsubscribePush(subscription.endpoint);
+	await subscription.unsubscribe();
+}
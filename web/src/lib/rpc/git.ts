@@ -1,10 +1,68 @@
-import type { JSONRPCRequester } from "json-rpc-2.0";
-import type { GitStatus } from "../../types/git";
+import { JSONRPCErrorException, type JSONRPCRequester } from "json-rpc-2.0";
+import {
+	GIT_ERROR_CODE,
+	type GitBlame,
+	type GitBranch,
+	type GitCommitDetail,
+	type GitCommitParams,
+	type GitErrorData,
+	type GitHunkSelection,
+	type GitLogParams,
+	type GitLogResult,
+	type GitStatus,
+	type GitTrashEntry,
+} from "../../types/git";
 
 export interface GitActions {
 	getStatus: () => Promise<GitStatus>;
 	stage: (paths: string[]) => Promise<void>;
 	unstage: (paths: string[]) => Promise<void>;
+	stageHunks: (
+		path: string,
+		hash: string,
+		hunks: GitHunkSelection[],
+	) => Promise<void>;
+	unstageHunks: (
+		path: string,
+		hash: string,
+		hunks: GitHunkSelection[],
+	) => Promise<void>;
+	discardHunks: (
+		path: string,
+		hash: string,
+		hunks: GitHunkSelection[],
+	) => Promise<GitTrashEntry>;
+	discard: (paths: string[], staged?: boolean) => Promise<GitTrashEntry>;
+	restoreDiscard: (id: string) => Promise<GitTrashEntry>;
+	listDiscards: () => Promise<GitTrashEntry[]>;
+	commit: (params: GitCommitParams) => Promise<string>;
+	getLog: (params?: GitLogParams) => Promise<GitLogResult>;
+	showCommit: (rev: string, path?: string) => Promise<GitCommitDetail>;
+	blame: (path: string, rev?: string) => Promise<GitBlame>;
+	listBranches: () => Promise<GitBranch[]>;
+	createBranch: (
+		name: string,
+		options?: { startPoint?: string; checkout?: boolean },
+	) => Promise<void>;
+	checkoutBranch: (name: string) => Promise<void>;
+	deleteBranch: (name: string, force?: boolean) => Promise<void>;
+	fetchRemotes: () => Promise<void>;
+	pull: () => Promise<void>;
+	push: (forceWithLease?: boolean) => Promise<void>;
+}
+
+/**
+ * Returns the details of a git failure the user can act on, such as a
+ * conflict or a rejected push, or null for other errors.
+ */
+export function getGitErrorData(error: unknown): GitErrorData | null {
+	if (
+		error instanceof JSONRPCErrorException &&
+		error.code === GIT_ERROR_CODE
+	) {
+		return (error.data as GitErrorData) ?? null;
+	}
+	return null;
 }
 
 export function createGitActions(
@@ -28,5 +86,84 @@ export function createGitActions(
 		unstage: async (paths: string[]): Promise<void> => {
 			await requireClient().request("git.reset", { paths });
 		},
+		stageHunks: async (path, hash, hunks): Promise<void> => {
+			await requireClient().request("git.hunk.stage", { path, hash, hunks });
+		},
+		unstageHunks: async (path, hash, hunks): Promise<void> => {
+			await requireClient().request("git.hunk.unstage", {
+				path,
+				hash,
+				hunks,
+			});
+		},
+		discardHunks: async (path, hash, hunks): Promise<GitTrashEntry> => {
+			return requireClient().request("git.hunk.discard", {
+				path,
+				hash,
+				hunks,
+			});
+		},
+		discard: async (
+			paths: string[],
+			staged = false,
+		): Promise<GitTrashEntry> => {
+			return requireClient().request("git.discard", { paths, staged });
+		},
+		restoreDiscard: async (id: string): Promise<GitTrashEntry> => {
+			return requireClient().request("git.discard.restore", { id });
+		},
+		listDiscards: async (): Promise<GitTrashEntry[]> => {
+			const result: { entries: GitTrashEntry[] } =
+				await requireClient().request("git.discard.list", {});
+			return result.entries;
+		},
+		commit: async (params: GitCommitParams): Promise<string> => {
+			const result: { hash: string } = await requireClient().request(
+				"git.commit",
+				params,
+			);
+			return result.hash;
+		},
+		getLog: async (params: GitLogParams = {}): Promise<GitLogResult> => {
+			return requireClient().request("git.log", params);
+		},
+		showCommit: async (
+			rev: string,
+			path?: string,
+		): Promise<GitCommitDetail> => {
+			return requireClient().request("git.show", { rev, path });
+		},
+		blame: async (path: string, rev?: string): Promise<GitBlame> => {
+			return requireClient().request("git.blame", { path, rev });
+		},
+		listBranches: async (): Promise<GitBranch[]> => {
+			const result: { branches: GitBranch[] } =
+				await requireClient().request("git.branch.list", {});
+			return result.branches;
+		},
+		createBranch: async (name, options = {}): Promise<void> => {
+			await requireClient().request("git.branch.create", {
+				name,
+				start_point: options.startPoint,
+				checkout: options.checkout ?? false,
+			});
+		},
+		checkoutBranch: async (name: string): Promise<void> => {
+			await requireClient().request("git.branch.checkout", { name });
+		},
+		deleteBranch: async (name: string, force = false): Promise<void> => {
+			await requireClient().request("git.branch.delete", { name, force });
+		},
+		fetchRemotes: async (): Promise<void> => {
+			await requireClient().request("git.fetch", {});
+		},
+		pull: async (): Promise<void> => {
+			await requireClient().request("git.pull", {});
+		},
+		push: async (forceWithLease = false): Promise<void> => {
+			await requireClient().request("git.push", {
+				force_with_lease: forceWithLease,
+			});
+		},
 	};
 }
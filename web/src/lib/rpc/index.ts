@@ -5,7 +5,13 @@ export {
 	createCommandActions,
 } from "./command";
 export { createFileActions, type FileActions } from "./file";
-export { createGitActions, type GitActions } from "./git";
+export {
+	createGitActions,
+	type GitActions,
+	getGitErrorData,
+} from "./git";
+export { createNotifyActions, type NotifyActions } from "./notify";
+export { createScheduleActions, type ScheduleActions } from "./schedule";
 export { createSessionActions, type SessionActions } from "./session";
 export { createSettingsActions, type SettingsActions } from "./settings";
 export { createWorktreeActions, type WorktreeActions } from "./worktree";
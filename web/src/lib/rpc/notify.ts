@@ -0,0 +1,66 @@
+import type { JSONRPCRequester } from "json-rpc-2.0";
+import type {
+	NotifyVapidKeyResult,
+	NotifyWebhookAddParams,
+	Webhook,
+} from "../../types/message";
+
+export interface NotifyActions {
+	getVapidKey: () => Promise<string>;
+	subscribePush: (subscription: PushSubscriptionJSON) => Promise<void>;
+	unsubscribePush: (endpoint: string) => Promise<void>;
+	listWebhooks: () => Promise<Webhook[]>;
+	addWebhook: (params: NotifyWebhookAddParams) => Promise<Webhook>;
+	removeWebhook: (id: string) => Promise<void>;
+}
+
+export function createNotifyActions(
+	getClient: () => JSONRPCRequester<void> | null,
+): NotifyActions {
+	const requireClient = (): JSONRPCRequester<void> => {
+		const client = getClient();
+		if (!client) {
+			throw new Error("Not connected");
+		}
+		return client;
+	};
+
+	return {
+		getVapidKey: async (): Promise<string> => {
+			const result: NotifyVapidKeyResult = await requireClient().request(
+				"notify.vapid_key",
+				{},
+			);
+			return result.public_key;
+		},
+
+		subscribePush: async (
+			subscription: PushSubscriptionJSON,
+		): Promise<void> => {
+			await requireClient().request("notify.subscribe", {
+				endpoint: subscription.endpoint,
+				keys: subscription.keys,
+			});
+		},
+
+		unsubscribePush: async (endpoint: string): Promise<void> => {
+			await requireClient().request("notify.unsubscribe", { endpoint });
+		},
+
+		listWebhooks: async (): Promise<Webhook[]> => {
+			const result: { webhooks: Webhook[] } = await requireClient().request(
+				"notify.webhook.list",
+				{},
+			);
+			return result.webhooks;
+		},
+
+		addWebhook: async (params: NotifyWebhookAddParams): Promise<Webhook> => {
+			return requireClient().request("notify.webhook.add", params);
+		},
+
+		removeWebhook: async (id: string): Promise<void> => {
+			await requireClient().request("notify.webhook.remove", { id });
+		},
+	};
+}
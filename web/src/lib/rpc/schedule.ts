@@ -0,0 +1,65 @@
+import type { JSONRPCRequester } from "json-rpc-2.0";
+import type {
+	Schedule,
+	ScheduleCreateParams,
+	ScheduleRun,
+	ScheduleRunsParams,
+	ScheduleUpdateParams,
+} from "../../types/message";
+
+export interface ScheduleActions {
+	listSchedules: () => Promise<Schedule[]>;
+	createSchedule: (params: ScheduleCreateParams) => Promise<Schedule>;
+	updateSchedule: (params: ScheduleUpdateParams) => Promise<Schedule>;
+	deleteSchedule: (id: string) => Promise<void>;
+	runSchedule: (id: string) => Promise<ScheduleRun>;
+	listScheduleRuns: (params?: ScheduleRunsParams) => Promise<ScheduleRun[]>;
+}
+
+export function createScheduleActions(
+	getClient: () => JSONRPCRequester<void> | null,
+): ScheduleActions {
+	const requireClient = (): JSONRPCRequester<void> => {
+		const client = getClient();
+		if (!client) {
+			throw new Error("Not connected");
+		}
+		return client;
+	};
+
+	return {
+		listSchedules: async (): Promise<Schedule[]> => {
+			const result: { schedules: Schedule[] } = await requireClient().request(
+				"schedule.list",
+				{},
+			);
+			return result.schedules;
+		},
+
+		createSchedule: async (params: ScheduleCreateParams): Promise<Schedule> => {
+			return requireClient().request("schedule.create", params);
+		},
+
+		updateSchedule: async (params: ScheduleUpdateParams): Promise<Schedule> => {
+			return requireClient().request("schedule.update", params);
+		},
+
+		deleteSchedule: async (id: string): Promise<void> => {
+			await requireClient().request("schedule.delete", { id });
+		},
+
+		runSchedule: async (id: string): Promise<ScheduleRun> => {
+			return requireClient().request("schedule.run", { id });
+		},
+
+		listScheduleRuns: async (
+			params: ScheduleRunsParams = {},
+		): Promise<ScheduleRun[]> => {
+			const result: { runs: ScheduleRun[] } = await requireClient().request(
+				"schedule.runs",
+				params,
+			);
+			return result.runs;
+		},
+	};
+}
@@ -1,9 +1,20 @@
 import type { JSONRPCRequester } from "json-rpc-2.0";
 import type {
+	ExportFormat,
+	SessionCheckpoint,
+	SessionCheckpointsParams,
+	SessionCheckpointsResult,
 	SessionDeleteParams,
+	SessionExportParams,
+	SessionExportResult,
+	SessionForkParams,
+	SessionImportParams,
 	SessionListItem,
 	SessionMode,
+	SessionRollbackParams,
+	SessionRollbackResult,
 	SessionSetModeParams,
+	SessionSetMutedParams,
 	SessionUpdateTitleParams,
 } from "../../types/message";
 
@@ -12,6 +23,18 @@ export interface SessionActions {
 	deleteSession: (sessionId: string) => Promise<void>;
 	updateSessionTitle: (sessionId: string, title: string) => Promise<void>;
 	setSessionMode: (sessionId: string, mode: SessionMode) => Promise<void>;
+	setSessionMuted: (sessionId: string, muted: boolean) => Promise<void>;
+	forkSession: (sessionId: string, index?: number) => Promise<SessionListItem>;
+	exportSession: (
+		sessionId: string,
+		format: ExportFormat,
+	) => Promise<SessionExportResult>;
+	importSession: (bundle: unknown) => Promise<SessionListItem>;
+	listCheckpoints: (sessionId: string) => Promise<SessionCheckpoint[]>;
+	rollbackSession: (
+		sessionId: string,
+		checkpointId: string,
+	) => Promise<SessionRollbackResult>;
 }
 
 export function createSessionActions(
@@ -55,5 +78,61 @@ export function createSessionActions(
 				mode,
 			} as SessionSetModeParams);
 		},
+
+		setSessionMuted: async (
+			sessionId: string,
+			muted: boolean,
+		): Promise<void> => {
+			await requireClient().request("session.set_muted", {
+				session_id: sessionId,
+				muted,
+			} as SessionSetMutedParams);
+		},
+
+		forkSession: async (
+			sessionId: string,
+			index?: number,
+		): Promise<SessionListItem> => {
+			return requireClient().request("session.fork", {
+				session_id: sessionId,
+				index,
+			} as SessionForkParams);
+		},
+
+		exportSession: async (
+			sessionId: string,
+			format: ExportFormat,
+		): Promise<SessionExportResult> => {
+			return requireClient().request("session.export", {
+				session_id: sessionId,
+				format,
+			} as SessionExportParams);
+		},
+
+		importSession: async (bundle: unknown): Promise<SessionListItem> => {
+			return requireClient().request("session.import", {
+				bundle,
+			} as SessionImportParams);
+		},
+
+		listCheckpoints: async (
+			sessionId: string,
+		): Promise<SessionCheckpoint[]> => {
+			const result: SessionCheckpointsResult =
+				await requireClient().request("session.checkpoints", {
+					session_id: sessionId,
+				} as SessionCheckpointsParams);
+			return result.checkpoints;
+		},
+
+		rollbackSession: async (
+			sessionId: string,
+			checkpointId: string,
+		): Promise<SessionRollbackResult> => {
+			return requireClient().request("session.rollback", {
+				session_id: sessionId,
+				checkpoint_id: checkpointId,
+			} as SessionRollbackParams);
+		},
 	};
 }
@@ -1,3 +1,9 @@
 declare const __APP_VERSION__: string;
 
 export const APP_VERSION = __APP_VERSION__;
+
+/** RPC protocol version this build speaks, sent in auth. */
+export const PROTOCOL_VERSION = 1;
+
+/** Oldest server protocol version this build can work with. */
+export const MIN_SERVER_PROTOCOL_VERSION = 1;
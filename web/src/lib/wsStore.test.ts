@@ -71,6 +71,16 @@ class MockWebSocket {
 		this.readyState = MockWebSocket.CLOSED;
 		this.onclose?.();
 	}
+	mockAuthResult(result: Record<string, unknown>) {
+		this.send = vi.fn((data: string) => {
+			const parsed = JSON.parse(data);
+			if (parsed.id !== undefined && parsed.method === "auth") {
+				queueMicrotask(() => {
+					this.simulateMessage({ jsonrpc: "2.0", id: parsed.id, result });
+				});
+			}
+		});
+	}
 	mockAuthFailure() {
 		this.send = vi.fn((data: string) => {
 			const parsed = JSON.parse(data);
@@ -168,7 +178,10 @@ describe("wsStore", () => {
 			const sentData = JSON.parse(ws?.send.mock.calls[0][0] ?? "{}");
 			expect(sentData.jsonrpc).toBe("2.0");
 			expect(sentData.method).toBe("auth");
-			expect(sentData.params).toEqual({ token: TEST_TOKEN });
+			expect(sentData.params).toEqual({
+				token: TEST_TOKEN,
+				protocol_version: 1,
+			});
 		});
 
 		it("sets status to auth_failed on auth failure", async () => {
@@ -252,6 +265,62 @@ describe("wsStore", () => {
 		});
 	});
 
+	describe("version negotiation", () => {
+		afterEach(() => {
+			sessionStorage.clear();
+		});
+
+		async function connectWithAuthResult(result: Record<string, unknown>) {
+			const wsActions = await getWsActions();
+			wsActions.connect(TEST_TOKEN);
+			getMockWs()?.mockAuthResult(result);
+			getMockWs()?.simulateOpen();
+			await vi.runAllTimersAsync();
+		}
+
+		it("stores server capabilities", async () => {
+			const useWSStore = await getUseWSStore();
+
+			await connectWithAuthResult({
+				version: "test",
+				protocol_version: 1,
+				min_protocol_version: 1,
+				capabilities: ["schedule"],
+			});
+
+			expect(useWSStore.getState().status).toBe("connected");
+			expect(useWSStore.getState().capabilities).toEqual(["schedule"]);
+		});
+
+		it("continues with a compatible server after reloading once", async () => {
+			const useWSStore = await getUseWSStore();
+			sessionStorage.setItem("pockode:reloaded-for-version", "v2");
+
+			await connectWithAuthResult({
+				version: "v2",
+				protocol_version: 2,
+				min_protocol_version: 1,
+			});
+
+			expect(useWSStore.getState().status).toBe("connected");
+		});
+
+		it("stops with an incompatible server after reloading once", async () => {
+			const useWSStore = await getUseWSStore();
+			sessionStorage.setItem("pockode:reloaded-for-version", "v3");
+
+			await connectWithAuthResult({
+				version: "v3",
+				protocol_version: 3,
+				min_protocol_version: 2,
+			});
+
+			expect(useWSStore.getState().status).toBe("error");
+			vi.advanceTimersByTime(3000);
+			expect(mockWsInstances.length).toBe(1);
+		});
+	});
+
 	describe("disconnect", () => {
 		it("closes WebSocket and sets status to disconnected", async () => {
 			const wsActions = await getWsActions();
@@ -26,16 +26,24 @@ import {
 	createCommandActions,
 	createFileActions,
 	createGitActions,
+	createNotifyActions,
+	createScheduleActions,
 	createSessionActions,
 	createSettingsActions,
 	createWorktreeActions,
 	type FileActions,
 	type GitActions,
+	type NotifyActions,
+	type ScheduleActions,
 	type SessionActions,
 	type SettingsActions,
 	type WorktreeActions,
 } from "./rpc";
-import { APP_VERSION } from "./version";
+import {
+	APP_VERSION,
+	MIN_SERVER_PROTOCOL_VERSION,
+	PROTOCOL_VERSION,
+} from "./version";
 import { worktreeActions } from "./worktreeStore";
 
 export type ConnectionStatus =
@@ -82,6 +90,7 @@ export interface WatchActions {
 	chatMessagesSubscribe: (
 		sessionId: string,
 		callback: (notification: ServerNotification) => void,
+		afterSeq?: number,
 	) => Promise<WatchSubscribeResult<ChatMessagesSubscribeResult>>;
 	chatMessagesUnsubscribe: (id: string) => Promise<void>;
 	settingsSubscribe: (
@@ -97,6 +106,8 @@ type RPCActions = ConnectionActions &
 	SettingsActions &
 	FileActions &
 	GitActions &
+	NotifyActions &
+	ScheduleActions &
 	WatchActions &
 	WorktreeActions;
 
@@ -104,6 +115,8 @@ interface WSState {
 	status: ConnectionStatus;
 	projectTitle: string;
 	workDir: string;
+	/** Optional server features, e.g. "schedule" */
+	capabilities: string[];
 	actions: RPCActions;
 }
 
@@ -258,6 +271,8 @@ const sessionActions = createSessionActions(getClient);
 const settingsActions = createSettingsActions(getClient);
 const fileActions = createFileActions(getClient);
 const gitActions = createGitActions(getClient);
+const notifyActions = createNotifyActions(getClient);
+const scheduleActions = createScheduleActions(getClient);
 const worktreeRpcActions = createWorktreeActions(getClient);
 
 // Listener for worktree deleted notification
@@ -273,6 +288,34 @@ export function setWorktreeDeletedListener(
 	worktreeDeletedListener = listener;
 }
 
+const RELOADED_FOR_VERSION_KEY = "pockode:reloaded-for-version";
+
+type VersionCheck = "ok" | "reload" | "incompatible";
+
+/**
+ * Decide what to do when the server runs a different version than this build.
+ * Reloading picks up the matching build, but a relay may keep serving an older
+ * one, so reload once per server version and then continue as long as the
+ * protocols overlap.
+ */
+function checkServerVersion(result: AuthResult): VersionCheck {
+	if (result.version === APP_VERSION) {
+		return "ok";
+	}
+	// Servers predating negotiation give no way to tell compatibility
+	if (result.protocol_version === undefined) {
+		return "reload";
+	}
+	if (sessionStorage.getItem(RELOADED_FOR_VERSION_KEY) !== result.version) {
+		sessionStorage.setItem(RELOADED_FOR_VERSION_KEY, result.version);
+		return "reload";
+	}
+	const compatible =
+		result.protocol_version >= MIN_SERVER_PROTOCOL_VERSION &&
+		(result.min_protocol_version ?? 0) <= PROTOCOL_VERSION;
+	return compatible ? "ok" : "incompatible";
+}
+
 // Listener called when auth fails due to non-existent worktree
 type WorktreeNotFoundListener = () => void;
 let worktreeNotFoundListener: WorktreeNotFoundListener | null = null;
@@ -287,6 +330,7 @@ export const useWSStore = create<WSState>((set, get) => ({
 	status: "disconnected",
 	projectTitle: "",
 	workDir: "",
+	capabilities: [],
 
 	actions: {
 		connect: (token: string) => {
@@ -321,15 +365,25 @@ export const useWSStore = create<WSState>((set, get) => ({
 					const result = (await rpcRequester.request("auth", {
 						token,
 						worktree: currentWorktree || undefined,
+						protocol_version: PROTOCOL_VERSION,
 					} as AuthParams)) as AuthResult;
 
-					if (result.version !== APP_VERSION) {
+					const versionCheck = checkServerVersion(result);
+					if (versionCheck === "reload") {
 						console.info(
 							`Version mismatch: client=${APP_VERSION}, server=${result.version}. Reloading...`,
 						);
 						window.location.reload();
 						return;
 					}
+					if (versionCheck === "incompatible") {
+						console.error(
+							`Protocol mismatch: client=${PROTOCOL_VERSION}, server=${result.protocol_version} (min ${result.min_protocol_version})`,
+						);
+						set({ status: "error" });
+						socket.close(1000, "incompatible");
+						return;
+					}
 
 					document.title = `${result.title} | Pockode`;
 
@@ -337,6 +391,7 @@ export const useWSStore = create<WSState>((set, get) => ({
 						status: "connected",
 						projectTitle: result.title,
 						workDir: result.work_dir,
+						capabilities: result.capabilities ?? [],
 					});
 					reconnectAttempts = 0;
 				} catch (error) {
@@ -390,9 +445,10 @@ export const useWSStore = create<WSState>((set, get) => ({
 				clearWatchSubscriptions();
 
 				const currentStatus = get().status;
-				// Don't reconnect on auth failure or intentional disconnect
+				// Don't reconnect on auth failure, incompatible server or intentional disconnect
 				if (
 					currentStatus === "auth_failed" ||
+					currentStatus === "error" ||
 					currentStatus === "disconnected"
 				) {
 					return;
@@ -563,6 +619,7 @@ export const useWSStore = create<WSState>((set, get) => ({
 		chatMessagesSubscribe: async (
 			sessionId: string,
 			callback: (notification: ServerNotification) => void,
+			afterSeq?: number,
 		) => {
 			const client = getClient();
 			if (!client) {
@@ -570,6 +627,7 @@ export const useWSStore = create<WSState>((set, get) => ({
 			}
 			const result = (await client.request("chat.messages.subscribe", {
 				session_id: sessionId,
+				after_seq: afterSeq || undefined,
 			})) as ChatMessagesSubscribeResult;
 			chatMessagesCallbacks.set(result.id, callback);
 			return { id: result.id, initial: result };
@@ -621,6 +679,8 @@ export const useWSStore = create<WSState>((set, get) => ({
 		...settingsActions,
 		...fileActions,
 		...gitActions,
+		...notifyActions,
+		...scheduleActions,
 		...worktreeRpcActions,
 	},
 }));
@@ -705,5 +765,6 @@ export function resetWSStore() {
 		status: "disconnected",
 		projectTitle: "",
 		workDir: "",
+		capabilities: [],
 	});
 }
@@ -13,6 +13,18 @@ export interface GitDiffData {
 	diff: string;
 	old_content: string;
 	new_content: string;
+	/** Identifies the diff for the hunk actions; absent when there is no diff */
+	hash?: string;
+}
+
+/**
+ * Changes picked from one hunk of a diff. Line ranges index the hunk's body,
+ * the lines after its "@@" header, from start up to but not including end.
+ */
+export interface GitHunkSelection {
+	hunk: number;
+	/** Omit to select the whole hunk */
+	lines?: { start: number; end: number }[];
 }
 
 export interface GitDiffSubscribeResult extends GitDiffData {
@@ -23,6 +35,112 @@ export interface GitDiffChangedNotification extends GitDiffData {
 	id: string;
 }
 
+export interface GitLogEntry {
+	hash: string;
+	parents: string[];
+	author_name: string;
+	author_email: string;
+	date: string;
+	subject: string;
+}
+
+export interface GitLogParams {
+	limit?: number;
+	skip?: number;
+	/** Only commits touching this file or directory */
+	path?: string;
+}
+
+export interface GitLogResult {
+	commits: GitLogEntry[];
+	has_more: boolean;
+}
+
+/**
+ * A file changed by a commit, diffed against the first parent. The diff and
+ * contents are only filled in when git.show is asked for the file by path.
+ */
+export interface GitCommitFile extends GitDiffData {
+	path: string;
+	/** Set for renames and copies */
+	old_path?: string;
+	status: "A" | "M" | "D" | "R" | "C" | "T";
+	/** Contents are left empty for binary files */
+	binary: boolean;
+}
+
+export interface GitCommitDetail extends GitLogEntry {
+	body: string;
+	files: GitCommitFile[];
+}
+
+export interface GitBlameCommit {
+	hash: string;
+	author_name: string;
+	author_email: string;
+	date: string;
+	summary: string;
+}
+
+export interface GitBlameLine {
+	/** 1-based */
+	line: number;
+	/** Key of GitBlame.commits; all zeros for uncommitted lines */
+	hash: string;
+	content: string;
+}
+
+export interface GitBlame {
+	lines: GitBlameLine[];
+	commits: Record<string, GitBlameCommit>;
+}
+
+export interface GitBranch {
+	/** e.g. "main" or "origin/main" */
+	name: string;
+	remote: boolean;
+	current: boolean;
+	hash: string;
+	upstream?: string;
+	ahead: number;
+	behind: number;
+}
+
+/** A discard that git.discard.restore can undo. */
+export interface GitTrashEntry {
+	id: string;
+	created_at: string;
+	/** The index was reset to HEAD too */
+	staged: boolean;
+	paths: string[];
+}
+
+export interface GitCommitParams {
+	message: string;
+	amend?: boolean;
+	sign_off?: boolean;
+}
+
+/** JSON-RPC error code of git failures the user can act on. */
+export const GIT_ERROR_CODE = -32001;
+
+export type GitErrorKind =
+	| "conflict"
+	| "rejected"
+	| "nothing_to_commit"
+	| "dirty"
+	| "not_merged"
+	| "auth_failed"
+	| "stale";
+
+/** Data of a GIT_ERROR_CODE error. */
+export interface GitErrorData {
+	kind: GitErrorKind;
+	/** Conflicted paths for "conflict" */
+	files?: string[];
+	output?: string;
+}
+
 /**
  * Flatten GitStatus into a list of files with full paths.
  * Submodule files are prefixed with their submodule path.
@@ -1,4 +1,4 @@
-export type SessionMode = "default" | "yolo";
+export type SessionMode = "default" | "yolo" | "plan";
 export type ProcessState = "idle" | "running" | "ended";
 
 export interface SessionListItem {
@@ -7,9 +7,39 @@ export interface SessionListItem {
 	created_at: string;
 	updated_at: string;
 	mode: SessionMode;
+	agent?: string;
+	config?: SessionConfig;
+	usage?: Usage;
+	daily_usage?: Record<string, Usage>;
+	forked_from?: ForkOrigin;
+	muted?: boolean;
 	state: ProcessState;
 }
 
+export interface ForkOrigin {
+	session_id: string;
+	records: number;
+	resume: boolean;
+}
+
+export interface Usage {
+	input_tokens?: number;
+	output_tokens?: number;
+	cache_creation_tokens?: number;
+	cache_read_tokens?: number;
+	cost_usd?: number;
+	turns?: number;
+	duration_ms?: number;
+}
+
+export interface SessionConfig {
+	model?: string;
+	system_prompt?: string;
+	allowed_tools?: string[];
+	disallowed_tools?: string[];
+	max_turns?: number;
+}
+
 export type MessageStatus =
 	| "sending"
 	| "streaming"
@@ -146,6 +176,7 @@ export interface AskUserQuestionRequest {
 export interface AuthParams {
 	token: string;
 	worktree?: string;
+	protocol_version?: number;
 }
 
 export interface WorktreeInfo {
@@ -177,11 +208,271 @@ export interface AuthResult {
 	version: string;
 	title: string;
 	work_dir: string;
+	user: string;
+	role: Role;
+	// Absent on servers predating protocol negotiation
+	protocol_version?: number;
+	min_protocol_version?: number;
+	capabilities?: string[];
+}
+
+export type Role = "viewer" | "operator" | "admin";
+
+export interface TokenInfo {
+	id: string;
+	user: string;
+	role: Role;
+	created_at: string;
+}
+
+export interface AuditEntry {
+	seq: number;
+	time: string;
+	actor: string;
+	role?: Role;
+	conn_id?: string;
+	worktree: string;
+	method: string;
+	params?: unknown;
+	denied?: boolean;
+	prev: string;
+	hash: string;
+}
+
+export interface AuditListParams {
+	actor?: string;
+	worktree?: string;
+	method?: string;
+	from?: string;
+	to?: string;
+	before_seq?: number;
+	limit?: number;
+}
+
+export interface AuditListResult {
+	entries: AuditEntry[];
+}
+
+export interface AuditVerifyResult {
+	ok: boolean;
+	entries: number;
+	first_seq: number;
+	last_seq: number;
+	/** Chain head; record it to detect later truncation */
+	last_hash?: string;
+	broken_seq?: number;
+	reason?: string;
+}
+
+export type PolicyAction = "allow" | "deny" | "ask";
+export type PolicyScope = "global" | "worktree" | "session";
+
+export interface PolicyRule {
+	id: string;
+	action: PolicyAction;
+	tool: string;
+	pattern?: string;
+	scope: PolicyScope;
+	worktree?: string;
+	session_id?: string;
+	created_by?: string;
+	created_at: string;
+}
+
+export interface PermissionsListParams {
+	scope?: PolicyScope;
+	worktree?: string;
+	session_id?: string;
+}
+
+export interface PermissionsListResult {
+	rules: PolicyRule[];
+}
+
+export type TimeoutDecision = "deny" | "allow" | "escalate";
+
+export interface PermissionTimeout {
+	scope: PolicyScope;
+	worktree?: string;
+	session_id?: string;
+	seconds: number;
+	decision: TimeoutDecision;
+	updated_by?: string;
+	updated_at: string;
+}
+
+export interface PermissionsTimeoutSetParams {
+	scope: PolicyScope;
+	worktree?: string;
+	session_id?: string;
+	seconds: number;
+	decision: TimeoutDecision;
+}
+
+export interface PermissionsTimeoutClearParams {
+	scope: PolicyScope;
+	worktree?: string;
+	session_id?: string;
+}
+
+export interface PermissionsAddParams {
+	action: PolicyAction;
+	tool: string;
+	pattern?: string;
+	scope: PolicyScope;
+	worktree?: string;
+	session_id?: string;
+}
+
+export type NotificationKind =
+	| "permission_request"
+	| "ask_user_question"
+	| "done"
+	| "error";
+
+/** Payload of a Web Push message, as received by the service worker */
+export interface PushNotificationPayload {
+	kind: NotificationKind;
+	worktree: string;
+	session_id: string;
+	title: string;
+	body: string;
+}
+
+export interface NotifyVapidKeyResult {
+	public_key: string;
+}
+
+export interface Webhook {
+	id: string;
+	url: string;
+	topic?: string;
+	created_by?: string;
+	created_at: string;
+}
+
+export interface NotifyWebhookAddParams {
+	url: string;
+	topic?: string;
+}
+
+export interface Schedule {
+	id: string;
+	name: string;
+	cron: string;
+	worktree: string;
+	session_id?: string;
+	mode?: SessionMode;
+	prompt: string;
+	enabled: boolean;
+	created_by?: string;
+	created_at: string;
+	updated_at: string;
+}
+
+export interface ScheduleCreateParams {
+	name: string;
+	cron: string;
+	worktree?: string;
+	session_id?: string;
+	mode?: SessionMode;
+	prompt: string;
+	enabled?: boolean;
+}
+
+export type ScheduleUpdateParams = { id: string } & Partial<
+	Omit<ScheduleCreateParams, "enabled"> & { enabled: boolean }
+>;
+
+export type ScheduleRunStatus =
+	| "running"
+	| "succeeded"
+	| "failed"
+	| "interrupted"
+	| "skipped";
+
+export interface ScheduleRun {
+	id: string;
+	schedule_id: string;
+	/** "cron" or the user who ran it manually */
+	trigger: string;
+	session_id?: string;
+	status: ScheduleRunStatus;
+	error?: string;
+	started_at: string;
+	finished_at?: string;
+}
+
+export interface ScheduleRunsParams {
+	schedule_id?: string;
+	limit?: number;
+}
+
+export interface TokenCreateParams {
+	user: string;
+	role: Role;
+}
+
+export interface TokenCreateResult {
+	token: string;
+	info: TokenInfo;
+}
+
+export interface Attachment {
+	type: "image" | "file";
+	name?: string;
+	path?: string;
+	media_type?: string;
+	data?: string;
 }
 
 export interface MessageParams {
 	session_id: string;
 	content: string;
+	attachments?: Attachment[];
+}
+
+export interface MessageResult {
+	queue_id?: string;
+}
+
+export interface QueuedMessage {
+	id: string;
+	content: string;
+	attachments?: Attachment[];
+	user?: string;
+	created_at: string;
+}
+
+export interface ChatQueueListParams {
+	session_id: string;
+}
+
+export interface ChatQueueListResult {
+	queue: QueuedMessage[];
+	/** Set while an interrupt holds the queue until resumed */
+	paused?: boolean;
+}
+
+export interface ChatQueueUpdateParams {
+	session_id: string;
+	id: string;
+	content: string;
+}
+
+export interface ChatQueueCancelParams {
+	session_id: string;
+	id: string;
+}
+
+export interface ChatQueueResumeParams {
+	session_id: string;
+}
+
+export interface ChatQueueNotificationParams {
+	id: string;
+	queue: QueuedMessage[];
+	paused?: boolean;
 }
 
 export interface InterruptParams {
@@ -232,9 +523,101 @@ export interface ChatMessagesSubscribeParams {
 
 export interface ChatMessagesSubscribeResult {
 	id: string;
+	/** Records after after_seq; a zero after_seq means the full history */
 	history: unknown[];
+	after_seq?: number;
+	/** Sequence number of the last history record */
+	seq?: number;
 	state: ProcessState;
 	mode: SessionMode;
+	queue: QueuedMessage[];
+	queue_paused?: boolean;
+}
+
+export interface SessionApprovePlanParams {
+	session_id: string;
+	mode?: Exclude<SessionMode, "plan">;
+	request_id?: string;
+}
+
+export interface SessionForkParams {
+	session_id: string;
+	index?: number;
+}
+
+export type ExportFormat = "markdown" | "html" | "json";
+
+export interface SessionExportParams {
+	session_id: string;
+	format: ExportFormat;
+}
+
+export interface SessionExportResult {
+	filename: string;
+	content_type: string;
+	content: string;
+}
+
+export interface SessionImportParams {
+	bundle: unknown;
+}
+
+export interface SessionCheckpointsParams {
+	session_id: string;
+}
+
+/**
+ * Worktree snapshot taken before a turn. seq is the history record of the
+ * message starting that turn; snapshots taken by a rollback have none.
+ */
+export interface SessionCheckpoint {
+	id: string;
+	created_at: string;
+	seq?: number;
+	message?: string;
+	user?: string;
+}
+
+export interface SessionCheckpointsResult {
+	checkpoints: SessionCheckpoint[];
+}
+
+export interface SessionRollbackParams {
+	session_id: string;
+	checkpoint_id: string;
+}
+
+/** backup is the checkpoint of the replaced state, to undo the rollback */
+export interface SessionRollbackResult {
+	backup?: string;
+}
+
+export interface SessionSearchParams {
+	query: string;
+	worktree?: string;
+	types?: ServerMethod[];
+	from?: string;
+	to?: string;
+	limit?: number;
+}
+
+export interface SessionSearchMatch {
+	offset: number;
+	type: ServerMethod;
+	time: string;
+	snippet: string;
+}
+
+export interface SessionSearchResultItem {
+	worktree: string;
+	session_id: string;
+	title: string;
+	total: number;
+	matches: SessionSearchMatch[];
+}
+
+export interface SessionSearchResult {
+	results: SessionSearchResultItem[];
 }
 
 export interface SessionSetModeParams {
@@ -242,9 +625,76 @@ export interface SessionSetModeParams {
 	mode: SessionMode;
 }
 
+export interface SessionSetMutedParams {
+	session_id: string;
+	muted: boolean;
+}
+
+export interface SessionGetConfigParams {
+	session_id: string;
+}
+
+export interface SessionSetConfigParams {
+	session_id: string;
+	config: SessionConfig;
+}
+
+export interface SessionSetAgentParams {
+	session_id: string;
+	agent: string;
+}
+
+export interface AgentInfo {
+	name: string;
+	is_default: boolean;
+}
+
+export interface AgentListResult {
+	agents: AgentInfo[];
+}
+
+export interface UsageDay {
+	date: string;
+	usage: Usage;
+}
+
+export interface UsageSessionParams {
+	session_id: string;
+}
+
+export interface UsageSessionResult {
+	session_id: string;
+	total: Usage;
+	days: UsageDay[];
+}
+
+export interface UsageWorktreeResult {
+	worktree: string;
+	total: Usage;
+	sessions: { session_id: string; title: string; usage: Usage }[];
+}
+
+export interface UsageDailyParams {
+	from?: string;
+	to?: string;
+}
+
+export interface UsageDailyResult {
+	days: UsageDay[];
+}
+
 // JSON-RPC 2.0 Notification Params (Server → Client)
 // These match the EventRecord format from the server.
 
+/**
+ * History position carried by chat events. prev_seq is the seq of the
+ * previous event sent; a client that has seen less missed events.
+ */
+export interface ChatEventSeq {
+	seq?: number;
+	prev_seq?: number;
+}
+
 export type ServerMethod =
 	| "text"
 	| "tool_call"
@@ -258,7 +708,8 @@ export type ServerMethod =
 	| "ask_user_question"
 	| "request_cancelled"
 	| "system"
-	| "command_output";
+	| "command_output"
+	| "usage";
 
 export type ServerNotification =
 	| { type: "text"; content: string }
@@ -301,4 +752,5 @@ export type ServerNotification =
 			request_id: string;
 	  }
 	| { type: "system"; content: string }
-	| { type: "command_output"; content: string };
+	| { type: "command_output"; content: string }
+	| { type: "usage"; usage: Usage };